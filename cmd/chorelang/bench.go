@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	
+	"github.com/chorlang/chorlang/compiler/bench"
+	"github.com/chorlang/chorlang/compiler/codegen"
+)
+
+// benchSettings is the "bench" section of chore.json.
+type benchSettings struct {
+	// Baseline is the results file to compare against, relative to the
+	// project root.
+	Baseline string `json:"baseline"`
+	// Threshold is the regression allowed against the baseline, in percent.
+	Threshold float64 `json:"threshold"`
+}
+
+func newBenchCommand() *command {
+	cmd := newCommand("bench", "[flags] [files or directories]", "Run the encores in ChoreLang test files as benchmarks.")
+	cmd.detail = "Files are found as for chorelang test. Each encore is compiled into a Go\n" +
+		"testing.B benchmark and run with the Go toolchain: the statements outside\n" +
+		"encores run once, untimed, and the encore's body runs repeatedly. Results\n" +
+		"give the time, bytes and allocations per run and the dancers started.\n" +
+		"\n" +
+		"With -baseline the results are compared with ones saved by -save, and the\n" +
+		"command fails if any encore got slower or allocates more by over the\n" +
+		"threshold. The \"bench\" section of chore.json may set \"baseline\", relative\n" +
+		"to the project root, and \"threshold\"."
+	run := cmd.flags.String("run", "", "run only encores whose names match this regular expression")
+	benchtime := cmd.flags.String("benchtime", "", "run each encore for this long, or this many times as in 100x")
+	baseline := cmd.flags.String("baseline", "", "compare the results with this file saved by -save")
+	save := cmd.flags.String("save", "", "save the results to this file, to be used as a baseline")
+	threshold := cmd.flags.Float64("threshold", 0, "percent a result may regress against the baseline (default 10)")
+	
+	cmd.run = func(ctx *context, args []string) int {
+		var match *regexp.Regexp
+		if *run != "" {
+			re, err := regexp.Compile(*run)
+			if err != nil {
+				fmt.Fprintf(ctx.stderr, "chorelang bench: bad -run pattern: %v\n", err)
+				return exitUsage
+			}
+			match = re
+		}
+		
+		if len(args) == 0 {
+			args = []string{"."}
+		}
+		files, err := testFiles(args)
+		if err != nil {
+			fmt.Fprintf(ctx.stderr, "chorelang bench: %v\n", err)
+			return exitUsage
+		}
+		if len(files) == 0 {
+			fmt.Fprintln(ctx.stdout, "no test files")
+			return exitOK
+		}
+		
+		settings := benchSettings{Threshold: 10}
+		cfg, ok := loadConfig(ctx, files[0], "bench", &settings)
+		if !ok {
+			return exitFailure
+		}
+		if *baseline == "" && settings.Baseline != "" {
+			*baseline = cfg.Resolve(settings.Baseline)
+		}
+		if *threshold == 0 {
+			*threshold = settings.Threshold
+		}
+		
+		var base []bench.Result
+		if *baseline != "" {
+			f, err := os.Open(*baseline)
+			if err == nil {
+				base, err = bench.ReadBaseline(f)
+				f.Close()
+			}
+			if err != nil {
+				fmt.Fprintf(ctx.stderr, "Error reading %s: %v\n", *baseline, err)
+				return exitFailure
+			}
+		}
+		
+		status := exitOK
+		var results []bench.Result
+		for _, file := range files {
+			r, ok := benchFile(ctx, file, match, *benchtime)
+			if !ok {
+				status = exitFailure
+			}
+			results = append(results, r...)
+		}
+		if len(results) == 0 {
+			if status == exitOK {
+				fmt.Fprintln(ctx.stdout, "no encores to run")
+			}
+			return status
+		}
+		
+		if !report(ctx, bench.Compare(base, results, *threshold/100), *baseline != "", *threshold) {
+			status = exitFailure
+		}
+		
+		if *save != "" {
+			var out bytes.Buffer
+			if err := bench.WriteBaseline(&out, results); err == nil {
+				err = ioutil.WriteFile(*save, out.Bytes(), 0644)
+			}
+			if err != nil {
+				fmt.Fprintf(ctx.stderr, "Error writing %s: %v\n", *save, err)
+				status = exitFailure
+			}
+		}
+		return status
+	}
+	return cmd
+}
+
+// benchFile runs the selected encores of one file with go test and returns
+// their results. A file without any is skipped.
+func benchFile(ctx *context, file string, match *regexp.Regexp, benchtime string) ([]bench.Result, bool) {
+	source, ok := readSource(ctx, file)
+	if !ok {
+		return nil, false
+	}
+	program, ok := loadProgram(ctx, file, source)
+	if !ok {
+		return nil, false
+	}
+	encores := bench.List(program)
+	pattern := bench.Pattern(encores, match)
+	if pattern == "" {
+		return nil, true
+	}
+	
+	g := codegen.New()
+	goCode, err := g.GenerateBenchmarks(program)
+	if err != nil {
+		fmt.Fprintf(ctx.stderr, "Code generation error: %s: %v\n", file, err)
+		return nil, false
+	}
+	
+	dir, err := ioutil.TempDir("", "chorelang-bench-")
+	if err != nil {
+		fmt.Fprintf(ctx.stderr, "Error: %v\n", err)
+		return nil, false
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "bench_test.go"), []byte(goCode), 0644); err != nil {
+		fmt.Fprintf(ctx.stderr, "Error writing Go file: %v\n", err)
+		return nil, false
+	}
+	
+	args := []string{"test", "-run", "^$", "-bench", pattern, "-benchmem"}
+	if benchtime != "" {
+		args = append(args, "-benchtime", benchtime)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("go", append(args, "bench_test.go")...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// Compile errors and panics are shown with ChoreLang names
+		fmt.Fprintf(ctx.stderr, "Benchmark error: %s: %v\n", file, err)
+		fmt.Fprint(ctx.stderr, g.NameMap().Demangle(stdout.String()+stderr.String()))
+		return nil, false
+	}
+	
+	results, err := bench.Parse(&stdout, file, encores)
+	if err != nil {
+		fmt.Fprintf(ctx.stderr, "Benchmark error: %s: %v\n", file, err)
+		return nil, false
+	}
+	return results, true
+}
+
+// report prints the results as a table in the manner of go test -bench, with
+// the change against the baseline when there is one. It returns false if a
+// result regressed.
+func report(ctx *context, comparisons []bench.Comparison, compared bool, threshold float64) bool {
+	w := tabwriter.NewWriter(ctx.stdout, 0, 8, 2, ' ', 0)
+	file := ""
+	regressed := 0
+	for _, c := range comparisons {
+		if c.File != file {
+			w.Flush()
+			fmt.Fprintln(ctx.stdout, c.File)
+			file = c.File
+		}
+		cells := []string{
+			"    " + c.Name,
+			fmt.Sprint(c.Runs),
+			fmt.Sprintf("%.0f ns/op", c.NsPerOp),
+			fmt.Sprintf("%.0f B/op", c.BytesPerOp),
+			fmt.Sprintf("%.0f allocs/op", c.AllocsPerOp),
+			fmt.Sprintf("%.2f dancers/op", c.DancersPerOp),
+		}
+		switch {
+		case !compared:
+		case c.Baseline == nil:
+			cells = append(cells, "new")
+		default:
+			cells = append(cells, percent(c.Time)+" time", percent(c.Allocs)+" allocs")
+			if c.Regressed {
+				cells = append(cells, "REGRESSED")
+				regressed++
+			}
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	w.Flush()
+	
+	if regressed > 0 {
+		fmt.Fprintf(ctx.stdout, "FAIL: %d encore(s) regressed by more than %g%%\n", regressed, threshold)
+		return false
+	}
+	return true
+}
+
+func percent(change float64) string {
+	if math.IsInf(change, 1) {
+		return "+inf%"
+	}
+	return fmt.Sprintf("%+.1f%%", change*100)
+}
\ No newline at end of file
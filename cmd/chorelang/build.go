@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/codegen"
+)
+
+// buildSettings is the "build" section of chore.json.
+type buildSettings struct {
+	// OutDir is where binaries go, relative to the project root. By
+	// default they go in the working directory.
+	OutDir string `json:"outDir"`
+}
+
+func newBuildCommand() *command {
+	cmd := newCommand("build", "[flags] <files or directories>", "Compile ChoreLang programs to native executables.")
+	cmd.detail = "Each program is translated to Go and built with the Go toolchain. The\n" +
+		"\"build\" section of chore.json may set \"outDir\", relative to the project root.\n" +
+		"\n" +
+		"A program built with -trace records its dancers and channel operations as\n" +
+		"it runs, to the file named by $CHORELANG_TRACE or else to its own name\n" +
+		"with .trace added. Draw the trace with chorelang trace.\n" +
+		"\n" +
+		"A built program explains a deadlock as chorelang run does, naming each\n" +
+		"blocked dancer, its channel and the line it waits at, and warns of the\n" +
+		"dancers still blocked when main finishes. -nowatch leaves this out.\n" +
+		"\n" +
+		"The file system module of a built program reaches the files under\n" +
+		"$CHORELANG_FSROOT, or else under its working directory."
+	output := cmd.flags.String("o", "", "output file, or output directory when building several programs")
+	trace := cmd.flags.Bool("trace", false, "build programs that record a trace of their choreography")
+	nowatch := cmd.flags.Bool("nowatch", false, "build programs without deadlock and leak reports")
+	
+	cmd.run = func(ctx *context, args []string) int {
+		files, code := inputsOrUsage(ctx, "build", args)
+		if code != exitOK {
+			return code
+		}
+		
+		settings := buildSettings{}
+		cfg, ok := loadConfig(ctx, files[0], "build", &settings)
+		if !ok {
+			return exitFailure
+		}
+		
+		outDir := cfg.Resolve(settings.OutDir)
+		
+		status := exitOK
+		for _, file := range files {
+			binary := filepath.Join(outDir, baseName(file))
+			if *output != "" {
+				binary = outputPath(*output, len(files) > 1, baseName(file))
+			}
+			
+			if !buildFile(ctx, file, binary, *trace, !*nowatch) {
+				status = exitFailure
+				continue
+			}
+			fmt.Fprintf(ctx.stdout, "Compiled %s to %s\n", file, binary)
+		}
+		return status
+	}
+	return cmd
+}
+
+func buildFile(ctx *context, file, binary string, trace, watch bool) bool {
+	source, ok := readSource(ctx, file)
+	if !ok {
+		return false
+	}
+	program, ok := loadProgram(ctx, file, source)
+	if !ok {
+		return false
+	}
+	
+	if dir := filepath.Dir(binary); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Fprintf(ctx.stderr, "Error creating %s: %v\n", dir, err)
+			return false
+		}
+	}
+	
+	if err := buildBinary(ctx, generator(file, trace, watch), program, binary); err != nil {
+		fmt.Fprintf(ctx.stderr, "Compilation error: %s: %v\n", file, err)
+		return false
+	}
+	return true
+}
+
+// generator returns a code generator for the program in file, which traces
+// the program's choreography if trace is set and reports its deadlocks and
+// leaked dancers if watch is.
+func generator(file string, trace, watch bool) *codegen.CodeGenerator {
+	g := codegen.New()
+	g.Trace = trace
+	g.Watch = watch
+	g.Source = file
+	return g
+}
+
+// buildBinary generates Go for program with g and builds it into binary.
+// The Go source is written to a private temporary directory.
+func buildBinary(ctx *context, g *codegen.CodeGenerator, program *ast.Program, binary string) error {
+	goCode, err := g.Generate(program)
+	if err != nil {
+		return err
+	}
+	
+	dir, err := ioutil.TempDir("", "chorelang-build-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	
+	goFile := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(goFile, []byte(goCode), 0644); err != nil {
+		return err
+	}
+	
+	// Capture compiler diagnostics so renamed identifiers can be shown
+	// with their ChoreLang names
+	var buildErr bytes.Buffer
+	cmd := exec.Command("go", "build", "-o", binary, goFile)
+	cmd.Stdout = ctx.stdout
+	cmd.Stderr = &buildErr
+	
+	err = cmd.Run()
+	fmt.Fprint(ctx.stderr, g.NameMap().Demangle(buildErr.String()))
+	return err
+}
+
+func newGenCommand() *command {
+	cmd := newCommand("gen", "[flags] <files or directories>", "Generate the Go source for ChoreLang programs.")
+	output := cmd.flags.String("o", "", "output file, or output directory when generating several programs")
+	trace := cmd.flags.Bool("trace", false, "generate programs that record a trace of their choreography")
+	watch := cmd.flags.Bool("watch", false, "generate programs that report deadlocks and leaked dancers")
+	
+	cmd.run = func(ctx *context, args []string) int {
+		files, code := inputsOrUsage(ctx, "gen", args)
+		if code != exitOK {
+			return code
+		}
+		
+		status := exitOK
+		for _, file := range files {
+			goFile := outputPath(*output, len(files) > 1, baseName(file)+".go")
+			
+			if !genFile(ctx, file, goFile, *trace, *watch) {
+				status = exitFailure
+				continue
+			}
+			fmt.Fprintf(ctx.stdout, "Generated %s\n", goFile)
+		}
+		return status
+	}
+	return cmd
+}
+
+func genFile(ctx *context, file, goFile string, trace, watch bool) bool {
+	source, ok := readSource(ctx, file)
+	if !ok {
+		return false
+	}
+	program, ok := loadProgram(ctx, file, source)
+	if !ok {
+		return false
+	}
+	
+	goCode, err := generator(file, trace, watch).Generate(program)
+	if err != nil {
+		fmt.Fprintf(ctx.stderr, "Code generation error: %s: %v\n", file, err)
+		return false
+	}
+	
+	if dir := filepath.Dir(goFile); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Fprintf(ctx.stderr, "Error creating %s: %v\n", dir, err)
+			return false
+		}
+	}
+	
+	if dir := filepath.Dir(goFile); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Fprintf(ctx.stderr, "Error creating %s: %v\n", dir, err)
+			return false
+		}
+	}
+	
+	if err := ioutil.WriteFile(goFile, []byte(goCode), 0644); err != nil {
+		fmt.Fprintf(ctx.stderr, "Error writing Go file: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// baseName is a source file's name without directory or extension.
+func baseName(file string) string {
+	return strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+}
+
+// outputPath places an output named name according to the -o flag: -o
+// names the file itself, unless there are several outputs or it is an
+// existing directory, in which case the output goes inside it.
+func outputPath(output string, several bool, name string) string {
+	if output == "" {
+		return name
+	}
+	if info, err := os.Stat(output); several || (err == nil && info.IsDir()) {
+		return filepath.Join(output, name)
+	}
+	return output
+}
\ No newline at end of file
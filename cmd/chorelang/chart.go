@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	
+	"github.com/chorlang/chorlang/compiler/chart"
+)
+
+func newChartCommand() *command {
+	cmd := newCommand("chart", "[flags] <file.chore>", "Draw a Mermaid diagram of a program's dancers.")
+	cmd.detail = "The flowchart shows each dancer in its own swimlane, with sway loops as\n" +
+		"cycles and if and match as decisions. The sequence diagram shows the\n" +
+		"messages dancers send each other, and warns about channels only one side\n" +
+		"uses, which deadlock. An -o file ending in .md gets the diagram in a\n" +
+		"mermaid code block, ready to render."
+	output := cmd.flags.String("o", "", "write the diagram to this file instead of standard output")
+	sequence := cmd.flags.Bool("sequence", false, "draw a sequence diagram of channel messages instead of a flowchart")
+	
+	cmd.run = func(ctx *context, args []string) int {
+		if len(args) != 1 {
+			fmt.Fprintf(ctx.stderr, "chorelang chart: expected one file\nRun 'chorelang help chart' for usage.\n")
+			return exitUsage
+		}
+		file := args[0]
+		
+		source, ok := readSource(ctx, file)
+		if !ok {
+			return exitFailure
+		}
+		program, ok := parseProgram(ctx, file, source)
+		if !ok {
+			return exitFailure
+		}
+		
+		diagram := chart.Flowchart(program)
+		if *sequence {
+			var deadlocks []chart.Deadlock
+			var err error
+			diagram, deadlocks, err = chart.Sequence(program)
+			if err != nil {
+				reportErrors(ctx, "Resolver errors", file, err)
+				return exitFailure
+			}
+			for _, d := range deadlocks {
+				fmt.Fprintf(ctx.stderr, "Warning: %s:%s; potential deadlock\n", file, d)
+			}
+		}
+		
+		return writeDiagram(ctx, *output, diagram)
+	}
+	return cmd
+}
+
+// writeDiagram prints a Mermaid diagram, or writes it to output if set. A
+// Markdown output gets the diagram in a mermaid code block.
+func writeDiagram(ctx *context, output, diagram string) int {
+	if output == "" {
+		fmt.Fprint(ctx.stdout, diagram)
+		return exitOK
+	}
+	if strings.HasSuffix(output, ".md") {
+		diagram = "```mermaid\n" + diagram + "```\n"
+	}
+	if err := ioutil.WriteFile(output, []byte(diagram), 0644); err != nil {
+		fmt.Fprintf(ctx.stderr, "Error writing %s: %v\n", output, err)
+		return exitFailure
+	}
+	return exitOK
+}
\ No newline at end of file
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	
+	"github.com/chorlang/chorlang/compiler/deadlock"
+	"github.com/chorlang/chorlang/compiler/explore"
+	"github.com/chorlang/chorlang/compiler/rehearsal"
+)
+
+func newExploreCommand() *command {
+	cmd := newCommand("explore", "[flags] <file.chore> [--] [arguments]", "Check a program under every interleaving of its dancers.")
+	cmd.detail = "The program runs on the interpreter one dancer at a time, and wherever\n" +
+		"more than one dancer could go on after a start, send or receive, each is\n" +
+		"tried in turn. Every deadlock and failure reached is reported, and every\n" +
+		"output when runs can end differently, each with the smallest schedule\n" +
+		"found that leads to it: the fewest preemptions, then the fewest turns.\n" +
+		"A preemption gives the turn away from a dancer that could have gone on.\n" +
+		"\n" +
+		"The search is bounded by -depth choices per schedule, -preemptions per\n" +
+		"schedule and -runs schedules in all; the summary says when the bounds\n" +
+		"left schedules unexplored. -rehearsal explores one rehearsal of a test\n" +
+		"file, with its expects, instead of the program.\n" +
+		"\n" +
+		"-replay runs a single schedule, given by the choices a report shows, and\n" +
+		"prints the program's output followed by the schedule's turns. The exit\n" +
+		"status is 1 when anything was found."
+	depth := cmd.flags.Int("depth", 40, "explore this many choices of each schedule")
+	preemptions := cmd.flags.Int("preemptions", 2, "explore schedules with at most this many preemptions")
+	statements := cmd.flags.Int("statements", 100000, "cut off a run after this many statements; 0 for no limit")
+	runs := cmd.flags.Int("runs", 10000, "stop after this many schedules; 0 for no limit")
+	name := cmd.flags.String("rehearsal", "", "explore the rehearsal with this name instead of the program")
+	replay := cmd.flags.String("replay", "", "run the schedule with these `choices`, such as 1,0,2, and show it")
+	
+	cmd.run = func(ctx *context, args []string) int {
+		if len(args) == 0 {
+			fmt.Fprintf(ctx.stderr, "chorelang explore: no file given\nRun 'chorelang help explore' for usage.\n")
+			return exitUsage
+		}
+		file := args[0]
+		programArgs := args[1:]
+		if len(programArgs) > 0 && programArgs[0] == "--" {
+			programArgs = programArgs[1:]
+		}
+		programArgs = append([]string{file}, programArgs...)
+		
+		var choices []int
+		if *replay != "" {
+			var err error
+			if choices, err = explore.ParseChoices(*replay); err != nil {
+				fmt.Fprintf(ctx.stderr, "chorelang explore: -replay: %v\n", err)
+				return exitUsage
+			}
+		}
+		
+		source, ok := readSource(ctx, file)
+		if !ok {
+			return exitFailure
+		}
+		program, ok := loadProgram(ctx, file, source)
+		if !ok {
+			return exitFailure
+		}
+		if *name != "" && !hasRehearsal(rehearsal.List(program), *name) {
+			fmt.Fprintf(ctx.stderr, "chorelang explore: %s has no rehearsal %q\n", file, *name)
+			return exitFailure
+		}
+		
+		opts := explore.Options{
+			Rehearsal:   *name,
+			Args:        programArgs,
+			Depth:       *depth,
+			Preemptions: *preemptions,
+			Statements:  *statements,
+			Runs:        *runs,
+		}
+		
+		sites := func() deadlock.Sites { return deadlock.Find(program) }
+		if *replay != "" {
+			schedule, err := explore.Replay(program, opts, choices, ctx.stdout)
+			printSchedule(ctx, schedule)
+			return finishRun(ctx, file, nil, err, nil, sites)
+		}
+		
+		report := explore.Explore(program, opts)
+		outputs := 0
+		for _, issue := range report.Issues {
+			if issue.Kind == explore.Output {
+				outputs++
+			}
+		}
+		output := 0
+		for _, issue := range report.Issues {
+			switch issue.Kind {
+			case explore.Output:
+				output++
+				status := ""
+				if issue.Message != "" {
+					status = ", " + issue.Message
+				}
+				fmt.Fprintf(ctx.stdout, "output %d of %d%s:\n", output, outputs, status)
+				if issue.Output == "" {
+					fmt.Fprintln(ctx.stdout, "    no output")
+				}
+				printOutput(ctx, issue.Output)
+			default:
+				fmt.Fprintf(ctx.stdout, "%s: %s:%d:%d: %s\n", issue.Kind, file, issue.Line, issue.Column, issue.Message)
+				if len(issue.Blocked) > 0 {
+					sites().Write(ctx.stdout, issue.Blocked, false)
+				}
+			}
+			printSchedule(ctx, issue.Schedule)
+		}
+		
+		summarizeExplore(ctx, report, outputs)
+		if len(report.Issues) > 0 {
+			return exitFailure
+		}
+		return exitOK
+	}
+	return cmd
+}
+
+// printSchedule shows a schedule's turns, with the choices that replay it.
+func printSchedule(ctx *context, s explore.Schedule) {
+	fmt.Fprintf(ctx.stdout, "    schedule with %s (-replay=%s):\n", plural(s.Preemptions, "preemption"), s.Replay())
+	for _, step := range s.Steps {
+		fmt.Fprintf(ctx.stdout, "        %s\n", step)
+	}
+}
+
+// summarizeExplore prints what the search covered and found.
+func summarizeExplore(ctx *context, report *explore.Report, outputs int) {
+	var found []string
+	counts := make(map[string]int)
+	for _, issue := range report.Issues {
+		counts[issue.Kind]++
+	}
+	if n := counts[explore.Deadlock]; n > 0 {
+		found = append(found, plural(n, "deadlock"))
+	}
+	if n := counts[explore.Failure]; n > 0 {
+		found = append(found, plural(n, "failure"))
+	}
+	if outputs > 0 {
+		found = append(found, fmt.Sprintf("%d different outputs", outputs))
+	}
+	result := "nothing found"
+	if len(found) > 0 {
+		result = strings.Join(found, ", ")
+	}
+	
+	coverage := "all of them"
+	if report.Bounded {
+		coverage = "within the bounds; raise -depth, -preemptions or -runs to explore more"
+	}
+	fmt.Fprintf(ctx.stdout, "explored %s, %s: %s\n", plural(report.Runs, "schedule"), coverage, result)
+	if report.Cut > 0 {
+		fmt.Fprintf(ctx.stdout, "%d of them ran past -statements and were cut off\n", report.Cut)
+	}
+}
+
+// plural counts n of a noun, as "1 deadlock" or "2 deadlocks".
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+func hasRehearsal(list []rehearsal.Rehearsal, name string) bool {
+	for _, r := range list {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
\ No newline at end of file
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	
+	"github.com/chorlang/chorlang/compiler/diff"
+	"github.com/chorlang/chorlang/compiler/format"
+)
+
+func newFmtCommand() *command {
+	cmd := newCommand("fmt", "[flags] [files or directories]", "Format ChoreLang source.")
+	cmd.detail = "Without flags the formatted source is printed. Without files, fmt formats\n" +
+		"standard input."
+	write := cmd.flags.Bool("w", false, "write the result back to the source files")
+	showDiff := cmd.flags.Bool("d", false, "print a diff of the changes instead of the source")
+	check := cmd.flags.Bool("check", false, "list files that are not formatted and exit 1 if there are any")
+	
+	cmd.run = func(ctx *context, args []string) int {
+		if len(args) == 0 {
+			if *write {
+				fmt.Fprintf(ctx.stderr, "chorelang fmt: -w needs files to write\n")
+				return exitUsage
+			}
+			source, err := ioutil.ReadAll(ctx.stdin)
+			if err != nil {
+				fmt.Fprintf(ctx.stderr, "Error reading standard input: %v\n", err)
+				return exitFailure
+			}
+			return fmtSource(ctx, "<stdin>", source, false, *showDiff, *check)
+		}
+		
+		files, code := inputsOrUsage(ctx, "fmt", args)
+		if code != exitOK {
+			return code
+		}
+		
+		status := exitOK
+		for _, file := range files {
+			source, ok := readSource(ctx, file)
+			if !ok {
+				status = exitFailure
+				continue
+			}
+			if code := fmtSource(ctx, file, source, *write, *showDiff, *check); code != exitOK {
+				status = code
+			}
+		}
+		return status
+	}
+	return cmd
+}
+
+// fmtSource formats one source. The flags combine: each of -w, -d and
+// -check does its part, and with none of them the result is printed.
+func fmtSource(ctx *context, file string, source []byte, write, showDiff, check bool) int {
+	program, ok := parseProgram(ctx, file, source)
+	if !ok {
+		return exitFailure
+	}
+	formatted := format.Program(program)
+	if err := format.Lossless(source, formatted); err != nil {
+		fmt.Fprintf(ctx.stderr, "Error: %s: %v\n", file, err)
+		return exitFailure
+	}
+	changed := string(formatted) != string(source)
+	
+	if !write && !showDiff && !check {
+		ctx.stdout.Write(formatted)
+		return exitOK
+	}
+	
+	if showDiff && changed {
+		fmt.Fprint(ctx.stdout, diff.Unified(file+".orig", file, source, formatted))
+	}
+	if write && changed {
+		info, err := os.Stat(file)
+		if err == nil {
+			err = ioutil.WriteFile(file, formatted, info.Mode().Perm())
+		}
+		if err != nil {
+			fmt.Fprintf(ctx.stderr, "Error writing %s: %v\n", file, err)
+			return exitFailure
+		}
+	}
+	if check && changed {
+		fmt.Fprintln(ctx.stdout, file)
+		return exitFailure
+	}
+	return exitOK
+}
\ No newline at end of file
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/config"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/parser"
+	"github.com/chorlang/chorlang/compiler/resolver"
+)
+
+// expandInputs turns file and directory arguments into a list of files.
+// Files are kept as given; directories contribute every .chore file below
+// them, skipping hidden directories, in lexical order.
+func expandInputs(args []string) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	add := func(file string) {
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			add(arg)
+			continue
+		}
+		
+		var found []string
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && path != arg && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if !d.IsDir() && strings.HasSuffix(path, ".chore") {
+				found = append(found, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("no .chore files in %s", arg)
+		}
+		
+		sort.Strings(found)
+		for _, file := range found {
+			add(file)
+		}
+	}
+	
+	return files, nil
+}
+
+// inputsOrUsage expands a command's arguments, reporting a missing or bad
+// argument as a usage error.
+func inputsOrUsage(ctx *context, cmd string, args []string) ([]string, int) {
+	if len(args) == 0 {
+		fmt.Fprintf(ctx.stderr, "chorelang %s: no files given\nRun 'chorelang help %s' for usage.\n", cmd, cmd)
+		return nil, exitUsage
+	}
+	
+	files, err := expandInputs(args)
+	if err != nil {
+		fmt.Fprintf(ctx.stderr, "chorelang %s: %v\n", cmd, err)
+		return nil, exitUsage
+	}
+	return files, exitOK
+}
+
+// loadConfig reads the chore.json governing path and decodes the named
+// section into v.
+func loadConfig(ctx *context, path, section string, v interface{}) (*config.Config, bool) {
+	cfg, err := config.Load(path)
+	if err == nil {
+		err = cfg.Section(section, v)
+	}
+	if err != nil {
+		fmt.Fprintf(ctx.stderr, "Config error: %v\n", err)
+		return nil, false
+	}
+	return cfg, true
+}
+
+// readSource reads an input file, reporting a failure.
+func readSource(ctx *context, file string) ([]byte, bool) {
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(ctx.stderr, "Error reading file %s: %v\n", file, err)
+		return nil, false
+	}
+	return source, true
+}
+
+// parseProgram parses source, reporting syntax errors.
+func parseProgram(ctx *context, inputFile string, source []byte) (*ast.Program, bool) {
+	// Lexing
+	l := lexer.New(string(source))
+	
+	// Parsing
+	p := parser.New(l)
+	program := p.ParseProgram()
+	
+	if len(p.Errors()) > 0 {
+		fmt.Fprintf(ctx.stderr, "Parser errors:\n")
+		for _, err := range p.Errors() {
+			fmt.Fprintf(ctx.stderr, "  %s: %s\n", inputFile, err)
+		}
+		return nil, false
+	}
+	return program, true
+}
+
+// reportErrors prints the errors of one phase, such as "Resolver errors",
+// one per line of err.
+func reportErrors(ctx *context, phase, file string, err error) {
+	fmt.Fprintf(ctx.stderr, "%s:\n", phase)
+	for _, line := range strings.Split(err.Error(), "\n") {
+		fmt.Fprintf(ctx.stderr, "  %s: %s\n", file, line)
+	}
+}
+
+// loadProgram parses and resolves source, reporting errors and warnings.
+func loadProgram(ctx *context, inputFile string, source []byte) (*ast.Program, bool) {
+	program, ok := parseProgram(ctx, inputFile, source)
+	if !ok {
+		return nil, false
+	}
+	
+	// Name resolution
+	r := resolver.New()
+	r.Resolve(program)
+	
+	for _, warning := range r.Warnings() {
+		fmt.Fprintf(ctx.stderr, "Warning: %s: %s\n", inputFile, warning)
+	}
+	
+	if len(r.Errors()) > 0 {
+		fmt.Fprintf(ctx.stderr, "Resolver errors:\n")
+		for _, err := range r.Errors() {
+			fmt.Fprintf(ctx.stderr, "  %s: %s\n", inputFile, err)
+		}
+		return nil, false
+	}
+	
+	return program, true
+}
\ No newline at end of file
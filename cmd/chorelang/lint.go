@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	
+	"github.com/chorlang/chorlang/compiler/diff"
+	"github.com/chorlang/chorlang/compiler/lint"
+)
+
+func newLintCommand() *command {
+	cmd := newCommand("lint", "[flags] <files or directories>", "Check ChoreLang source for style problems and likely mistakes.")
+	
+	var rules strings.Builder
+	for _, rule := range lint.Default() {
+		fmt.Fprintf(&rules, "\n  %-16s %s", rule.Name(), rule.Doc())
+	}
+	cmd.detail = "Rules:" + rules.String() + "\n\n" +
+		"Turn rules off for a project with \"lint\": {\"disable\": [...]} in chore.json,\n" +
+		"or for one statement with a // lint:ignore rule comment."
+	fix := cmd.flags.Bool("fix", false, "apply suggested fixes to the source files")
+	showDiff := cmd.flags.Bool("d", false, "print a diff of the suggested fixes instead of applying them")
+	
+	cmd.run = func(ctx *context, args []string) int {
+		files, code := inputsOrUsage(ctx, "lint", args)
+		if code != exitOK {
+			return code
+		}
+		
+		settings := lint.Config{}
+		if _, ok := loadConfig(ctx, files[0], "lint", &settings); !ok {
+			return exitFailure
+		}
+		linter, err := lint.New(settings, lint.Default())
+		if err != nil {
+			fmt.Fprintf(ctx.stderr, "Config error: %v\n", err)
+			return exitFailure
+		}
+		
+		status := exitOK
+		for _, file := range files {
+			if code := lintFile(ctx, linter, file, *fix, *showDiff); code != exitOK {
+				status = code
+			}
+		}
+		return status
+	}
+	return cmd
+}
+
+// lintFile checks one file and prints what the linter found. With fix or
+// showDiff, fixable diagnostics are applied or shown instead, and only the
+// rest are printed. It fails if any diagnostic is left.
+func lintFile(ctx *context, linter *lint.Linter, file string, fix, showDiff bool) int {
+	source, ok := readSource(ctx, file)
+	if !ok {
+		return exitFailure
+	}
+	program, ok := parseProgram(ctx, file, source)
+	if !ok {
+		return exitFailure
+	}
+	
+	diagnostics, err := linter.Check(program, source)
+	if err != nil {
+		reportErrors(ctx, "Resolver errors", file, err)
+		return exitFailure
+	}
+	
+	if fix || showDiff {
+		fixed, remaining := lint.ApplyFixes(source, diagnostics)
+		if showDiff {
+			fmt.Fprint(ctx.stdout, diff.Unified(file+".orig", file, source, fixed))
+		} else if string(fixed) != string(source) {
+			info, err := os.Stat(file)
+			if err == nil {
+				err = ioutil.WriteFile(file, fixed, info.Mode().Perm())
+			}
+			if err != nil {
+				fmt.Fprintf(ctx.stderr, "Error writing %s: %v\n", file, err)
+				return exitFailure
+			}
+		}
+		diagnostics = remaining
+	}
+	
+	for _, d := range diagnostics {
+		fmt.Fprintf(ctx.stdout, "%s:%s\n", file, d)
+		if d.Fix != nil && !fix && !showDiff {
+			fmt.Fprintf(ctx.stdout, "\tfix: %s\n", d.Fix.Message)
+		}
+	}
+	if len(diagnostics) > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
\ No newline at end of file
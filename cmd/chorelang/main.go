@@ -1,141 +1,198 @@
+// Command chorelang is the ChoreLang toolchain. Each tool is a subcommand
+// with its own flags:
+//
+//	chorelang build [flags] <files or directories>
+//	chorelang run [flags] <file.chore> [--] [arguments]
+//	chorelang gen [flags] <files or directories>
+//	chorelang fmt [flags] [files or directories]
+//	chorelang lint [flags] <files or directories>
+//	chorelang chart [flags] <file.chore>
+//	chorelang trace [flags] <file.trace>
+//	chorelang test [flags] [files or directories]
+//	chorelang bench [flags] [files or directories]
+//	chorelang explore [flags] <file.chore> [--] [arguments]
+//	chorelang disasm <files or directories>
+//	chorelang repl
+//	chorelang lsp
+//	chorelang dap
+//	chorelang help <command>
+//
+// Every command exits 0 on success, 1 when a program, build or check fails,
+// and 2 when the command line itself is wrong.
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"strings"
-	
-	"github.com/chorlang/chorlang/compiler/codegen"
-	"github.com/chorlang/chorlang/compiler/lexer"
-	"github.com/chorlang/chorlang/compiler/parser"
 )
 
-func main() {
-	var (
-		output  = flag.String("o", "", "output file name")
-		compile = flag.Bool("c", false, "compile to binary")
-		run     = flag.Bool("r", false, "run the program after compilation")
-		help    = flag.Bool("h", false, "show help")
-	)
-	
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "ChoreLang Compiler\n\n")
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] <input.chore>\n\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "Options:\n")
-		flag.PrintDefaults()
-		fmt.Fprintf(os.Stderr, "\nExamples:\n")
-		fmt.Fprintf(os.Stderr, "  %s hello.chore                  # Generate Go code\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s -c hello.chore               # Compile to binary\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s -r hello.chore               # Run immediately\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s -c -o myapp hello.chore      # Compile with custom output name\n", os.Args[0])
+const (
+	exitOK      = 0 // success
+	exitFailure = 1 // a program, build or check failed
+	exitUsage   = 2 // the command line is wrong
+)
+
+// context is what a command runs with.
+type context struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// command is one chorelang subcommand.
+type command struct {
+	name    string
+	args    string // argument synopsis shown in help
+	summary string // one line for the command list
+	detail  string // more help, shown by 'chorelang help <command>'
+	flags   *flag.FlagSet
+	run     func(ctx *context, args []string) int
+}
+
+func newCommand(name, args, summary string) *command {
+	return &command{
+		name:    name,
+		args:    args,
+		summary: summary,
+		flags:   flag.NewFlagSet(name, flag.ContinueOnError),
 	}
-	
-	flag.Parse()
-	
-	if *help || flag.NArg() == 0 {
-		flag.Usage()
-		os.Exit(0)
+}
+
+func (c *command) usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: chorelang %s %s\n\n%s\n", c.name, c.args, c.summary)
+	if c.detail != "" {
+		fmt.Fprintf(w, "\n%s\n", c.detail)
 	}
 	
-	inputFile := flag.Arg(0)
-	
-	// Read input file
-	source, err := ioutil.ReadFile(inputFile)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", inputFile, err)
-		os.Exit(1)
+	hasFlags := false
+	c.flags.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		fmt.Fprintf(w, "\nFlags:\n")
+		c.flags.SetOutput(w)
+		c.flags.PrintDefaults()
+	}
+}
+
+// commands returns a fresh set of commands, so flag values never leak
+// from one invocation to the next.
+func commands() []*command {
+	return []*command{
+		newBuildCommand(),
+		newRunCommand(),
+		newGenCommand(),
+		newFmtCommand(),
+		newLintCommand(),
+		newChartCommand(),
+		newTraceCommand(),
+		newTestCommand(),
+		newBenchCommand(),
+		newExploreCommand(),
+		newDisasmCommand(),
+		newReplCommand(),
+		newLspCommand(),
+		newDapCommand(),
+	}
+}
+
+func main() {
+	ctx := &context{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+	os.Exit(dispatch(ctx, os.Args[1:]))
+}
+
+// dispatch runs the command named by args[0] and returns the exit code.
+func dispatch(ctx *context, args []string) int {
+	if len(args) == 0 {
+		usage(ctx.stderr)
+		return exitUsage
 	}
 	
-	// Lexing
-	l := lexer.New(string(source))
-	
-	// Parsing
-	p := parser.New(l)
-	program := p.ParseProgram()
+	args = translateLegacy(args)
 	
-	if len(p.Errors()) > 0 {
-		fmt.Fprintf(os.Stderr, "Parser errors:\n")
-		for _, err := range p.Errors() {
-			fmt.Fprintf(os.Stderr, "  %s\n", err)
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		if len(args) > 1 {
+			if cmd := lookup(args[1]); cmd != nil {
+				cmd.usage(ctx.stdout)
+				return exitOK
+			}
+			fmt.Fprintf(ctx.stderr, "chorelang help: unknown command %q\n", args[1])
+			return exitUsage
 		}
-		os.Exit(1)
+		usage(ctx.stdout)
+		return exitOK
 	}
 	
-	// Code generation
-	g := codegen.New()
-	goCode, err := g.Generate(program)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Code generation error: %v\n", err)
-		os.Exit(1)
+	cmd := lookup(args[0])
+	if cmd == nil {
+		fmt.Fprintf(ctx.stderr, "chorelang: unknown command %q\nRun 'chorelang help' for usage.\n", args[0])
+		return exitUsage
 	}
 	
-	// Determine output file name
-	baseName := strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(inputFile))
-	goFile := baseName + ".go"
-	
-	if !*compile && !*run {
-		// Just output the Go code
-		if *output != "" {
-			goFile = *output
-		}
-		err = ioutil.WriteFile(goFile, []byte(goCode), 0644)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error writing Go file: %v\n", err)
-			os.Exit(1)
+	cmd.flags.SetOutput(ctx.stderr)
+	cmd.flags.Usage = func() { cmd.usage(ctx.stderr) }
+	if err := cmd.flags.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
 		}
-		fmt.Printf("Generated %s\n", goFile)
-		return
+		return exitUsage
 	}
 	
-	// Write temporary Go file for compilation
-	tmpGoFile := filepath.Join(os.TempDir(), baseName+"_chorelang.go")
-	err = ioutil.WriteFile(tmpGoFile, []byte(goCode), 0644)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing temporary Go file: %v\n", err)
-		os.Exit(1)
+	return cmd.run(ctx, cmd.flags.Args())
+}
+
+func lookup(name string) *command {
+	for _, cmd := range commands() {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "ChoreLang toolchain\n\n")
+	fmt.Fprintf(w, "Usage: chorelang <command> [flags] [arguments]\n\n")
+	fmt.Fprintf(w, "Commands:\n")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nRun 'chorelang help <command>' for a command's flags.\n")
+	fmt.Fprintf(w, "Project settings are read from the nearest chore.json.\n")
+}
+
+// translateLegacy maps the original single-command flags onto the
+// subcommands: -r runs, -c builds, and a bare file generates Go. Anything
+// after "--" belongs to the program and is left alone.
+func translateLegacy(args []string) []string {
+	first := args[0]
+	if !strings.HasPrefix(first, "-") && !strings.HasSuffix(first, ".chore") {
+		return args
+	}
+	if first == "-h" || first == "-help" || first == "--help" {
+		return args
 	}
-	defer os.Remove(tmpGoFile)
 	
-	if *compile || *run {
-		// Compile to binary
-		outputBinary := baseName
-		if *output != "" {
-			outputBinary = *output
-		}
-		
-		cmd := exec.Command("go", "build", "-o", outputBinary, tmpGoFile)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		
-		err = cmd.Run()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Compilation error: %v\n", err)
-			os.Exit(1)
-		}
-		
-		if *compile && !*run {
-			fmt.Printf("Compiled to %s\n", outputBinary)
+	name := "gen"
+	var rest []string
+	for i, arg := range args {
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
 		}
-		
-		if *run {
-			// Run the compiled binary
-			cmd = exec.Command("./" + outputBinary)
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			cmd.Stdin = os.Stdin
-			
-			err = cmd.Run()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Runtime error: %v\n", err)
-				os.Exit(1)
+		switch arg {
+		case "-r":
+			name = "run"
+		case "-c":
+			if name != "run" {
+				name = "build"
 			}
-			
-			// Clean up binary after running
-			os.Remove(outputBinary)
+		default:
+			rest = append(rest, arg)
 		}
 	}
+	return append([]string{name}, rest...)
 }
\ No newline at end of file
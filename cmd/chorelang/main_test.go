@@ -0,0 +1,662 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestMain keeps the bytecode cache of the runs under test out of the
+// user's cache directory.
+func TestMain(m *testing.M) {
+	cache, err := os.MkdirTemp("", "chorelang-cache-")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("CHORELANG_CACHE", cache)
+	code := m.Run()
+	os.RemoveAll(cache)
+	os.Exit(code)
+}
+
+func TestDispatchExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	good := writeFile(t, dir, "good.chore", `spin print("ok")`)
+	bad := writeFile(t, dir, "bad.chore", `spin print(1 / 0)`)
+	stuck := writeFile(t, dir, "stuck.chore", "flow ch = flow channel<int>\ndance v = <-ch")
+	
+	tests := []struct {
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{[]string{}, exitUsage, "", "Usage: chorelang <command>"},
+		{[]string{"help"}, exitOK, "Commands:", ""},
+		{[]string{"help", "run"}, exitOK, "Usage: chorelang run", ""},
+		{[]string{"run", "-h"}, exitOK, "", "Usage: chorelang run"},
+		{[]string{"bogus"}, exitUsage, "", `unknown command "bogus"`},
+		{[]string{"run", "-bogus", good}, exitUsage, "", "flag provided but not defined"},
+		{[]string{"run"}, exitUsage, "", "no file given"},
+		{[]string{"disasm", filepath.Join(dir, "missing.chore")}, exitUsage, "", "no such file"},
+		{[]string{"run", good}, exitOK, "ok\n", ""},
+		{[]string{"run", bad}, exitFailure, "", "integer divide by zero"},
+		{[]string{"-r", "-interp", good}, exitOK, "ok\n", ""},
+		{[]string{"run", "-schedule=seed:7", good}, exitOK, "ok\n", ""},
+		{[]string{"run", "-schedule=7", good}, exitUsage, "", "want seed:N or random"},
+		{[]string{"run", "-go", "-schedule=seed:7", good}, exitUsage, "", "needs the vm or interp backend"},
+		{[]string{"run", "-interp", "-schedule=seed:7", stuck}, exitFailure, "", "Replay with -schedule=seed:7"},
+		{[]string{"run", stuck}, exitFailure, "", "main is blocked receiving from `ch` at 2:11"},
+		{[]string{"run", "-maxoutput=1", good}, exitFailure, "", "output limit of 1 byte exceeded"},
+		{[]string{"run", "-interp", "-maxoutput=3", good}, exitOK, "ok\n", ""},
+		{[]string{"run", "-go", "-maxtime=1s", good}, exitUsage, "", "the -max flags need the vm or interp backend"},
+		{[]string{"run", "-interp", stuck}, exitFailure, "", "hint: no dancer ever sends on `ch`"},
+		{[]string{"test", "-schedule=seed:x", dir}, exitUsage, "", "seed must be an integer"},
+		{[]string{"explore"}, exitUsage, "", "no file given"},
+		{[]string{"explore", good}, exitOK, "nothing found", ""},
+		{[]string{"explore", stuck}, exitFailure, "deadlock: " + stuck + ":2:11", ""},
+		{[]string{"explore", "-replay=none", stuck}, exitFailure, "main       receive at 2:11, blocked", "deadlock"},
+		{[]string{"explore", "-replay=x", good}, exitUsage, "", "bad choice"},
+		{[]string{"explore", "-rehearsal=missing", good}, exitFailure, "", `no rehearsal "missing"`},
+		{[]string{"lsp", good}, exitUsage, "", "unexpected arguments"},
+		{[]string{"lsp"}, exitFailure, "", "closed the connection without exit"},
+		{[]string{"dap", good}, exitUsage, "", "unexpected arguments"},
+		{[]string{"dap"}, exitFailure, "", "closed the connection without disconnect"},
+	}
+	
+	for _, tt := range tests {
+		code, stdout, stderr := runCLI(t, tt.args...)
+		if code != tt.code {
+			t.Errorf("%v: exit code %d, want %d (stderr %q)", tt.args, code, tt.code, stderr)
+		}
+		if !strings.Contains(stdout, tt.stdout) {
+			t.Errorf("%v: stdout %q does not contain %q", tt.args, stdout, tt.stdout)
+		}
+		if !strings.Contains(stderr, tt.stderr) {
+			t.Errorf("%v: stderr %q does not contain %q", tt.args, stderr, tt.stderr)
+		}
+	}
+}
+
+func TestTranslateLegacy(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"hello.chore"}, []string{"gen", "hello.chore"}},
+		{[]string{"-o", "out.go", "hello.chore"}, []string{"gen", "-o", "out.go", "hello.chore"}},
+		{[]string{"-c", "-o", "app", "hello.chore"}, []string{"build", "-o", "app", "hello.chore"}},
+		{[]string{"-r", "-go", "hello.chore"}, []string{"run", "-go", "hello.chore"}},
+		{[]string{"-c", "-r", "hello.chore"}, []string{"run", "hello.chore"}},
+		{[]string{"run", "hello.chore"}, []string{"run", "hello.chore"}},
+	}
+	
+	for _, tt := range tests {
+		if got := translateLegacy(tt.args); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("translateLegacy(%v) = %v, want %v", tt.args, got, tt.expected)
+		}
+	}
+}
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "b.chore", "")
+	writeFile(t, dir, "a.chore", "")
+	writeFile(t, dir, "notes.txt", "")
+	writeFile(t, filepath.Join(dir, "sub"), "c.chore", "")
+	writeFile(t, filepath.Join(dir, ".hidden"), "d.chore", "")
+	
+	files, err := expandInputs([]string{dir, filepath.Join(dir, "a.chore")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	var names []string
+	for _, f := range files {
+		rel, _ := filepath.Rel(dir, f)
+		names = append(names, filepath.ToSlash(rel))
+	}
+	if strings.Join(names, " ") != "a.chore b.chore sub/c.chore" {
+		t.Errorf("expandInputs = %v", names)
+	}
+	
+	if _, err := expandInputs([]string{filepath.Join(dir, "missing.chore")}); err == nil {
+		t.Errorf("expected an error for a missing path")
+	}
+	if _, err := expandInputs([]string{t.TempDir()}); err == nil || !strings.Contains(err.Error(), "no .chore files") {
+		t.Errorf("expected an error for a directory without sources, got %v", err)
+	}
+}
+
+func TestRunBackendFromConfig(t *testing.T) {
+	dir := t.TempDir()
+	cache := t.TempDir()
+	t.Setenv("CHORELANG_CACHE", cache)
+	writeFile(t, dir, "chore.json", `{"run": {"backend": "interp"}}`)
+	file := writeFile(t, dir, "main.chore", `spin print("configured")`)
+	
+	code, stdout, stderr := runCLI(t, "run", file)
+	if code != exitOK || stdout != "configured\n" {
+		t.Fatalf("run failed: code %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	// The interpreter never writes a bytecode cache
+	if cached, _ := filepath.Glob(filepath.Join(cache, "*.chorec")); len(cached) != 0 {
+		t.Errorf("run used the VM instead of the configured interpreter")
+	}
+	
+	writeFile(t, dir, "chore.json", `{"run": {"backend": "jit"}}`)
+	code, _, stderr = runCLI(t, "run", file)
+	if code != exitFailure || !strings.Contains(stderr, `unknown run backend "jit"`) {
+		t.Errorf("expected a config error, got code %d, stderr %q", code, stderr)
+	}
+}
+
+func TestRunCache(t *testing.T) {
+	dir := t.TempDir()
+	cache := filepath.Join(t.TempDir(), "cache")
+	t.Setenv("CHORELANG_CACHE", cache)
+	file := writeFile(t, dir, "main.chore", `spin print("first")`)
+	cached := func() []string {
+		files, _ := filepath.Glob(filepath.Join(cache, "*.chorec"))
+		return files
+	}
+	
+	if code, stdout, stderr := runCLI(t, "run", file); code != exitOK || stdout != "first\n" || stderr != "" {
+		t.Fatalf("run: got code %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	first := cached()
+	if len(first) != 1 {
+		t.Fatalf("run cached %v, want one file", first)
+	}
+	if beside, _ := filepath.Glob(filepath.Join(dir, "*.chorec")); len(beside) != 0 {
+		t.Errorf("run wrote %v beside the script", beside)
+	}
+	
+	// A broken cache is compiled again, and mended
+	if err := os.WriteFile(first[0], []byte("CHOREC garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code, stdout, _ := runCLI(t, "run", file); code != exitOK || stdout != "first\n" {
+		t.Errorf("run with a broken cache: got code %d, stdout %q", code, stdout)
+	}
+	if data, _ := os.ReadFile(first[0]); string(data) == "CHOREC garbage" {
+		t.Errorf("run left the broken cache in place")
+	}
+	
+	// An edited script gets a cache of its own, unless caching is off
+	writeFile(t, dir, "main.chore", `spin print("second")`)
+	if code, stdout, _ := runCLI(t, "run", "-nocache", file); code != exitOK || stdout != "second\n" || len(cached()) != 1 {
+		t.Errorf("run -nocache: got code %d, stdout %q, cache %v", code, stdout, cached())
+	}
+	if code, stdout, _ := runCLI(t, "run", file); code != exitOK || stdout != "second\n" || len(cached()) != 2 {
+		t.Errorf("run of an edited script: got code %d, stdout %q, cache %v", code, stdout, cached())
+	}
+}
+
+func TestRunPassesArgsAndExitStatus(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "tool.chore", `
+sway i from 1 to spin args() {
+    spin print(spin args(i))
+}
+spin exit(spin args() + 40)
+`)
+	
+	backends := []string{"-interp", "-nocache"}
+	if !testing.Short() {
+		if _, err := exec.LookPath("go"); err == nil {
+			backends = append(backends, "-go")
+		}
+	}
+	
+	for _, backend := range backends {
+		code, stdout, stderr := runCLI(t, "run", backend, file, "--", "a", "-b")
+		if code != 42 || stdout != "a\n-b\n" || stderr != "" {
+			t.Errorf("run %s: got code %d, stdout %q, stderr %q", backend, code, stdout, stderr)
+		}
+	}
+	
+	// The Go backend builds in a temporary directory, never next to the
+	// script or in the working directory
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("run left files behind: %v", entries)
+	}
+}
+
+func TestRunFileSystemRoot(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "copy.chore", `
+flow files = chore.fs()
+files.write("copy.txt", files.read("notes.txt") + "!")
+spin print(files.read("copy.txt"), files.stat("copy.txt"))
+files.read("../copy.chore")
+`)
+	writeFile(t, dir, "notes.txt", "script")
+	writeFile(t, filepath.Join(dir, "flagged"), "notes.txt", "flag")
+	writeFile(t, filepath.Join(dir, "configured"), "notes.txt", "config")
+	
+	backends := []string{"-interp", "-nocache"}
+	if !testing.Short() {
+		if _, err := exec.LookPath("go"); err == nil {
+			backends = append(backends, "-go")
+		}
+	}
+	
+	// Every backend reports the escape the same way
+	denied := "Runtime error: " + file + ": 5:7: "
+	var first string
+	for _, backend := range backends {
+		// The script's directory, then chore.json, then -fsroot
+		os.Remove(filepath.Join(dir, "chore.json"))
+		code, stdout, stderr := runCLI(t, "run", backend, file)
+		if code != exitFailure || stdout != "script! file 7\n" || !strings.HasPrefix(stderr, denied) || !strings.Contains(stderr, "denied by the jail rule") {
+			t.Errorf("run %s: got code %d, stdout %q, stderr %q", backend, code, stdout, stderr)
+		}
+		if first == "" {
+			first = stderr
+		} else if stderr != first {
+			t.Errorf("run %s: stderr %q, but %s gave %q", backend, stderr, backends[0], first)
+		}
+		
+		writeFile(t, dir, "chore.json", `{"run": {"fsRoot": "configured"}}`)
+		if code, stdout, stderr := runCLI(t, "run", backend, file); stdout != "config! file 7\n" {
+			t.Errorf("run %s with fsRoot: got code %d, stdout %q, stderr %q", backend, code, stdout, stderr)
+		}
+		
+		flagged := filepath.Join(dir, "flagged")
+		if code, stdout, stderr := runCLI(t, "run", backend, "-fsroot", flagged, file); stdout != "flag! file 5\n" {
+			t.Errorf("run %s -fsroot: got code %d, stdout %q, stderr %q", backend, code, stdout, stderr)
+		}
+	}
+	
+	code, _, stderr := runCLI(t, "run", "-fsroot", filepath.Join(dir, "missing"), file)
+	if code != exitFailure || !strings.Contains(stderr, "file system root") {
+		t.Errorf("run with a missing root: got code %d, stderr %q", code, stderr)
+	}
+}
+
+func TestFmtModes(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "messy.chore", "dance x=1 // one\nif x>0{spin print(x)}")
+	formatted := "dance x = 1 // one\nif x > 0 {\n    spin print(x)\n}\n"
+	
+	code, stdout, _ := runCLI(t, "fmt", file)
+	if code != exitOK || stdout != formatted {
+		t.Errorf("fmt: got code %d, stdout %q", code, stdout)
+	}
+	
+	code, stdout, _ = runCLI(t, "fmt", "-check", dir)
+	if code != exitFailure || stdout != file+"\n" {
+		t.Errorf("fmt -check: got code %d, stdout %q", code, stdout)
+	}
+	
+	code, stdout, _ = runCLI(t, "fmt", "-d", file)
+	if code != exitOK || !strings.Contains(stdout, "-if x>0{spin print(x)}") || !strings.Contains(stdout, "+    spin print(x)") {
+		t.Errorf("fmt -d: got code %d, stdout %q", code, stdout)
+	}
+	
+	if code, _, stderr := runCLI(t, "fmt", "-w", file); code != exitOK {
+		t.Fatalf("fmt -w: got code %d, stderr %q", code, stderr)
+	}
+	if written, _ := os.ReadFile(file); string(written) != formatted {
+		t.Errorf("fmt -w wrote %q", written)
+	}
+	if code, stdout, _ := runCLI(t, "fmt", "-check", file); code != exitOK || stdout != "" {
+		t.Errorf("fmt -check after -w: got code %d, stdout %q", code, stdout)
+	}
+	
+	bad := writeFile(t, dir, "bad.chore", "dance = 1")
+	if code, _, stderr := runCLI(t, "fmt", bad); code != exitFailure || !strings.Contains(stderr, "bad.chore") {
+		t.Errorf("fmt of a bad file: got code %d, stderr %q", code, stderr)
+	}
+	
+	lossy := "dance r = match x {\n    when Note(n, 5): flow 1\n}\n"
+	kept := writeFile(t, dir, "lossy.chore", lossy)
+	if code, _, stderr := runCLI(t, "fmt", "-w", kept); code != exitFailure || !strings.Contains(stderr, "would drop or change") {
+		t.Errorf("fmt -w of code the formatter would lose: got code %d, stderr %q", code, stderr)
+	}
+	if written, _ := os.ReadFile(kept); string(written) != lossy {
+		t.Errorf("fmt -w rewrote code it would lose: %q", written)
+	}
+}
+
+func TestLint(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "main.chore", "dance total_count = 1\nspin print(total_count)\n")
+	
+	code, stdout, _ := runCLI(t, "lint", dir)
+	expected := file + `:1:7: variable "total_count" should be camelCase: "totalCount" (camel-case)` + "\n" +
+		"\tfix: rename to \"totalCount\"\n"
+	if code != exitFailure || stdout != expected {
+		t.Errorf("lint: got code %d, stdout %q", code, stdout)
+	}
+	
+	code, stdout, _ = runCLI(t, "lint", "-d", file)
+	if code != exitOK || !strings.Contains(stdout, "+spin print(totalCount)") {
+		t.Errorf("lint -d: got code %d, stdout %q", code, stdout)
+	}
+	
+	if code, _, stderr := runCLI(t, "lint", "-fix", file); code != exitOK {
+		t.Fatalf("lint -fix: got code %d, stderr %q", code, stderr)
+	}
+	if written, _ := os.ReadFile(file); string(written) != "dance totalCount = 1\nspin print(totalCount)\n" {
+		t.Errorf("lint -fix wrote %q", written)
+	}
+	
+	writeFile(t, dir, "main.chore", "dance snake_case = 1\n")
+	writeFile(t, dir, "chore.json", `{"lint": {"disable": ["unused", "camel-case"]}}`)
+	if code, stdout, _ := runCLI(t, "lint", file); code != exitOK || stdout != "" {
+		t.Errorf("lint with rules disabled: got code %d, stdout %q", code, stdout)
+	}
+	
+	writeFile(t, dir, "chore.json", `{"lint": {"disable": ["camelcase"]}}`)
+	if code, _, stderr := runCLI(t, "lint", file); code != exitFailure || !strings.Contains(stderr, `unknown lint rule "camelcase"`) {
+		t.Errorf("expected a config error, got code %d, stderr %q", code, stderr)
+	}
+}
+
+func TestTest(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "main.chore", "spin print(\"not a test file\")\n")
+	passing := writeFile(t, dir, "a_test.chore", "rehearse \"adds\" {\n    spin expect(1 + 1, 2)\n}\n")
+	
+	code, stdout, _ := runCLI(t, "test", dir)
+	if code != exitOK || !strings.HasPrefix(stdout, "ok  \t"+passing+"\t") || strings.Contains(stdout, "main.chore") {
+		t.Errorf("test: got code %d, stdout %q", code, stdout)
+	}
+	
+	code, stdout, _ = runCLI(t, "test", "-v", passing)
+	if code != exitOK || !strings.HasPrefix(stdout, "=== RUN   adds\n--- PASS: adds (") {
+		t.Errorf("test -v: got code %d, stdout %q", code, stdout)
+	}
+	
+	failing := writeFile(t, dir, "b_test.chore", "rehearse \"adds\" {\n    spin print(\"working\")\n    spin expect(1 + 1, 3)\n}\n")
+	code, stdout, _ = runCLI(t, "test", failing)
+	expected := "    " + failing + ":3:5: spin expect(1 + 1, 3)\n" +
+		"        got 2, want 3\n" +
+		"    output:\n" +
+		"        working\n" +
+		"FAIL\t" + failing + "\t"
+	if code != exitFailure || !strings.HasPrefix(stdout, "--- FAIL: adds (") || !strings.Contains(stdout, expected) {
+		t.Errorf("failing test: got code %d, stdout %q", code, stdout)
+	}
+	
+	report := filepath.Join(dir, "report.xml")
+	if code, _, _ := runCLI(t, "test", "-run", "^none$", "-junit", report, dir); code != exitOK {
+		t.Errorf("test -run matching nothing: got code %d", code)
+	}
+	writeFile(t, dir, "c_test.chore", "rehearse {\n")
+	if code, _, _ := runCLI(t, "test", "-junit", report, dir); code != exitFailure {
+		t.Errorf("test with failures: got code %d", code)
+	}
+	if written, _ := os.ReadFile(report); !strings.Contains(string(written), `<testsuites tests="3" failures="1" errors="1"`) {
+		t.Errorf("junit report wrong:\n%s", written)
+	}
+	
+	html, lcov := filepath.Join(dir, "cover.html"), filepath.Join(dir, "cover.lcov")
+	covered := writeFile(t, t.TempDir(), "d_test.chore", "dance base = 1\nif base > 1 {\n    spin print(base)\n}\nrehearse \"runs\" {\n    spin expect(base, 1)\n}\n")
+	code, stdout, _ = runCLI(t, "test", "-coverhtml", html, "-coverlcov", lcov, covered)
+	if code != exitOK || !strings.HasSuffix(stdout, "s\tcoverage: 66.7% of statements\n") {
+		t.Errorf("test -cover: got code %d, stdout %q", code, stdout)
+	}
+	if written, _ := os.ReadFile(html); !strings.Contains(string(written), `class="notrun"`) {
+		t.Errorf("html coverage report wrong:\n%s", written)
+	}
+	if written, _ := os.ReadFile(lcov); !strings.Contains(string(written), "SF:"+covered+"\nDA:1,1\nDA:2,1\nDA:3,0\nLF:3\nLH:2\n") {
+		t.Errorf("lcov coverage report wrong:\n%s", written)
+	}
+	
+	if code, stdout, _ := runCLI(t, "test", t.TempDir()); code != exitOK || stdout != "no test files\n" {
+		t.Errorf("directory without tests: got code %d, stdout %q", code, stdout)
+	}
+	if code, _, stderr := runCLI(t, "test", "-run", "(", dir); code != exitUsage || !strings.Contains(stderr, "bad -run pattern") {
+		t.Errorf("bad -run: got code %d, stderr %q", code, stderr)
+	}
+}
+
+func TestBench(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds Go benchmarks")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("Go toolchain not available")
+	}
+	
+	dir := t.TempDir()
+	file := writeFile(t, dir, "sum_test.chore", `dance rounds = 10
+spin print("setup is not timed")
+
+encore "sums" {
+    dance total = 0
+    sway i from 1 to rounds {
+        total = total + i
+    }
+}
+
+encore "pings" {
+    flow ch = flow channel<int>
+    start send ch <- 1
+    dance v = <-ch
+}
+
+encore "reserved" {
+    dance len = 3
+    dance fmt = len + 1
+    spin print(fmt)
+}
+`)
+	baseline := filepath.Join(dir, "base.json")
+	
+	code, stdout, stderr := runCLI(t, "bench", "-benchtime", "10x", "-save", baseline, dir)
+	if code != exitOK || !strings.HasPrefix(stdout, file+"\n") || strings.Contains(stdout, "setup") {
+		t.Fatalf("bench: got code %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	if !regexp.MustCompile(`(?m)^    sums +10 +\d+ ns/op +\d+ B/op +\d+ allocs/op +0\.00 dancers/op$`).MatchString(stdout) ||
+		!regexp.MustCompile(`(?m)^    pings +10 +\d+ ns/op .* 1\.00 dancers/op$`).MatchString(stdout) ||
+		!regexp.MustCompile(`(?m)^    reserved +10 +\d+ ns/op `).MatchString(stdout) {
+		t.Errorf("bench results wrong:\n%s", stdout)
+	}
+	saved, err := os.ReadFile(baseline)
+	if err != nil || !strings.Contains(string(saved), `"name": "pings"`) {
+		t.Fatalf("baseline not saved: %v\n%s", err, saved)
+	}
+	
+	// A baseline far faster than anything real makes every encore regress
+	fast := regexp.MustCompile(`"nsPerOp": [0-9.e+]+`).ReplaceAll(saved, []byte(`"nsPerOp": 0.001`))
+	writeFile(t, dir, "base.json", string(fast))
+	code, stdout, _ = runCLI(t, "bench", "-benchtime", "10x", "-run", "^sums$", "-baseline", baseline, file)
+	if code != exitFailure || strings.Contains(stdout, "pings") ||
+		!strings.Contains(stdout, "REGRESSED") || !strings.Contains(stdout, "FAIL: 1 encore(s) regressed by more than 10%") {
+		t.Errorf("bench against a fast baseline: got code %d, stdout %q", code, stdout)
+	}
+	
+	writeFile(t, dir, "chore.json", `{"bench": {"baseline": "base.json", "threshold": 1e12}}`)
+	if code, stdout, _ := runCLI(t, "bench", "-benchtime", "10x", "-run", "sums", file); code != exitOK || !strings.Contains(stdout, "% time") {
+		t.Errorf("bench with a configured baseline: got code %d, stdout %q", code, stdout)
+	}
+	
+	writeFile(t, dir, "plain_test.chore", "spin print(1)\n")
+	if code, stdout, _ := runCLI(t, "bench", filepath.Join(dir, "plain_test.chore")); code != exitOK || stdout != "no encores to run\n" {
+		t.Errorf("file without encores: got code %d, stdout %q", code, stdout)
+	}
+}
+
+func TestChart(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "main.chore", "start spin print(1)\n")
+	
+	code, stdout, _ := runCLI(t, "chart", file)
+	if code != exitOK || !strings.HasPrefix(stdout, "flowchart TD\n") || !strings.Contains(stdout, `subgraph dancer1 ["dancer at line 1"]`) {
+		t.Errorf("chart: got code %d, stdout %q", code, stdout)
+	}
+	
+	out := filepath.Join(dir, "chart.md")
+	if code, _, stderr := runCLI(t, "chart", "-o", out, file); code != exitOK {
+		t.Fatalf("chart -o: got code %d, stderr %q", code, stderr)
+	}
+	if written, _ := os.ReadFile(out); !strings.HasPrefix(string(written), "```mermaid\nflowchart TD\n") {
+		t.Errorf("chart -o wrote %q", written)
+	}
+	
+	writeFile(t, dir, "main.chore", "flow channel<int> ch\nstart send ch <- 1\n")
+	code, stdout, stderr := runCLI(t, "chart", "--sequence", file)
+	if code != exitOK || !strings.HasPrefix(stdout, "sequenceDiagram\n") ||
+		!strings.Contains(stderr, `main.chore:2:7: send on "ch", but nothing ever receives from it; potential deadlock`) {
+		t.Errorf("chart --sequence: got code %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	
+	if code, _, stderr := runCLI(t, "chart", file, file); code != exitUsage || !strings.Contains(stderr, "expected one file") {
+		t.Errorf("chart with two files: got code %d, stderr %q", code, stderr)
+	}
+}
+
+func TestRunTrace(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds Go programs")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("Go toolchain not available")
+	}
+	
+	dir := t.TempDir()
+	file := writeFile(t, dir, "ping.chore", `flow ping = flow channel<string>
+start send ping <- "hello"
+spin print(<-ping)
+spin exit(3)
+`)
+	traceFile := filepath.Join(dir, "ping.trace")
+	t.Setenv("CHORELANG_TRACE", traceFile)
+	
+	if code, stdout, stderr := runCLI(t, "run", "-trace", file); code != 3 || stdout != "hello\n" {
+		t.Fatalf("run -trace: got code %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	
+	code, stdout, stderr := runCLI(t, "trace", traceFile)
+	if code != exitOK {
+		t.Fatalf("trace: got code %d, stderr %q", code, stderr)
+	}
+	for _, line := range []string{
+		"participant dancer1 as dancer 1 at line 2",
+		"main-)dancer1: start",
+		"dancer1->>main: ping #lt;- #quot;hello#quot;",
+		"Note over main: exit 3",
+	} {
+		if !strings.Contains(stdout, line) {
+			t.Errorf("sequence diagram lacks %q:\n%s", line, stdout)
+		}
+	}
+	
+	code, stdout, _ = runCLI(t, "trace", "-timeline", traceFile)
+	if code != exitOK || !strings.Contains(stdout, "main      3:12     receive \"hello\" from ping") {
+		t.Errorf("trace -timeline: got code %d, output:\n%s", code, stdout)
+	}
+	
+	if code, _, stderr := runCLI(t, "trace", file); code != exitFailure || !strings.Contains(stderr, "line 1: ") {
+		t.Errorf("trace of a source file: got code %d, stderr %q", code, stderr)
+	}
+}
+
+func TestRunGoDeadlock(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds Go programs")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("Go toolchain not available")
+	}
+	
+	dir := t.TempDir()
+	file := writeFile(t, dir, "cycle.chore", `flow a = flow channel<int>
+flow b = flow channel<int>
+start {
+    dance x = <-a
+    send b <- x
+}
+dance y = <-b
+send a <- y
+`)
+	code, _, stderr := runCLI(t, "run", "-go", file)
+	want := "Runtime error: " + file + ": 7:11: all dancers are asleep - deadlock!\n" +
+		"    main is blocked receiving from `b` at 7:11\n" +
+		"    dancer 1 (started at 3:1) is blocked receiving from `a` at 4:15\n" +
+		"    hint: no dancer is left to send on `b`\n" +
+		"    hint: no dancer is left to send on `a`\n"
+	if code != exitFailure || stderr != want {
+		t.Errorf("run -go of a deadlock: got code %d, stderr:\n%s", code, stderr)
+	}
+	for _, args := range [][]string{{"run", file}, {"run", "-interp", file}} {
+		if code, _, _ := runCLI(t, args...); code != exitFailure {
+			t.Errorf("%v of a deadlock: got code %d, want %d as with -go", args, code, exitFailure)
+		}
+	}
+	
+	leak := writeFile(t, dir, "leak.chore", `flow ch = flow channel<int>
+start sway i from 1 to 5 {
+    send ch <- i
+}
+spin print(<-ch)
+`)
+	code, stdout, stderr := runCLI(t, "run", "-go", leak)
+	if code != exitOK || stdout != "1\n" || !strings.Contains(stderr, "dancer 1 (started at 2:1) is blocked sending on `ch` at 3:5") {
+		t.Errorf("run -go of a leak: got code %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+}
+
+func TestBuildSeveralPrograms(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds Go programs")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("Go toolchain not available")
+	}
+	
+	dir := t.TempDir()
+	writeFile(t, dir, "chore.json", `{"build": {"outDir": "bin"}}`)
+	writeFile(t, dir, "one.chore", `spin print(1)`)
+	writeFile(t, dir, "two.chore", `spin print(undefined_name)`)
+	writeFile(t, dir, "three.chore", `spin print(3)`)
+	
+	code, stdout, stderr := runCLI(t, "build", dir)
+	if code != exitFailure {
+		t.Errorf("expected exit %d when one program fails, got %d", exitFailure, code)
+	}
+	if !strings.Contains(stderr, "two.chore") {
+		t.Errorf("expected the failing file to be named, got %q", stderr)
+	}
+	
+	for _, name := range []string{"one", "three"} {
+		if _, err := os.Stat(filepath.Join(dir, "bin", name)); err != nil {
+			t.Errorf("%s was not built: %v\nstdout: %s", name, err, stdout)
+		}
+	}
+}
+
+func runCLI(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	
+	var stdout, stderr bytes.Buffer
+	ctx := &context{stdin: strings.NewReader(""), stdout: &stdout, stderr: &stderr}
+	code := dispatch(ctx, args)
+	return code, stdout.String(), stderr.String()
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
\ No newline at end of file
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime/debug"
+	"syscall"
+	
+	"github.com/chorlang/chorlang/compiler/bytecode"
+	"github.com/chorlang/chorlang/compiler/deadlock"
+	"github.com/chorlang/chorlang/compiler/fs"
+	"github.com/chorlang/chorlang/compiler/interp"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/parser"
+	"github.com/chorlang/chorlang/compiler/vm"
+)
+
+// runSettings is the "run" section of chore.json.
+type runSettings struct {
+	// Backend is "vm", "interp" or "go". The VM is the default: it is the
+	// fastest backend that needs no Go toolchain.
+	Backend string `json:"backend"`
+	// Cache turns the bytecode cache on or off.
+	Cache *bool `json:"cache"`
+	// FSRoot is the root of the sandbox chore.fs() opens, relative to
+	// the project root.
+	FSRoot string `json:"fsRoot"`
+}
+
+func newRunCommand() *command {
+	cmd := newCommand("run", "[flags] <file.chore> [--] [arguments]", "Run a ChoreLang program.")
+	cmd.detail = "By default the program runs on the bytecode VM, the fastest backend that\n" +
+		"needs no Go toolchain. -interp runs it on the tree-walking interpreter and\n" +
+		"-go through the Go toolchain; all three print the same output. The \"run\"\n" +
+		"section of chore.json may set \"backend\" to vm, interp or go.\n" +
+		"\n" +
+		"The VM caches compiled bytecode in $CHORELANG_CACHE, or else in chorelang\n" +
+		"under the user's cache directory, never beside the script. The cache is\n" +
+		"keyed by the source and by the chorelang build, so an edited script or a\n" +
+		"new chorelang recompiles. -nocache, or \"cache\": false, turns it off.\n" +
+		"\n" +
+		"Arguments after the file are passed to the program, which reads them with\n" +
+		"args(). chorelang run exits with the program's own exit status.\n" +
+		"\n" +
+		"The file system module that chore.fs() opens reaches only the files under\n" +
+		"one root: the script's directory, or the \"fsRoot\" of the \"run\" section,\n" +
+		"relative to the project root, or the directory -fsroot names.\n" +
+		"\n" +
+		"-trace runs the program through the Go toolchain and records its dancers\n" +
+		"and channel operations to name.trace, or to $CHORELANG_TRACE if set. Draw\n" +
+		"the trace with chorelang trace.\n" +
+		"\n" +
+		"-schedule=seed:N runs the dancers one at a time, switching only at start,\n" +
+		"send and receive, in an order drawn from the seed. The same seed gives the\n" +
+		"same interleaving on the vm and interp backends, every time.\n" +
+		"-schedule=random draws a seed, which a failing run reports for replay.\n" +
+		"\n" +
+		"The -max flags cap what an untrusted program may use: its wall time, the\n" +
+		"loop iterations of all its dancers, the dancers running at once, the bytes\n" +
+		"its channels hold and the bytes it prints. A program that goes past one\n" +
+		"stops with an error naming the limit and the line that went past it. They\n" +
+		"need the vm or interp backend."
+	useInterp := cmd.flags.Bool("interp", false, "run with the tree-walking interpreter")
+	useGo := cmd.flags.Bool("go", false, "build and run through the Go toolchain")
+	noCache := cmd.flags.Bool("nocache", false, "do not read or write the bytecode cache")
+	trace := cmd.flags.Bool("trace", false, "build and run through the Go toolchain, recording a trace")
+	schedule := cmd.flags.String("schedule", "", "run the dancers in the order drawn from `seed:N`, or random")
+	fsroot := cmd.flags.String("fsroot", "", "root chore.fs() at `dir` instead of the script's directory")
+	var limits interp.Limits
+	cmd.flags.DurationVar(&limits.Time, "maxtime", 0, "stop the program once it has run this long")
+	cmd.flags.Int64Var(&limits.Iterations, "maxiterations", 0, "stop the program after this many loop iterations")
+	cmd.flags.IntVar(&limits.Dancers, "maxdancers", 0, "stop the program if more dancers than this run at once")
+	cmd.flags.Int64Var(&limits.Memory, "maxmemory", 0, "stop the program if its channels hold more than this many bytes")
+	cmd.flags.Int64Var(&limits.Output, "maxoutput", 0, "stop the program if it prints more than this many bytes")
+	
+	cmd.run = func(ctx *context, args []string) int {
+		if len(args) == 0 {
+			fmt.Fprintf(ctx.stderr, "chorelang run: no file given\nRun 'chorelang help run' for usage.\n")
+			return exitUsage
+		}
+		file := args[0]
+		programArgs := args[1:]
+		if len(programArgs) > 0 && programArgs[0] == "--" {
+			programArgs = programArgs[1:]
+		}
+		// As in Go, the program's own name comes first
+		programArgs = append([]string{file}, programArgs...)
+		
+		settings := runSettings{Backend: "vm"}
+		cfg, ok := loadConfig(ctx, file, "run", &settings)
+		if !ok {
+			return exitFailure
+		}
+		
+		backend := settings.Backend
+		switch {
+		case *useGo, *trace:
+			backend = "go"
+		case *useInterp:
+			backend = "interp"
+		}
+		cache := !*noCache && (settings.Cache == nil || *settings.Cache)
+		
+		var sched *interp.Schedule
+		if *schedule != "" {
+			var err error
+			if sched, err = interp.ParseSchedule(*schedule); err != nil {
+				fmt.Fprintf(ctx.stderr, "chorelang run: %v\n", err)
+				return exitUsage
+			}
+			if backend == "go" {
+				fmt.Fprintf(ctx.stderr, "chorelang run: -schedule needs the vm or interp backend\n")
+				return exitUsage
+			}
+		}
+		
+		if backend == "go" && limits != (interp.Limits{}) {
+			fmt.Fprintf(ctx.stderr, "chorelang run: the -max flags need the vm or interp backend\n")
+			return exitUsage
+		}
+		
+		source, ok := readSource(ctx, file)
+		if !ok {
+			return exitFailure
+		}
+		
+		root := *fsroot
+		if root == "" {
+			root = cfg.Resolve(settings.FSRoot)
+		}
+		if root == "" {
+			root = filepath.Dir(file)
+		}
+		sandbox, err := fs.Dir(root)
+		if err != nil {
+			fmt.Fprintf(ctx.stderr, "Error: file system root: %v\n", err)
+			return exitFailure
+		}
+		
+		switch backend {
+		case "vm":
+			return runVM(ctx, file, source, programArgs, sandbox, cache, sched, limits)
+		case "interp":
+			return runInterp(ctx, file, source, programArgs, sandbox, sched, limits)
+		case "go":
+			return runGo(ctx, file, source, programArgs, root, *trace)
+		}
+		fmt.Fprintf(ctx.stderr, "Config error: unknown run backend %q (want vm, interp or go)\n", backend)
+		return exitFailure
+	}
+	return cmd
+}
+
+func runVM(ctx *context, file string, source []byte, args []string, sandbox *fs.Sandbox, cache bool, sched *interp.Schedule, limits interp.Limits) int {
+	chunk, ok := loadChunk(ctx, file, source, cache)
+	if !ok {
+		return exitFailure
+	}
+	machine := vm.New(chunk, ctx.stdout)
+	machine.Args = args
+	machine.FS = sandbox
+	machine.Schedule = sched
+	machine.Limits = limits
+	err := machine.Run()
+	return finishRun(ctx, file, sched, err, machine.Leaked(), func() deadlock.Sites {
+		return sourceSites(file, source)
+	})
+}
+
+func runInterp(ctx *context, file string, source []byte, args []string, sandbox *fs.Sandbox, sched *interp.Schedule, limits interp.Limits) int {
+	program, ok := loadProgram(ctx, file, source)
+	if !ok {
+		return exitFailure
+	}
+	in := interp.New(ctx.stdout)
+	in.Args = args
+	in.FS = sandbox
+	in.Schedule = sched
+	in.Limits = limits
+	err := in.Run(program)
+	return finishRun(ctx, file, sched, err, in.Leaked(), func() deadlock.Sites {
+		return deadlock.Find(program)
+	})
+}
+
+// finishRun is runStatus for a run in process. A deadlock is explained by
+// the sites of the blocked dancers' operations, and so are dancers leaked
+// by a program that finished. A runtime error under a schedule names the
+// schedule, so the run can be replayed.
+func finishRun(ctx *context, file string, sched *interp.Schedule, err error, leaked []interp.Blocked, sites func() deadlock.Sites) int {
+	code := runStatus(ctx, file, err)
+	var stuck *interp.DeadlockError
+	switch {
+	case errors.As(err, &stuck):
+		sites().Write(ctx.stderr, stuck.Blocked, false)
+	case err == nil && len(leaked) > 0:
+		fmt.Fprintf(ctx.stderr, "Warning: %s: %s still blocked when main finished\n", file, plural(len(leaked), "dancer"))
+		sites().Write(ctx.stderr, leaked, true)
+	}
+	var exit *interp.ExitError
+	if sched != nil && err != nil && !errors.As(err, &exit) {
+		fmt.Fprintf(ctx.stderr, "Replay with -schedule=%s\n", sched)
+	}
+	return code
+}
+
+// sourceSites finds the sends and receives of a script without reporting
+// its errors, which compiling it has already done. Bytecode keeps no
+// source, so it has none.
+func sourceSites(file string, source []byte) deadlock.Sites {
+	if filepath.Ext(file) == ".chorec" {
+		return nil
+	}
+	return deadlock.Find(parser.New(lexer.New(string(source))).ParseProgram())
+}
+
+// runStatus turns the result of running a program in process into the
+// exit status: the code the program passed to exit, or 1 for a runtime
+// error.
+func runStatus(ctx *context, file string, err error) int {
+	var exit *interp.ExitError
+	if errors.As(err, &exit) {
+		return exit.Code
+	}
+	if err != nil {
+		fmt.Fprintf(ctx.stderr, "Runtime error: %s: %v\n", file, err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// runGo builds the program in a private temporary directory and runs it
+// with args, forwarding stdin and interrupts, and with its file system
+// rooted at root. The program's exit status becomes ours, so nothing is
+// added to what it prints. A traced program writes its trace to the
+// working directory, named after file.
+func runGo(ctx *context, file string, source []byte, args []string, root string, trace bool) int {
+	program, ok := loadProgram(ctx, file, source)
+	if !ok {
+		return exitFailure
+	}
+	
+	dir, err := ioutil.TempDir("", "chorelang-run-")
+	if err != nil {
+		fmt.Fprintf(ctx.stderr, "Error: %v\n", err)
+		return exitFailure
+	}
+	defer os.RemoveAll(dir)
+	
+	binary := filepath.Join(dir, baseName(file))
+	if err := buildBinary(ctx, generator(file, trace, true), program, binary); err != nil {
+		fmt.Fprintf(ctx.stderr, "Compilation error: %s: %v\n", file, err)
+		return exitFailure
+	}
+	
+	cmd := exec.Command(binary)
+	cmd.Args = args
+	cmd.Stdin = ctx.stdin
+	cmd.Stdout = ctx.stdout
+	cmd.Stderr = ctx.stderr
+	cmd.Env = append(os.Environ(), "CHORELANG_FSROOT="+root)
+	if trace && os.Getenv("CHORELANG_TRACE") == "" {
+		cmd.Env = append(cmd.Env, "CHORELANG_TRACE="+baseName(file)+".trace")
+	}
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(ctx.stderr, "Error: %s: %v\n", file, err)
+		return exitFailure
+	}
+	
+	// The program decides what an interrupt means, so pass it on instead
+	// of dying first
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				cmd.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+	
+	err = cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// A program killed by a signal exits as a shell reports it
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		fmt.Fprintf(ctx.stderr, "Error: %s: %v\n", file, err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// loadChunk returns the bytecode for a script. A .chorec file is decoded
+// directly. For a .chore file, useCache reuses the bytecode cached for the
+// same source by the same chorelang, and otherwise compiles the script and
+// refreshes the cache.
+func loadChunk(ctx *context, inputFile string, source []byte, useCache bool) (*bytecode.Chunk, bool) {
+	if filepath.Ext(inputFile) == ".chorec" {
+		chunk, err := bytecode.Decode(bytes.NewReader(source), nil)
+		if err != nil {
+			fmt.Fprintf(ctx.stderr, "Error reading %s: %v\n", inputFile, err)
+			return nil, false
+		}
+		return chunk, true
+	}
+	
+	cacheFile := cachePath(source)
+	if useCache && cacheFile != "" {
+		if cached, err := ioutil.ReadFile(cacheFile); err == nil {
+			if chunk, err := bytecode.Decode(bytes.NewReader(cached), source); err == nil {
+				return chunk, true
+			}
+		}
+	}
+	
+	program, ok := loadProgram(ctx, inputFile, source)
+	if !ok {
+		return nil, false
+	}
+	chunk, err := bytecode.Compile(program)
+	if err != nil {
+		fmt.Fprintf(ctx.stderr, "Bytecode compilation error: %s: %v\n", inputFile, err)
+		return nil, false
+	}
+	
+	if useCache && cacheFile != "" {
+		// The cache only saves time, so failing to write it only warns
+		if err := writeCache(cacheFile, chunk, source); err != nil {
+			fmt.Fprintf(ctx.stderr, "Warning: bytecode cache: %v\n", err)
+		}
+	}
+	
+	return chunk, true
+}
+
+// cachePath names the file that caches the bytecode of source, in
+// $CHORELANG_CACHE or else chorelang under the user's cache directory,
+// never beside the script. The name hashes the source with buildVersion,
+// so an edited script or another chorelang never reads stale bytecode.
+// It is "" when there is no cache directory, and nothing is cached.
+func cachePath(source []byte) string {
+	dir := os.Getenv("CHORELANG_CACHE")
+	if dir == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(base, "chorelang")
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", buildVersion())
+	h.Write(source)
+	return filepath.Join(dir, fmt.Sprintf("%x.chorec", h.Sum(nil)))
+}
+
+// buildVersion identifies this chorelang: the bytecode format, and the
+// module version and revision it was built from when Go recorded them.
+func buildVersion() string {
+	version := fmt.Sprintf("chorec %d", bytecode.FormatVersion)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		version += " " + info.Main.Version
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" || setting.Key == "vcs.modified" {
+				version += " " + setting.Value
+			}
+		}
+	}
+	return version
+}
+
+// writeCache stores the bytecode of source in file. It writes a temporary
+// file and renames it, so a concurrent run never reads half a cache.
+func writeCache(file string, chunk *bytecode.Chunk, source []byte) error {
+	var buf bytes.Buffer
+	if err := bytecode.Encode(&buf, chunk, source); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), "chorec-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
\ No newline at end of file
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+	
+	"github.com/chorlang/chorlang/compiler/coverage"
+	"github.com/chorlang/chorlang/compiler/interp"
+	"github.com/chorlang/chorlang/compiler/rehearsal"
+)
+
+func newTestCommand() *command {
+	cmd := newCommand("test", "[flags] [files or directories]", "Run the rehearsals in ChoreLang test files.")
+	cmd.detail = "Test files are .chore files whose names end in _test.chore; directories\n" +
+		"contribute every test file below them, and files named explicitly are run\n" +
+		"whatever their names. With no arguments the current directory is tested.\n" +
+		"Each rehearse block runs the whole file afresh with only its own body in\n" +
+		"place, and fails on a false expect, a runtime error, exit or a timeout.\n" +
+		"\n" +
+		"With -cover each file's summary gives the share of its statements that\n" +
+		"ran, outside rehearse and encore blocks. -coverhtml writes the source\n" +
+		"marked with what ran, and -coverlcov an lcov tracefile; both imply -cover.\n" +
+		"\n" +
+		"-schedule=seed:N runs each rehearsal's dancers one at a time in the order\n" +
+		"the seed draws, as chorelang run does, so concurrent rehearsals give the\n" +
+		"same result every time. With -schedule=random a seed is drawn for the\n" +
+		"run, and a failing rehearsal prints the command that replays it."
+	run := cmd.flags.String("run", "", "run only rehearsals whose names match this regular expression")
+	timeout := cmd.flags.Duration("timeout", 10*time.Second, "fail a rehearsal that runs longer than this; 0 for no limit")
+	parallel := cmd.flags.Int("parallel", runtime.GOMAXPROCS(0), "run up to this many rehearsals of a file at once")
+	verbose := cmd.flags.Bool("v", false, "list every rehearsal, and show what passing ones printed")
+	junit := cmd.flags.String("junit", "", "also write the results as JUnit XML to this file")
+	cover := cmd.flags.Bool("cover", false, "report the share of statements the rehearsals ran")
+	coverHTML := cmd.flags.String("coverhtml", "", "write the source annotated with coverage as HTML to this file")
+	coverLCOV := cmd.flags.String("coverlcov", "", "write coverage as an lcov tracefile to this file")
+	schedule := cmd.flags.String("schedule", "", "run the dancers in the order drawn from `seed:N`, or random")
+	
+	cmd.run = func(ctx *context, args []string) int {
+		opts := rehearsal.Options{Timeout: *timeout, Parallel: *parallel}
+		if *run != "" {
+			re, err := regexp.Compile(*run)
+			if err != nil {
+				fmt.Fprintf(ctx.stderr, "chorelang test: bad -run pattern: %v\n", err)
+				return exitUsage
+			}
+			opts.Run = re
+		}
+		if *schedule != "" {
+			sched, err := interp.ParseSchedule(*schedule)
+			if err != nil {
+				fmt.Fprintf(ctx.stderr, "chorelang test: %v\n", err)
+				return exitUsage
+			}
+			opts.Schedule = sched
+		}
+		
+		if len(args) == 0 {
+			args = []string{"."}
+		}
+		files, err := testFiles(args)
+		if err != nil {
+			fmt.Fprintf(ctx.stderr, "chorelang test: %v\n", err)
+			return exitUsage
+		}
+		if len(files) == 0 {
+			fmt.Fprintln(ctx.stdout, "no test files")
+			return exitOK
+		}
+		
+		if *coverHTML != "" || *coverLCOV != "" {
+			*cover = true
+		}
+		
+		status := exitOK
+		var suites []rehearsal.Suite
+		var profiles []*coverage.Profile
+		for _, file := range files {
+			suite, profile := testFile(ctx, file, opts, *verbose, *cover)
+			if suite.Err != "" || !passed(suite.Results) {
+				status = exitFailure
+			}
+			suites = append(suites, suite)
+			if profile != nil {
+				profiles = append(profiles, profile)
+			}
+		}
+		
+		if *junit != "" {
+			var out bytes.Buffer
+			if err := rehearsal.JUnit(&out, suites); err == nil {
+				err = os.WriteFile(*junit, out.Bytes(), 0644)
+			}
+			if err != nil {
+				fmt.Fprintf(ctx.stderr, "Error writing %s: %v\n", *junit, err)
+				status = exitFailure
+			}
+		}
+		if *coverHTML != "" && !writeReport(ctx, *coverHTML, profiles, coverage.WriteHTML) {
+			status = exitFailure
+		}
+		if *coverLCOV != "" && !writeReport(ctx, *coverLCOV, profiles, coverage.WriteLCOV) {
+			status = exitFailure
+		}
+		return status
+	}
+	return cmd
+}
+
+// testFiles expands the arguments of chorelang test and bench. Unlike the
+// other commands they keep only the test files of a directory, and a
+// directory without any is not an error.
+func testFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		
+		found, err := expandInputs([]string{arg})
+		if err != nil && !strings.HasPrefix(err.Error(), "no .chore files") {
+			return nil, err
+		}
+		for _, file := range found {
+			if strings.HasSuffix(file, "_test.chore") {
+				files = append(files, file)
+			}
+		}
+	}
+	return files, nil
+}
+
+// testFile runs the rehearsals of one file and reports them in the manner of
+// go test: the failures, then a summary line for the file. With cover it
+// also returns the file's coverage, unless the file failed to load.
+func testFile(ctx *context, file string, opts rehearsal.Options, verbose, cover bool) (rehearsal.Suite, *coverage.Profile) {
+	suite := rehearsal.Suite{File: file}
+	
+	// Load errors are reported as usual, and also kept for the JUnit report
+	var errs bytes.Buffer
+	loadCtx := &context{stdin: ctx.stdin, stdout: ctx.stdout, stderr: io.MultiWriter(ctx.stderr, &errs)}
+	source, ok := readSource(loadCtx, file)
+	if ok {
+		program, loaded := loadProgram(loadCtx, file, source)
+		if loaded {
+			var profile *coverage.Profile
+			if cover {
+				profile = coverage.New(file, source, program)
+				opts.Count = profile.Count
+			}
+			start := time.Now()
+			suite.Results = rehearsal.Run(program, source, opts)
+			summarize(ctx, file, suite.Results, time.Since(start), verbose, profile)
+			return suite, profile
+		}
+	}
+	suite.Err = strings.TrimSpace(errs.String())
+	fmt.Fprintf(ctx.stdout, "FAIL\t%s [setup failed]\n", file)
+	return suite, nil
+}
+
+// summarize prints the failures of a file's rehearsals, or every result if
+// verbose, then the summary line, ending with the coverage if there is a
+// profile.
+func summarize(ctx *context, file string, results []rehearsal.Result, elapsed time.Duration, verbose bool, profile *coverage.Profile) {
+	for _, r := range results {
+		if verbose {
+			fmt.Fprintf(ctx.stdout, "=== RUN   %s\n", r.Name)
+		}
+		if r.Passed() {
+			if verbose {
+				fmt.Fprintf(ctx.stdout, "--- PASS: %s (%.2fs)\n", r.Name, r.Elapsed.Seconds())
+				printOutput(ctx, r.Output)
+			}
+			continue
+		}
+		fmt.Fprintf(ctx.stdout, "--- FAIL: %s (%.2fs)\n", r.Name, r.Elapsed.Seconds())
+		for _, f := range r.Failures {
+			for _, line := range strings.SplitAfter(rehearsal.FormatFailure(file, f), "\n") {
+				if line != "" {
+					fmt.Fprintf(ctx.stdout, "    %s", line)
+				}
+			}
+		}
+		if r.Schedule != nil {
+			fmt.Fprintf(ctx.stdout, "    replay: chorelang test -run '^%s$' -schedule=%s %s\n",
+				regexp.QuoteMeta(r.Name), r.Schedule, file)
+		}
+		printOutput(ctx, r.Output)
+	}
+	
+	cover := ""
+	if profile != nil {
+		if _, total := profile.Covered(); total == 0 {
+			cover = "\tcoverage: [no statements]"
+		} else {
+			cover = fmt.Sprintf("\tcoverage: %.1f%% of statements", profile.Percent())
+		}
+	}
+	switch {
+	case len(results) == 0:
+		fmt.Fprintf(ctx.stdout, "ok  \t%s\t%.3fs [no rehearsals to run]%s\n", file, elapsed.Seconds(), cover)
+	case passed(results):
+		fmt.Fprintf(ctx.stdout, "ok  \t%s\t%.3fs%s\n", file, elapsed.Seconds(), cover)
+	default:
+		fmt.Fprintf(ctx.stdout, "FAIL\t%s\t%.3fs%s\n", file, elapsed.Seconds(), cover)
+	}
+}
+
+// writeReport writes a coverage report of the profiles to path.
+func writeReport(ctx *context, path string, profiles []*coverage.Profile, write func(io.Writer, []*coverage.Profile) error) bool {
+	var out bytes.Buffer
+	err := write(&out, profiles)
+	if err == nil {
+		err = os.WriteFile(path, out.Bytes(), 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(ctx.stderr, "Error writing %s: %v\n", path, err)
+		return false
+	}
+	return true
+}
+
+// printOutput shows what a rehearsal printed, indented below its result.
+func printOutput(ctx *context, output string) {
+	if output == "" {
+		return
+	}
+	fmt.Fprintln(ctx.stdout, "    output:")
+	for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		fmt.Fprintf(ctx.stdout, "        %s\n", line)
+	}
+}
+
+func passed(results []rehearsal.Result) bool {
+	for _, r := range results {
+		if !r.Passed() {
+			return false
+		}
+	}
+	return true
+}
\ No newline at end of file
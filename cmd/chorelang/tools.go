@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	
+	"github.com/chorlang/chorlang/compiler/bytecode"
+	"github.com/chorlang/chorlang/compiler/dap"
+	"github.com/chorlang/chorlang/compiler/lsp"
+	"github.com/chorlang/chorlang/compiler/repl"
+)
+
+func newDisasmCommand() *command {
+	cmd := newCommand("disasm", "<files or directories>",
+		"Show the bytecode of .chore or .chorec files.")
+	
+	cmd.run = func(ctx *context, args []string) int {
+		files, code := inputsOrUsage(ctx, "disasm", args)
+		if code != exitOK {
+			return code
+		}
+		
+		status := exitOK
+		for i, file := range files {
+			source, ok := readSource(ctx, file)
+			if !ok {
+				status = exitFailure
+				continue
+			}
+			chunk, ok := loadChunk(ctx, file, source, false)
+			if !ok {
+				status = exitFailure
+				continue
+			}
+			
+			if len(files) > 1 {
+				if i > 0 {
+					fmt.Fprintln(ctx.stdout)
+				}
+				fmt.Fprintf(ctx.stdout, "== %s ==\n", file)
+			}
+			fmt.Fprint(ctx.stdout, bytecode.Disassemble(chunk))
+		}
+		return status
+	}
+	return cmd
+}
+
+func newReplCommand() *command {
+	cmd := newCommand("repl", "", "Start an interactive session.")
+	cmd.detail = "Bindings and dancers persist between inputs; type :help for the REPL's commands."
+	
+	cmd.run = func(ctx *context, args []string) int {
+		if len(args) != 0 {
+			fmt.Fprintf(ctx.stderr, "chorelang repl: unexpected arguments\n")
+			return exitUsage
+		}
+		fmt.Fprintln(ctx.stdout, "ChoreLang REPL. Type :help for commands.")
+		repl.Start(ctx.stdin, ctx.stdout)
+		return exitOK
+	}
+	return cmd
+}
+
+func newLspCommand() *command {
+	cmd := newCommand("lsp", "", "Run the language server, for editors.")
+	cmd.detail = "The server speaks the Language Server Protocol over standard input and\n" +
+		"output; editors start it and talk to it themselves. It reports errors, type\n" +
+		"errors and lint findings as files are edited, and offers hovers, go to\n" +
+		"definition, references, an outline, completion and semantic highlighting.\n" +
+		"Lint rules are configured by chore.json as for chorelang lint."
+	
+	cmd.run = func(ctx *context, args []string) int {
+		if len(args) != 0 {
+			fmt.Fprintf(ctx.stderr, "chorelang lsp: unexpected arguments\n")
+			return exitUsage
+		}
+		if err := lsp.Serve(ctx.stdin, ctx.stdout); err != nil {
+			fmt.Fprintf(ctx.stderr, "chorelang lsp: %v\n", err)
+			return exitFailure
+		}
+		return exitOK
+	}
+	return cmd
+}
+
+func newDapCommand() *command {
+	cmd := newCommand("dap", "", "Run the debug adapter, for editors.")
+	cmd.detail = "The adapter speaks the Debug Adapter Protocol over standard input and\n" +
+		"output; editors start it and talk to it themselves. The program named by\n" +
+		"the launch request runs on the interpreter, with breakpoints on .chore\n" +
+		"lines, step over, into and out, the bindings of each scope, and a thread\n" +
+		"for every dancer. A paused channel shows the dancers waiting on it."
+	
+	cmd.run = func(ctx *context, args []string) int {
+		if len(args) != 0 {
+			fmt.Fprintf(ctx.stderr, "chorelang dap: unexpected arguments\n")
+			return exitUsage
+		}
+		if err := dap.Serve(ctx.stdin, ctx.stdout); err != nil {
+			fmt.Fprintf(ctx.stderr, "chorelang dap: %v\n", err)
+			return exitFailure
+		}
+		return exitOK
+	}
+	return cmd
+}
\ No newline at end of file
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	
+	"github.com/chorlang/chorlang/compiler/trace"
+)
+
+func newTraceCommand() *command {
+	cmd := newCommand("trace", "[flags] <file.trace>", "Draw a trace recorded by a program built with -trace.")
+	cmd.detail = "By default the trace is drawn as a Mermaid sequence diagram of the starts\n" +
+		"and messages that really happened, in the order they happened. -timeline\n" +
+		"lists every event instead, with its time, dancer and source position, and\n" +
+		"how long each channel operation was blocked. An -o file ending in .md gets\n" +
+		"a diagram in a mermaid code block."
+	output := cmd.flags.String("o", "", "write the output to this file instead of standard output")
+	timeline := cmd.flags.Bool("timeline", false, "list the events as a timeline instead of drawing a diagram")
+	
+	cmd.run = func(ctx *context, args []string) int {
+		if len(args) != 1 {
+			fmt.Fprintf(ctx.stderr, "chorelang trace: expected one trace file\nRun 'chorelang help trace' for usage.\n")
+			return exitUsage
+		}
+		file := args[0]
+		
+		f, err := os.Open(file)
+		if err != nil {
+			fmt.Fprintf(ctx.stderr, "Error reading %s: %v\n", file, err)
+			return exitFailure
+		}
+		defer f.Close()
+		events, err := trace.Read(f)
+		if err != nil {
+			fmt.Fprintf(ctx.stderr, "Error reading %s: %v\n", file, err)
+			return exitFailure
+		}
+		
+		if !*timeline {
+			return writeDiagram(ctx, *output, trace.Sequence(events))
+		}
+		if *output == "" {
+			fmt.Fprint(ctx.stdout, trace.Timeline(events))
+			return exitOK
+		}
+		if err := ioutil.WriteFile(*output, []byte(trace.Timeline(events)), 0644); err != nil {
+			fmt.Fprintf(ctx.stderr, "Error writing %s: %v\n", *output, err)
+			return exitFailure
+		}
+		return exitOK
+	}
+	return cmd
+}
\ No newline at end of file
@@ -22,6 +22,18 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+	
+	// Trivia maps nodes to their comments and blank lines. The parser
+	// fills it in; a program built by hand may leave it nil.
+	Trivia map[Node]*Trivia
+}
+
+// TriviaOf returns the trivia recorded for node, never nil.
+func (p *Program) TriviaOf(node Node) *Trivia {
+	if t, ok := p.Trivia[node]; ok {
+		return t
+	}
+	return &Trivia{}
 }
 
 func (p *Program) TokenLiteral() string {
@@ -92,9 +104,10 @@ func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
 func (b *Boolean) String() string       { return b.Token.Literal }
 
-// Dance Statement (variable declaration)
+// Dance Statement (variable declaration). Channel declarations written with
+// flow (`flow ch = flow channel<int>`) share this node with a FLOW token.
 type DanceStatement struct {
-	Token lexer.Token // the DANCE token
+	Token lexer.Token // the DANCE or FLOW token
 	Name  *Identifier
 	Value Expression
 }
@@ -115,6 +128,28 @@ func (ds *DanceStatement) String() string {
 	return out.String()
 }
 
+// Assign Statement (reassignment of an existing binding)
+type AssignStatement struct {
+	Token lexer.Token // the IDENT token
+	Name  *Identifier
+	Value Expression
+}
+
+func (as *AssignStatement) statementNode()       {}
+func (as *AssignStatement) TokenLiteral() string { return as.Token.Literal }
+func (as *AssignStatement) String() string {
+	var out bytes.Buffer
+	
+	out.WriteString(as.Name.String())
+	out.WriteString(" = ")
+	
+	if as.Value != nil {
+		out.WriteString(as.Value.String())
+	}
+	
+	return out.String()
+}
+
 // Expression Statement
 type ExpressionStatement struct {
 	Token      lexer.Token // the first token of the expression
@@ -180,6 +215,37 @@ func (se *SpinExpression) String() string {
 	return out.String()
 }
 
+// Member Call Expression (receiver.member(arguments)), a call of a member
+// of a library value such as chore or the file system chore.fs() returns
+type MemberCallExpression struct {
+	Token     lexer.Token // The . token
+	Receiver  Expression
+	Member    *Identifier
+	Arguments []Expression
+}
+
+func (mc *MemberCallExpression) expressionNode()      {}
+func (mc *MemberCallExpression) TokenLiteral() string { return mc.Token.Literal }
+func (mc *MemberCallExpression) String() string {
+	var out bytes.Buffer
+	
+	out.WriteString(mc.Receiver.String())
+	out.WriteString(".")
+	out.WriteString(mc.Member.String())
+	out.WriteString("(")
+	
+	for i, arg := range mc.Arguments {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(arg.String())
+	}
+	
+	out.WriteString(")")
+	
+	return out.String()
+}
+
 // Sway Statement (for loop)
 type SwayStatement struct {
 	Token    lexer.Token // The SWAY token
@@ -206,6 +272,46 @@ func (ss *SwayStatement) String() string {
 	return out.String()
 }
 
+// Rehearse Statement (a named test, run by chorelang test)
+type RehearseStatement struct {
+	Token lexer.Token // The REHEARSE token
+	Name  *StringLiteral
+	Body  *BlockStatement
+}
+
+func (rs *RehearseStatement) statementNode()       {}
+func (rs *RehearseStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *RehearseStatement) String() string {
+	var out bytes.Buffer
+	
+	out.WriteString(rs.TokenLiteral() + " ")
+	out.WriteString(rs.Name.String())
+	out.WriteString(" ")
+	out.WriteString(rs.Body.String())
+	
+	return out.String()
+}
+
+// Encore Statement (a named benchmark, run by chorelang bench)
+type EncoreStatement struct {
+	Token lexer.Token // The ENCORE token
+	Name  *StringLiteral
+	Body  *BlockStatement
+}
+
+func (es *EncoreStatement) statementNode()       {}
+func (es *EncoreStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *EncoreStatement) String() string {
+	var out bytes.Buffer
+	
+	out.WriteString(es.TokenLiteral() + " ")
+	out.WriteString(es.Name.String())
+	out.WriteString(" ")
+	out.WriteString(es.Body.String())
+	
+	return out.String()
+}
+
 // Block Statement
 type BlockStatement struct {
 	Token      lexer.Token // the { token
@@ -233,14 +339,30 @@ func (bs *BlockStatement) String() string {
 type FlowExpression struct {
 	Token       lexer.Token // The FLOW token
 	ChannelType Expression  // e.g., channel<int>
+	ElementType *Identifier // the int in channel<int>, nil if not given
 }
 
 func (fe *FlowExpression) expressionNode()      {}
 func (fe *FlowExpression) TokenLiteral() string { return fe.Token.Literal }
 func (fe *FlowExpression) String() string {
+	if fe.ElementType != nil {
+		return fe.TokenLiteral() + " " + fe.ChannelType.String() + "<" + fe.ElementType.String() + ">"
+	}
 	return fe.TokenLiteral() + " " + fe.ChannelType.String()
 }
 
+// Receive Expression (channel receive)
+type ReceiveExpression struct {
+	Token   lexer.Token // The <- token
+	Channel Expression
+}
+
+func (re *ReceiveExpression) expressionNode()      {}
+func (re *ReceiveExpression) TokenLiteral() string { return re.Token.Literal }
+func (re *ReceiveExpression) String() string {
+	return "<-" + re.Channel.String()
+}
+
 // Start Statement (goroutine)
 type StartStatement struct {
 	Token     lexer.Token // The START token
@@ -327,16 +449,28 @@ func (me *MatchExpression) String() string {
 
 // When Case (for pattern matching)
 type WhenCase struct {
-	Token      lexer.Token // The WHEN token
-	Pattern    Expression
+	Token       lexer.Token // The WHEN token
+	Pattern     Expression
+	Parameters  []*Identifier // the n in `when Note(n)`; nil without parentheses
 	Consequence Expression
 }
 
+func (wc *WhenCase) TokenLiteral() string { return wc.Token.Literal }
 func (wc *WhenCase) String() string {
 	var out bytes.Buffer
 	
 	out.WriteString(wc.Token.Literal + " ")
 	out.WriteString(wc.Pattern.String())
+	if wc.Parameters != nil {
+		out.WriteString("(")
+		for i, param := range wc.Parameters {
+			if i > 0 {
+				out.WriteString(", ")
+			}
+			out.WriteString(param.String())
+		}
+		out.WriteString(")")
+	}
 	out.WriteString(": ")
 	out.WriteString(wc.Consequence.String())
 	
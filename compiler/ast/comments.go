@@ -0,0 +1,34 @@
+package ast
+
+import "github.com/chorlang/chorlang/compiler/lexer"
+
+// Comment is a `//` comment. Text holds the slashes and the rest of the
+// line.
+type Comment struct {
+	Token lexer.Token // the COMMENT token
+	Text  string
+	
+	// BlankBefore reports whether a blank line came before the comment
+	BlankBefore bool
+}
+
+// Trivia is what the parser keeps of the source around a node beyond its
+// syntax, so a printer can write the source back with its comments:
+//
+//	// leading
+//	dance x = 1 // trailing
+//
+// Statements, when cases, blocks, matches and the program itself carry
+// trivia; comments inside an expression move to the statement holding it.
+type Trivia struct {
+	Leading  []*Comment // on their own lines before the node
+	Trailing *Comment   // at the end of the node's last line
+	
+	// Dangling are the comments of a block, match or program that follow
+	// its last statement or case
+	Dangling []*Comment
+	
+	// BlankBefore reports whether a blank line came directly before the
+	// node, after any leading comments
+	BlankBefore bool
+}
\ No newline at end of file
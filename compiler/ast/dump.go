@@ -0,0 +1,75 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Dump renders a node as an indented tree, one node per line, with its
+// scalar fields inline and the line:column of its token:
+//
+//	DanceStatement 1:1
+//	  Name: Identifier 1:7 Value="x"
+//	  Value: IntegerLiteral 1:11 Value=5
+func Dump(node Node) string {
+	var out bytes.Buffer
+	dumpNode(&out, "", 0, reflect.ValueOf(node))
+	return out.String()
+}
+
+func dumpNode(out *bytes.Buffer, label string, depth int, v reflect.Value) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return
+	}
+	
+	out.WriteString(strings.Repeat("  ", depth))
+	if label != "" {
+		out.WriteString(label + ": ")
+	}
+	
+	s := v
+	if s.Kind() == reflect.Ptr {
+		s = s.Elem()
+	}
+	out.WriteString(s.Type().Name())
+	
+	if tok := s.FieldByName("Token"); tok.IsValid() {
+		fmt.Fprintf(out, " %d:%d", tok.FieldByName("Line").Int(), tok.FieldByName("Column").Int())
+	}
+	
+	// Scalars first, on the node's own line
+	for i := 0; i < s.NumField(); i++ {
+		f := s.Field(i)
+		name := s.Type().Field(i).Name
+		switch f.Kind() {
+		case reflect.String:
+			fmt.Fprintf(out, " %s=%q", name, f.String())
+		case reflect.Int64, reflect.Float64, reflect.Bool:
+			fmt.Fprintf(out, " %s=%v", name, f.Interface())
+		}
+	}
+	out.WriteString("\n")
+	
+	for i := 0; i < s.NumField(); i++ {
+		f := s.Field(i)
+		name := s.Type().Field(i).Name
+		switch f.Kind() {
+		case reflect.Interface, reflect.Ptr:
+			dumpNode(out, name, depth+1, f)
+		case reflect.Slice:
+			for j := 0; j < f.Len(); j++ {
+				// A program's statements need no labels
+				label := fmt.Sprintf("%s[%d]", name, j)
+				if s.Type() == reflect.TypeOf(Program{}) {
+					label = ""
+				}
+				dumpNode(out, label, depth+1, f.Index(j))
+			}
+		}
+	}
+}
\ No newline at end of file
@@ -0,0 +1,36 @@
+package ast
+
+import (
+	"testing"
+	
+	"github.com/chorlang/chorlang/compiler/lexer"
+)
+
+func TestDump(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&DanceStatement{
+				Token: lexer.Token{Type: lexer.DANCE, Literal: "dance", Line: 1, Column: 1},
+				Name:  &Identifier{Token: lexer.Token{Type: lexer.IDENT, Literal: "x", Line: 1, Column: 7}, Value: "x"},
+				Value: &InfixExpression{
+					Token:    lexer.Token{Type: lexer.PLUS, Literal: "+", Line: 1, Column: 13},
+					Left:     &IntegerLiteral{Token: lexer.Token{Type: lexer.INT, Literal: "1", Line: 1, Column: 11}, Value: 1},
+					Operator: "+",
+					Right:    &StringLiteral{Token: lexer.Token{Type: lexer.STRING, Literal: "a", Line: 1, Column: 15}, Value: "a"},
+				},
+			},
+		},
+	}
+	
+	expected := `Program
+  DanceStatement 1:1
+    Name: Identifier 1:7 Value="x"
+    Value: InfixExpression 1:13 Operator="+"
+      Left: IntegerLiteral 1:11 Value=1
+      Right: StringLiteral 1:15 Value="a"
+`
+	
+	if got := Dump(program); got != expected {
+		t.Errorf("Dump wrong.\nwant:\n%s\ngot:\n%s", expected, got)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,130 @@
+package ast
+
+// A Visitor's Visit method is called for each node found by Walk. If it
+// returns a non-nil Visitor w, Walk visits each child of the node with w,
+// then calls w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree below node in depth-first, source order, as
+// go/ast.Walk does. Match cases are visited as *WhenCase nodes.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	
+	switch n := node.(type) {
+	case *Program:
+		for _, stmt := range n.Statements {
+			Walk(v, stmt)
+		}
+	case *DanceStatement:
+		walkIdent(v, n.Name)
+		walkExpr(v, n.Value)
+	case *AssignStatement:
+		walkIdent(v, n.Name)
+		walkExpr(v, n.Value)
+	case *ExpressionStatement:
+		walkExpr(v, n.Expression)
+	case *SwayStatement:
+		walkIdent(v, n.Variable)
+		walkExpr(v, n.From)
+		walkExpr(v, n.To)
+		walkBlock(v, n.Body)
+	case *BlockStatement:
+		for _, stmt := range n.Statements {
+			Walk(v, stmt)
+		}
+	case *StartStatement:
+		if n.Statement != nil {
+			Walk(v, n.Statement)
+		}
+	case *SendStatement:
+		walkExpr(v, n.Channel)
+		walkExpr(v, n.Value)
+	case *IfStatement:
+		walkExpr(v, n.Condition)
+		walkBlock(v, n.Consequence)
+		walkBlock(v, n.Alternative)
+	case *RehearseStatement:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		walkBlock(v, n.Body)
+	case *EncoreStatement:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		walkBlock(v, n.Body)
+	case *InfixExpression:
+		walkExpr(v, n.Left)
+		walkExpr(v, n.Right)
+	case *SpinExpression:
+		walkExpr(v, n.Function)
+		for _, arg := range n.Arguments {
+			walkExpr(v, arg)
+		}
+	case *MemberCallExpression:
+		walkExpr(v, n.Receiver)
+		walkIdent(v, n.Member)
+		for _, arg := range n.Arguments {
+			walkExpr(v, arg)
+		}
+	case *FlowExpression:
+		walkExpr(v, n.ChannelType)
+		walkIdent(v, n.ElementType)
+	case *ReceiveExpression:
+		walkExpr(v, n.Channel)
+	case *MatchExpression:
+		walkExpr(v, n.Expression)
+		for _, c := range n.Cases {
+			Walk(v, c)
+		}
+	case *WhenCase:
+		walkExpr(v, n.Pattern)
+		for _, param := range n.Parameters {
+			walkIdent(v, param)
+		}
+		walkExpr(v, n.Consequence)
+	}
+	
+	v.Visit(nil)
+}
+
+// The parser leaves fields nil after a syntax error, and a nil pointer in
+// an interface is not a nil interface, so children are checked by type.
+
+func walkIdent(v Visitor, ident *Identifier) {
+	if ident != nil {
+		Walk(v, ident)
+	}
+}
+
+func walkBlock(v Visitor, block *BlockStatement) {
+	if block != nil {
+		Walk(v, block)
+	}
+}
+
+func walkExpr(v Visitor, exp Expression) {
+	if exp != nil {
+		Walk(v, exp)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree below node, calling f for each node and then
+// f(nil) once its children are done. If f returns false, the node's
+// children are skipped.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
\ No newline at end of file
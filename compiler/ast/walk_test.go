@@ -0,0 +1,80 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	
+	"github.com/chorlang/chorlang/compiler/lexer"
+)
+
+func TestInspect(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: lexer.Token{Type: lexer.IDENT, Literal: name}, Value: name}
+	}
+	
+	// sway i from 0 to n { send ch <- i }
+	// if true { spin print(x) }
+	program := &Program{
+		Statements: []Statement{
+			&SwayStatement{
+				Variable: ident("i"),
+				From:     &IntegerLiteral{Value: 0},
+				To:       ident("n"),
+				Body: &BlockStatement{Statements: []Statement{
+					&SendStatement{Channel: ident("ch"), Value: ident("i")},
+				}},
+			},
+			&IfStatement{
+				Condition: &Boolean{Value: true},
+				Consequence: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: &SpinExpression{Function: ident("print"), Arguments: []Expression{ident("x")}}},
+				}},
+			},
+		},
+	}
+	
+	var visited []string
+	Inspect(program, func(node Node) bool {
+		if node == nil {
+			visited = append(visited, "end")
+			return true
+		}
+		name := fmt.Sprintf("%T", node)[len("*ast."):]
+		if ident, ok := node.(*Identifier); ok {
+			name += " " + ident.Value
+		}
+		visited = append(visited, name)
+		return true
+	})
+	
+	expected := "Program SwayStatement Identifier i end IntegerLiteral end Identifier n end " +
+		"BlockStatement SendStatement Identifier ch end Identifier i end end end end " +
+		"IfStatement Boolean end BlockStatement ExpressionStatement SpinExpression " +
+		"Identifier print end Identifier x end end end end end end"
+	if got := strings.Join(visited, " "); got != expected {
+		t.Errorf("visit order wrong.\nwant: %s\ngot:  %s", expected, got)
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&StartStatement{Statement: &ExpressionStatement{Expression: &Identifier{Value: "hidden"}}},
+			&ExpressionStatement{Expression: &Identifier{Value: "seen"}},
+		},
+	}
+	
+	var idents []string
+	Inspect(program, func(node Node) bool {
+		if ident, ok := node.(*Identifier); ok {
+			idents = append(idents, ident.Value)
+		}
+		_, isStart := node.(*StartStatement)
+		return !isStart
+	})
+	
+	if len(idents) != 1 || idents[0] != "seen" {
+		t.Errorf("expected only %q, got %v", "seen", idents)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,191 @@
+// Package bench measures the encore blocks of ChoreLang files:
+//
+//	encore "doubles through a dancer" {
+//	    send numbers <- 21
+//	    dance n = <-doubled
+//	}
+//
+// The code generator turns each encore into a Go testing.B benchmark; this
+// package reads what go test reports for them, and compares the results with
+// a baseline saved from an earlier run.
+package bench
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/codegen"
+)
+
+// Encore is an encore block, named as the source writes it.
+type Encore struct {
+	Name         string
+	Line, Column int
+}
+
+// List returns the encores of a program in source order. The i'th one is
+// benchmarked as codegen.BenchmarkName(i).
+func List(program *ast.Program) []Encore {
+	var list []Encore
+	for _, stmt := range program.Statements {
+		if e, ok := stmt.(*ast.EncoreStatement); ok {
+			list = append(list, Encore{Name: e.Name.Value, Line: e.Token.Line, Column: e.Token.Column})
+		}
+	}
+	return list
+}
+
+// Pattern returns the go test -bench pattern for the encores whose names
+// match run, or "" if none do. A nil run matches every encore.
+func Pattern(encores []Encore, run *regexp.Regexp) string {
+	var names []string
+	for i, e := range encores {
+		if run == nil || run.MatchString(e.Name) {
+			names = append(names, codegen.BenchmarkName(i))
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return "^(" + strings.Join(names, "|") + ")$"
+}
+
+// Result is the measurement of one encore.
+type Result struct {
+	File         string  `json:"file"`
+	Name         string  `json:"name"`
+	Runs         int     `json:"runs"`
+	NsPerOp      float64 `json:"nsPerOp"`
+	BytesPerOp   float64 `json:"bytesPerOp"`
+	AllocsPerOp  float64 `json:"allocsPerOp"`
+	DancersPerOp float64 `json:"dancersPerOp"`
+}
+
+// benchLine matches a result line of go test -bench: the name, with the
+// GOMAXPROCS suffix go test adds when it is above one, the number of runs,
+// and the measurements.
+var benchLine = regexp.MustCompile(`^(BenchmarkEncore\d+)(?:-\d+)?\s+(\d+)\s+(.*)$`)
+
+// Parse reads the output of go test -bench -benchmem for the benchmarks
+// generated from the encores of file. Lines other than results are skipped.
+func Parse(r io.Reader, file string, encores []Encore) ([]Result, error) {
+	names := make(map[string]string)
+	for i, e := range encores {
+		names[codegen.BenchmarkName(i)] = e.Name
+	}
+	
+	var results []Result
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		m := benchLine.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		name, ok := names[m[1]]
+		if !ok {
+			return nil, fmt.Errorf("result for unknown benchmark %s", m[1])
+		}
+		result := Result{File: file, Name: name}
+		result.Runs, _ = strconv.Atoi(m[2])
+		
+		// Measurements come as value-unit pairs separated by tabs
+		fields := strings.Fields(m[3])
+		for i := 0; i+1 < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: bad measurement %q", m[1], fields[i])
+			}
+			switch fields[i+1] {
+			case "ns/op":
+				result.NsPerOp = value
+			case "B/op":
+				result.BytesPerOp = value
+			case "allocs/op":
+				result.AllocsPerOp = value
+			case codegen.DancersMetric:
+				result.DancersPerOp = value
+			}
+		}
+		results = append(results, result)
+	}
+	return results, scanner.Err()
+}
+
+// ReadBaseline reads results saved by WriteBaseline.
+func ReadBaseline(r io.Reader) ([]Result, error) {
+	var results []Result
+	if err := json.NewDecoder(r).Decode(&results); err != nil {
+		return nil, fmt.Errorf("reading baseline: %v", err)
+	}
+	return results, nil
+}
+
+// WriteBaseline saves results as JSON, sorted by file and name so that
+// baselines diff well.
+func WriteBaseline(w io.Writer, results []Result) error {
+	sorted := append([]Result(nil), results...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].File != sorted[j].File {
+			return sorted[i].File < sorted[j].File
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sorted)
+}
+
+// Comparison is a result set against its baseline.
+type Comparison struct {
+	Result
+	Baseline *Result // nil if the baseline does not have the encore
+	
+	// Relative changes from the baseline: 0.1 is 10% slower or more
+	// allocations. A measurement that was zero and is no longer changes
+	// by +Inf.
+	Time, Allocs float64
+	
+	// Regressed is set when either change is above the threshold.
+	Regressed bool
+}
+
+// Compare matches results with the baseline by file and name. A result
+// regresses when its time or allocations per run grew by more than the
+// threshold, a fraction such as 0.1 for 10%.
+func Compare(baseline, results []Result, threshold float64) []Comparison {
+	type key struct{ file, name string }
+	base := make(map[key]*Result)
+	for i := range baseline {
+		base[key{baseline[i].File, baseline[i].Name}] = &baseline[i]
+	}
+	
+	comparisons := make([]Comparison, len(results))
+	for i, r := range results {
+		c := Comparison{Result: r, Baseline: base[key{r.File, r.Name}]}
+		if c.Baseline != nil {
+			c.Time = change(c.Baseline.NsPerOp, r.NsPerOp)
+			c.Allocs = change(c.Baseline.AllocsPerOp, r.AllocsPerOp)
+			c.Regressed = c.Time > threshold || c.Allocs > threshold
+		}
+		comparisons[i] = c
+	}
+	return comparisons
+}
+
+func change(from, to float64) float64 {
+	if from == 0 {
+		if to == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return (to - from) / from
+}
\ No newline at end of file
@@ -0,0 +1,123 @@
+package bench
+
+import (
+	"bytes"
+	"math"
+	"regexp"
+	"strings"
+	"testing"
+	
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/parser"
+)
+
+var encores = []Encore{{Name: "sums"}, {Name: "pings"}, {Name: "sorts"}}
+
+func TestList(t *testing.T) {
+	p := parser.New(lexer.New("dance x = 1\nencore \"sums\" {\n}\nrehearse \"r\" {\n}\nencore \"pings\" {\n}\n"))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parser errors: %v", p.Errors())
+	}
+	
+	list := List(program)
+	if len(list) != 2 || list[0] != (Encore{Name: "sums", Line: 2, Column: 1}) || list[1].Name != "pings" {
+		t.Errorf("encores listed wrong: %+v", list)
+	}
+}
+
+func TestPattern(t *testing.T) {
+	if got := Pattern(encores, nil); got != "^(BenchmarkEncore1|BenchmarkEncore2|BenchmarkEncore3)$" {
+		t.Errorf("all encores: got %q", got)
+	}
+	if got := Pattern(encores, regexp.MustCompile("s$")); got != "^(BenchmarkEncore1|BenchmarkEncore2|BenchmarkEncore3)$" {
+		t.Errorf("matching all: got %q", got)
+	}
+	if got := Pattern(encores, regexp.MustCompile("^p")); got != "^(BenchmarkEncore2)$" {
+		t.Errorf("matching one: got %q", got)
+	}
+	if got := Pattern(encores, regexp.MustCompile("none")); got != "" {
+		t.Errorf("matching none: got %q", got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	output := `goos: linux
+goarch: amd64
+BenchmarkEncore1-8   	 1000000	      1043 ns/op	         0 dancers/op	      16 B/op	       1 allocs/op
+setup
+BenchmarkEncore3 	     200	   5211.5 ns/op	         2.500 dancers/op	    4096 B/op	      12 allocs/op
+PASS
+ok  	command-line-arguments	2.345s
+`
+	results, err := Parse(strings.NewReader(output), "a_test.chore", encores)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Result{
+		{File: "a_test.chore", Name: "sums", Runs: 1000000, NsPerOp: 1043, BytesPerOp: 16, AllocsPerOp: 1},
+		{File: "a_test.chore", Name: "sorts", Runs: 200, NsPerOp: 5211.5, BytesPerOp: 4096, AllocsPerOp: 12, DancersPerOp: 2.5},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results, got %+v", len(expected), results)
+	}
+	for i := range expected {
+		if results[i] != expected[i] {
+			t.Errorf("result %d: expected %+v, got %+v", i, expected[i], results[i])
+		}
+	}
+	
+	if _, err := Parse(strings.NewReader("BenchmarkEncore9 1 1 ns/op\n"), "a_test.chore", encores); err == nil {
+		t.Error("expected an error for an unknown benchmark")
+	}
+}
+
+func TestBaselineRoundTrip(t *testing.T) {
+	results := []Result{
+		{File: "b_test.chore", Name: "x", Runs: 10, NsPerOp: 5},
+		{File: "a_test.chore", Name: "y", Runs: 20, NsPerOp: 7, AllocsPerOp: 1},
+	}
+	var buf bytes.Buffer
+	if err := WriteBaseline(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadBaseline(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 2 || read[0] != results[1] || read[1] != results[0] {
+		t.Errorf("baseline not sorted by file: %+v", read)
+	}
+	
+	if _, err := ReadBaseline(strings.NewReader("{")); err == nil || !strings.HasPrefix(err.Error(), "reading baseline: ") {
+		t.Errorf("expected a baseline error, got %v", err)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	baseline := []Result{
+		{File: "a", Name: "steady", NsPerOp: 100, AllocsPerOp: 2},
+		{File: "a", Name: "slower", NsPerOp: 100, AllocsPerOp: 2},
+		{File: "a", Name: "allocates", NsPerOp: 100, AllocsPerOp: 0},
+	}
+	results := []Result{
+		{File: "a", Name: "steady", NsPerOp: 105, AllocsPerOp: 2},
+		{File: "a", Name: "slower", NsPerOp: 150, AllocsPerOp: 1},
+		{File: "a", Name: "allocates", NsPerOp: 90, AllocsPerOp: 1},
+		{File: "b", Name: "steady", NsPerOp: 1000},
+	}
+	c := Compare(baseline, results, 0.1)
+	
+	if c[0].Regressed || math.Abs(c[0].Time-0.05) > 1e-9 || c[0].Allocs != 0 {
+		t.Errorf("steady: %+v", c[0])
+	}
+	if !c[1].Regressed || math.Abs(c[1].Time-0.5) > 1e-9 || c[1].Allocs != -0.5 {
+		t.Errorf("slower: %+v", c[1])
+	}
+	if !c[2].Regressed || !math.IsInf(c[2].Allocs, 1) {
+		t.Errorf("allocates: %+v", c[2])
+	}
+	if c[3].Baseline != nil || c[3].Regressed {
+		t.Errorf("a result of another file matched the baseline: %+v", c[3])
+	}
+}
\ No newline at end of file
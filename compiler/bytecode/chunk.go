@@ -0,0 +1,105 @@
+package bytecode
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Chunk is a compiled ChoreLang program.
+type Chunk struct {
+	Code      []byte
+	Constants []interface{} // int64, float64 or string
+	
+	// Slots names every variable slot, in the order the compiler allocated
+	// them. Each `dance`, `flow` and `sway` variable gets its own slot.
+	Slots []string
+	
+	// Positions maps instruction offsets back to the source. An entry
+	// covers every instruction from its offset up to the next entry.
+	Positions []Position
+}
+
+// Position is the source location of the instructions starting at Offset.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// PositionOf returns the source position of the instruction at offset.
+func (c *Chunk) PositionOf(offset int) (line, column int) {
+	i := sort.Search(len(c.Positions), func(i int) bool {
+		return c.Positions[i].Offset > offset
+	})
+	if i == 0 {
+		return 0, 0
+	}
+	p := c.Positions[i-1]
+	return p.Line, p.Column
+}
+
+// Validate checks that every instruction decodes and that its operands
+// name existing constants, slots and instruction boundaries, so a VM can
+// run the chunk without bounds checks on them.
+func (c *Chunk) Validate() error {
+	starts := make(map[int]bool)
+	type target struct{ from, to int }
+	var targets []target
+	
+	for offset := 0; offset < len(c.Code); {
+		starts[offset] = true
+		op := Opcode(c.Code[offset])
+		def, err := Lookup(op)
+		if err != nil {
+			return fmt.Errorf("offset %d: %v", offset, err)
+		}
+		
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if offset+1+width > len(c.Code) {
+			return fmt.Errorf("offset %d: truncated %s", offset, def.Name)
+		}
+		
+		operands, read := ReadOperands(def, c.Code[offset+1:])
+		switch op {
+		case OpConstant:
+			if operands[0] >= len(c.Constants) {
+				return fmt.Errorf("offset %d: constant %d out of range", offset, operands[0])
+			}
+		case OpChannel:
+			if operands[0] >= len(c.Constants) {
+				return fmt.Errorf("offset %d: constant %d out of range", offset, operands[0])
+			}
+			if _, ok := c.Constants[operands[0]].(string); !ok {
+				return fmt.Errorf("offset %d: channel element type is not a string", offset)
+			}
+		case OpMember:
+			if operands[0] >= len(c.Constants) {
+				return fmt.Errorf("offset %d: constant %d out of range", offset, operands[0])
+			}
+			if _, ok := c.Constants[operands[0]].(string); !ok {
+				return fmt.Errorf("offset %d: member name is not a string", offset)
+			}
+		case OpGet, OpSet:
+			if operands[0] >= len(c.Slots) {
+				return fmt.Errorf("offset %d: slot %d out of range", offset, operands[0])
+			}
+		case OpJump, OpJumpIfFalse, OpStart:
+			targets = append(targets, target{offset, operands[0]})
+		}
+		offset += 1 + read
+	}
+	
+	for _, t := range targets {
+		if !starts[t.to] {
+			return fmt.Errorf("offset %d: jump to %d is not an instruction", t.from, t.to)
+		}
+	}
+	
+	if len(c.Code) == 0 || Opcode(c.Code[len(c.Code)-1]) != OpEnd {
+		return fmt.Errorf("code does not end with END")
+	}
+	return nil
+}
\ No newline at end of file
@@ -0,0 +1,341 @@
+package bytecode
+
+import (
+	"fmt"
+	"strings"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/fs"
+	"github.com/chorlang/chorlang/compiler/lexer"
+)
+
+// builtin describes a function `spin` can call.
+type builtin struct {
+	op      Opcode
+	minArgs int
+	maxArgs int    // -1 for any number
+	arity   string // the accepted arguments, for errors
+}
+
+var builtins = map[string]builtin{
+	"print":   {op: OpPrint, maxArgs: -1},
+	"println": {op: OpPrint, maxArgs: -1},
+	"args":    {op: OpArgs, maxArgs: 1, arity: "at most 1 argument"},
+	"exit":    {op: OpExit, minArgs: 1, maxArgs: 1, arity: "1 argument"},
+}
+
+// scope maps the names declared in one block to their slots.
+type scope struct {
+	outer *scope
+	slots map[string]int
+}
+
+func (s *scope) lookup(name string) (int, bool) {
+	for cur := s; cur != nil; cur = cur.outer {
+		if slot, ok := cur.slots[name]; ok {
+			return slot, true
+		}
+	}
+	return 0, false
+}
+
+type Compiler struct {
+	chunk     *Chunk
+	constants map[interface{}]int
+	scope     *scope
+	errors    []string
+}
+
+func NewCompiler() *Compiler {
+	return &Compiler{
+		chunk:     &Chunk{Constants: []interface{}{}, Slots: []string{}},
+		constants: make(map[interface{}]int),
+		scope:     &scope{slots: make(map[string]int)},
+		errors:    []string{},
+	}
+}
+
+// Compile translates program to bytecode. The program should already have
+// passed the resolver; Compile reports only what it cannot translate.
+func Compile(program *ast.Program) (*Chunk, error) {
+	c := NewCompiler()
+	for _, stmt := range program.Statements {
+		c.compileStatement(stmt)
+	}
+	c.emit(lexer.Token{}, OpEnd)
+	
+	if len(c.errors) > 0 {
+		return nil, fmt.Errorf("compilation errors: %s", strings.Join(c.errors, "; "))
+	}
+	return c.chunk, nil
+}
+
+func (c *Compiler) compileStatement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.DanceStatement:
+		// The value is compiled first so `dance x = x + 1` in an inner
+		// block reads the outer x.
+		c.compileExpression(s.Value)
+		c.emit(s.Name.Token, OpSet, c.declare(s.Name.Value))
+	case *ast.AssignStatement:
+		c.compileExpression(s.Value)
+		slot, ok := c.scope.lookup(s.Name.Value)
+		if !ok {
+			c.errorf(s.Name.Token, "undefined: %s", s.Name.Value)
+			return
+		}
+		c.emit(s.Name.Token, OpSet, slot)
+	case *ast.ExpressionStatement:
+		c.compileExpression(s.Expression)
+		c.emit(s.Token, OpPop)
+	case *ast.SwayStatement:
+		c.compileSway(s)
+	case *ast.StartStatement:
+		// The dancer's code follows START; the launching dancer skips it
+		start := c.emit(s.Token, OpStart, 0)
+		c.pushScope()
+		c.compileStatement(s.Statement)
+		c.popScope()
+		c.emit(s.Token, OpEnd)
+		c.patch(start, len(c.chunk.Code))
+	case *ast.SendStatement:
+		c.compileExpression(s.Channel)
+		c.compileExpression(s.Value)
+		c.emit(s.Token, OpSend)
+	case *ast.IfStatement:
+		c.compileExpression(s.Condition)
+		jumpElse := c.emit(s.Token, OpJumpIfFalse, 0)
+		c.compileBlock(s.Consequence)
+		if s.Alternative == nil {
+			c.patch(jumpElse, len(c.chunk.Code))
+			return
+		}
+		jumpEnd := c.emit(s.Token, OpJump, 0)
+		c.patch(jumpElse, len(c.chunk.Code))
+		c.compileBlock(s.Alternative)
+		c.patch(jumpEnd, len(c.chunk.Code))
+	case *ast.RehearseStatement:
+		// Rehearsals only run under chorelang test
+	case *ast.EncoreStatement:
+		// Encores only run under chorelang bench
+	case *ast.BlockStatement:
+		c.compileBlock(s)
+	default:
+		c.errors = append(c.errors, fmt.Sprintf("unknown statement type: %T", stmt))
+	}
+}
+
+func (c *Compiler) compileBlock(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	
+	c.pushScope()
+	for _, stmt := range block.Statements {
+		c.compileStatement(stmt)
+	}
+	c.popScope()
+}
+
+// compileSway emits `for i := from; i <= to; i++`. Like the generated Go,
+// the upper bound is evaluated before every iteration.
+func (c *Compiler) compileSway(s *ast.SwayStatement) {
+	c.compileExpression(s.From)
+	
+	c.pushScope()
+	slot := c.declare(s.Variable.Value)
+	c.emit(s.Variable.Token, OpSet, slot)
+	
+	loop := len(c.chunk.Code)
+	c.emit(s.Token, OpGet, slot)
+	c.compileExpression(s.To)
+	c.emit(s.Token, OpLessEqual)
+	exit := c.emit(s.Token, OpJumpIfFalse, 0)
+	
+	c.compileBlock(s.Body)
+	
+	c.emit(s.Token, OpGet, slot)
+	c.emit(s.Token, OpConstant, c.constant(int64(1)))
+	c.emit(s.Token, OpAdd)
+	c.emit(s.Token, OpSet, slot)
+	c.emit(s.Token, OpJump, loop)
+	c.patch(exit, len(c.chunk.Code))
+	c.popScope()
+}
+
+func (c *Compiler) compileExpression(exp ast.Expression) {
+	switch e := exp.(type) {
+	case *ast.Identifier:
+		slot, ok := c.scope.lookup(e.Value)
+		if !ok {
+			c.errorf(e.Token, "undefined: %s", e.Value)
+			return
+		}
+		c.emit(e.Token, OpGet, slot)
+	case *ast.IntegerLiteral:
+		c.emit(e.Token, OpConstant, c.constant(e.Value))
+	case *ast.FloatLiteral:
+		c.emit(e.Token, OpConstant, c.constant(e.Value))
+	case *ast.StringLiteral:
+		c.emit(e.Token, OpConstant, c.constant(lexer.Unquote(e.Value)))
+	case *ast.Boolean:
+		if e.Value {
+			c.emit(e.Token, OpTrue)
+		} else {
+			c.emit(e.Token, OpFalse)
+		}
+	case *ast.InfixExpression:
+		op, ok := binaryOps[e.Operator]
+		if !ok {
+			c.errorf(e.Token, "unknown operator: %s", e.Operator)
+			return
+		}
+		c.compileExpression(e.Left)
+		c.compileExpression(e.Right)
+		c.emit(e.Token, op)
+	case *ast.SpinExpression:
+		ident, ok := e.Function.(*ast.Identifier)
+		if !ok {
+			c.errorf(e.Token, "cannot call %s", e.Function.String())
+			return
+		}
+		fn, ok := builtins[ident.Value]
+		if !ok {
+			c.errorf(ident.Token, "undefined function: %s", ident.Value)
+			return
+		}
+		count := len(e.Arguments)
+		if count < fn.minArgs || fn.maxArgs >= 0 && count > fn.maxArgs {
+			c.errorf(ident.Token, "%s takes %s, got %d", ident.Value, fn.arity, count)
+			return
+		}
+		for _, arg := range e.Arguments {
+			c.compileExpression(arg)
+		}
+		if fn.op == OpExit {
+			c.emit(ident.Token, fn.op)
+		} else {
+			c.emit(ident.Token, fn.op, count)
+		}
+	case *ast.MemberCallExpression:
+		c.compileMember(e)
+	case *ast.FlowExpression:
+		ident, ok := e.ChannelType.(*ast.Identifier)
+		if !ok || ident.Value != "channel" {
+			c.errorf(e.Token, "flow needs a channel type such as channel<int>")
+			return
+		}
+		elem := ""
+		if e.ElementType != nil {
+			elem = e.ElementType.Value
+		}
+		c.emit(e.Token, OpChannel, c.constant(elem))
+	case *ast.ReceiveExpression:
+		c.compileExpression(e.Channel)
+		c.emit(e.Token, OpReceive)
+	case *ast.MatchExpression:
+		c.compileMatch(e)
+	default:
+		c.errors = append(c.errors, fmt.Sprintf("unknown expression type: %T", exp))
+	}
+}
+
+// compileMember calls a member of the receiver, or opens the file system
+// for chore.fs() when the program declares no chore of its own.
+func (c *Compiler) compileMember(e *ast.MemberCallExpression) {
+	if ident, ok := e.Receiver.(*ast.Identifier); ok && ident.Value == "chore" {
+		if _, declared := c.scope.lookup(ident.Value); !declared {
+			if err := fs.CheckOpen(e.Member.Value, len(e.Arguments)); err != nil {
+				c.errorf(e.Member.Token, "%s", err)
+				return
+			}
+			c.emit(e.Member.Token, OpFS)
+			return
+		}
+	}
+	
+	c.compileExpression(e.Receiver)
+	for _, arg := range e.Arguments {
+		c.compileExpression(arg)
+	}
+	c.emit(e.Member.Token, OpMember, c.constant(e.Member.Value), len(e.Arguments))
+}
+
+// compileMatch keeps the subject on the stack while the cases compare
+// against it, and leaves the chosen value, or nothing, in its place.
+func (c *Compiler) compileMatch(e *ast.MatchExpression) {
+	c.compileExpression(e.Expression)
+	
+	var ends []int
+	for _, wc := range e.Cases {
+		c.emit(wc.Token, OpDup)
+		c.compileExpression(wc.Pattern)
+		c.emit(wc.Token, OpEqual)
+		next := c.emit(wc.Token, OpJumpIfFalse, 0)
+		
+		c.emit(wc.Token, OpPop)
+		// In a case, `flow value` yields the value rather than a channel
+		consequence := wc.Consequence
+		if flow, ok := consequence.(*ast.FlowExpression); ok && flow.ElementType == nil {
+			consequence = flow.ChannelType
+		}
+		c.compileExpression(consequence)
+		ends = append(ends, c.emit(wc.Token, OpJump, 0))
+		
+		c.patch(next, len(c.chunk.Code))
+	}
+	
+	c.emit(e.Token, OpPop)
+	c.emit(e.Token, OpNil)
+	for _, end := range ends {
+		c.patch(end, len(c.chunk.Code))
+	}
+}
+
+// emit appends an instruction positioned at tok and returns its offset.
+func (c *Compiler) emit(tok lexer.Token, op Opcode, operands ...int) int {
+	offset := len(c.chunk.Code)
+	
+	positions := c.chunk.Positions
+	if n := len(positions); n == 0 || positions[n-1].Line != tok.Line || positions[n-1].Column != tok.Column {
+		c.chunk.Positions = append(positions, Position{Offset: offset, Line: tok.Line, Column: tok.Column})
+	}
+	
+	c.chunk.Code = append(c.chunk.Code, Make(op, operands...)...)
+	return offset
+}
+
+// patch rewrites the address operand of the jump or start at offset.
+func (c *Compiler) patch(offset, address int) {
+	op := Opcode(c.chunk.Code[offset])
+	copy(c.chunk.Code[offset:], Make(op, address))
+}
+
+func (c *Compiler) constant(v interface{}) int {
+	if index, ok := c.constants[v]; ok {
+		return index
+	}
+	index := len(c.chunk.Constants)
+	c.chunk.Constants = append(c.chunk.Constants, v)
+	c.constants[v] = index
+	return index
+}
+
+func (c *Compiler) declare(name string) int {
+	slot := len(c.chunk.Slots)
+	c.chunk.Slots = append(c.chunk.Slots, name)
+	c.scope.slots[name] = slot
+	return slot
+}
+
+func (c *Compiler) pushScope() {
+	c.scope = &scope{outer: c.scope, slots: make(map[string]int)}
+}
+
+func (c *Compiler) popScope() {
+	c.scope = c.scope.outer
+}
+
+func (c *Compiler) errorf(tok lexer.Token, format string, args ...interface{}) {
+	c.errors = append(c.errors, fmt.Sprintf("%d:%d: ", tok.Line, tok.Column)+fmt.Sprintf(format, args...))
+}
\ No newline at end of file
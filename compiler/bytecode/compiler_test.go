@@ -0,0 +1,255 @@
+package bytecode
+
+import (
+	"strings"
+	"testing"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/parser"
+)
+
+type compilerTestCase struct {
+	input             string
+	expectedConstants []interface{}
+	expectedCode      [][]byte
+}
+
+func TestCompileExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "dance x = 1 + 2.5",
+			expectedConstants: []interface{}{int64(1), 2.5},
+			expectedCode: [][]byte{
+				Make(OpConstant, 0),
+				Make(OpConstant, 1),
+				Make(OpAdd),
+				Make(OpSet, 0),
+				Make(OpEnd),
+			},
+		},
+		{
+			input:             "dance a = \"x\"\ndance b = \"x\"\na = b =~ a",
+			expectedConstants: []interface{}{"x"},
+			expectedCode: [][]byte{
+				Make(OpConstant, 0),
+				Make(OpSet, 0),
+				Make(OpConstant, 0),
+				Make(OpSet, 1),
+				Make(OpGet, 1),
+				Make(OpGet, 0),
+				Make(OpMatch),
+				Make(OpSet, 0),
+				Make(OpEnd),
+			},
+		},
+		{
+			input:             `spin print("a\tb", true)`,
+			expectedConstants: []interface{}{"a\tb"},
+			expectedCode: [][]byte{
+				Make(OpConstant, 0),
+				Make(OpTrue),
+				Make(OpPrint, 2),
+				Make(OpPop),
+				Make(OpEnd),
+			},
+		},
+	}
+	
+	runCompilerTests(t, tests)
+}
+
+func TestCompileControlFlow(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if true { spin print(1) } else { spin print(2) }",
+			expectedConstants: []interface{}{int64(1), int64(2)},
+			expectedCode: [][]byte{
+				Make(OpTrue),            // 0000
+				Make(OpJumpIfFalse, 18), // 0001
+				Make(OpConstant, 0),     // 0006
+				Make(OpPrint, 1),        // 0009
+				Make(OpPop),             // 0012
+				Make(OpJump, 25),        // 0013
+				Make(OpConstant, 1),     // 0018
+				Make(OpPrint, 1),        // 0021
+				Make(OpPop),             // 0024
+				Make(OpEnd),             // 0025
+			},
+		},
+		{
+			input:             "sway i from 1 to 3 { }",
+			expectedConstants: []interface{}{int64(1), int64(3)},
+			expectedCode: [][]byte{
+				Make(OpConstant, 0),     // 0000
+				Make(OpSet, 0),          // 0003
+				Make(OpGet, 0),          // 0006
+				Make(OpConstant, 1),     // 0009
+				Make(OpLessEqual),       // 0012
+				Make(OpJumpIfFalse, 33), // 0013
+				Make(OpGet, 0),          // 0018
+				Make(OpConstant, 0),     // 0021
+				Make(OpAdd),             // 0024
+				Make(OpSet, 0),          // 0025
+				Make(OpJump, 6),         // 0028
+				Make(OpEnd),             // 0033
+			},
+		},
+		{
+			input:             "dance r = match 1 {\n when 1: flow \"one\"\n}",
+			expectedConstants: []interface{}{int64(1), "one"},
+			expectedCode: [][]byte{
+				Make(OpConstant, 0),     // 0000
+				Make(OpDup),             // 0003
+				Make(OpConstant, 0),     // 0004
+				Make(OpEqual),           // 0007
+				Make(OpJumpIfFalse, 22), // 0008
+				Make(OpPop),             // 0013
+				Make(OpConstant, 1),     // 0014
+				Make(OpJump, 24),        // 0017
+				Make(OpPop),             // 0022
+				Make(OpNil),             // 0023
+				Make(OpSet, 0),          // 0024
+				Make(OpEnd),             // 0027
+			},
+		},
+	}
+	
+	runCompilerTests(t, tests)
+}
+
+func TestCompileDancers(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "flow ch = flow channel<int>\nstart send ch <- 1\ndance v = <-ch",
+			expectedConstants: []interface{}{"int", int64(1)},
+			expectedCode: [][]byte{
+				Make(OpChannel, 0),  // 0000
+				Make(OpSet, 0),      // 0003
+				Make(OpStart, 19),   // 0006
+				Make(OpGet, 0),      // 0011
+				Make(OpConstant, 1), // 0014
+				Make(OpSend),        // 0017
+				Make(OpEnd),         // 0018
+				Make(OpGet, 0),      // 0019
+				Make(OpReceive),     // 0022
+				Make(OpSet, 1),      // 0023
+				Make(OpEnd),         // 0026
+			},
+		},
+	}
+	
+	runCompilerTests(t, tests)
+}
+
+func TestCompileMembers(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "flow files = chore.fs()\nfiles.write(\"a.txt\", files.read(\"b.txt\"))",
+			expectedConstants: []interface{}{"a.txt", "b.txt", "read", "write"},
+			expectedCode: [][]byte{
+				Make(OpFS),           // 0000
+				Make(OpSet, 0),       // 0001
+				Make(OpGet, 0),       // 0004
+				Make(OpConstant, 0),  // 0007
+				Make(OpGet, 0),       // 0010
+				Make(OpConstant, 1),  // 0013
+				Make(OpMember, 2, 1), // 0016
+				Make(OpMember, 3, 2), // 0021
+				Make(OpPop),          // 0026
+				Make(OpEnd),          // 0027
+			},
+		},
+	}
+	
+	runCompilerTests(t, tests)
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"spin missing(1)", "1:6: undefined function: missing"},
+		{"spin print(y)", "1:12: undefined: y"},
+		{"dance m = match 1 {\n when other: flow 2\n}", "2:7: undefined: other"},
+		{"spin args(1, 2)", "1:6: args takes at most 1 argument, got 2"},
+		{"spin exit()", "1:6: exit takes 1 argument, got 0"},
+		{"flow files = chore.files()", "1:20: chore has no member files"},
+		{"flow files = chore.fs(1)", "1:20: chore.fs takes no arguments, got 1"},
+	}
+	
+	for _, tt := range tests {
+		_, err := Compile(parse(t, tt.input))
+		if err == nil {
+			t.Errorf("input %q: expected error %q, got none", tt.input, tt.expected)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("input %q: expected error containing %q, got %q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	chunk, err := Compile(parse(t, "dance x = 1\ndance y = x / 0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	// DIV comes after CONST 1, SET x, GET x, CONST 0
+	line, column := chunk.PositionOf(12)
+	if Opcode(chunk.Code[12]) != OpDiv {
+		t.Fatalf("expected DIV at offset 12, got %d", chunk.Code[12])
+	}
+	if line != 2 || column != 13 {
+		t.Errorf("DIV position wrong. want=2:13, got=%d:%d", line, column)
+	}
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+	
+	for _, tt := range tests {
+		chunk, err := Compile(parse(t, tt.input))
+		if err != nil {
+			t.Fatalf("input %q: compiler error: %s", tt.input, err)
+		}
+		
+		var expected []byte
+		for _, ins := range tt.expectedCode {
+			expected = append(expected, ins...)
+		}
+		if string(chunk.Code) != string(expected) {
+			t.Errorf("input %q: wrong instructions.\nwant:\n%s\ngot:\n%s", tt.input,
+				Disassemble(&Chunk{Code: expected}), Disassemble(chunk))
+		}
+		
+		if len(chunk.Constants) != len(tt.expectedConstants) {
+			t.Errorf("input %q: wrong number of constants. want=%d, got=%d",
+				tt.input, len(tt.expectedConstants), len(chunk.Constants))
+			continue
+		}
+		for i, want := range tt.expectedConstants {
+			if chunk.Constants[i] != want {
+				t.Errorf("input %q: constant %d wrong. want=%#v, got=%#v", tt.input, i, want, chunk.Constants[i])
+			}
+		}
+		
+		if err := chunk.Validate(); err != nil {
+			t.Errorf("input %q: compiled chunk does not validate: %v", tt.input, err)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parser errors: %v", p.Errors())
+	}
+	
+	return program
+}
\ No newline at end of file
@@ -0,0 +1,82 @@
+package bytecode
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// Disassemble renders a chunk as one instruction per line, with the source
+// position each instruction came from and the values its operands name:
+//
+//	0000    1:7  CONST      0  ; 5
+//	0003    1:7  SET        0  ; x
+func Disassemble(c *Chunk) string {
+	var out bytes.Buffer
+	
+	fmt.Fprintf(&out, "constants:\n")
+	for i, v := range c.Constants {
+		fmt.Fprintf(&out, "  %4d  %s\n", i, constantString(v))
+	}
+	fmt.Fprintf(&out, "slots:\n")
+	for i, name := range c.Slots {
+		fmt.Fprintf(&out, "  %4d  %s\n", i, name)
+	}
+	fmt.Fprintf(&out, "code:\n")
+	
+	lastLine, lastColumn := -1, -1
+	for offset := 0; offset < len(c.Code); {
+		def, err := Lookup(Opcode(c.Code[offset]))
+		if err != nil {
+			fmt.Fprintf(&out, "%04d  ERROR: %s\n", offset, err)
+			offset++
+			continue
+		}
+		
+		operands, read := ReadOperands(def, c.Code[offset+1:])
+		
+		position := "|"
+		if line, column := c.PositionOf(offset); line != lastLine || column != lastColumn {
+			position = fmt.Sprintf("%d:%d", line, column)
+			lastLine, lastColumn = line, column
+		}
+		
+		fmt.Fprintf(&out, "%04d  %7s  %s\n", offset, position, c.instructionString(Opcode(c.Code[offset]), def, operands))
+		offset += 1 + read
+	}
+	
+	return out.String()
+}
+
+func (c *Chunk) instructionString(op Opcode, def *Definition, operands []int) string {
+	if len(operands) == 0 {
+		return def.Name
+	}
+	
+	text := fmt.Sprintf("%-8s %4d", def.Name, operands[0])
+	for _, operand := range operands[1:] {
+		text += fmt.Sprintf(" %d", operand)
+	}
+	switch op {
+	case OpConstant, OpChannel, OpMember:
+		if operands[0] < len(c.Constants) {
+			text += "  ; " + constantString(c.Constants[operands[0]])
+		}
+	case OpGet, OpSet:
+		if operands[0] < len(c.Slots) {
+			text += "  ; " + c.Slots[operands[0]]
+		}
+	}
+	return text
+}
+
+func constantString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64) + " (float)"
+	default:
+		return fmt.Sprint(v)
+	}
+}
\ No newline at end of file
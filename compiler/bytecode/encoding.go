@@ -0,0 +1,218 @@
+package bytecode
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// A .chorec file caches a compiled script so an unchanged script runs
+// without being lexed and parsed again. It holds:
+//
+//	magic "CHOREC", format version (1 byte)
+//	SHA-256 of the source (32 bytes)
+//	constants, slots, code and positions
+//
+// Integers are unsigned varints; strings are a length and their bytes.
+const (
+	magic         = "CHOREC"
+	FormatVersion = 2
+)
+
+const (
+	tagInt byte = iota + 1
+	tagFloat
+	tagString
+)
+
+// ErrStale reports a cache file built from a different source or by a
+// different format version.
+var ErrStale = errors.New("stale .chorec cache")
+
+// SourceHash identifies the source a chunk was compiled from.
+func SourceHash(source []byte) [sha256.Size]byte {
+	return sha256.Sum256(source)
+}
+
+// Encode writes c as a .chorec file for the given source.
+func Encode(w io.Writer, c *Chunk, source []byte) error {
+	var buf bytes.Buffer
+	buf.WriteString(magic)
+	buf.WriteByte(FormatVersion)
+	hash := SourceHash(source)
+	buf.Write(hash[:])
+	
+	putUint(&buf, len(c.Constants))
+	for _, v := range c.Constants {
+		switch v := v.(type) {
+		case int64:
+			buf.WriteByte(tagInt)
+			var b [binary.MaxVarintLen64]byte
+			buf.Write(b[:binary.PutVarint(b[:], v)])
+		case float64:
+			buf.WriteByte(tagFloat)
+			var b [8]byte
+			binary.BigEndian.PutUint64(b[:], math.Float64bits(v))
+			buf.Write(b[:])
+		case string:
+			buf.WriteByte(tagString)
+			putString(&buf, v)
+		default:
+			return fmt.Errorf("cannot encode constant of type %T", v)
+		}
+	}
+	
+	putUint(&buf, len(c.Slots))
+	for _, name := range c.Slots {
+		putString(&buf, name)
+	}
+	
+	putUint(&buf, len(c.Code))
+	buf.Write(c.Code)
+	
+	putUint(&buf, len(c.Positions))
+	for _, p := range c.Positions {
+		putUint(&buf, p.Offset)
+		putUint(&buf, p.Line)
+		putUint(&buf, p.Column)
+	}
+	
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Decode reads a .chorec file. If source is not nil, the file must have
+// been built from exactly that source, or ErrStale is returned.
+func Decode(r io.Reader, source []byte) (*Chunk, error) {
+	br := bufio.NewReader(r)
+	
+	header := make([]byte, len(magic)+1+sha256.Size)
+	n, err := io.ReadFull(br, header)
+	if n < len(magic) || string(header[:len(magic)]) != magic {
+		return nil, errors.New("not a .chorec file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("corrupt .chorec file: %v", err)
+	}
+	if header[len(magic)] != FormatVersion {
+		return nil, ErrStale
+	}
+	if source != nil {
+		hash := SourceHash(source)
+		if !bytes.Equal(header[len(magic)+1:], hash[:]) {
+			return nil, ErrStale
+		}
+	}
+	
+	d := &decoder{r: br}
+	c := &Chunk{}
+	
+	n = d.uint()
+	c.Constants = make([]interface{}, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		switch tag := d.byte(); tag {
+		case tagInt:
+			v, err := binary.ReadVarint(d.r)
+			d.fail(err)
+			c.Constants = append(c.Constants, v)
+		case tagFloat:
+			var b [8]byte
+			d.read(b[:])
+			c.Constants = append(c.Constants, math.Float64frombits(binary.BigEndian.Uint64(b[:])))
+		case tagString:
+			c.Constants = append(c.Constants, d.string())
+		default:
+			d.fail(fmt.Errorf("unknown constant tag %d", tag))
+		}
+	}
+	
+	n = d.uint()
+	c.Slots = make([]string, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		c.Slots = append(c.Slots, d.string())
+	}
+	
+	c.Code = make([]byte, d.uint())
+	d.read(c.Code)
+	
+	n = d.uint()
+	c.Positions = make([]Position, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		c.Positions = append(c.Positions, Position{Offset: d.uint(), Line: d.uint(), Column: d.uint()})
+	}
+	
+	if d.err != nil {
+		return nil, fmt.Errorf("corrupt .chorec file: %v", d.err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("corrupt .chorec file: %v", err)
+	}
+	return c, nil
+}
+
+func putUint(buf *bytes.Buffer, n int) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutUvarint(b[:], uint64(n))])
+}
+
+func putString(buf *bytes.Buffer, s string) {
+	putUint(buf, len(s))
+	buf.WriteString(s)
+}
+
+// decoder reads fields until the first error, which it keeps.
+type decoder struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil && err != nil {
+		d.err = err
+	}
+}
+
+// maxLength bounds lengths read from a file so a corrupt one cannot ask
+// for an enormous allocation.
+const maxLength = 1 << 30
+
+func (d *decoder) uint() int {
+	if d.err != nil {
+		return 0
+	}
+	n, err := binary.ReadUvarint(d.r)
+	d.fail(err)
+	if n > maxLength {
+		d.fail(fmt.Errorf("length %d out of range", n))
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	b, err := d.r.ReadByte()
+	d.fail(err)
+	return b
+}
+
+func (d *decoder) read(p []byte) {
+	if d.err != nil {
+		return
+	}
+	_, err := io.ReadFull(d.r, p)
+	d.fail(err)
+}
+
+func (d *decoder) string() string {
+	b := make([]byte, d.uint())
+	d.read(b)
+	return string(b)
+}
\ No newline at end of file
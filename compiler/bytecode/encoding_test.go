@@ -0,0 +1,173 @@
+package bytecode
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const encodingSource = `
+flow ch = flow channel<int>
+start sway i from 1 to 3 {
+    send ch <- i * 2
+}
+dance f = 2.5
+spin print("total", <-ch + <-ch, f)
+`
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	chunk, err := Compile(parse(t, encodingSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	var buf bytes.Buffer
+	if err := Encode(&buf, chunk, []byte(encodingSource)); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	
+	decoded, err := Decode(bytes.NewReader(buf.Bytes()), []byte(encodingSource))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	
+	if !reflect.DeepEqual(chunk, decoded) {
+		t.Errorf("round trip changed the chunk.\nwant:\n%s\ngot:\n%s", Disassemble(chunk), Disassemble(decoded))
+	}
+}
+
+func TestDecodeRejectsStaleCache(t *testing.T) {
+	chunk, err := Compile(parse(t, encodingSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	var buf bytes.Buffer
+	if err := Encode(&buf, chunk, []byte(encodingSource)); err != nil {
+		t.Fatal(err)
+	}
+	
+	_, err = Decode(bytes.NewReader(buf.Bytes()), []byte(encodingSource+"\n"))
+	if err != ErrStale {
+		t.Errorf("expected ErrStale for changed source, got %v", err)
+	}
+	
+	data := buf.Bytes()
+	data[len(magic)] = FormatVersion + 1
+	_, err = Decode(bytes.NewReader(data), nil)
+	if err != ErrStale {
+		t.Errorf("expected ErrStale for another format version, got %v", err)
+	}
+}
+
+func TestDecodeRejectsCorruptFiles(t *testing.T) {
+	chunk, err := Compile(parse(t, encodingSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	var buf bytes.Buffer
+	if err := Encode(&buf, chunk, nil); err != nil {
+		t.Fatal(err)
+	}
+	good := buf.Bytes()
+	
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"not chorec", []byte("package main"), "not a .chorec file"},
+		{"truncated", good[:len(good)-3], "corrupt"},
+		{"bad jump", corruptFirst(good, chunk, OpStart), "corrupt"},
+	}
+	
+	for _, tt := range tests {
+		_, err := Decode(bytes.NewReader(tt.data), nil)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestValidateChecksConstants(t *testing.T) {
+	code := func(ins ...[]byte) []byte {
+		var out []byte
+		for _, in := range ins {
+			out = append(out, in...)
+		}
+		return append(out, Make(OpEnd)...)
+	}
+	
+	tests := []struct {
+		name     string
+		chunk    *Chunk
+		expected string
+	}{
+		{"member name", &Chunk{Constants: []interface{}{"read"}, Code: code(Make(OpFS), Make(OpMember, 0, 0))}, ""},
+		{"member constant", &Chunk{Code: code(Make(OpMember, 0, 0))}, "offset 0: constant 0 out of range"},
+		{"member name type", &Chunk{Constants: []interface{}{int64(1)}, Code: code(Make(OpMember, 0, 0))},
+			"offset 0: member name is not a string"},
+		{"channel type", &Chunk{Constants: []interface{}{1.5}, Code: code(Make(OpChannel, 0))},
+			"offset 0: channel element type is not a string"},
+		{"constant", &Chunk{Code: code(Make(OpConstant, 3))}, "offset 0: constant 3 out of range"},
+	}
+	
+	for _, tt := range tests {
+		err := tt.chunk.Validate()
+		if tt.expected == "" && err != nil || tt.expected != "" && (err == nil || err.Error() != tt.expected) {
+			t.Errorf("%s: Validate() = %v, want %q", tt.name, err, tt.expected)
+		}
+	}
+}
+
+// corruptFirst returns a copy of an encoded chunk whose first op
+// instruction has its address pointing outside the code.
+func corruptFirst(encoded []byte, chunk *Chunk, op Opcode) []byte {
+	data := append([]byte{}, encoded...)
+	ins := Make(op, 0)
+	for offset := 0; offset < len(chunk.Code); {
+		def, _ := Lookup(Opcode(chunk.Code[offset]))
+		_, read := ReadOperands(def, chunk.Code[offset+1:])
+		if Opcode(chunk.Code[offset]) == op {
+			ins = chunk.Code[offset : offset+1+read]
+			break
+		}
+		offset += 1 + read
+	}
+	
+	i := bytes.Index(data, ins)
+	copy(data[i:], Make(op, 1<<20))
+	return data
+}
+
+func TestDisassemble(t *testing.T) {
+	chunk, err := Compile(parse(t, "dance x = 5\nif x > 2.5 {\n    spin print(\"big\")\n}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	expected := `constants:
+     0  5
+     1  2.5 (float)
+     2  "big"
+slots:
+     0  x
+code:
+0000     1:11  CONST       0  ; 5
+0003      1:7  SET         0  ; x
+0006      2:4  GET         0  ; x
+0009      2:8  CONST       1  ; 2.5 (float)
+0012      2:6  GT
+0013      2:1  JUMPF      25
+0018     3:16  CONST       2  ; "big"
+0021     3:10  PRINT       1
+0024      3:5  POP
+0025      0:0  END
+`
+	
+	if got := Disassemble(chunk); got != expected {
+		t.Errorf("disassembly wrong.\nwant:\n%s\ngot:\n%s", expected, got)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,191 @@
+// Package bytecode defines the compact instruction format the ChoreLang VM
+// executes, a compiler from the AST to it, a disassembler and the .chorec
+// file encoding used to cache compiled scripts.
+//
+// An instruction is a one-byte opcode followed by its operands in big-endian
+// order. Operands are two bytes wide, except jump targets, which are four.
+package bytecode
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // push constant [index]
+	OpTrue                   // push true
+	OpFalse                  // push false
+	OpNil                    // push nothing
+	OpPop                    // discard the top of the stack
+	OpDup                    // duplicate the top of the stack
+	OpGet                    // push slot [slot]
+	OpSet                    // pop into slot [slot]
+	
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpEqual
+	OpNotEqual
+	OpLess
+	OpGreater
+	OpLessEqual
+	OpGreaterEqual
+	OpMatch // =~
+	
+	OpJump        // jump to [address]
+	OpJumpIfFalse // pop a bool, jump to [address] if it is false
+	
+	OpPrint   // pop [count] values and print them, push nothing
+	OpChannel // push a new channel of element type constant [index]
+	OpSend    // pop value and channel, send
+	OpReceive // pop channel, push the value received
+	OpStart   // start a dancer at the next instruction, continue at [address]
+	OpEnd     // the current dancer has finished
+	
+	OpArgs   // pop [count] (0 or 1) values, push args() or args(i)
+	OpExit   // pop the exit code and end the program
+	OpFS     // push chore.fs(), the file system module
+	OpMember // pop [count] values and the receiver below them, push the receiver's member named by constant [index] called with them
+)
+
+// Definition describes an opcode for assembly and disassembly.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"CONST", []int{2}},
+	OpTrue:     {"TRUE", []int{}},
+	OpFalse:    {"FALSE", []int{}},
+	OpNil:      {"NIL", []int{}},
+	OpPop:      {"POP", []int{}},
+	OpDup:      {"DUP", []int{}},
+	OpGet:      {"GET", []int{2}},
+	OpSet:      {"SET", []int{2}},
+	
+	OpAdd:          {"ADD", []int{}},
+	OpSub:          {"SUB", []int{}},
+	OpMul:          {"MUL", []int{}},
+	OpDiv:          {"DIV", []int{}},
+	OpEqual:        {"EQ", []int{}},
+	OpNotEqual:     {"NE", []int{}},
+	OpLess:         {"LT", []int{}},
+	OpGreater:      {"GT", []int{}},
+	OpLessEqual:    {"LE", []int{}},
+	OpGreaterEqual: {"GE", []int{}},
+	OpMatch:        {"MATCH", []int{}},
+	
+	OpJump:        {"JUMP", []int{4}},
+	OpJumpIfFalse: {"JUMPF", []int{4}},
+	
+	OpPrint:   {"PRINT", []int{2}},
+	OpChannel: {"CHANNEL", []int{2}},
+	OpSend:    {"SEND", []int{}},
+	OpReceive: {"RECV", []int{}},
+	OpStart:   {"START", []int{4}},
+	OpEnd:     {"END", []int{}},
+	
+	OpArgs:   {"ARGS", []int{2}},
+	OpExit:   {"EXIT", []int{}},
+	OpFS:     {"FS", []int{}},
+	OpMember: {"MEMBER", []int{2, 2}},
+}
+
+// binaryOps maps ChoreLang infix operators to their opcodes.
+var binaryOps = map[string]Opcode{
+	"+":  OpAdd,
+	"-":  OpSub,
+	"*":  OpMul,
+	"/":  OpDiv,
+	"==": OpEqual,
+	"!=": OpNotEqual,
+	"<":  OpLess,
+	">":  OpGreater,
+	"<=": OpLessEqual,
+	">=": OpGreaterEqual,
+	"=~": OpMatch,
+}
+
+// operators maps binary opcodes back to their ChoreLang operators.
+var operators = func() map[Opcode]string {
+	m := make(map[Opcode]string, len(binaryOps))
+	for operator, code := range binaryOps {
+		m[code] = operator
+	}
+	return m
+}()
+
+// Operator returns the ChoreLang operator a binary opcode implements.
+func Operator(op Opcode) (string, bool) {
+	operator, ok := operators[op]
+	return operator, ok
+}
+
+func Lookup(op Opcode) (*Definition, error) {
+	def, ok := definitions[op]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make assembles one instruction.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+	
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+	
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+	
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 4:
+			binary.BigEndian.PutUint32(instruction[offset:], uint32(o))
+		}
+		offset += width
+	}
+	
+	return instruction
+}
+
+// ReadOperands decodes the operands of def starting at ins, returning them
+// and the number of bytes read.
+func ReadOperands(def *Definition, ins []byte) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+	
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 4:
+			operands[i] = int(ReadUint32(ins[offset:]))
+		}
+		offset += width
+	}
+	
+	return operands, offset
+}
+
+func ReadUint16(ins []byte) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint32(ins []byte) uint32 {
+	return binary.BigEndian.Uint32(ins)
+}
\ No newline at end of file
@@ -0,0 +1,232 @@
+// Package chart draws ChoreLang programs as Mermaid diagrams. Flowchart
+// shows control flow:
+//
+//   - each statement is a box labelled with its source
+//   - a sway is a hexagon whose body loops back to it
+//   - an if, or a statement holding a match, is a decision diamond with one
+//     edge per branch or case
+//   - each start spawns a dancer, drawn in its own swimlane subgraph
+package chart
+
+import (
+	"fmt"
+	"strings"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/format"
+)
+
+// maxLabel is the longest node label, in characters. Longer source is cut
+// short so the diagram stays readable.
+const maxLabel = 48
+
+// Node shapes, filled in with a node id and a quoted label
+const (
+	terminal      = `%s(["%s"])`
+	box           = `%s["%s"]`
+	decision      = `%s{"%s"}`
+	loop          = `%s{{"%s"}}`
+	parallelogram = `%s[/"%s"/]`
+)
+
+// Flowchart returns a Mermaid flowchart of program.
+func Flowchart(program *ast.Program) string {
+	b := &builder{}
+	
+	main := b.lane("main", "main")
+	begin := b.node(main, terminal, "begin")
+	out := b.statements(main, program.Statements, []exit{{from: begin}})
+	b.connect(out, b.node(main, terminal, "end"))
+	
+	var sb strings.Builder
+	sb.WriteString("flowchart TD\n")
+	for _, l := range b.lanes {
+		fmt.Fprintf(&sb, "    subgraph %s [\"%s\"]\n", l.id, Escape(l.title))
+		for _, node := range l.nodes {
+			fmt.Fprintf(&sb, "        %s\n", node)
+		}
+		sb.WriteString("    end\n")
+	}
+	for _, edge := range b.edges {
+		fmt.Fprintf(&sb, "    %s\n", edge)
+	}
+	return sb.String()
+}
+
+// exit is an edge waiting for the next node: control leaves from along it,
+// labelled label. Spawn edges are dotted.
+type exit struct {
+	from  string
+	label string
+	spawn bool
+}
+
+// lane is a swimlane: the nodes of main or of one dancer.
+type lane struct {
+	id    string
+	title string
+	nodes []string
+}
+
+type builder struct {
+	lanes   []*lane
+	edges   []string
+	nodes   int
+	dancers int
+}
+
+func (b *builder) lane(id, title string) *lane {
+	l := &lane{id: id, title: title}
+	b.lanes = append(b.lanes, l)
+	return l
+}
+
+// node adds a node of the given shape to l and returns its id.
+func (b *builder) node(l *lane, shape, label string) string {
+	b.nodes++
+	id := fmt.Sprintf("n%d", b.nodes)
+	l.nodes = append(l.nodes, fmt.Sprintf(shape, id, Escape(shorten(label))))
+	return id
+}
+
+// connect draws the waiting edges to the node to.
+func (b *builder) connect(exits []exit, to string) {
+	for _, e := range exits {
+		switch {
+		case e.spawn:
+			b.edges = append(b.edges, fmt.Sprintf("%s -. %s .-> %s", e.from, e.label, to))
+		case e.label != "":
+			b.edges = append(b.edges, fmt.Sprintf("%s -->|%s| %s", e.from, Escape(e.label), to))
+		default:
+			b.edges = append(b.edges, fmt.Sprintf("%s --> %s", e.from, to))
+		}
+	}
+}
+
+func (b *builder) statements(l *lane, stmts []ast.Statement, in []exit) []exit {
+	for _, stmt := range stmts {
+		in = b.statement(l, stmt, in)
+	}
+	return in
+}
+
+// statement draws stmt, entered along in, and returns the edges leaving it.
+func (b *builder) statement(l *lane, stmt ast.Statement, in []exit) []exit {
+	switch s := stmt.(type) {
+	case *ast.SwayStatement:
+		id := b.node(l, loop, label(s))
+		b.connect(in, id)
+		b.connect(b.statements(l, s.Body.Statements, []exit{{from: id, label: "loop"}}), id)
+		return []exit{{from: id, label: "done"}}
+	case *ast.IfStatement:
+		id := b.node(l, decision, label(s))
+		b.connect(in, id)
+		out := b.statements(l, s.Consequence.Statements, []exit{{from: id, label: "yes"}})
+		if s.Alternative != nil {
+			return append(out, b.statements(l, s.Alternative.Statements, []exit{{from: id, label: "no"}})...)
+		}
+		return append(out, exit{from: id, label: "no"})
+	case *ast.BlockStatement:
+		return b.statements(l, s.Statements, in)
+	case *ast.RehearseStatement:
+		// Rehearsals are tests, not part of the program's flow
+		return in
+	case *ast.EncoreStatement:
+		// Nor are benchmarks
+		return in
+	case *ast.StartStatement:
+		id := b.node(l, parallelogram, label(s))
+		b.connect(in, id)
+		
+		b.dancers++
+		dancer := b.lane(fmt.Sprintf("dancer%d", b.dancers), fmt.Sprintf("dancer at line %d", s.Token.Line))
+		out := b.statement(dancer, s.Statement, []exit{{from: id, label: "spawn", spawn: true}})
+		b.connect(out, b.node(dancer, terminal, "done"))
+		return []exit{{from: id}}
+	}
+	
+	if m := matchOf(stmt); m != nil {
+		return b.match(l, stmt, m, in)
+	}
+	id := b.node(l, box, label(stmt))
+	b.connect(in, id)
+	return []exit{{from: id}}
+}
+
+// match draws a statement holding a match as a decision with an edge per
+// case, and an edge for values no case takes unless a case falls back.
+func (b *builder) match(l *lane, stmt ast.Statement, m *ast.MatchExpression, in []exit) []exit {
+	id := b.node(l, decision, label(stmt))
+	b.connect(in, id)
+	
+	var out []exit
+	fallback := false
+	for _, c := range m.Cases {
+		pattern := expression(c.Pattern)
+		if c.Parameters != nil {
+			names := make([]string, len(c.Parameters))
+			for i, param := range c.Parameters {
+				names[i] = param.Value
+			}
+			pattern += "(" + strings.Join(names, ", ") + ")"
+		}
+		if subject, ok := m.Expression.(*ast.Identifier); ok && c.Parameters == nil && pattern == subject.Value {
+			fallback = true
+		}
+		
+		caseID := b.node(l, box, expression(c.Consequence))
+		b.connect([]exit{{from: id, label: pattern}}, caseID)
+		out = append(out, exit{from: caseID})
+	}
+	if !fallback {
+		out = append(out, exit{from: id, label: "no match"})
+	}
+	return out
+}
+
+// matchOf returns the match a statement's value is, if any.
+func matchOf(stmt ast.Statement) *ast.MatchExpression {
+	var value ast.Expression
+	switch s := stmt.(type) {
+	case *ast.DanceStatement:
+		value = s.Value
+	case *ast.AssignStatement:
+		value = s.Value
+	case *ast.ExpressionStatement:
+		value = s.Expression
+	}
+	m, _ := value.(*ast.MatchExpression)
+	return m
+}
+
+// label is the first line of a statement's formatted source, without the
+// brace opening its block or match.
+func label(stmt ast.Statement) string {
+	printed := string(format.Program(&ast.Program{Statements: []ast.Statement{stmt}}))
+	first := strings.SplitN(printed, "\n", 2)[0]
+	first = strings.TrimSuffix(first, " {}")
+	return strings.TrimSuffix(first, " {")
+}
+
+func expression(exp ast.Expression) string {
+	return label(&ast.ExpressionStatement{Expression: exp})
+}
+
+func shorten(s string) string {
+	runes := []rune(s)
+	if len(runes) <= maxLabel {
+		return s
+	}
+	return string(runes[:maxLabel-1]) + "…"
+}
+
+// Escape makes text safe inside a quoted Mermaid label, using Mermaid's
+// entity codes for the characters it would otherwise read as syntax.
+var Escape = strings.NewReplacer(
+	"#", "#35;",
+	`"`, "#quot;",
+	"<", "#lt;",
+	">", "#gt;",
+	"|", "#124;",
+	";", "#59;",
+).Replace
\ No newline at end of file
@@ -0,0 +1,195 @@
+package chart
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	return program
+}
+
+func TestFlowchart(t *testing.T) {
+	input := `flow channel<int> ch
+start sway i from 1 to 3 {
+    send ch <- i
+}
+if x > 0 {
+    spin print("positive")
+}
+dance kind = match x {
+    when 1: flow "one"
+    when x: flow "other"
+}
+`
+	expected := `flowchart TD
+    subgraph main ["main"]
+        n1(["begin"])
+        n2["flow channel#lt;int#gt; ch"]
+        n3[/"start sway i from 1 to 3"/]
+        n7{"if x #gt; 0"}
+        n8["spin print(#quot;positive#quot;)"]
+        n9{"dance kind = match x"}
+        n10["flow #quot;one#quot;"]
+        n11["flow #quot;other#quot;"]
+        n12(["end"])
+    end
+    subgraph dancer1 ["dancer at line 2"]
+        n4{{"sway i from 1 to 3"}}
+        n5["send ch #lt;- i"]
+        n6(["done"])
+    end
+    n1 --> n2
+    n2 --> n3
+    n3 -. spawn .-> n4
+    n4 -->|loop| n5
+    n5 --> n4
+    n4 -->|done| n6
+    n3 --> n7
+    n7 -->|yes| n8
+    n8 --> n9
+    n7 -->|no| n9
+    n9 -->|1| n10
+    n9 -->|x| n11
+    n10 --> n12
+    n11 --> n12
+`
+	if got := Flowchart(parse(t, input)); got != expected {
+		t.Errorf("flowchart wrong.\nwant:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestFlowchartMatchWithoutFallback(t *testing.T) {
+	got := Flowchart(parse(t, "dance y = match x {\n    when \"a\": flow 1\n}\n"))
+	if !strings.Contains(got, "n2 -->|no match| n4") {
+		t.Errorf("expected an edge for unmatched values, got:\n%s", got)
+	}
+}
+
+func TestLabelsAreShortened(t *testing.T) {
+	got := Flowchart(parse(t, `spin print("a very long message that goes on and on and on")`))
+	if !strings.Contains(got, `n2["spin print(#quot;a very long message that goes on an…"]`) {
+		t.Errorf("expected a shortened label, got:\n%s", got)
+	}
+}
+
+func TestExamplesChart(t *testing.T) {
+	files, err := filepath.Glob("../../examples/*.chore")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no examples found: %v", err)
+	}
+	
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := Flowchart(parse(t, string(source)))
+		if !strings.HasPrefix(got, "flowchart TD\n") || !strings.Contains(got, `(["end"])`) {
+			t.Errorf("%s: unexpected chart:\n%s", file, got)
+		}
+	}
+}
+
+func TestSequence(t *testing.T) {
+	input := `flow channel<int> jobs
+flow channel<int> results
+dance inbox = jobs
+start sway w from 1 to 2 {
+    dance job = <-inbox
+    send results <- job * 10
+}
+sway j from 1 to 2 {
+    send jobs <- j
+}
+spin print(<-results)
+`
+	expected := `sequenceDiagram
+    participant main
+    participant dancer1 as dancer at line 4
+    main-)dancer1: start
+    loop sway w from 1 to 2
+        dancer1->>main: results #lt;- job * 10
+    end
+    loop sway j from 1 to 2
+        main->>dancer1: jobs #lt;- j
+    end
+`
+	got, deadlocks, err := Sequence(parse(t, input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != expected {
+		t.Errorf("sequence wrong.\nwant:\n%s\ngot:\n%s", expected, got)
+	}
+	if len(deadlocks) != 0 {
+		t.Errorf("expected no deadlocks, got %v", deadlocks)
+	}
+}
+
+func TestSequenceFlagsOneSidedChannels(t *testing.T) {
+	input := `flow channel<int> out
+flow channel<int> in
+flow channel<int> passed
+start send out <- 1
+spin print(<-in)
+spin print(passed)
+send passed <- 2
+`
+	got, deadlocks, err := Sequence(parse(t, input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	var reported []string
+	for _, d := range deadlocks {
+		reported = append(reported, d.String())
+	}
+	expected := []string{
+		`4:7: send on "out", but nothing ever receives from it`,
+		`5:12: receive from "in", but nothing ever sends on it`,
+	}
+	if strings.Join(reported, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("deadlocks wrong.\nwant:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(reported, "\n"))
+	}
+	for _, note := range []string{
+		"Note over dancer1: potential deadlock: nothing receives from out",
+		"Note over main: potential deadlock: nothing sends on in",
+	} {
+		if !strings.Contains(got, note) {
+			t.Errorf("diagram lacks %q:\n%s", note, got)
+		}
+	}
+}
+
+func TestSequenceNeedsAResolvedProgram(t *testing.T) {
+	if _, _, err := Sequence(parse(t, "send ch <- 1\nch = 2\n")); err == nil {
+		t.Errorf("expected a resolver error")
+	}
+}
+
+func TestExamplesHaveNoDeadlocks(t *testing.T) {
+	files, _ := filepath.Glob("../../examples/*.chore")
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, deadlocks, err := Sequence(parse(t, string(source)))
+		if err != nil || len(deadlocks) != 0 || !strings.HasPrefix(got, "sequenceDiagram\n") {
+			t.Errorf("%s: err %v, deadlocks %v, diagram:\n%s", file, err, deadlocks, got)
+		}
+	}
+}
\ No newline at end of file
@@ -0,0 +1,278 @@
+package chart
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/resolver"
+)
+
+// Deadlock is a channel operation nothing can ever complete: a send on a
+// channel no dancer receives from, or a receive from one none sends on.
+// Channels are unbuffered, so the dancer blocks there forever.
+type Deadlock struct {
+	Line, Column int
+	Message      string
+}
+
+func (d Deadlock) String() string {
+	return fmt.Sprintf("%d:%d: %s", d.Line, d.Column, d.Message)
+}
+
+// Sequence returns a Mermaid sequence diagram of the messages a program's
+// dancers exchange: a lifeline for main and for each start, an arrow for
+// each start and for each send to every dancer that receives from its
+// channel, in source order. Sends inside a sway are drawn in a loop.
+//
+// One-sided channels are marked on the diagram and returned as deadlocks.
+// A channel used other than by send, receive or `dance alias = ch` may be
+// handled anywhere, so it is never reported. Sequence fails if the program
+// does not resolve, since channels are told apart by their bindings.
+func Sequence(program *ast.Program) (string, []Deadlock, error) {
+	r := resolver.New()
+	r.Resolve(program)
+	if errs := r.Errors(); len(errs) > 0 {
+		return "", nil, errors.New(strings.Join(errs, "\n"))
+	}
+	
+	s := &sequence{
+		resolver:  r,
+		aliases:   make(map[*resolver.Binding]*resolver.Binding),
+		senders:   make(map[*resolver.Binding][]*participant),
+		receivers: make(map[*resolver.Binding][]*participant),
+		escaped:   make(map[*resolver.Binding]bool),
+	}
+	main := s.participant("main", "")
+	s.statements(program.Statements, main, nil)
+	return s.render()
+}
+
+// participant is a lifeline: main or the dancers one start launches.
+type participant struct {
+	id    string
+	title string
+}
+
+type eventKind int
+
+const (
+	spawn eventKind = iota
+	send
+	receive
+)
+
+// event is a step of the conversation, in source order.
+type event struct {
+	kind    eventKind
+	from    *participant
+	to      *participant // the dancer started, for spawn
+	channel *resolver.Binding
+	text    string // the sent channel and value, for send
+	line    int
+	column  int
+	loops   []*ast.SwayStatement // the sways around it within its dancer
+}
+
+type sequence struct {
+	resolver     *resolver.Resolver
+	participants []*participant
+	events       []event
+	
+	aliases   map[*resolver.Binding]*resolver.Binding
+	senders   map[*resolver.Binding][]*participant
+	receivers map[*resolver.Binding][]*participant
+	escaped   map[*resolver.Binding]bool
+}
+
+func (s *sequence) participant(id, title string) *participant {
+	p := &participant{id: id, title: title}
+	s.participants = append(s.participants, p)
+	return p
+}
+
+func (s *sequence) statements(stmts []ast.Statement, p *participant, loops []*ast.SwayStatement) {
+	for _, stmt := range stmts {
+		s.statement(stmt, p, loops)
+	}
+}
+
+func (s *sequence) statement(stmt ast.Statement, p *participant, loops []*ast.SwayStatement) {
+	switch st := stmt.(type) {
+	case *ast.DanceStatement:
+		if ch := s.channel(st.Value); ch != nil {
+			if b := s.resolver.BindingOf(st.Name); b != nil {
+				s.aliases[b] = ch
+			}
+			return
+		}
+		s.expression(st.Value, p, loops)
+	case *ast.AssignStatement:
+		s.expression(st.Value, p, loops)
+	case *ast.ExpressionStatement:
+		s.expression(st.Expression, p, loops)
+	case *ast.SwayStatement:
+		s.expression(st.From, p, loops)
+		s.expression(st.To, p, loops)
+		s.statements(st.Body.Statements, p, append(loops[:len(loops):len(loops)], st))
+	case *ast.BlockStatement:
+		s.statements(st.Statements, p, loops)
+	case *ast.RehearseStatement:
+		// A rehearsal runs in main when it is selected, and may be what
+		// talks to the dancers the file starts
+		s.statements(st.Body.Statements, p, loops)
+	case *ast.EncoreStatement:
+		// So does a benchmark
+		s.statements(st.Body.Statements, p, loops)
+	case *ast.IfStatement:
+		s.expression(st.Condition, p, loops)
+		s.statements(st.Consequence.Statements, p, loops)
+		if st.Alternative != nil {
+			s.statements(st.Alternative.Statements, p, loops)
+		}
+	case *ast.StartStatement:
+		n := len(s.participants)
+		dancer := s.participant(fmt.Sprintf("dancer%d", n), fmt.Sprintf("dancer at line %d", st.Token.Line))
+		s.events = append(s.events, event{kind: spawn, from: p, to: dancer, loops: loops})
+		s.statement(st.Statement, dancer, nil)
+	case *ast.SendStatement:
+		ch := s.channel(st.Channel)
+		if ch == nil {
+			s.expression(st.Channel, p, loops)
+		} else {
+			s.senders[ch] = appendOnce(s.senders[ch], p)
+			s.events = append(s.events, event{
+				kind: send, from: p, channel: ch, loops: loops,
+				text: label(st)[len("send "):],
+				line: st.Token.Line, column: st.Token.Column,
+			})
+		}
+		s.expression(st.Value, p, loops)
+	}
+}
+
+// expression records the receives in exp. Any other use of a channel lets
+// it escape the analysis.
+func (s *sequence) expression(exp ast.Expression, p *participant, loops []*ast.SwayStatement) {
+	if exp == nil {
+		return
+	}
+	handled := make(map[*ast.Identifier]bool)
+	ast.Inspect(exp, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.ReceiveExpression:
+			ch := s.channel(n.Channel)
+			if ch == nil {
+				return true
+			}
+			if ident, ok := n.Channel.(*ast.Identifier); ok {
+				handled[ident] = true
+			}
+			s.receivers[ch] = appendOnce(s.receivers[ch], p)
+			s.events = append(s.events, event{
+				kind: receive, from: p, channel: ch, loops: loops,
+				line: n.Token.Line, column: n.Token.Column,
+			})
+		case *ast.Identifier:
+			if ch := s.channel(n); ch != nil && !handled[n] {
+				s.escaped[ch] = true
+			}
+		}
+		return true
+	})
+}
+
+// channel returns the channel binding exp names, seeing through aliases,
+// or nil if it names none.
+func (s *sequence) channel(exp ast.Expression) *resolver.Binding {
+	ident, ok := exp.(*ast.Identifier)
+	if !ok {
+		return nil
+	}
+	b := s.resolver.BindingOf(ident)
+	if b == nil {
+		return nil
+	}
+	if ch, ok := s.aliases[b]; ok {
+		return ch
+	}
+	if b.Kind == resolver.Channel {
+		return b
+	}
+	return nil
+}
+
+func (s *sequence) render() (string, []Deadlock, error) {
+	var sb strings.Builder
+	var deadlocks []Deadlock
+	
+	sb.WriteString("sequenceDiagram\n")
+	for _, p := range s.participants {
+		if p.title == "" {
+			fmt.Fprintf(&sb, "    participant %s\n", p.id)
+		} else {
+			fmt.Fprintf(&sb, "    participant %s as %s\n", p.id, Escape(p.title))
+		}
+	}
+	
+	var open []*ast.SwayStatement
+	emit := func(e event, lines ...string) {
+		// Close the loops this event is not in, then open its own
+		common := 0
+		for common < len(open) && common < len(e.loops) && open[common] == e.loops[common] {
+			common++
+		}
+		for len(open) > common {
+			open = open[:len(open)-1]
+			fmt.Fprintf(&sb, "%send\n", strings.Repeat("    ", len(open)+1))
+		}
+		for _, loop := range e.loops[common:] {
+			fmt.Fprintf(&sb, "%sloop %s\n", strings.Repeat("    ", len(open)+1), Escape(label(loop)))
+			open = append(open, loop)
+		}
+		for _, line := range lines {
+			fmt.Fprintf(&sb, "%s%s\n", strings.Repeat("    ", len(open)+1), line)
+		}
+	}
+	
+	for _, e := range s.events {
+		switch e.kind {
+		case spawn:
+			emit(e, fmt.Sprintf("%s-)%s: start", e.from.id, e.to.id))
+		case send:
+			receivers := s.receivers[e.channel]
+			if len(receivers) == 0 && !s.escaped[e.channel] {
+				deadlocks = append(deadlocks, Deadlock{e.line, e.column,
+					fmt.Sprintf("send on %q, but nothing ever receives from it", e.channel.Name)})
+				emit(e, fmt.Sprintf("Note over %s: potential deadlock: nothing receives from %s", e.from.id, Escape(e.channel.Name)))
+				continue
+			}
+			var lines []string
+			for _, to := range receivers {
+				lines = append(lines, fmt.Sprintf("%s->>%s: %s", e.from.id, to.id, Escape(e.text)))
+			}
+			if len(lines) > 0 {
+				emit(e, lines...)
+			}
+		case receive:
+			if len(s.senders[e.channel]) == 0 && !s.escaped[e.channel] {
+				deadlocks = append(deadlocks, Deadlock{e.line, e.column,
+					fmt.Sprintf("receive from %q, but nothing ever sends on it", e.channel.Name)})
+				emit(e, fmt.Sprintf("Note over %s: potential deadlock: nothing sends on %s", e.from.id, Escape(e.channel.Name)))
+			}
+		}
+	}
+	emit(event{})
+	
+	return sb.String(), deadlocks, nil
+}
+
+func appendOnce(ps []*participant, p *participant) []*participant {
+	for _, q := range ps {
+		if q == p {
+			return ps
+		}
+	}
+	return append(ps, p)
+}
\ No newline at end of file
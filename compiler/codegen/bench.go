@@ -0,0 +1,171 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	goast "go/ast"
+	"go/format"
+	"go/token"
+	"strconv"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/resolver"
+)
+
+// DancersMetric is the unit of the benchmark metric counting the dancers an
+// encore starts per run.
+const DancersMetric = "dancers/op"
+
+// BenchmarkName is the Go name of the benchmark for the i'th encore of a
+// program, counting from 0. Encore names are free text, so the Go names
+// are numbered instead.
+func BenchmarkName(i int) string {
+	return fmt.Sprintf("BenchmarkEncore%d", i+1)
+}
+
+// GenerateBenchmarks returns a Go test file with a testing.B benchmark for
+// each encore block of program, in source order and named by BenchmarkName.
+//
+// Each benchmark runs the statements outside encores and rehearsals once,
+// untimed, then the encore's body b.N times. Besides time and allocations
+// it reports the dancers the body starts per run, in DancersMetric. Every
+// binding is marked used, since a binding that is only set up for other
+// encores, or a result a benchmark discards, is no mistake there.
+func (g *CodeGenerator) GenerateBenchmarks(program *ast.Program) (string, error) {
+	g.imports = make(map[string]bool)
+	g.aliases = make(map[string]string)
+	g.fset = token.NewFileSet()
+	g.fs = false
+	g.resolver = resolver.New()
+	g.resolver.Resolve(program)
+	if errs := g.resolver.Errors(); len(errs) > 0 {
+		return "", fmt.Errorf("unresolved program: %s", errs[0])
+	}
+	stmts := program.Statements
+	for _, stmt := range program.Statements {
+		if encore, ok := stmt.(*ast.EncoreStatement); ok {
+			stmts = append(stmts, encore.Body)
+		}
+	}
+	g.reads = readBindings(stmts, g.resolver)
+	g.names = newNameMap(program, g.reads)
+	
+	// Benchmarks are never traced or watched; they count dancers instead
+	trace, watch := g.Trace, g.Watch
+	g.Trace, g.Watch, g.bench = false, false, true
+	defer func() { g.Trace, g.Watch, g.bench = trace, watch, false }()
+	
+	file := &goast.File{Name: goast.NewIdent("main")}
+	var funcs []goast.Decl
+	for _, stmt := range program.Statements {
+		encore, ok := stmt.(*ast.EncoreStatement)
+		if !ok {
+			continue
+		}
+		fn, err := g.generateBenchmark(program, encore, len(funcs))
+		if err != nil {
+			return "", err
+		}
+		// Name each benchmark's encore for readers of the generated code
+		fn.Doc = docComment(fmt.Sprintf("%s is encore %q.", fn.Name.Name, encore.Name.Value))
+		funcs = append(funcs, fn)
+	}
+	if len(funcs) == 0 {
+		return "", fmt.Errorf("no encores to benchmark")
+	}
+	
+	runtime, err := g.runtimeDecls(runtimeFiles, "runtime/bench.go")
+	if err != nil {
+		return "", err
+	}
+	if g.fs {
+		decls, err := g.fsDecls()
+		if err != nil {
+			return "", err
+		}
+		runtime = append(runtime, decls...)
+	}
+	g.imports["testing"] = true
+	file.Decls = append([]goast.Decl{g.importDecl()}, funcs...)
+	file.Decls = append(file.Decls, runtime...)
+	
+	var out bytes.Buffer
+	if err := format.Node(&out, g.fset, file); err != nil {
+		return "", fmt.Errorf("printing generated Go: %v", err)
+	}
+	formatted, err := format.Source(out.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("generated invalid Go: %v", err)
+	}
+	return string(formatted), nil
+}
+
+// generateBenchmark builds the benchmark for the i'th encore:
+//
+//	func BenchmarkEncore1(choreB *testing.B) {
+//		defer choreQuiet()()
+//		... the statements outside encores ...
+//		choreB.ReportAllocs()
+//		choreDancers.Store(0)
+//		choreB.ResetTimer()
+//		for choreRound := 0; choreRound < choreB.N; choreRound++ {
+//			... the encore's body ...
+//		}
+//		choreB.ReportMetric(float64(choreDancers.Load())/float64(choreB.N), "dancers/op")
+//	}
+func (g *CodeGenerator) generateBenchmark(program *ast.Program, encore *ast.EncoreStatement, i int) (*goast.FuncDecl, error) {
+	setup, err := g.generateBlock(program.Statements)
+	if err != nil {
+		return nil, err
+	}
+	body, err := g.generateBlock(encore.Body.Statements)
+	if err != nil {
+		return nil, err
+	}
+	
+	b := goast.NewIdent("choreB")
+	call := func(x goast.Expr, method string, args ...goast.Expr) *goast.ExprStmt {
+		return &goast.ExprStmt{X: &goast.CallExpr{
+			Fun:  &goast.SelectorExpr{X: x, Sel: goast.NewIdent(method)},
+			Args: args,
+		}}
+	}
+	n := &goast.SelectorExpr{X: b, Sel: goast.NewIdent("N")}
+	round := goast.NewIdent("choreRound")
+	
+	list := []goast.Stmt{&goast.DeferStmt{Call: &goast.CallExpr{
+		Fun: &goast.CallExpr{Fun: goast.NewIdent("choreQuiet")},
+	}}}
+	list = append(list, setup...)
+	
+	list = append(list,
+		call(b, "ReportAllocs"),
+		call(goast.NewIdent("choreDancers"), "Store", intLiteral(0)),
+		call(b, "ResetTimer"),
+		&goast.ForStmt{
+			Init: &goast.AssignStmt{Lhs: []goast.Expr{round}, Tok: token.DEFINE, Rhs: []goast.Expr{intLiteral(0)}},
+			Cond: &goast.BinaryExpr{X: round, Op: token.LSS, Y: n},
+			Post: &goast.IncDecStmt{X: round, Tok: token.INC},
+			Body: &goast.BlockStmt{List: body},
+		},
+		call(b, "ReportMetric",
+			&goast.BinaryExpr{
+				X: &goast.CallExpr{Fun: goast.NewIdent("float64"), Args: []goast.Expr{
+					&goast.CallExpr{Fun: &goast.SelectorExpr{X: goast.NewIdent("choreDancers"), Sel: goast.NewIdent("Load")}},
+				}},
+				Op: token.QUO,
+				Y:  &goast.CallExpr{Fun: goast.NewIdent("float64"), Args: []goast.Expr{n}},
+			},
+			&goast.BasicLit{Kind: token.STRING, Value: strconv.Quote(DancersMetric)},
+		),
+	)
+	
+	return &goast.FuncDecl{
+		Name: goast.NewIdent(BenchmarkName(i)),
+		Type: &goast.FuncType{Params: &goast.FieldList{List: []*goast.Field{{
+			Names: []*goast.Ident{b},
+			Type:  &goast.StarExpr{X: &goast.SelectorExpr{X: goast.NewIdent("testing"), Sel: goast.NewIdent("B")}},
+		}}}},
+		Body: &goast.BlockStmt{List: list},
+	}, nil
+}
\ No newline at end of file
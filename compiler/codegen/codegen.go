@@ -3,101 +3,185 @@ package codegen
 import (
 	"bytes"
 	"fmt"
+	goast "go/ast"
+	"go/format"
+	"go/token"
+	"strconv"
 	"strings"
 	
 	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/resolver"
 )
 
+// CodeGenerator translates a resolved program into Go source. Scoping rules
+// are enforced by the resolver package before generation, so a DanceStatement
+// is always a declaration and an AssignStatement always a reassignment.
+//
+// The program is built as a go/ast tree and printed with go/format, so the
+// output is syntactically valid and gofmt-clean by construction.
 type CodeGenerator struct {
-	output      bytes.Buffer
-	indent      int
-	errors      []string
-	hasMain     bool
-	imports     map[string]bool
-	declaredVars map[string]bool
-	scopeStack  []map[string]bool
+	// Trace makes the program record its choreography when it runs: each
+	// dancer it starts and each channel operation, with the operation's
+	// position in the source and how long it blocked. Package trace reads
+	// what it records. Source is the .chore file the trace and runtime
+	// errors name.
+	Trace  bool
+	Source string
+	
+	// Watch makes the program explain a deadlock as chorelang run does,
+	// naming each blocked dancer, its channel and where it waits, instead
+	// of Go's "all goroutines are asleep". It also warns of the dancers
+	// still blocked when main finishes.
+	Watch bool
+	
+	errors   []string
+	fset     *token.FileSet // positions of the runtime code
+	hasMain  bool
+	bench    bool // generating benchmarks, which count dancers
+	imports  map[string]bool
+	aliases  map[string]string // the names of imports that need one, by path
+	fs       bool              // the program opens the file system module
+	names    *NameMap
+	reads    map[*resolver.Binding]bool // the bindings main reads
+	resolver *resolver.Resolver
 }
 
 func New() *CodeGenerator {
-	g := &CodeGenerator{
-		imports:      make(map[string]bool),
-		declaredVars: make(map[string]bool),
-		scopeStack:   []map[string]bool{},
-	}
-	// Push initial scope
-	g.pushScope()
-	return g
+	return &CodeGenerator{
+		imports: make(map[string]bool),
+		aliases: make(map[string]string),
+	}
 }
 
+// Generate returns the Go source for program. The output depends only on the
+// program: identical input always yields byte-for-byte identical Go, so
+// generated files can be cached and diffed.
 func (g *CodeGenerator) Generate(program *ast.Program) (string, error) {
-	// Generate package declaration
-	g.write("package main\n\n")
+	g.imports = make(map[string]bool)
+	g.aliases = make(map[string]string)
+	g.fset = token.NewFileSet()
+	g.fs = false
+	
+	// Resolve bindings so dancers know what they capture
+	g.resolver = resolver.New()
+	g.resolver.Resolve(program)
+	if errs := g.resolver.Errors(); len(errs) > 0 {
+		return "", fmt.Errorf("unresolved program: %s", errs[0])
+	}
 	
-	// Process all statements to collect imports
-	for _, stmt := range program.Statements {
-		g.collectImports(stmt)
+	// Pick Go names for every declared binding up front
+	g.reads = readBindings(program.Statements, g.resolver)
+	g.names = newNameMap(program, g.reads)
+	
+	// Generate statements inside main; imports are collected on the way
+	body, err := g.generateBlock(program.Statements)
+	if err != nil {
+		return "", err
 	}
 	
-	// Generate imports
-	if len(g.imports) > 0 {
-		g.write("import (\n")
-		g.indent++
-		for imp := range g.imports {
-			g.writeLine(fmt.Sprintf(`"%s"`, imp))
+	var runtime []goast.Decl
+	if g.instrumented() {
+		// Main is dancer 0
+		begin := &goast.AssignStmt{
+			Lhs: []goast.Expr{dancerIdent()},
+			Tok: token.DEFINE,
+			Rhs: []goast.Expr{g.traceCall("begin", &goast.BasicLit{Kind: token.STRING, Value: strconv.Quote(g.Source)})},
+		}
+		end := &goast.DeferStmt{Call: g.traceCall("end", dancerIdent())}
+		body = append([]goast.Stmt{begin, end}, body...)
+		
+		var files []string
+		switch {
+		case g.Trace && g.Watch:
+			files = []string{"runtime/trace.go", "runtime/watch.go", "runtime/trace_watched.go"}
+		case g.Trace:
+			files = []string{"runtime/trace.go"}
+		case g.Watch:
+			files = []string{"runtime/watch.go", "runtime/watch_channels.go"}
+		}
+		if runtime, err = g.runtimeDecls(runtimeFiles, files...); err != nil {
+			return "", err
+		}
+		if g.Watch {
+			runtime = append(runtime, neverTable(program))
 		}
-		g.indent--
-		g.write(")\n\n")
 	}
 	
-	// Generate main function with all statements
-	g.write("func main() {\n")
-	g.indent++
-	
-	// Generate statements inside main
-	for _, stmt := range program.Statements {
-		if err := g.generateStatement(stmt); err != nil {
+	if g.fs {
+		decls, err := g.fsDecls()
+		if err != nil {
 			return "", err
 		}
+		runtime = append(runtime, decls...)
 	}
 	
-	g.indent--
-	g.write("}\n")
+	file := &goast.File{Name: goast.NewIdent("main")}
 	
-	return g.output.String(), nil
-}
-
-func (g *CodeGenerator) collectImports(stmt ast.Statement) {
-	switch s := stmt.(type) {
-	case *ast.ExpressionStatement:
-		if spin, ok := s.Expression.(*ast.SpinExpression); ok {
-			if ident, ok := spin.Function.(*ast.Identifier); ok {
-				if ident.Value == "print" || ident.Value == "println" {
-					g.imports["fmt"] = true
-				}
-			}
-		}
-	case *ast.SwayStatement:
-		g.collectImportsFromBlock(s.Body)
-	case *ast.StartStatement:
-		g.collectImports(s.Statement)
-	case *ast.IfStatement:
-		g.collectImportsFromBlock(s.Consequence)
-		if s.Alternative != nil {
-			g.collectImportsFromBlock(s.Alternative)
+	if len(g.imports) > 0 {
+		file.Decls = append(file.Decls, g.importDecl())
+	}
+	
+	main := &goast.FuncDecl{
+		Name: goast.NewIdent("main"),
+		Type: &goast.FuncType{Params: &goast.FieldList{}},
+		Body: &goast.BlockStmt{List: body},
+	}
+	
+	// Record renamed identifiers for readers of the generated code
+	if renames := g.names.Renames(); len(renames) > 0 {
+		text := "ChoreLang identifiers renamed to avoid Go keywords, builtins and imports:"
+		for _, r := range renames {
+			text += fmt.Sprintf("\n\t%s = %s", r[0], r[1])
 		}
+		main.Doc = docComment(text)
+	}
+	file.Decls = append(file.Decls, main)
+	file.Decls = append(file.Decls, runtime...)
+	
+	var out bytes.Buffer
+	if err := format.Node(&out, g.fset, file); err != nil {
+		return "", fmt.Errorf("printing generated Go: %v", err)
+	}
+	
+	// A final gofmt pass doubles as a syntax check of the whole file
+	formatted, err := format.Source(out.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("generated invalid Go: %v", err)
 	}
+	
+	return string(formatted), nil
+}
+
+// instrumented reports whether the program tells a runtime of its dancers
+// and channel operations.
+func (g *CodeGenerator) instrumented() bool {
+	return g.Trace || g.Watch
 }
 
-func (g *CodeGenerator) collectImportsFromBlock(block *ast.BlockStatement) {
-	for _, stmt := range block.Statements {
-		g.collectImports(stmt)
+// NameMap returns the identifier renames chosen by the last call to Generate.
+func (g *CodeGenerator) NameMap() *NameMap {
+	return g.names
+}
+
+func (g *CodeGenerator) generateBlock(stmts []ast.Statement) ([]goast.Stmt, error) {
+	list := []goast.Stmt{}
+	for _, stmt := range stmts {
+		s, err := g.generateStatement(stmt)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s...)
 	}
+	return list, nil
 }
 
-func (g *CodeGenerator) generateStatement(stmt ast.Statement) error {
+func (g *CodeGenerator) generateStatement(stmt ast.Statement) ([]goast.Stmt, error) {
 	switch s := stmt.(type) {
 	case *ast.DanceStatement:
 		return g.generateDanceStatement(s)
+	case *ast.AssignStatement:
+		return g.generateAssignStatement(s)
 	case *ast.ExpressionStatement:
 		return g.generateExpressionStatement(s)
 	case *ast.SwayStatement:
@@ -108,341 +192,469 @@ func (g *CodeGenerator) generateStatement(stmt ast.Statement) error {
 		return g.generateSendStatement(s)
 	case *ast.IfStatement:
 		return g.generateIfStatement(s)
+	case *ast.RehearseStatement:
+		// Rehearsals only run under chorelang test
+		return nil, nil
+	case *ast.EncoreStatement:
+		// Encores only run as benchmarks; see GenerateBenchmarks
+		return nil, nil
+	case *ast.BlockStatement:
+		// A nested block is its own scope in ChoreLang, and so in Go
+		list, err := g.generateBlock(s.Statements)
+		if err != nil {
+			return nil, err
+		}
+		return []goast.Stmt{&goast.BlockStmt{List: list}}, nil
 	default:
-		return fmt.Errorf("unknown statement type: %T", stmt)
+		return nil, fmt.Errorf("unknown statement type: %T", stmt)
 	}
 }
 
-func (g *CodeGenerator) generateDanceStatement(stmt *ast.DanceStatement) error {
-	g.writeIndent()
-	
-	// Check if variable is already declared in current scope
-	varName := stmt.Name.Value
-	if g.isVarDeclared(varName) {
-		// Use = for reassignment
-		g.write(varName)
-		g.write(" = ")
-	} else {
-		// Use := for new declaration
-		g.write(varName)
-		g.write(" := ")
-		g.declareVar(varName)
+func (g *CodeGenerator) generateDanceStatement(stmt *ast.DanceStatement) ([]goast.Stmt, error) {
+	value, err := g.generateExpression(stmt.Value)
+	if err != nil {
+		return nil, err
 	}
 	
-	if err := g.generateExpression(stmt.Value); err != nil {
-		return err
+	if g.blank(stmt.Name) {
+		return []goast.Stmt{&goast.AssignStmt{
+			Lhs: []goast.Expr{goast.NewIdent("_")},
+			Tok: token.ASSIGN,
+			Rhs: []goast.Expr{value},
+		}}, nil
 	}
 	
-	g.write("\n")
-	return nil
+	decl := []goast.Stmt{&goast.AssignStmt{
+		Lhs: []goast.Expr{g.ident(stmt.Name.Value)},
+		Tok: token.DEFINE,
+		Rhs: []goast.Expr{value},
+	}}
+	// ChoreLang allows a binding nothing reads, and Go does not; every
+	// binding a benchmark sets up may go unread
+	if g.bench || !g.reads[g.resolver.BindingOf(stmt.Name)] {
+		decl = append(decl, &goast.AssignStmt{
+			Lhs: []goast.Expr{goast.NewIdent("_")},
+			Tok: token.ASSIGN,
+			Rhs: []goast.Expr{g.ident(stmt.Name.Value)},
+		})
+	}
+	return decl, nil
 }
 
-func (g *CodeGenerator) generateExpressionStatement(stmt *ast.ExpressionStatement) error {
-	g.writeIndent()
-	if err := g.generateExpression(stmt.Expression); err != nil {
-		return err
+func (g *CodeGenerator) generateAssignStatement(stmt *ast.AssignStatement) ([]goast.Stmt, error) {
+	value, err := g.generateExpression(stmt.Value)
+	if err != nil {
+		return nil, err
+	}
+	
+	target := g.ident(stmt.Name.Value)
+	if g.blank(stmt.Name) {
+		target = goast.NewIdent("_")
 	}
-	g.write("\n")
-	return nil
+	return []goast.Stmt{&goast.AssignStmt{
+		Lhs: []goast.Expr{target},
+		Tok: token.ASSIGN,
+		Rhs: []goast.Expr{value},
+	}}, nil
 }
 
-func (g *CodeGenerator) generateSwayStatement(stmt *ast.SwayStatement) error {
-	g.writeIndent()
-	g.write("for ")
-	g.write(stmt.Variable.Value)
-	g.write(" := ")
-	
-	if err := g.generateExpression(stmt.From); err != nil {
-		return err
+func (g *CodeGenerator) generateExpressionStatement(stmt *ast.ExpressionStatement) ([]goast.Stmt, error) {
+	exp, err := g.generateExpression(stmt.Expression)
+	if err != nil {
+		return nil, err
 	}
-	
-	g.write("; ")
-	g.write(stmt.Variable.Value)
-	g.write(" <= ")
-	
-	if err := g.generateExpression(stmt.To); err != nil {
-		return err
+	return []goast.Stmt{&goast.ExprStmt{X: exp}}, nil
+}
+
+func (g *CodeGenerator) generateSwayStatement(stmt *ast.SwayStatement) ([]goast.Stmt, error) {
+	from, err := g.generateExpression(stmt.From)
+	if err != nil {
+		return nil, err
 	}
 	
-	g.write("; ")
-	g.write(stmt.Variable.Value)
-	g.write("++ {\n")
-	
-	// Push new scope for loop body
-	g.pushScope()
-	// Declare loop variable in new scope
-	g.declareVar(stmt.Variable.Value)
-	
-	g.indent++
-	for _, s := range stmt.Body.Statements {
-		if err := g.generateStatement(s); err != nil {
-			return err
-		}
+	to, err := g.generateExpression(stmt.To)
+	if err != nil {
+		return nil, err
 	}
-	g.indent--
-	
-	// Pop scope
-	g.popScope()
 	
-	g.writeIndent()
-	g.write("}\n")
+	body, err := g.generateBlock(stmt.Body.Statements)
+	if err != nil {
+		return nil, err
+	}
 	
-	return nil
+	loopVar := stmt.Variable.Value
+	
+	return []goast.Stmt{&goast.ForStmt{
+		Init: &goast.AssignStmt{
+			Lhs: []goast.Expr{g.ident(loopVar)},
+			Tok: token.DEFINE,
+			Rhs: []goast.Expr{from},
+		},
+		Cond: &goast.BinaryExpr{X: g.ident(loopVar), Op: token.LEQ, Y: to},
+		Post: &goast.IncDecStmt{X: g.ident(loopVar), Tok: token.INC},
+		Body: &goast.BlockStmt{List: body},
+	}}, nil
 }
 
-func (g *CodeGenerator) generateStartStatement(stmt *ast.StartStatement) error {
-	g.writeIndent()
-	g.write("go func() {\n")
+// generateStartStatement launches a goroutine. Every outer binding the
+// dancer uses is copied into a fresh variable first, so the dancer sees the
+// values at launch time no matter which Go version builds the output (loop
+// variables are shared between iterations before Go 1.22).
+func (g *CodeGenerator) generateStartStatement(stmt *ast.StartStatement) ([]goast.Stmt, error) {
+	var body []goast.Stmt
+	var err error
+	if block, ok := stmt.Statement.(*ast.BlockStatement); ok {
+		body, err = g.generateBlock(block.Statements)
+	} else {
+		body, err = g.generateStatement(stmt.Statement)
+	}
+	if err != nil {
+		return nil, err
+	}
 	
-	// Push new scope for goroutine
-	g.pushScope()
-	g.indent++
+	launch := &goast.GoStmt{Call: &goast.CallExpr{
+		Fun: &goast.FuncLit{
+			Type: &goast.FuncType{Params: &goast.FieldList{}},
+			Body: &goast.BlockStmt{List: body},
+		},
+	}}
+	
+	if g.instrumented() {
+		// The dancer gets its number as a parameter, shadowing its parent's
+		fn := launch.Call.Fun.(*goast.FuncLit)
+		fn.Type.Params.List = []*goast.Field{{Names: []*goast.Ident{dancerIdent()}, Type: goast.NewIdent("int")}}
+		fn.Body.List = append([]goast.Stmt{&goast.DeferStmt{Call: g.traceCall("end", dancerIdent())}}, fn.Body.List...)
+		launch.Call.Args = []goast.Expr{g.traceCall("spawn", dancerIdent(), intLiteral(stmt.Token.Line), intLiteral(stmt.Token.Column))}
+	}
 	
-	if err := g.generateStatement(stmt.Statement); err != nil {
-		return err
+	launched := []goast.Stmt{launch}
+	if g.bench {
+		count := &goast.CallExpr{Fun: &goast.SelectorExpr{X: goast.NewIdent("choreDancers"), Sel: goast.NewIdent("Add")}, Args: []goast.Expr{intLiteral(1)}}
+		launched = []goast.Stmt{&goast.ExprStmt{X: count}, launch}
 	}
 	
-	g.indent--
-	g.popScope()
+	captures := g.resolver.Captures(stmt)
+	if len(captures) == 0 {
+		return launched, nil
+	}
 	
-	g.writeIndent()
-	g.write("}()\n")
+	block := &goast.BlockStmt{}
+	for _, b := range captures {
+		block.List = append(block.List, &goast.AssignStmt{
+			Lhs: []goast.Expr{g.ident(b.Name)},
+			Tok: token.DEFINE,
+			Rhs: []goast.Expr{g.ident(b.Name)},
+		})
+	}
+	block.List = append(block.List, launched...)
 	
-	return nil
+	return []goast.Stmt{block}, nil
 }
 
-func (g *CodeGenerator) generateSendStatement(stmt *ast.SendStatement) error {
-	g.writeIndent()
-	
-	if err := g.generateExpression(stmt.Channel); err != nil {
-		return err
+func (g *CodeGenerator) generateSendStatement(stmt *ast.SendStatement) ([]goast.Stmt, error) {
+	channel, err := g.generateExpression(stmt.Channel)
+	if err != nil {
+		return nil, err
 	}
 	
-	g.write(" <- ")
+	value, err := g.generateExpression(stmt.Value)
+	if err != nil {
+		return nil, err
+	}
 	
-	if err := g.generateExpression(stmt.Value); err != nil {
-		return err
+	if g.instrumented() {
+		// choreSend(...)(value) sends value once the channel is known
+		send := &goast.CallExpr{
+			Fun:  goast.NewIdent("choreSend"),
+			Args: append(traceSite(stmt.Token.Line, stmt.Token.Column, stmt.Channel), channel),
+		}
+		return []goast.Stmt{&goast.ExprStmt{X: &goast.CallExpr{Fun: send, Args: []goast.Expr{value}}}}, nil
 	}
 	
-	g.write("\n")
-	return nil
+	return []goast.Stmt{&goast.SendStmt{Chan: channel, Value: value}}, nil
 }
 
-func (g *CodeGenerator) generateIfStatement(stmt *ast.IfStatement) error {
-	g.writeIndent()
-	g.write("if ")
-	
-	if err := g.generateExpression(stmt.Condition); err != nil {
-		return err
+func (g *CodeGenerator) generateIfStatement(stmt *ast.IfStatement) ([]goast.Stmt, error) {
+	cond, err := g.generateExpression(stmt.Condition)
+	if err != nil {
+		return nil, err
 	}
 	
-	g.write(" {\n")
-	
-	// Push scope for consequence
-	g.pushScope()
-	g.indent++
-	for _, s := range stmt.Consequence.Statements {
-		if err := g.generateStatement(s); err != nil {
-			return err
-		}
+	consequence, err := g.generateBlock(stmt.Consequence.Statements)
+	if err != nil {
+		return nil, err
 	}
-	g.indent--
-	g.popScope()
 	
-	g.writeIndent()
-	g.write("}")
+	ifStmt := &goast.IfStmt{Cond: cond, Body: &goast.BlockStmt{List: consequence}}
 	
 	if stmt.Alternative != nil {
-		g.write(" else {\n")
-		// Push scope for alternative
-		g.pushScope()
-		g.indent++
-		for _, s := range stmt.Alternative.Statements {
-			if err := g.generateStatement(s); err != nil {
-				return err
-			}
+		alternative, err := g.generateBlock(stmt.Alternative.Statements)
+		if err != nil {
+			return nil, err
 		}
-		g.indent--
-		g.popScope()
-		g.writeIndent()
-		g.write("}")
+		ifStmt.Else = &goast.BlockStmt{List: alternative}
 	}
 	
-	g.write("\n")
-	return nil
+	return []goast.Stmt{ifStmt}, nil
 }
 
-func (g *CodeGenerator) generateExpression(exp ast.Expression) error {
+func (g *CodeGenerator) generateExpression(exp ast.Expression) (goast.Expr, error) {
 	switch e := exp.(type) {
 	case *ast.Identifier:
-		g.write(e.Value)
+		return g.ident(e.Value), nil
 	case *ast.IntegerLiteral:
-		g.write(fmt.Sprintf("%d", e.Value))
+		return &goast.BasicLit{Kind: token.INT, Value: strconv.FormatInt(e.Value, 10)}, nil
 	case *ast.FloatLiteral:
-		g.write(fmt.Sprintf("%f", e.Value))
+		return floatLiteral(e.Value), nil
 	case *ast.StringLiteral:
-		g.write(fmt.Sprintf(`"%s"`, e.Value))
+		return &goast.BasicLit{Kind: token.STRING, Value: goStringLiteral(e.Value)}, nil
 	case *ast.Boolean:
-		g.write(fmt.Sprintf("%t", e.Value))
+		return goast.NewIdent(strconv.FormatBool(e.Value)), nil
 	case *ast.InfixExpression:
-		g.write("(")
-		if err := g.generateExpression(e.Left); err != nil {
-			return err
-		}
-		g.write(fmt.Sprintf(" %s ", e.Operator))
-		if err := g.generateExpression(e.Right); err != nil {
-			return err
-		}
-		g.write(")")
+		return g.generateInfixExpression(e)
 	case *ast.SpinExpression:
 		return g.generateSpinExpression(e)
+	case *ast.MemberCallExpression:
+		return g.generateMemberCall(e)
 	case *ast.FlowExpression:
 		return g.generateFlowExpression(e)
+	case *ast.ReceiveExpression:
+		channel, err := g.generateExpression(e.Channel)
+		if err != nil {
+			return nil, err
+		}
+		if g.instrumented() {
+			return &goast.CallExpr{
+				Fun:  goast.NewIdent("choreReceive"),
+				Args: append(traceSite(e.Token.Line, e.Token.Column, e.Channel), channel),
+			}, nil
+		}
+		return &goast.UnaryExpr{Op: token.ARROW, X: channel}, nil
 	case *ast.MatchExpression:
 		return g.generateMatchExpression(e)
 	default:
-		return fmt.Errorf("unknown expression type: %T", exp)
+		return nil, fmt.Errorf("unknown expression type: %T", exp)
 	}
-	return nil
 }
 
-func (g *CodeGenerator) generateSpinExpression(exp *ast.SpinExpression) error {
+var binaryOperators = map[string]token.Token{
+	"+":  token.ADD,
+	"-":  token.SUB,
+	"*":  token.MUL,
+	"/":  token.QUO,
+	"==": token.EQL,
+	"!=": token.NEQ,
+	"<":  token.LSS,
+	">":  token.GTR,
+	"<=": token.LEQ,
+	">=": token.GEQ,
+}
+
+// generateInfixExpression builds a binary expression. The printer does not
+// add parentheses, so operands are wrapped only where Go's precedence would
+// otherwise regroup the ChoreLang tree.
+func (g *CodeGenerator) generateInfixExpression(exp *ast.InfixExpression) (goast.Expr, error) {
+	if lit, ok := fold(exp); ok {
+		return lit, nil
+	}
+	
+	left, err := g.generateExpression(exp.Left)
+	if err != nil {
+		return nil, err
+	}
+	
+	right, err := g.generateExpression(exp.Right)
+	if err != nil {
+		return nil, err
+	}
+	
+	if exp.Operator == "=~" {
+		// x =~ pattern becomes regexp.MustCompile(pattern).MatchString(x)
+		g.imports["regexp"] = true
+		compile := &goast.CallExpr{
+			Fun:  &goast.SelectorExpr{X: goast.NewIdent("regexp"), Sel: goast.NewIdent("MustCompile")},
+			Args: []goast.Expr{right},
+		}
+		return &goast.CallExpr{
+			Fun:  &goast.SelectorExpr{X: compile, Sel: goast.NewIdent("MatchString")},
+			Args: []goast.Expr{left},
+		}, nil
+	}
+	
+	op, ok := binaryOperators[exp.Operator]
+	if !ok {
+		return nil, fmt.Errorf("unknown operator: %s", exp.Operator)
+	}
+	
+	if b, ok := left.(*goast.BinaryExpr); ok && b.Op.Precedence() < op.Precedence() {
+		left = &goast.ParenExpr{X: left}
+	}
+	if b, ok := right.(*goast.BinaryExpr); ok && b.Op.Precedence() <= op.Precedence() {
+		right = &goast.ParenExpr{X: right}
+	}
+	
+	return &goast.BinaryExpr{X: left, Op: op, Y: right}, nil
+}
+
+func (g *CodeGenerator) generateSpinExpression(exp *ast.SpinExpression) (goast.Expr, error) {
+	args := []goast.Expr{}
+	for _, arg := range exp.Arguments {
+		a, err := g.generateExpression(arg)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, a)
+	}
+	
 	// Handle built-in functions
 	if ident, ok := exp.Function.(*ast.Identifier); ok {
 		switch ident.Value {
 		case "print", "println":
-			g.write("fmt.Println(")
-			for i, arg := range exp.Arguments {
-				if i > 0 {
-					g.write(", ")
-				}
-				if err := g.generateExpression(arg); err != nil {
-					return err
-				}
+			g.imports["fmt"] = true
+			return &goast.CallExpr{
+				Fun:  &goast.SelectorExpr{X: goast.NewIdent("fmt"), Sel: goast.NewIdent("Println")},
+				Args: args,
+			}, nil
+		case "args":
+			// args() counts the arguments after the program name, and
+			// args(i) is os.Args[i]
+			g.imports["os"] = true
+			osArgs := &goast.SelectorExpr{X: goast.NewIdent("os"), Sel: goast.NewIdent("Args")}
+			switch len(args) {
+			case 0:
+				count := &goast.CallExpr{Fun: goast.NewIdent("len"), Args: []goast.Expr{osArgs}}
+				return &goast.BinaryExpr{X: count, Op: token.SUB, Y: &goast.BasicLit{Kind: token.INT, Value: "1"}}, nil
+			case 1:
+				return &goast.IndexExpr{X: osArgs, Index: args[0]}, nil
+			}
+			return nil, fmt.Errorf("args takes at most 1 argument, got %d", len(args))
+		case "exit":
+			if len(args) != 1 {
+				return nil, fmt.Errorf("exit takes 1 argument, got %d", len(args))
+			}
+			if g.instrumented() {
+				return g.traceCall("exit", dancerIdent(), args[0]), nil
 			}
-			g.write(")")
-			return nil
+			g.imports["os"] = true
+			return &goast.CallExpr{
+				Fun:  &goast.SelectorExpr{X: goast.NewIdent("os"), Sel: goast.NewIdent("Exit")},
+				Args: args,
+			}, nil
 		}
 	}
 	
 	// Regular function call
-	if err := g.generateExpression(exp.Function); err != nil {
-		return err
+	fn, err := g.generateExpression(exp.Function)
+	if err != nil {
+		return nil, err
 	}
 	
-	g.write("(")
-	for i, arg := range exp.Arguments {
-		if i > 0 {
-			g.write(", ")
-		}
-		if err := g.generateExpression(arg); err != nil {
-			return err
-		}
-	}
-	g.write(")")
-	
-	return nil
+	return &goast.CallExpr{Fun: fn, Args: args}, nil
 }
 
-func (g *CodeGenerator) generateFlowExpression(exp *ast.FlowExpression) error {
-	// For now, generate as a channel type
-	// flow channel<int> becomes chan int
+func (g *CodeGenerator) generateFlowExpression(exp *ast.FlowExpression) (goast.Expr, error) {
+	// flow channel<int> becomes make(chan int)
 	if ident, ok := exp.ChannelType.(*ast.Identifier); ok && ident.Value == "channel" {
-		g.write("make(chan ")
-		// TODO: Parse the type parameter properly
-		g.write("interface{})")
-	} else {
-		g.write("make(")
-		if err := g.generateExpression(exp.ChannelType); err != nil {
-			return err
-		}
-		g.write(")")
+		chanType := &goast.ChanType{Dir: goast.SEND | goast.RECV, Value: goast.NewIdent(goType(exp.ElementType))}
+		return &goast.CallExpr{Fun: goast.NewIdent("make"), Args: []goast.Expr{chanType}}, nil
 	}
-	return nil
+	
+	arg, err := g.generateExpression(exp.ChannelType)
+	if err != nil {
+		return nil, err
+	}
+	
+	return &goast.CallExpr{Fun: goast.NewIdent("make"), Args: []goast.Expr{arg}}, nil
 }
 
-func (g *CodeGenerator) generateMatchExpression(exp *ast.MatchExpression) error {
-	// Generate match as a switch statement
-	g.write("func() interface{} {\n")
-	g.indent++
-	g.writeIndent()
-	g.write("switch ")
-	if err := g.generateExpression(exp.Expression); err != nil {
-		return err
+// generateMatchExpression builds a switch inside an immediately invoked
+// function literal, so the match can be used as a value.
+func (g *CodeGenerator) generateMatchExpression(exp *ast.MatchExpression) (goast.Expr, error) {
+	subject, err := g.generateExpression(exp.Expression)
+	if err != nil {
+		return nil, err
 	}
-	g.write(" {\n")
 	
+	cases := []goast.Stmt{}
 	for _, c := range exp.Cases {
-		g.writeIndent()
-		g.write("case ")
-		if err := g.generateExpression(c.Pattern); err != nil {
-			return err
+		pattern, err := g.generateExpression(c.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		
+		// In a case, `flow value` yields the value rather than a channel
+		consequence := c.Consequence
+		if flow, ok := consequence.(*ast.FlowExpression); ok && flow.ElementType == nil {
+			consequence = flow.ChannelType
 		}
-		g.write(":\n")
-		g.indent++
-		g.writeIndent()
-		g.write("return ")
-		if err := g.generateExpression(c.Consequence); err != nil {
-			return err
+		
+		result, err := g.generateExpression(consequence)
+		if err != nil {
+			return nil, err
 		}
-		g.write("\n")
-		g.indent--
+		
+		cases = append(cases, &goast.CaseClause{
+			List: []goast.Expr{pattern},
+			Body: []goast.Stmt{&goast.ReturnStmt{Results: []goast.Expr{result}}},
+		})
 	}
 	
-	g.writeIndent()
-	g.write("}\n")
-	g.writeIndent()
-	g.write("return nil\n")
-	g.indent--
-	g.writeIndent()
-	g.write("}()")
-	
-	return nil
-}
-
-func (g *CodeGenerator) write(s string) {
-	g.output.WriteString(s)
+	return &goast.CallExpr{
+		Fun: &goast.FuncLit{
+			Type: &goast.FuncType{
+				Params:  &goast.FieldList{},
+				Results: &goast.FieldList{List: []*goast.Field{{Type: goast.NewIdent("interface{}")}}},
+			},
+			Body: &goast.BlockStmt{List: []goast.Stmt{
+				&goast.SwitchStmt{Tag: subject, Body: &goast.BlockStmt{List: cases}},
+				&goast.ReturnStmt{Results: []goast.Expr{goast.NewIdent("nil")}},
+			}},
+		},
+	}, nil
 }
 
-func (g *CodeGenerator) writeLine(s string) {
-	g.writeIndent()
-	g.output.WriteString(s)
-	g.output.WriteString("\n")
+// ident returns the Go identifier for a ChoreLang name.
+func (g *CodeGenerator) ident(name string) *goast.Ident {
+	return goast.NewIdent(g.names.GoName(name))
 }
 
-func (g *CodeGenerator) writeIndent() {
-	g.output.WriteString(strings.Repeat("\t", g.indent))
+// blank reports whether name is a `_` binding nothing reads, which Go
+// writes as its blank identifier: Go rejects a variable never used.
+func (g *CodeGenerator) blank(name *ast.Identifier) bool {
+	b := g.resolver.BindingOf(name)
+	return name.Value == "_" && b != nil && !g.reads[b]
 }
 
-func (g *CodeGenerator) pushScope() {
-	newScope := make(map[string]bool)
-	// Copy parent scope variables
-	if len(g.scopeStack) > 0 {
-		parentScope := g.scopeStack[len(g.scopeStack)-1]
-		for k, v := range parentScope {
-			newScope[k] = v
-		}
+// floatLiteral prints the shortest literal that reads back as exactly v and
+// still has float type in Go.
+func floatLiteral(v float64) *goast.BasicLit {
+	lit := strconv.FormatFloat(v, 'g', -1, 64)
+	if !strings.ContainsAny(lit, ".e") {
+		lit += ".0"
 	}
-	g.scopeStack = append(g.scopeStack, newScope)
+	return &goast.BasicLit{Kind: token.FLOAT, Value: lit}
 }
 
-func (g *CodeGenerator) popScope() {
-	if len(g.scopeStack) > 0 {
-		g.scopeStack = g.scopeStack[:len(g.scopeStack)-1]
-	}
+// goStringLiteral converts the raw text between a ChoreLang string's quotes
+// into a Go string literal with the same value. Strings may span lines,
+// which Go's interpreted literals cannot.
+func goStringLiteral(raw string) string {
+	return strconv.Quote(lexer.Unquote(raw))
 }
 
-func (g *CodeGenerator) isVarDeclared(name string) bool {
-	if len(g.scopeStack) > 0 {
-		currentScope := g.scopeStack[len(g.scopeStack)-1]
-		return currentScope[name]
+// goType maps a ChoreLang element type name to its Go equivalent. Unknown or
+// missing types fall back to interface{}.
+func goType(ident *ast.Identifier) string {
+	if ident == nil {
+		return "interface{}"
 	}
-	return false
-}
-
-func (g *CodeGenerator) declareVar(name string) {
-	if len(g.scopeStack) > 0 {
-		currentScope := g.scopeStack[len(g.scopeStack)-1]
-		currentScope[name] = true
+	
+	switch ident.Value {
+	case "int", "string", "bool":
+		return ident.Value
+	case "float":
+		return "float64"
+	default:
+		return "interface{}"
 	}
 }
\ No newline at end of file
@@ -1,6 +1,7 @@
 package codegen
 
 import (
+	"go/format"
 	"strings"
 	"testing"
 	
@@ -24,7 +25,7 @@ import (
 func main() {
 	x := 5
 	y := 10
-	fmt.Println((x + y))
+	fmt.Println(x + y)
 }`
 	
 	result := generateAndCompare(t, input, expected)
@@ -138,7 +139,7 @@ import (
 func main() {
 	x := 5
 	y := 10
-	if (x < y) {
+	if x < y {
 		fmt.Println("x is less than y")
 	} else {
 		fmt.Println("x is not less than y")
@@ -162,6 +163,520 @@ func main() {
 	}
 }
 
+func TestGenerateDanceAndAssignInNestedScope(t *testing.T) {
+	input := `
+dance a = 0
+dance b = 1
+sway i from 0 to 3 {
+    dance temp = a + b
+    a = b
+    b = temp
+}
+`
+	
+	expected := `package main
+
+func main() {
+	a := 0
+	b := 1
+	for i := 0; i <= 3; i++ {
+		temp := a + b
+		a = b
+		b = temp
+	}
+}`
+	
+	result := generateAndCompare(t, input, expected)
+	if result != normalizeWhitespace(expected) {
+		t.Errorf("Generated code does not match expected.\nGot:\n%s\n\nExpected:\n%s", result, expected)
+	}
+}
+
+func TestGenerateStartCapturesLoopVariable(t *testing.T) {
+	input := `
+flow results = flow channel<int>
+sway w from 1 to 3 {
+    start {
+        dance doubled = w * 2
+        send results <- doubled
+    }
+}
+`
+	
+	expected := `package main
+
+func main() {
+	results := make(chan int)
+	for w := 1; w <= 3; w++ {
+		{
+			w := w
+			results := results
+			go func() {
+				doubled := w * 2
+				results <- doubled
+			}()
+		}
+	}
+}`
+	
+	result := generateAndCompare(t, input, expected)
+	if result != normalizeWhitespace(expected) {
+		t.Errorf("Generated code does not match expected.\nGot:\n%s\n\nExpected:\n%s", result, expected)
+	}
+}
+
+func TestGenerateParenthesesFollowGoPrecedence(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"dance r = a + b * c", "r := a + b*c"},
+		{"dance r = (a + b) * c", "r := (a + b) * c"},
+		{"dance r = a - (b - c)", "r := a - (b - c)"},
+		{"dance r = a - b - c", "r := a - b - c"},
+		{"dance r = a == b < c", "r := a == (b < c)"},
+		{"dance r = a / (b * c)", "r := a / (b * c)"},
+	}
+	
+	for _, tt := range tests {
+		result := generateCode(t, "dance a = 1\ndance b = 2\ndance c = 3\n"+tt.input)
+		if !strings.Contains(result, tt.expected) {
+			t.Errorf("input %q: expected %q in:\n%s", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestGenerateExactLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`dance f = 0.000000001`, "f := 1e-09"},
+		{`dance f = 2.50`, "f := 2.5"},
+		{`dance f = 3.0`, "f := 3.0"},
+		{`dance f = 123456789.123456789`, "f := 1.2345678912345679e+08"},
+		{`dance s = "tab\there"`, `s := "tab\there"`},
+		{`dance s = "say \"hi\""`, `s := "say \"hi\""`},
+		{"dance s = \"two\nlines\"", `s := "two\nlines"`},
+	}
+	
+	for _, tt := range tests {
+		result := generateCode(t, tt.input)
+		if !strings.Contains(result, tt.expected) {
+			t.Errorf("input %q: expected %q in:\n%s", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestGenerateMatchExpression(t *testing.T) {
+	input := `
+dance item = "Note"
+dance result = match item {
+    when "Note": flow "process_note"
+    when "Rest": flow "handle_rest"
+}
+spin print(result)
+`
+	
+	expected := `package main
+
+import (
+	"fmt"
+)
+
+func main() {
+	item := "Note"
+	result := func() interface{} {
+		switch item {
+		case "Note":
+			return "process_note"
+		case "Rest":
+			return "handle_rest"
+		}
+		return nil
+	}()
+	fmt.Println(result)
+}`
+	
+	result := generateAndCompare(t, input, expected)
+	if result != normalizeWhitespace(expected) {
+		t.Errorf("Generated code does not match expected.\nGot:\n%s\n\nExpected:\n%s", result, expected)
+	}
+}
+
+func TestGeneratePatternMatchOperator(t *testing.T) {
+	input := `
+dance name = "step"
+if name =~ "st.+" {
+    spin print("matched")
+}
+`
+	
+	expected := `package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+func main() {
+	name := "step"
+	if regexp.MustCompile("st.+").MatchString(name) {
+		fmt.Println("matched")
+	}
+}`
+	
+	result := generateAndCompare(t, input, expected)
+	if result != normalizeWhitespace(expected) {
+		t.Errorf("Generated code does not match expected.\nGot:\n%s\n\nExpected:\n%s", result, expected)
+	}
+}
+
+func TestGenerateArgsAndExit(t *testing.T) {
+	input := `
+sway i from 1 to spin args() {
+    spin print(spin args(i))
+}
+spin exit(2)
+`
+	
+	expected := `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	for i := 1; i <= len(os.Args)-1; i++ {
+		fmt.Println(os.Args[i])
+	}
+	os.Exit(2)
+}`
+	
+	result := generateAndCompare(t, input, expected)
+	if result != normalizeWhitespace(expected) {
+		t.Errorf("Generated code does not match expected.\nGot:\n%s\n\nExpected:\n%s", result, expected)
+	}
+}
+
+func TestGenerateFileSystem(t *testing.T) {
+	input := `
+dance fs = "notes.txt"
+flow files = chore.fs()
+files.write("copy.txt", files.read(fs))
+if files.exists("copy.txt") {
+    spin print(files.glob("*.txt"), files.list("/"), files.stat(fs), files.tempdir())
+}
+spin print(files.watch("*.txt", 10), files)
+files.remove("copy.txt")
+`
+	
+	expected := `package main
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func main() {
+	fs := "notes.txt"
+	files := choreFSOpen(3, 20)
+	files.write(4, 7, "copy.txt", files.read(4, 31, fs))
+	if files.exists(5, 10, "copy.txt") {
+		fmt.Println(files.glob(6, 22, "*.txt"), files.list(6, 43, "/"), files.stat(6, 60, fs), files.tempdir(6, 76))
+	}
+	fmt.Println(files.watch(8, 18, "*.txt", 10), files)
+	files.remove(9, 7, "copy.txt")
+}`
+	
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parser errors: %v", p.Errors())
+	}
+	
+	result, err := New().Generate(program)
+	if err != nil {
+		t.Fatalf("Code generation error: %v", err)
+	}
+	
+	// The file system runtime follows main, and the sandbox follows it
+	runtime := strings.Index(result, "\n// choreFSSandbox is")
+	if runtime < 0 || !strings.Contains(result, "\nfunc Dir(root string) (*Sandbox, error) {") {
+		t.Fatalf("program lacks the file system runtime:\n%s", result)
+	}
+	if got := normalizeWhitespace(result[:runtime]); got != normalizeWhitespace(expected) {
+		t.Errorf("Generated code does not match expected.\nGot:\n%s\n\nExpected:\n%s", got, expected)
+	}
+}
+
+func TestGenerateTrace(t *testing.T) {
+	input := `
+flow channel<float> ch
+start send ch <- 1
+spin print(<-ch)
+spin exit(2)
+`
+	
+	expected := `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+func main() {
+	choreDancer := choreTrace.begin("t.chore")
+	defer choreTrace.end(choreDancer)
+	ch := make(chan float64)
+	{
+		ch := ch
+		go func(choreDancer int) {
+			defer choreTrace.end(choreDancer)
+			choreSend(choreDancer, 3, 7, "ch", ch)(1)
+		}(choreTrace.spawn(choreDancer, 3, 1))
+	}
+	fmt.Println(choreReceive(choreDancer, 4, 12, "ch", ch))
+	choreTrace.exit(choreDancer, 2)
+}`
+	
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parser errors: %v", p.Errors())
+	}
+	
+	g := New()
+	g.Trace = true
+	g.Source = "t.chore"
+	result, err := g.Generate(program)
+	if err != nil {
+		t.Fatalf("Code generation error: %v", err)
+	}
+	
+	// The tracing runtime follows main
+	runtime := strings.Index(result, "\n// choreTrace records")
+	if runtime < 0 {
+		t.Fatalf("traced program lacks the tracing runtime:\n%s", result)
+	}
+	if got := normalizeWhitespace(result[:runtime]); got != normalizeWhitespace(expected) {
+		t.Errorf("Generated code does not match expected.\nGot:\n%s\n\nExpected:\n%s", got, expected)
+	}
+}
+
+func TestGenerateWatch(t *testing.T) {
+	input := `
+flow channel<int> ch
+start send ch <- 1
+spin print(<-ch)
+flow channel<int> never
+send never <- 2
+`
+	
+	expected := `package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+func main() {
+	choreDancer := choreWatch.begin("w.chore")
+	defer choreWatch.end(choreDancer)
+	ch := make(chan int)
+	{
+		ch := ch
+		go func(choreDancer int) {
+			defer choreWatch.end(choreDancer)
+			choreSend(choreDancer, 3, 7, "ch", ch)(1)
+		}(choreWatch.spawn(choreDancer, 3, 1))
+	}
+	fmt.Println(choreReceive(choreDancer, 4, 12, "ch", ch))
+	never := make(chan int)
+	choreSend(choreDancer, 6, 1, "never", never)(2)
+}`
+	
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parser errors: %v", p.Errors())
+	}
+	
+	g := New()
+	g.Watch = true
+	g.Source = "w.chore"
+	result, err := g.Generate(program)
+	if err != nil {
+		t.Fatalf("Code generation error: %v", err)
+	}
+	
+	runtime := strings.Index(result, "\n// choreWatch reports")
+	if runtime < 0 {
+		t.Fatalf("watched program lacks the watching runtime:\n%s", result)
+	}
+	if got := normalizeWhitespace(result[:runtime]); got != normalizeWhitespace(expected) {
+		t.Errorf("Generated code does not match expected.\nGot:\n%s\n\nExpected:\n%s", got, expected)
+	}
+	// Only the send on never can never complete
+	if !strings.Contains(result, "var choreNever = map[[2]int]bool{{6, 1}: true}") {
+		t.Errorf("watched program lacks its hints:\n%s", result[runtime:])
+	}
+	
+	// A traced program's tracer tells the watcher what happens
+	g.Trace = true
+	result, err = g.Generate(program)
+	if err != nil {
+		t.Fatalf("Code generation error: %v", err)
+	}
+	if !strings.Contains(result, "choreWatching = choreWatch") || strings.Count(result, "func choreSend[") != 1 {
+		t.Errorf("traced and watched program wrong:\n%s", result)
+	}
+}
+
+func TestGenerateBenchmarks(t *testing.T) {
+	input := `
+dance rounds = 3
+spin print("setup")
+rehearse "ignored" {
+    spin expect(true)
+}
+encore "sums" {
+    dance total = 0
+    sway i from 1 to rounds {
+        total = total + i
+    }
+}
+encore "pings" {
+    flow ch = flow channel<int>
+    start send ch <- 1
+    dance v = <-ch
+}
+`
+	
+	expected := `package main
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+// BenchmarkEncore1 is encore "sums".
+func BenchmarkEncore1(choreB *testing.B) {
+	defer choreQuiet()()
+	rounds := 3
+	_ = rounds
+	fmt.Println("setup")
+	choreB.ReportAllocs()
+	choreDancers.Store(0)
+	choreB.ResetTimer()
+	for choreRound := 0; choreRound < choreB.N; choreRound++ {
+		total := 0
+		_ = total
+		for i := 1; i <= rounds; i++ {
+			total = total + i
+		}
+	}
+	choreB.ReportMetric(float64(choreDancers.Load())/float64(choreB.N), "dancers/op")
+}
+
+// BenchmarkEncore2 is encore "pings".
+func BenchmarkEncore2(choreB *testing.B) {
+	defer choreQuiet()()
+	rounds := 3
+	_ = rounds
+	fmt.Println("setup")
+	choreB.ReportAllocs()
+	choreDancers.Store(0)
+	choreB.ResetTimer()
+	for choreRound := 0; choreRound < choreB.N; choreRound++ {
+		ch := make(chan int)
+		_ = ch
+		{
+			ch := ch
+			choreDancers.Add(1)
+			go func() {
+				ch <- 1
+			}()
+		}
+		v := <-ch
+		_ = v
+	}
+	choreB.ReportMetric(float64(choreDancers.Load())/float64(choreB.N), "dancers/op")
+}`
+	
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parser errors: %v", p.Errors())
+	}
+	
+	result, err := New().GenerateBenchmarks(program)
+	if err != nil {
+		t.Fatalf("Code generation error: %v", err)
+	}
+	
+	// The benchmark runtime follows the benchmarks
+	runtime := strings.Index(result, "\n// choreDancers counts")
+	if runtime < 0 {
+		t.Fatalf("benchmarks lack their runtime:\n%s", result)
+	}
+	if got := normalizeWhitespace(result[:runtime]); got != normalizeWhitespace(expected) {
+		t.Errorf("Generated code does not match expected.\nGot:\n%s\n\nExpected:\n%s", got, expected)
+	}
+	
+	// Generating benchmarks leaves plain generation alone
+	if plain, err := New().Generate(program); err != nil || strings.Contains(plain, "choreDancers") {
+		t.Errorf("plain program changed by benchmarks: %v\n%s", err, plain)
+	}
+	
+	program = parser.New(lexer.New("spin print(1)")).ParseProgram()
+	if _, err := New().GenerateBenchmarks(program); err == nil || err.Error() != "no encores to benchmark" {
+		t.Errorf("expected an error for a program without encores, got %v", err)
+	}
+}
+
+func TestGeneratedCodeIsGofmtClean(t *testing.T) {
+	input := `
+dance n = 10
+sway i from 0 to n {
+    if i - 1 * 2 > n / 2 {
+        start spin print(i, n)
+    }
+}
+`
+	
+	result := generateCode(t, input)
+	
+	formatted, err := format.Source([]byte(result))
+	if err != nil {
+		t.Fatalf("generated code does not parse: %v", err)
+	}
+	
+	if string(formatted) != result {
+		t.Errorf("generated code is not gofmt-clean.\nGot:\n%s\n\ngofmt:\n%s", result, formatted)
+	}
+}
+
 func generateAndCompare(t *testing.T, input, expected string) string {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -184,6 +699,24 @@ func generateAndCompare(t *testing.T, input, expected string) string {
 	return result
 }
 
+// generateCode parses input and returns the generated Go code.
+func generateCode(t *testing.T, input string) string {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parser errors: %v", p.Errors())
+	}
+	
+	result, err := New().Generate(program)
+	if err != nil {
+		t.Fatalf("Code generation error: %v", err)
+	}
+	
+	return result
+}
+
 func normalizeWhitespace(s string) string {
 	// Split by newline and remove trailing spaces
 	lines := strings.Split(s, "\n")
@@ -0,0 +1,140 @@
+package codegen
+
+import (
+	goast "go/ast"
+	"go/constant"
+	"go/token"
+	"math"
+	"strconv"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/ops"
+)
+
+// Go evaluates arithmetic on literals exactly, as it compiles, where the
+// interpreter and the VM use int64 and float64 as they run: 0.1 + 0.2 is
+// 0.3 in Go and 0.30000000000000004 elsewhere, and an int that wraps
+// elsewhere does not compile in Go. So the generator works out such
+// arithmetic with the operators of package ops, which those backends
+// share, and writes the result wherever Go's would differ.
+
+// fold returns the literal for exp if it is arithmetic or a comparison on
+// literals alone whose Go constant value would differ from its value on
+// the other backends.
+func fold(exp *ast.InfixExpression) (goast.Expr, bool) {
+	value, ok := evaluate(exp)
+	if !ok {
+		return nil, false
+	}
+	if exact, ok := exactValue(exp); ok && sameValue(value, exact) {
+		return nil, false
+	}
+	return valueLiteral(value)
+}
+
+// evaluate computes a literal-only expression as the other backends do.
+func evaluate(exp ast.Expression) (interface{}, bool) {
+	switch e := exp.(type) {
+	case *ast.IntegerLiteral:
+		return e.Value, true
+	case *ast.FloatLiteral:
+		return e.Value, true
+	case *ast.Boolean:
+		return e.Value, true
+	case *ast.InfixExpression:
+		if _, ok := binaryOperators[e.Operator]; !ok {
+			return nil, false
+		}
+		left, ok := evaluate(e.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := evaluate(e.Right)
+		if !ok {
+			return nil, false
+		}
+		value, err := ops.Binary(e.Operator, left, right)
+		return value, err == nil
+	}
+	return nil, false
+}
+
+// exactValue computes a literal-only expression as Go's constants do.
+func exactValue(exp ast.Expression) (constant.Value, bool) {
+	switch e := exp.(type) {
+	case *ast.IntegerLiteral:
+		return constant.MakeInt64(e.Value), true
+	case *ast.FloatLiteral:
+		return constant.MakeFromLiteral(floatLiteral(e.Value).Value, token.FLOAT, 0), true
+	case *ast.Boolean:
+		return constant.MakeBool(e.Value), true
+	case *ast.InfixExpression:
+		left, ok := exactValue(e.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := exactValue(e.Right)
+		if !ok {
+			return nil, false
+		}
+		op := binaryOperators[e.Operator]
+		switch op {
+		case token.EQL, token.NEQ, token.LSS, token.GTR, token.LEQ, token.GEQ:
+			if left.Kind() == constant.Bool && op != token.EQL && op != token.NEQ {
+				return nil, false
+			}
+			return constant.MakeBool(constant.Compare(left, op, right)), true
+		case token.QUO:
+			if constant.Sign(right) == 0 {
+				return nil, false
+			}
+			if left.Kind() == constant.Int && right.Kind() == constant.Int {
+				// Go's / truncates untyped ints
+				op = token.QUO_ASSIGN
+			}
+		}
+		if left.Kind() == constant.Bool || right.Kind() == constant.Bool {
+			return nil, false
+		}
+		return constant.BinaryOp(left, op, right), true
+	}
+	return nil, false
+}
+
+// sameValue reports whether Go's constant exact prints as value does.
+func sameValue(value interface{}, exact constant.Value) bool {
+	switch v := value.(type) {
+	case int64:
+		n, ok := constant.Int64Val(exact)
+		return exact.Kind() == constant.Int && ok && n == v
+	case float64:
+		f, _ := constant.Float64Val(constant.ToFloat(exact))
+		return exact.Kind() == constant.Float && f == v
+	case bool:
+		return exact.Kind() == constant.Bool && constant.BoolVal(exact) == v
+	}
+	return false
+}
+
+// valueLiteral writes a value worked out by evaluate as Go.
+func valueLiteral(value interface{}) (goast.Expr, bool) {
+	var lit *goast.BasicLit
+	switch v := value.(type) {
+	case bool:
+		return goast.NewIdent(strconv.FormatBool(v)), true
+	case int64:
+		lit = &goast.BasicLit{Kind: token.INT, Value: strconv.FormatInt(v, 10)}
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return nil, false
+		}
+		lit = floatLiteral(v)
+	default:
+		return nil, false
+	}
+	if lit.Value[0] == '-' {
+		lit.Value = lit.Value[1:]
+		return &goast.UnaryExpr{Op: token.SUB, X: lit}, true
+	}
+	return lit, true
+}
\ No newline at end of file
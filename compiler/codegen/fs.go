@@ -0,0 +1,72 @@
+package codegen
+
+import (
+	"fmt"
+	goast "go/ast"
+	"go/token"
+	"strconv"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/fs"
+)
+
+// generateMemberCall calls a member of the file system module, a method of
+// the runtime's *choreFSModule, or opens the module for chore.fs(). Either
+// makes the program carry the file system runtime. The call passes the
+// member's position, where a failure is reported.
+func (g *CodeGenerator) generateMemberCall(exp *ast.MemberCallExpression) (goast.Expr, error) {
+	args := []goast.Expr{intLiteral(exp.Member.Token.Line), intLiteral(exp.Member.Token.Column)}
+	for _, arg := range exp.Arguments {
+		a, err := g.generateExpression(arg)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, a)
+	}
+	g.fs = true
+	
+	// chore, unless the program declares its own, is the library
+	if ident, ok := exp.Receiver.(*ast.Identifier); ok && ident.Value == "chore" && g.resolver.BindingOf(ident) == nil {
+		if err := fs.CheckOpen(exp.Member.Value, len(exp.Arguments)); err != nil {
+			return nil, err
+		}
+		return &goast.CallExpr{Fun: goast.NewIdent("choreFSOpen"), Args: args}, nil
+	}
+	
+	member, ok := fs.Members[exp.Member.Value]
+	if !ok {
+		return nil, fmt.Errorf("fs has no member %s", exp.Member.Value)
+	}
+	if err := member.CheckArity(len(exp.Arguments)); err != nil {
+		return nil, err
+	}
+	receiver, err := g.generateExpression(exp.Receiver)
+	if err != nil {
+		return nil, err
+	}
+	return &goast.CallExpr{
+		Fun:  &goast.SelectorExpr{X: receiver, Sel: goast.NewIdent(member.Name)},
+		Args: args,
+	}, nil
+}
+
+// fsDecls are the file system runtime, the name of the source its errors
+// give, and the sandbox of package fs it runs on.
+func (g *CodeGenerator) fsDecls() ([]goast.Decl, error) {
+	runtime, err := g.runtimeDecls(runtimeFiles, "runtime/fs.go")
+	if err != nil {
+		return nil, err
+	}
+	runtime = append(runtime, &goast.GenDecl{
+		Tok: token.CONST,
+		Specs: []goast.Spec{&goast.ValueSpec{
+			Names:  []*goast.Ident{goast.NewIdent("choreFSSource")},
+			Values: []goast.Expr{&goast.BasicLit{Kind: token.STRING, Value: strconv.Quote(g.Source)}},
+		}},
+	})
+	sandbox, err := g.runtimeDecls(fs.Source, "fs.go", "dir.go", "watch.go")
+	if err != nil {
+		return nil, err
+	}
+	return append(runtime, sandbox...), nil
+}
\ No newline at end of file
@@ -0,0 +1,119 @@
+package codegen
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/parser"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// TestGoldenConstructs locks in the generated Go for every language
+// construct under testdata.
+func TestGoldenConstructs(t *testing.T) {
+	runGoldenFiles(t, "testdata/*.chore", "testdata", nil)
+}
+
+// TestGoldenExamples locks in the generated Go for every example program.
+func TestGoldenExamples(t *testing.T) {
+	runGoldenFiles(t, "../../examples/*.chore", "testdata/examples", nil)
+}
+
+// TestGoldenWatched locks in the Go chorelang build and run -go generate
+// by default, which names the dancers of a deadlock or a leak.
+func TestGoldenWatched(t *testing.T) {
+	runGoldenFiles(t, "testdata/instrumented/*.chore", "testdata/instrumented/watch", func(g *CodeGenerator) {
+		g.Watch = true
+	})
+}
+
+// TestGoldenTraced locks in the Go of chorelang build -trace, which also
+// records a trace.
+func TestGoldenTraced(t *testing.T) {
+	runGoldenFiles(t, "testdata/instrumented/*.chore", "testdata/instrumented/trace", func(g *CodeGenerator) {
+		g.Watch = true
+		g.Trace = true
+	})
+}
+
+// runGoldenFiles compares the Go generated for the files matching pattern
+// with their golden files in goldenDir. configure, if set, sets up each
+// generator as a chorelang command would.
+func runGoldenFiles(t *testing.T, pattern, goldenDir string, configure func(*CodeGenerator)) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no files match %s", pattern)
+	}
+	
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".chore")
+		golden := filepath.Join(goldenDir, name+".golden")
+		
+		t.Run(name, func(t *testing.T) {
+			source, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			
+			generate := func() string {
+				g := New()
+				g.Source = filepath.Base(file)
+				if configure != nil {
+					configure(g)
+				}
+				return generateFromSource(t, g, string(source))
+			}
+			result := generate()
+			
+			// Output must be byte-for-byte reproducible across runs
+			for i := 0; i < 10; i++ {
+				if again := generate(); again != result {
+					t.Fatalf("generation is not reproducible.\nFirst:\n%s\n\nLater:\n%s", result, again)
+				}
+			}
+			
+			if *update {
+				if err := os.WriteFile(golden, []byte(result), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("missing golden file (run go test -update): %v", err)
+			}
+			
+			if result != string(expected) {
+				t.Errorf("generated code does not match %s.\nGot:\n%s\n\nExpected:\n%s", golden, result, expected)
+			}
+		})
+	}
+}
+
+// generateFromSource runs a fresh lexer and parser over source, and g over
+// the program.
+func generateFromSource(t *testing.T, g *CodeGenerator, source string) string {
+	l := lexer.New(source)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parser errors: %v", p.Errors())
+	}
+	
+	result, err := g.Generate(program)
+	if err != nil {
+		t.Fatalf("Code generation error: %v", err)
+	}
+	
+	return result
+}
\ No newline at end of file
@@ -0,0 +1,252 @@
+package codegen
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+	"strings"
+	"unicode"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/resolver"
+)
+
+// goReserved lists names a ChoreLang binding may not use verbatim in the
+// generated Go: predeclared identifiers, which a local binding would
+// silently shadow, and the packages the generator may import. Go keywords
+// are rejected separately through go/token.
+var goReserved = map[string]bool{
+	// Predeclared types
+	"any": true, "bool": true, "byte": true, "comparable": true,
+	"complex64": true, "complex128": true, "error": true,
+	"float32": true, "float64": true, "int": true, "int8": true,
+	"int16": true, "int32": true, "int64": true, "rune": true,
+	"string": true, "uint": true, "uint8": true, "uint16": true,
+	"uint32": true, "uint64": true, "uintptr": true,
+	
+	// Predeclared constants and zero value
+	"true": true, "false": true, "iota": true, "nil": true,
+	
+	// Predeclared functions
+	"append": true, "cap": true, "clear": true, "close": true,
+	"complex": true, "copy": true, "delete": true, "imag": true,
+	"len": true, "make": true, "max": true, "min": true, "new": true,
+	"panic": true, "print": true, "println": true, "real": true,
+	"recover": true,
+	
+	// The blank identifier
+	"_": true,
+	
+	// Packages the generator may import
+	"atomic": true, "fmt": true, "os": true, "regexp": true, "testing": true,
+	
+	// Names traced and watched programs use inside main
+	"choreDancer": true, "choreReceive": true, "choreSend": true, "choreTrace": true,
+	"choreWatch": true,
+	
+	// Names programs that reach the file system use inside main
+	"choreFSOpen": true,
+	
+	// Names benchmarks use
+	"choreB": true, "choreDancers": true, "choreQuiet": true, "choreRound": true,
+}
+
+// NameMap records how ChoreLang identifiers were renamed in the generated
+// Go, so diagnostics and debuggers can show the original names.
+type NameMap struct {
+	toGo    map[string]string
+	toChore map[string]string
+}
+
+// newNameMap assigns a Go name to every binding declared in the program,
+// including those inside rehearsals and encores.
+// Names are processed in sorted order so the result depends only on the set
+// of identifiers, never on map iteration order. A `_` that nothing reads is
+// Go's blank identifier, and needs no name of its own.
+func newNameMap(program *ast.Program, reads map[*resolver.Binding]bool) *NameMap {
+	declared := make(map[string]bool)
+	collectDeclaredNames(program.Statements, declared)
+	blankRead := false
+	for b := range reads {
+		blankRead = blankRead || b.Name == "_"
+	}
+	if !blankRead {
+		delete(declared, "_")
+	}
+	
+	names := make([]string, 0, len(declared))
+	for name := range declared {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	
+	m := &NameMap{
+		toGo:    make(map[string]string),
+		toChore: make(map[string]string),
+	}
+	
+	taken := make(map[string]bool)
+	for name := range declared {
+		taken[name] = true
+	}
+	
+	for _, name := range names {
+		goName := mangle(name, taken)
+		if goName != name {
+			taken[goName] = true
+			m.toGo[name] = goName
+			m.toChore[goName] = name
+		}
+	}
+	
+	return m
+}
+
+// GoName returns the identifier to emit for a ChoreLang name. Names that are
+// not declared by the program (builtins, external functions) pass through.
+func (m *NameMap) GoName(name string) string {
+	if goName, ok := m.toGo[name]; ok {
+		return goName
+	}
+	return name
+}
+
+// Original returns the ChoreLang name behind a renamed Go identifier.
+func (m *NameMap) Original(goName string) (string, bool) {
+	name, ok := m.toChore[goName]
+	return name, ok
+}
+
+// Renames returns the renamed identifiers as (Go name, ChoreLang name)
+// pairs sorted by Go name.
+func (m *NameMap) Renames() [][2]string {
+	renames := make([][2]string, 0, len(m.toChore))
+	for goName, name := range m.toChore {
+		renames = append(renames, [2]string{goName, name})
+	}
+	sort.Slice(renames, func(i, j int) bool {
+		return renames[i][0] < renames[j][0]
+	})
+	return renames
+}
+
+// Demangle replaces every renamed Go identifier in text, such as output
+// from the Go compiler, with its original ChoreLang name.
+func (m *NameMap) Demangle(text string) string {
+	if len(m.toChore) == 0 {
+		return text
+	}
+	
+	var out strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !isIdentRune(runes[i], true) {
+			out.WriteRune(runes[i])
+			i++
+			continue
+		}
+		
+		j := i
+		for j < len(runes) && isIdentRune(runes[j], false) {
+			j++
+		}
+		
+		word := string(runes[i:j])
+		if name, ok := m.toChore[word]; ok {
+			word = name
+		}
+		out.WriteString(word)
+		i = j
+	}
+	
+	return out.String()
+}
+
+// mangle returns a Go identifier for name that is neither a keyword, a
+// reserved name, nor one of the taken names. Runes Go does not accept in
+// identifiers are escaped as _uXXXX, and collisions are resolved by
+// appending underscores.
+func mangle(name string, taken map[string]bool) string {
+	base := escapeIdentifier(name)
+	if base == name && !token.IsKeyword(name) && !goReserved[name] {
+		return name
+	}
+	
+	candidate := base + "_"
+	for taken[candidate] || goReserved[candidate] {
+		candidate += "_"
+	}
+	return candidate
+}
+
+func escapeIdentifier(name string) string {
+	var out strings.Builder
+	for i, r := range []rune(name) {
+		if isIdentRune(r, i == 0) {
+			out.WriteRune(r)
+		} else {
+			out.WriteString(fmt.Sprintf("_u%04X", r))
+		}
+	}
+	return out.String()
+}
+
+// isIdentRune reports whether Go accepts r in an identifier, following the
+// letter and digit classes of the Go specification.
+func isIdentRune(r rune, first bool) bool {
+	if r == '_' || unicode.IsLetter(r) {
+		return true
+	}
+	return !first && unicode.IsDigit(r)
+}
+
+// readBindings returns the bindings whose value the statements read, as
+// opposed to declaring or assigning it. Rehearsals and encores at the top
+// level are left out, as Generate leaves them out of main.
+func readBindings(stmts []ast.Statement, r *resolver.Resolver) map[*resolver.Binding]bool {
+	reads := make(map[*resolver.Binding]bool)
+	targets := make(map[*ast.Identifier]bool)
+	for _, stmt := range stmts {
+		switch stmt.(type) {
+		case *ast.RehearseStatement, *ast.EncoreStatement:
+			continue
+		}
+		ast.Inspect(stmt, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.AssignStatement:
+				targets[n.Name] = true
+			case *ast.Identifier:
+				if b := r.BindingOf(n); b != nil && b.Decl != n && !targets[n] {
+					reads[b] = true
+				}
+			}
+			return true
+		})
+	}
+	return reads
+}
+
+func collectDeclaredNames(stmts []ast.Statement, declared map[string]bool) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.DanceStatement:
+			declared[s.Name.Value] = true
+		case *ast.SwayStatement:
+			declared[s.Variable.Value] = true
+			collectDeclaredNames(s.Body.Statements, declared)
+		case *ast.StartStatement:
+			collectDeclaredNames([]ast.Statement{s.Statement}, declared)
+		case *ast.IfStatement:
+			collectDeclaredNames(s.Consequence.Statements, declared)
+			if s.Alternative != nil {
+				collectDeclaredNames(s.Alternative.Statements, declared)
+			}
+		case *ast.BlockStatement:
+			collectDeclaredNames(s.Statements, declared)
+		case *ast.RehearseStatement:
+			collectDeclaredNames(s.Body.Statements, declared)
+		case *ast.EncoreStatement:
+			collectDeclaredNames(s.Body.Statements, declared)
+		}
+	}
+}
\ No newline at end of file
@@ -0,0 +1,181 @@
+package codegen
+
+import (
+	"testing"
+	
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/parser"
+	"github.com/chorlang/chorlang/compiler/resolver"
+)
+
+func TestGenerateMangledIdentifiers(t *testing.T) {
+	input := `
+dance func = 1
+dance len = 2
+dance fmt = func + len
+sway range from 0 to fmt {
+    spin print(range)
+}
+`
+	
+	expected := `package main
+
+import (
+	"fmt"
+)
+
+// ChoreLang identifiers renamed to avoid Go keywords, builtins and imports:
+//
+//	fmt_ = fmt
+//	func_ = func
+//	len_ = len
+//	range_ = range
+func main() {
+	func_ := 1
+	len_ := 2
+	fmt_ := func_ + len_
+	for range_ := 0; range_ <= fmt_; range_++ {
+		fmt.Println(range_)
+	}
+}`
+	
+	result := generateAndCompare(t, input, expected)
+	if result != normalizeWhitespace(expected) {
+		t.Errorf("Generated code does not match expected.\nGot:\n%s\n\nExpected:\n%s", result, expected)
+	}
+}
+
+func TestGenerateBlankBinding(t *testing.T) {
+	input := `
+dance _ = 6
+_ = 7
+sway i from 1 to 2 {
+    dance _ = i
+    spin print(_)
+}
+`
+	
+	expected := `package main
+
+import (
+	"fmt"
+)
+
+// ChoreLang identifiers renamed to avoid Go keywords, builtins and imports:
+//
+//	__ = _
+func main() {
+	_ = 6
+	_ = 7
+	for i := 1; i <= 2; i++ {
+		__ := i
+		fmt.Println(__)
+	}
+}`
+	
+	result := generateAndCompare(t, input, expected)
+	if result != normalizeWhitespace(expected) {
+		t.Errorf("Generated code does not match expected.\nGot:\n%s\n\nExpected:\n%s", result, expected)
+	}
+}
+
+func TestMangleAvoidsCollisions(t *testing.T) {
+	names := parseNameMap(t, `
+dance type = 1
+dance type_ = 2
+dance type__ = 3
+`)
+	
+	tests := map[string]string{
+		"type":   "type___",
+		"type_":  "type_",
+		"type__": "type__",
+	}
+	
+	for name, expected := range tests {
+		if got := names.GoName(name); got != expected {
+			t.Errorf("GoName(%q) = %q, expected %q", name, got, expected)
+		}
+	}
+}
+
+func TestMangleIsDeterministic(t *testing.T) {
+	input := `
+dance len = 1
+dance cap = 2
+dance new = 3
+dance make = 4
+`
+	first := parseNameMap(t, input).Renames()
+	for i := 0; i < 20; i++ {
+		again := parseNameMap(t, input).Renames()
+		if len(again) != len(first) {
+			t.Fatalf("rename count changed between runs: %v vs %v", first, again)
+		}
+		for j := range first {
+			if first[j] != again[j] {
+				t.Fatalf("renames changed between runs: %v vs %v", first, again)
+			}
+		}
+	}
+}
+
+func TestUndeclaredNamesPassThrough(t *testing.T) {
+	names := parseNameMap(t, `dance x = 1`)
+	
+	if got := names.GoName("len"); got != "len" {
+		t.Errorf("undeclared builtin was renamed to %q", got)
+	}
+	if got := names.GoName("x"); got != "x" {
+		t.Errorf("plain identifier was renamed to %q", got)
+	}
+}
+
+func TestEscapeIdentifier(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"café", "café"},
+		{"π", "π"},
+		{"a‍b", "a_u200Db"},
+	}
+	
+	for _, tt := range tests {
+		if got := escapeIdentifier(tt.input); got != tt.expected {
+			t.Errorf("escapeIdentifier(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestDemangle(t *testing.T) {
+	names := parseNameMap(t, `
+dance func = 1
+dance len = 2
+`)
+	
+	input := "./main.go:9:2: declared and not used: func_\n./main.go:10:7: len_ (variable of type int) is not used"
+	expected := "./main.go:9:2: declared and not used: func\n./main.go:10:7: len (variable of type int) is not used"
+	
+	if got := names.Demangle(input); got != expected {
+		t.Errorf("Demangle wrong.\nGot:\n%s\nExpected:\n%s", got, expected)
+	}
+	
+	if original, ok := names.Original("func_"); !ok || original != "func" {
+		t.Errorf("Original(%q) = %q, %t", "func_", original, ok)
+	}
+}
+
+func parseNameMap(t *testing.T, input string) *NameMap {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parser errors: %v", p.Errors())
+	}
+	
+	r := resolver.New()
+	r.Resolve(program)
+	return newNameMap(program, readBindings(program.Statements, r))
+}
\ No newline at end of file
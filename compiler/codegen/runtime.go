@@ -0,0 +1,89 @@
+package codegen
+
+import (
+	"embed"
+	"fmt"
+	goast "go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// runtimeFiles hold the Go that traced, watched and benchmark programs are
+// built on. They are ordinary Go files, kept out of this package's build
+// by their build tag, so they are edited as Go rather than inside strings.
+//
+//go:embed runtime/*.go
+var runtimeFiles embed.FS
+
+// runtimeDecls parses the named files and returns their declarations, to
+// follow the program's own. Only the comments on declarations and fields
+// are kept. The packages they import are added to g.imports, under the
+// names they give them.
+func (g *CodeGenerator) runtimeDecls(files embed.FS, names ...string) ([]goast.Decl, error) {
+	var decls []goast.Decl
+	for _, name := range names {
+		src, err := files.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		file, err := parser.ParseFile(g.fset, name, src, parser.ParseComments)
+		if err != nil {
+			return nil, fmt.Errorf("parsing runtime %s: %v", name, err)
+		}
+		for _, imp := range file.Imports {
+			path, err := strconv.Unquote(imp.Path.Value)
+			if err != nil {
+				return nil, fmt.Errorf("parsing runtime %s: %v", name, err)
+			}
+			g.imports[path] = true
+			if imp.Name != nil {
+				g.aliases[path] = imp.Name.Name
+			}
+		}
+		for _, decl := range file.Decls {
+			if gen, ok := decl.(*goast.GenDecl); ok && gen.Tok == token.IMPORT {
+				continue
+			}
+			decls = append(decls, decl)
+		}
+	}
+	return decls, nil
+}
+
+// importDecl imports the packages in g.imports, sorted, since map
+// iteration order is random.
+func (g *CodeGenerator) importDecl() *goast.GenDecl {
+	paths := make([]string, 0, len(g.imports))
+	for imp := range g.imports {
+		paths = append(paths, imp)
+	}
+	sort.Strings(paths)
+	
+	imports := &goast.GenDecl{Tok: token.IMPORT, Lparen: 1, Rparen: 1}
+	for _, imp := range paths {
+		spec := &goast.ImportSpec{
+			Path: &goast.BasicLit{Kind: token.STRING, Value: strconv.Quote(imp)},
+		}
+		if alias, ok := g.aliases[imp]; ok {
+			spec.Name = goast.NewIdent(alias)
+		}
+		imports.Specs = append(imports.Specs, spec)
+	}
+	return imports
+}
+
+// docComment returns text as a comment group, each line starting "// ",
+// or "//" alone before a tab or an empty line, as gofmt writes them.
+func docComment(text string) *goast.CommentGroup {
+	group := &goast.CommentGroup{}
+	for _, line := range strings.Split(text, "\n") {
+		if line != "" && !strings.HasPrefix(line, "\t") {
+			line = " " + line
+		}
+		group.List = append(group.List, &goast.Comment{Text: "//" + line})
+	}
+	return group
+}
\ No newline at end of file
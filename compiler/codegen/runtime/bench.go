@@ -0,0 +1,29 @@
+//go:build ignore
+
+// The benchmark runtime, added to benchmark files. Dancers are counted as
+// they start, and the program's own output is discarded while a benchmark
+// runs so that it does not interleave with the results.
+package main
+
+import (
+	"os"
+	"sync/atomic"
+)
+
+// choreDancers counts the dancers started since the benchmark's timer was
+// last reset.
+var choreDancers atomic.Int64
+
+// choreQuiet discards standard output until the func it returns is called.
+func choreQuiet() func() {
+	stdout := os.Stdout
+	if null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+		os.Stdout = null
+	}
+	return func() {
+		if os.Stdout != stdout {
+			os.Stdout.Close()
+			os.Stdout = stdout
+		}
+	}
+}
\ No newline at end of file
@@ -0,0 +1,172 @@
+//go:build ignore
+
+// The file system runtime, added to programs that call chore.fs(). Its
+// value is a *choreFSModule, whose methods are the module's members. They
+// reach a Sandbox of package fs, whose Go is added beside this, rooted at
+// $CHORELANG_FSROOT or else the working directory. A failure is a runtime
+// error: it is reported at the member's position in choreFSSource, as
+// chorelang run reports it, and exits 1.
+package main
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// choreFSSandbox is the sandbox the modules reach, opened once by
+// choreFSOpen.
+var (
+	choreFSOnce    sync.Once
+	choreFSSandbox *Sandbox
+)
+
+// choreFSModule is the value of chore.fs(): the sandbox, and the watchers
+// its watches keep running between calls.
+type choreFSModule struct {
+	sandbox  *Sandbox
+	mu       sync.Mutex
+	watchers map[string]*Watcher // by interval and pattern
+}
+
+// choreFSOpen is chore.fs() at line and column, which opens the sandbox the
+// first time it is called.
+func choreFSOpen(line, column int) *choreFSModule {
+	choreFSOnce.Do(func() {
+		root := os.Getenv("CHORELANG_FSROOT")
+		if root == "" {
+			root = "."
+		}
+		s, err := Dir(root)
+		if err != nil {
+			choreFSFail(line, column, err)
+		}
+		choreFSSandbox = s
+	})
+	return &choreFSModule{sandbox: choreFSSandbox, watchers: make(map[string]*Watcher)}
+}
+
+// choreFSFail reports err as the runtime error of the member at line and
+// column, and exits 1.
+func choreFSFail(line, column int, err error) {
+	fmt.Fprintf(os.Stderr, "Runtime error: %s: %d:%d: %v\n", choreFSSource, line, column, err)
+	os.Exit(1)
+}
+
+// String prints the module as ChoreLang does.
+func (m *choreFSModule) String() string {
+	return "fs"
+}
+
+// read is fs.read(path).
+func (m *choreFSModule) read(line, column int, name string) string {
+	data, err := m.sandbox.Read(name)
+	if err != nil {
+		choreFSFail(line, column, err)
+	}
+	return string(data)
+}
+
+// write is fs.write(path, text).
+func (m *choreFSModule) write(line, column int, name, text string) {
+	if err := m.sandbox.Write(name, []byte(text)); err != nil {
+		choreFSFail(line, column, err)
+	}
+}
+
+// remove is fs.remove(path).
+func (m *choreFSModule) remove(line, column int, name string) {
+	if err := m.sandbox.Remove(name); err != nil {
+		choreFSFail(line, column, err)
+	}
+}
+
+// exists is fs.exists(path).
+func (m *choreFSModule) exists(line, column int, name string) bool {
+	_, err := m.sandbox.Stat(name)
+	if errors.Is(err, iofs.ErrNotExist) {
+		return false
+	}
+	if err != nil {
+		choreFSFail(line, column, err)
+	}
+	return true
+}
+
+// list is fs.list(dir).
+func (m *choreFSModule) list(line, column int, dir string) string {
+	infos, err := m.sandbox.List(dir)
+	if err != nil {
+		choreFSFail(line, column, err)
+	}
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name
+		if info.Dir {
+			names[i] += "/"
+		}
+	}
+	return strings.Join(names, "\n")
+}
+
+// stat is fs.stat(path).
+func (m *choreFSModule) stat(line, column int, name string) string {
+	info, err := m.sandbox.Stat(name)
+	if err != nil {
+		choreFSFail(line, column, err)
+	}
+	if info.Dir {
+		return "dir"
+	}
+	return fmt.Sprintf("file %d", info.Size)
+}
+
+// glob is fs.glob(pattern).
+func (m *choreFSModule) glob(line, column int, pattern string) string {
+	matches, err := m.sandbox.Glob(pattern)
+	if err != nil {
+		choreFSFail(line, column, err)
+	}
+	return strings.Join(matches, "\n")
+}
+
+// tempdir is fs.tempdir().
+func (m *choreFSModule) tempdir(line, column int) string {
+	name, err := m.sandbox.TempDir("")
+	if err != nil {
+		choreFSFail(line, column, err)
+	}
+	return name
+}
+
+// watch is fs.watch(pattern, ms). The watcher of a pattern and interval
+// starts the first time they are watched, and keeps the changes made
+// between watches for the next.
+func (m *choreFSModule) watch(line, column int, pattern string, ms int) string {
+	m.mu.Lock()
+	key := fmt.Sprintf("%d %s", ms, pattern)
+	w, ok := m.watchers[key]
+	if !ok {
+		var err error
+		if w, err = m.sandbox.Watch(pattern, time.Duration(ms)*time.Millisecond); err != nil {
+			m.mu.Unlock()
+			choreFSFail(line, column, err)
+		}
+		m.watchers[key] = w
+	}
+	m.mu.Unlock()
+	
+	e, ok := <-w.Events
+	if !ok {
+		err := w.Err
+		if err == nil {
+			err = errors.New("fs.watch: the watcher has stopped")
+		}
+		choreFSFail(line, column, err)
+	}
+	return string(e.Change) + " " + e.Path
+}
\ No newline at end of file
@@ -0,0 +1,143 @@
+//go:build ignore
+
+// The tracing runtime, added to traced programs. It writes the events of
+// package trace as JSON lines to the file named by $CHORELANG_TRACE, or to
+// the program's name with .trace added. Each event is written as it
+// happens, so the trace survives exit and runtime errors.
+//
+// A channel operation is timed from when it starts waiting to when it
+// completes. A send's value is bound by calling the func choreSend returns,
+// so it converts to the element type just as in a plain send.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// choreTrace records the dancers and channel operations of this program.
+var choreTrace = &choreTracer{channels: make(map[interface{}]int)}
+
+// choreWatching, when set, is told of the dancers and channel operations
+// too, to report those left blocked.
+var choreWatching interface {
+	begin(file string) int
+	spawned(child, line, column int)
+	end(dancer int)
+	blocking(dancer, line, column int, send bool, name string, ch interface{})
+	unblocked(dancer int)
+}
+
+type choreTracer struct {
+	mu       sync.Mutex
+	out      *os.File
+	start    time.Time
+	dancers  int
+	channels map[interface{}]int
+}
+
+// choreEvent holds the fields of an event besides its time, dancer and kind.
+type choreEvent map[string]interface{}
+
+// begin opens the trace file and returns main's dancer number.
+func (t *choreTracer) begin(file string) int {
+	path := os.Getenv("CHORELANG_TRACE")
+	if path == "" {
+		path = filepath.Base(os.Args[0]) + ".trace"
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "trace: %v\n", err)
+	}
+	t.out = out
+	t.start = time.Now()
+	if choreWatching != nil {
+		choreWatching.begin(file)
+	}
+	t.record(0, "begin", choreEvent{"file": file})
+	return 0
+}
+
+func (t *choreTracer) record(dancer int, kind string, e choreEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.out == nil {
+		return
+	}
+	e["t"] = time.Since(t.start)
+	e["dancer"] = dancer
+	e["kind"] = kind
+	line, _ := json.Marshal(e)
+	t.out.Write(append(line, '\n'))
+}
+
+// spawn numbers the dancer a start launches.
+func (t *choreTracer) spawn(dancer, line, column int) int {
+	t.mu.Lock()
+	t.dancers++
+	child := t.dancers
+	t.mu.Unlock()
+	if choreWatching != nil {
+		choreWatching.spawned(child, line, column)
+	}
+	t.record(dancer, "spawn", choreEvent{"line": line, "column": column, "child": child})
+	return child
+}
+
+func (t *choreTracer) end(dancer int) {
+	t.record(dancer, "end", choreEvent{})
+	if choreWatching != nil {
+		choreWatching.end(dancer)
+	}
+}
+
+func (t *choreTracer) exit(dancer, code int) {
+	t.record(dancer, "exit", choreEvent{"code": code})
+	os.Exit(code)
+}
+
+func (t *choreTracer) channel(ch interface{}) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id, ok := t.channels[ch]
+	if !ok {
+		id = len(t.channels) + 1
+		t.channels[ch] = id
+	}
+	return id
+}
+
+func choreSend[T any](dancer, line, column int, name string, ch chan T) func(T) {
+	return func(v T) {
+		start := time.Now()
+		if choreWatching != nil {
+			choreWatching.blocking(dancer, line, column, true, name, ch)
+			defer choreWatching.unblocked(dancer)
+		}
+		ch <- v
+		choreTrace.record(dancer, "send", choreEvent{
+			"line": line, "column": column,
+			"channel": choreTrace.channel(ch), "name": name,
+			"value": fmt.Sprintf("%#v", v), "wait": time.Since(start),
+		})
+	}
+}
+
+func choreReceive[T any](dancer, line, column int, name string, ch chan T) T {
+	start := time.Now()
+	if choreWatching != nil {
+		choreWatching.blocking(dancer, line, column, false, name, ch)
+		defer choreWatching.unblocked(dancer)
+	}
+	v := <-ch
+	choreTrace.record(dancer, "receive", choreEvent{
+		"line": line, "column": column,
+		"channel": choreTrace.channel(ch), "name": name,
+		"value": fmt.Sprintf("%#v", v), "wait": time.Since(start),
+	})
+	return v
+}
\ No newline at end of file
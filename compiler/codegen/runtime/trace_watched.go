@@ -0,0 +1,10 @@
+//go:build ignore
+
+// Lets a traced program's tracer tell choreWatch of its dancers and
+// operations.
+package main
+
+// init has the tracer tell choreWatch of what it records.
+func init() {
+	choreWatching = choreWatch
+}
\ No newline at end of file
@@ -0,0 +1,214 @@
+//go:build ignore
+
+// The watching runtime, added to watched programs. It keeps the dancers
+// and the channel operations they are in, and explains a deadlock as the
+// interpreter and the VM do, instead of Go's "all goroutines are asleep",
+// and the dancers main leaves blocked as it finishes.
+//
+// A dancer that has met its partner is still in its operation until it
+// runs again, so a deadlock is only reported once nothing has moved for
+// choreGrace. The timer it waits on also keeps Go from declaring the
+// deadlock first. A deadlock exits 1, as a runtime error does under
+// chorelang run.
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// choreWatch reports the dancers stuck on channels: all of them when none
+// can go on, and those still blocked when main finishes.
+var choreWatch = &choreWatcher{started: make(map[int][2]int), waits: make(map[int]choreWait)}
+
+const choreGrace = 100 * time.Millisecond
+
+type choreWatcher struct {
+	mu       sync.Mutex
+	file     string
+	dancers  int
+	started  map[int][2]int    // the running dancers, with where they started
+	waits    map[int]choreWait // the dancers in a channel operation
+	progress int               // operations completed and dancers ended
+}
+
+// choreWait is a dancer in a send or receive.
+type choreWait struct {
+	line, column int
+	send         bool
+	name         string
+	ch           interface{}
+}
+
+// begin returns main's dancer number.
+func (w *choreWatcher) begin(file string) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.file = file
+	w.started[0] = [2]int{}
+	return 0
+}
+
+// spawn numbers the dancer a start launches.
+func (w *choreWatcher) spawn(dancer, line, column int) int {
+	w.mu.Lock()
+	w.dancers++
+	child := w.dancers
+	w.mu.Unlock()
+	w.spawned(child, line, column)
+	return child
+}
+
+func (w *choreWatcher) spawned(child, line, column int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.started[child] = [2]int{line, column}
+}
+
+// end reports the dancers left blocked once main ends, or checks whether
+// the others are stuck once another dancer does.
+func (w *choreWatcher) end(dancer int) {
+	w.mu.Lock()
+	delete(w.started, dancer)
+	w.progress++
+	if dancer != 0 {
+		w.check()
+		w.mu.Unlock()
+		return
+	}
+	w.mu.Unlock()
+	w.leaks()
+}
+
+func (w *choreWatcher) exit(dancer, code int) {
+	os.Exit(code)
+}
+
+func (w *choreWatcher) blocking(dancer, line, column int, send bool, name string, ch interface{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.waits[dancer] = choreWait{line, column, send, name, ch}
+	w.check()
+}
+
+func (w *choreWatcher) unblocked(dancer int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.waits, dancer)
+	w.progress++
+}
+
+// check reports a deadlock if every dancer still waits, and none has
+// moved, after choreGrace. The caller holds mu.
+func (w *choreWatcher) check() {
+	if !w.stuck() {
+		return
+	}
+	progress := w.progress
+	time.AfterFunc(choreGrace, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.progress != progress || !w.stuck() {
+			return
+		}
+		main := w.waits[0]
+		fmt.Fprintf(os.Stderr, "Runtime error: %s: %d:%d: all dancers are asleep - deadlock!\n", w.file, main.line, main.column)
+		w.report(w.blocked(), false)
+		os.Exit(1)
+	})
+}
+
+// stuck reports whether every dancer waits and no two can meet. The caller
+// holds mu.
+func (w *choreWatcher) stuck() bool {
+	if len(w.waits) < len(w.started) {
+		return false
+	}
+	return len(w.blocked()) == len(w.waits)
+}
+
+// blocked returns the numbers of the waiting dancers, in order, leaving
+// out those waiting on a channel where a sender and a receiver meet. The
+// caller holds mu.
+func (w *choreWatcher) blocked() []int {
+	sides := make(map[interface{}][2]bool)
+	for _, wait := range w.waits {
+		s := sides[wait.ch]
+		if wait.send {
+			s[0] = true
+		} else {
+			s[1] = true
+		}
+		sides[wait.ch] = s
+	}
+	var blocked []int
+	for dancer, wait := range w.waits {
+		if s := sides[wait.ch]; !s[0] || !s[1] {
+			blocked = append(blocked, dancer)
+		}
+	}
+	sort.Ints(blocked)
+	return blocked
+}
+
+// leaks warns of the dancers blocked as main finishes, giving any that
+// have met a partner a moment to go on first.
+func (w *choreWatcher) leaks() {
+	w.mu.Lock()
+	blocked := w.blocked()
+	w.mu.Unlock()
+	if len(blocked) == 0 {
+		return
+	}
+	time.Sleep(choreGrace / 10)
+	
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if blocked = w.blocked(); len(blocked) == 0 {
+		return
+	}
+	noun := "dancers"
+	if len(blocked) == 1 {
+		noun = "dancer"
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s: %d %s still blocked when main finished\n", w.file, len(blocked), noun)
+	w.report(blocked, true)
+}
+
+// report describes the blocked dancers and hints at why, as chorelang run
+// does for the interpreter and the VM. The caller holds mu.
+func (w *choreWatcher) report(blocked []int, leaked bool) {
+	var hints []string
+	seen := make(map[string]bool)
+	for _, dancer := range blocked {
+		wait := w.waits[dancer]
+		who := "main"
+		if dancer != 0 {
+			start := w.started[dancer]
+			who = fmt.Sprintf("dancer %d (started at %d:%d)", dancer, start[0], start[1])
+		}
+		op, never, left := "receiving from", "no dancer ever sends on", "no dancer is left to send on"
+		if wait.send {
+			op, never, left = "sending on", "no dancer ever receives from", "no dancer is left to receive from"
+		}
+		fmt.Fprintf(os.Stderr, "    %s is blocked %s `%s` at %d:%d\n", who, op, wait.name, wait.line, wait.column)
+		
+		hint := ""
+		switch {
+		case choreNever[[2]int{wait.line, wait.column}]:
+			hint = never + " `" + wait.name + "`"
+		case !leaked:
+			hint = left + " `" + wait.name + "`"
+		}
+		if hint != "" && !seen[hint] {
+			seen[hint] = true
+			hints = append(hints, hint)
+		}
+	}
+	for _, hint := range hints {
+		fmt.Fprintf(os.Stderr, "    hint: %s\n", hint)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,22 @@
+//go:build ignore
+
+// The channel operations of a program watched but not traced; a traced
+// one tells choreWatch of its operations itself.
+package main
+
+// choreSend sends on ch, telling choreWatch while it waits.
+func choreSend[T any](dancer, line, column int, name string, ch chan T) func(T) {
+	return func(v T) {
+		choreWatch.blocking(dancer, line, column, true, name, ch)
+		ch <- v
+		choreWatch.unblocked(dancer)
+	}
+}
+
+// choreReceive receives from ch, telling choreWatch while it waits.
+func choreReceive[T any](dancer, line, column int, name string, ch chan T) T {
+	choreWatch.blocking(dancer, line, column, false, name, ch)
+	v := <-ch
+	choreWatch.unblocked(dancer)
+	return v
+}
\ No newline at end of file
@@ -0,0 +1,43 @@
+package codegen
+
+import (
+	goast "go/ast"
+	"go/token"
+	"strconv"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+)
+
+// dancerIdent is the variable holding the number of the dancer that runs
+// the code around it.
+func dancerIdent() *goast.Ident {
+	return goast.NewIdent("choreDancer")
+}
+
+// traceCall calls the method name of the runtime watching the program's
+// dancers: the tracer, or else the watcher.
+func (g *CodeGenerator) traceCall(name string, args ...goast.Expr) *goast.CallExpr {
+	runtime := "choreTrace"
+	if !g.Trace {
+		runtime = "choreWatch"
+	}
+	return &goast.CallExpr{
+		Fun:  &goast.SelectorExpr{X: goast.NewIdent(runtime), Sel: goast.NewIdent(name)},
+		Args: args,
+	}
+}
+
+// traceSite is the arguments saying where a channel operation happens:
+// the dancer, its position, and the channel as the source wrote it.
+func traceSite(line, column int, channel ast.Expression) []goast.Expr {
+	return []goast.Expr{
+		dancerIdent(),
+		intLiteral(line),
+		intLiteral(column),
+		&goast.BasicLit{Kind: token.STRING, Value: strconv.Quote(channel.String())},
+	}
+}
+
+func intLiteral(n int) *goast.BasicLit {
+	return &goast.BasicLit{Kind: token.INT, Value: strconv.Itoa(n)}
+}
\ No newline at end of file
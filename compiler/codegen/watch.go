@@ -0,0 +1,49 @@
+package codegen
+
+import (
+	goast "go/ast"
+	"go/token"
+	"sort"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/chart"
+)
+
+// neverTable marks the sends and receives of program whose channel no
+// dancer ever uses the other way, as chorelang chart --sequence finds them,
+// for choreWatch's hints.
+func neverTable(program *ast.Program) *goast.GenDecl {
+	seen := make(map[[2]int]bool)
+	var never [][2]int
+	if _, oneSided, err := chart.Sequence(program); err == nil {
+		for _, d := range oneSided {
+			if pos := [2]int{d.Line, d.Column}; !seen[pos] {
+				seen[pos] = true
+				never = append(never, pos)
+			}
+		}
+	}
+	sort.Slice(never, func(i, j int) bool {
+		a, b := never[i], never[j]
+		return a[0] < b[0] || a[0] == b[0] && a[1] < b[1]
+	})
+	
+	table := &goast.CompositeLit{Type: &goast.MapType{
+		Key:   &goast.ArrayType{Len: intLiteral(2), Elt: goast.NewIdent("int")},
+		Value: goast.NewIdent("bool"),
+	}}
+	for _, pos := range never {
+		table.Elts = append(table.Elts, &goast.KeyValueExpr{
+			Key:   &goast.CompositeLit{Elts: []goast.Expr{intLiteral(pos[0]), intLiteral(pos[1])}},
+			Value: goast.NewIdent("true"),
+		})
+	}
+	return &goast.GenDecl{
+		Doc: docComment("choreNever marks the sends and receives on channels no dancer ever uses\nthe other way."),
+		Tok: token.VAR,
+		Specs: []goast.Spec{&goast.ValueSpec{
+			Names:  []*goast.Ident{goast.NewIdent("choreNever")},
+			Values: []goast.Expr{table},
+		}},
+	}
+}
\ No newline at end of file
@@ -0,0 +1,125 @@
+// Package config loads a project's chore.json, the settings file shared by
+// the chorelang tools. The file lives at the project root and holds one
+// section per tool:
+//
+//	{
+//	    "build": {"outDir": "bin"},
+//	    "run": {"backend": "interp"}
+//	}
+//
+// Each tool decodes its own section into its own type with Section, so new
+// tools plug in without this package knowing their settings.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// FileName is the name of the settings file.
+const FileName = "chore.json"
+
+type Config struct {
+	// Path is the chore.json that was loaded, or "" when there is none.
+	Path string
+	// Dir is the project root: the directory holding Path.
+	Dir string
+	
+	sections map[string]json.RawMessage
+}
+
+// Load finds the chore.json for path by looking in path's directory and
+// then in each parent. Without one, Load returns an empty Config.
+func Load(path string) (*Config, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	
+	dir := abs
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		dir = filepath.Dir(abs)
+	}
+	
+	for {
+		file := filepath.Join(dir, FileName)
+		if _, err := os.Stat(file); err == nil {
+			return LoadFile(file)
+		}
+		
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return &Config{sections: map[string]json.RawMessage{}}, nil
+		}
+		dir = parent
+	}
+}
+
+// LoadFile reads the given settings file.
+func LoadFile(file string) (*Config, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	
+	c := &Config{Path: file, Dir: filepath.Dir(file)}
+	if err := json.Unmarshal(data, &c.sections); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, describe(data, err))
+	}
+	return c, nil
+}
+
+// Section decodes the named tool section into v. A missing section leaves
+// v unchanged, so v should hold the tool's defaults. Unknown settings are
+// errors, which catches typos.
+func (c *Config) Section(name string, v interface{}) error {
+	raw, ok := c.sections[name]
+	if !ok {
+		return nil
+	}
+	
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%s: %q section: %s", c.Path, name, describe(raw, err))
+	}
+	return nil
+}
+
+// Resolve interprets a path from the settings file relative to the
+// project root.
+func (c *Config) Resolve(path string) string {
+	if path == "" || filepath.IsAbs(path) || c.Dir == "" {
+		return path
+	}
+	return filepath.Join(c.Dir, path)
+}
+
+// describe adds a line and column to JSON syntax errors.
+func describe(data []byte, err error) string {
+	syntax, ok := err.(*json.SyntaxError)
+	if !ok {
+		return err.Error()
+	}
+	
+	// Offset counts the byte that was rejected
+	end := int(syntax.Offset) - 1
+	if end < 0 {
+		end = 0
+	}
+	
+	line, column := 1, 1
+	for _, b := range data[:end] {
+		if b == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return fmt.Sprintf("%d:%d: %v", line, column, err)
+}
\ No newline at end of file
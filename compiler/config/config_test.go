@@ -0,0 +1,84 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type buildSettings struct {
+	OutDir string `json:"outDir"`
+	Race   bool   `json:"race"`
+}
+
+func TestLoadFindsProjectRoot(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, FileName), `{"build": {"outDir": "bin"}, "lint": {"disable": ["x"]}}`)
+	writeFile(t, filepath.Join(root, "src", "deep", "main.chore"), `spin print(1)`)
+	
+	c, err := Load(filepath.Join(root, "src", "deep", "main.chore"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Dir != root {
+		t.Errorf("Dir = %q, want %q", c.Dir, root)
+	}
+	
+	settings := buildSettings{Race: true}
+	if err := c.Section("build", &settings); err != nil {
+		t.Fatal(err)
+	}
+	if settings.OutDir != "bin" || !settings.Race {
+		t.Errorf("section decoded wrong, got %+v", settings)
+	}
+	if got := c.Resolve(settings.OutDir); got != filepath.Join(root, "bin") {
+		t.Errorf("Resolve = %q", got)
+	}
+}
+
+func TestLoadWithoutFile(t *testing.T) {
+	c, err := Load(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	settings := buildSettings{OutDir: "default"}
+	if err := c.Section("build", &settings); err != nil {
+		t.Fatal(err)
+	}
+	if settings.OutDir != "default" || c.Path != "" {
+		t.Errorf("expected defaults without a file, got %+v in %+v", settings, c)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	
+	bad := filepath.Join(dir, "bad", FileName)
+	writeFile(t, bad, "{\n  \"build\": {\"outDir\": \"bin\",}\n}")
+	if _, err := LoadFile(bad); err == nil || !strings.Contains(err.Error(), "2:29") {
+		t.Errorf("expected a positioned syntax error, got %v", err)
+	}
+	
+	typo := filepath.Join(dir, "typo", FileName)
+	writeFile(t, typo, `{"build": {"outDri": "bin"}}`)
+	c, err := LoadFile(typo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var settings buildSettings
+	if err := c.Section("build", &settings); err == nil || !strings.Contains(err.Error(), `unknown field "outDri"`) {
+		t.Errorf("expected an unknown field error, got %v", err)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,143 @@
+// Package coverage measures which statements of a ChoreLang file run, and
+// reports it as a percentage, as HTML annotating the source, and as an lcov
+// tracefile.
+//
+// Statements are counted in the .chore source itself, through the
+// interpreter's Count hook, rather than in generated Go. The statements of
+// rehearse and encore blocks are the tests, not the code under test, so
+// they are not tracked; neither are blocks, only the statements in them.
+package coverage
+
+import (
+	"sort"
+	"sync/atomic"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+)
+
+// Profile counts the runs of each statement of one file. Count may be
+// called from several dancers, and several runs, at once.
+type Profile struct {
+	File   string
+	Source []byte
+	
+	statements []ast.Statement // in source order
+	counts     map[ast.Statement]*int64
+}
+
+// New returns an empty profile of the statements of program, parsed from
+// source in file.
+func New(file string, source []byte, program *ast.Program) *Profile {
+	p := &Profile{File: file, Source: source, counts: make(map[ast.Statement]*int64)}
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch stmt := node.(type) {
+		case *ast.RehearseStatement, *ast.EncoreStatement:
+			return false
+		case *ast.BlockStatement:
+		case ast.Statement:
+			p.statements = append(p.statements, stmt)
+			p.counts[stmt] = new(int64)
+		}
+		return true
+	})
+	return p
+}
+
+// Count records a run of stmt. Statements the profile does not track are
+// ignored.
+func (p *Profile) Count(stmt ast.Statement) {
+	if n, ok := p.counts[stmt]; ok {
+		atomic.AddInt64(n, 1)
+	}
+}
+
+// Statement is a tracked statement and how often it ran.
+type Statement struct {
+	Line, Column int
+	Count        int64
+}
+
+// Statements returns the tracked statements in source order.
+func (p *Profile) Statements() []Statement {
+	list := make([]Statement, len(p.statements))
+	for i, stmt := range p.statements {
+		line, column := position(stmt)
+		list[i] = Statement{Line: line, Column: column, Count: atomic.LoadInt64(p.counts[stmt])}
+	}
+	return list
+}
+
+// Covered returns how many of the tracked statements ran, and how many
+// there are.
+func (p *Profile) Covered() (covered, total int) {
+	for _, s := range p.Statements() {
+		if s.Count > 0 {
+			covered++
+		}
+	}
+	return covered, len(p.statements)
+}
+
+// Percent is the share of tracked statements that ran, or 0 if there are
+// none.
+func (p *Profile) Percent() float64 {
+	covered, total := p.Covered()
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(covered) / float64(total)
+}
+
+// Line sums up the statements that start on one line of the source.
+type Line struct {
+	Number     int
+	Statements int
+	Covered    int   // how many of them ran
+	Count      int64 // the fewest runs of any of them
+}
+
+// Lines returns the lines on which tracked statements start, in order.
+func (p *Profile) Lines() []Line {
+	byNumber := make(map[int]*Line)
+	for _, s := range p.Statements() {
+		l, ok := byNumber[s.Line]
+		if !ok {
+			l = &Line{Number: s.Line, Count: s.Count}
+			byNumber[s.Line] = l
+		}
+		l.Statements++
+		if s.Count > 0 {
+			l.Covered++
+		}
+		if s.Count < l.Count {
+			l.Count = s.Count
+		}
+	}
+	
+	lines := make([]Line, 0, len(byNumber))
+	for _, l := range byNumber {
+		lines = append(lines, *l)
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].Number < lines[j].Number })
+	return lines
+}
+
+func position(stmt ast.Statement) (int, int) {
+	switch s := stmt.(type) {
+	case *ast.DanceStatement:
+		return s.Token.Line, s.Token.Column
+	case *ast.AssignStatement:
+		return s.Token.Line, s.Token.Column
+	case *ast.ExpressionStatement:
+		return s.Token.Line, s.Token.Column
+	case *ast.SwayStatement:
+		return s.Token.Line, s.Token.Column
+	case *ast.StartStatement:
+		return s.Token.Line, s.Token.Column
+	case *ast.SendStatement:
+		return s.Token.Line, s.Token.Column
+	case *ast.IfStatement:
+		return s.Token.Line, s.Token.Column
+	}
+	return 0, 0
+}
\ No newline at end of file
@@ -0,0 +1,113 @@
+package coverage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/parser"
+	"github.com/chorlang/chorlang/compiler/rehearsal"
+)
+
+const source = `flow numbers = flow channel<int>
+flow doubled = flow channel<int>
+
+start sway i from 1 to 2 {
+    dance n = <-numbers
+    if n > 100 {
+        spin print("big")
+    }
+    send doubled <- n * 2
+}
+
+rehearse "doubles" {
+    send numbers <- 2
+    spin expect(<-doubled, 4)
+    send numbers <- 3
+    spin expect(<-doubled, 6)
+}
+`
+
+func TestProfile(t *testing.T) {
+	program := parse(t, source)
+	p := New("double_test.chore", []byte(source), program)
+	rehearsal.Run(program, []byte(source), rehearsal.Options{Count: p.Count})
+	
+	expected := []Statement{{1, 1, 1}, {2, 1, 1}, {4, 1, 1}, {4, 7, 1}, {5, 5, 2}, {6, 5, 2}, {7, 9, 0}, {9, 5, 2}}
+	got := p.Statements()
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d statements, got %+v", len(expected), got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("statement %d: expected %+v, got %+v", i, expected[i], got[i])
+		}
+	}
+	if covered, total := p.Covered(); covered != 7 || total != 8 || p.Percent() != 87.5 {
+		t.Errorf("coverage: %d of %d, %.1f%%", covered, total, p.Percent())
+	}
+	
+	p.Count(&ast.ExpressionStatement{})
+	if covered, _ := p.Covered(); covered != 7 {
+		t.Errorf("an untracked statement was counted")
+	}
+}
+
+func TestLines(t *testing.T) {
+	input := "dance a = 1\nif a > 1 { spin print(a) }\n"
+	program := parse(t, input)
+	p := New("a.chore", []byte(input), program)
+	for _, stmt := range program.Statements {
+		p.Count(stmt)
+	}
+	
+	expected := []Line{
+		{Number: 1, Statements: 1, Covered: 1, Count: 1},
+		{Number: 2, Statements: 2, Covered: 1, Count: 0},
+	}
+	lines := p.Lines()
+	if len(lines) != len(expected) || lines[0] != expected[0] || lines[1] != expected[1] {
+		t.Errorf("expected lines %+v, got %+v", expected, lines)
+	}
+}
+
+func TestReports(t *testing.T) {
+	program := parse(t, source)
+	p := New("double_test.chore", []byte(source), program)
+	rehearsal.Run(program, []byte(source), rehearsal.Options{Count: p.Count})
+	
+	var lcov bytes.Buffer
+	if err := WriteLCOV(&lcov, []*Profile{p}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "TN:\nSF:double_test.chore\nDA:1,1\nDA:2,1\nDA:4,1\nDA:5,2\nDA:6,2\nDA:7,0\nDA:9,2\nLF:7\nLH:6\nend_of_record\n"
+	if lcov.String() != expected {
+		t.Errorf("lcov: expected %q, got %q", expected, lcov.String())
+	}
+	
+	var html bytes.Buffer
+	if err := WriteHTML(&html, []*Profile{p}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<h2 id="file0">double_test.chore: 87.5% of statements</h2>`,
+		`<span class="run" title="run 2 times"><span class="number">   6</span>    if n &gt; 100 {</span>`,
+		`<span class="notrun" title="not run"><span class="number">   7</span>        spin print(&#34;big&#34;)</span>`,
+		`<span><span class="number">  14</span>    spin expect(&lt;-doubled, 4)</span>`,
+	} {
+		if !strings.Contains(html.String(), want) {
+			t.Errorf("html report is missing %q:\n%s", want, html.String())
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parser errors: %v", p.Errors())
+	}
+	return program
+}
\ No newline at end of file
@@ -0,0 +1,104 @@
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// WriteLCOV writes profiles as an lcov tracefile, one record per file. A
+// line's count is the fewest runs of the statements starting on it, so a
+// line is only hit when all of them ran.
+func WriteLCOV(w io.Writer, profiles []*Profile) error {
+	bw := bufio.NewWriter(w)
+	for _, p := range profiles {
+		lines := p.Lines()
+		hit := 0
+		fmt.Fprintf(bw, "TN:\nSF:%s\n", p.File)
+		for _, l := range lines {
+			fmt.Fprintf(bw, "DA:%d,%d\n", l.Number, l.Count)
+			if l.Count > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", len(lines), hit)
+	}
+	return bw.Flush()
+}
+
+// WriteHTML writes a page showing the source of each profiled file, with
+// each line on which statements start marked as run, not run, or partly
+// run. Hovering over a line tells how often it ran.
+func WriteHTML(w io.Writer, profiles []*Profile) error {
+	var files []htmlFile
+	for i, p := range profiles {
+		f := htmlFile{ID: fmt.Sprintf("file%d", i), Name: p.File, Percent: fmt.Sprintf("%.1f%%", p.Percent())}
+		marks := make(map[int]Line)
+		for _, l := range p.Lines() {
+			marks[l.Number] = l
+		}
+		for i, text := range strings.Split(strings.TrimRight(string(p.Source), "\n"), "\n") {
+			line := htmlLine{Number: i + 1, Text: text}
+			if l, ok := marks[i+1]; ok {
+				switch {
+				case l.Covered == l.Statements:
+					line.Class, line.Title = "run", fmt.Sprintf("run %d times", l.Count)
+				case l.Covered == 0:
+					line.Class, line.Title = "notrun", "not run"
+				default:
+					line.Class, line.Title = "partial", fmt.Sprintf("%d of %d statements run", l.Covered, l.Statements)
+				}
+			}
+			f.Lines = append(f.Lines, line)
+		}
+		files = append(files, f)
+	}
+	return page.Execute(w, files)
+}
+
+type htmlFile struct {
+	ID, Name, Percent string
+	Lines             []htmlLine
+}
+
+type htmlLine struct {
+	Number       int
+	Text         string
+	Class, Title string
+}
+
+var page = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>ChoreLang coverage</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+pre { font-family: monospace; line-height: 1.4; }
+pre span { display: block; }
+.number { display: inline; color: #999; padding-right: 1em; user-select: none; }
+.run { background: #d6f5d6; }
+.notrun { background: #f8d0d0; }
+.partial { background: #f8ecc0; }
+</style>
+</head>
+<body>
+<h1>ChoreLang coverage</h1>
+<ul>
+{{- range .}}
+<li><a href="#{{.ID}}">{{.Name}}</a>: {{.Percent}}</li>
+{{- end}}
+</ul>
+{{- range .}}
+<h2 id="{{.ID}}">{{.Name}}: {{.Percent}} of statements</h2>
+<pre>
+{{- range .Lines}}
+<span{{if .Class}} class="{{.Class}}" title="{{.Title}}"{{end}}><span class="number">{{printf "%4d" .Number}}</span>{{.Text}}</span>
+{{- end}}
+</pre>
+{{- end}}
+</body>
+</html>
+`))
\ No newline at end of file
@@ -0,0 +1,438 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	
+	"github.com/chorlang/chorlang/compiler/internal/frame"
+)
+
+// message is a message of a test session in either direction.
+type message struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	Command    string          `json:"command,omitempty"`
+	Arguments  interface{}     `json:"arguments,omitempty"`
+	RequestSeq int             `json:"request_seq,omitempty"`
+	Success    bool            `json:"success,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Event      string          `json:"event,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+}
+
+// client drives a session from a test. Everything the adapter sends is
+// read as it comes, as an editor would, and events that arrive while the
+// client waits for something else are kept until asked for.
+type client struct {
+	t        *testing.T
+	w        io.WriteCloser
+	messages chan message
+	seq      int
+	events   []message
+	served   chan error
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &client{t: t, w: inW, messages: make(chan message, 1000), served: make(chan error, 1)}
+	go func() {
+		err := Serve(inR, outW)
+		outW.Close()
+		c.served <- err
+	}()
+	go func() {
+		r := bufio.NewReader(outR)
+		defer close(c.messages)
+		for {
+			body, err := frame.Read(r)
+			if err != nil {
+				return
+			}
+			var m message
+			if err := json.Unmarshal(body, &m); err != nil {
+				t.Errorf("bad message from the adapter: %v", err)
+				return
+			}
+			c.messages <- m
+		}
+	}()
+	t.Cleanup(func() { inW.Close() })
+	return c
+}
+
+func (c *client) read() message {
+	c.t.Helper()
+	select {
+	case m, ok := <-c.messages:
+		if !ok {
+			c.t.Fatalf("the adapter closed the connection")
+		}
+		return m
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("timed out waiting for the adapter")
+	}
+	return message{}
+}
+
+// request sends a request and returns its response, failing the test if
+// it failed.
+func (c *client) request(command string, args interface{}) message {
+	c.t.Helper()
+	resp := c.try(command, args)
+	if !resp.Success {
+		c.t.Fatalf("%s failed: %s", command, resp.Message)
+	}
+	return resp
+}
+
+func (c *client) try(command string, args interface{}) message {
+	c.t.Helper()
+	c.seq++
+	if err := frame.Write(c.w, message{Seq: c.seq, Type: "request", Command: command, Arguments: args}); err != nil {
+		c.t.Fatalf("writing %s: %v", command, err)
+	}
+	for {
+		m := c.read()
+		if m.Type == "event" {
+			c.events = append(c.events, m)
+			continue
+		}
+		if m.RequestSeq != c.seq || m.Command != command {
+			c.t.Fatalf("response %+v does not answer %s", m, command)
+		}
+		return m
+	}
+}
+
+// event returns the next event of a kind, skipping others, or the next
+// event of any kind if kind is "".
+func (c *client) event(kind string) message {
+	c.t.Helper()
+	for {
+		for i, e := range c.events {
+			if kind == "" || e.Event == kind {
+				c.events = c.events[i+1:]
+				return e
+			}
+		}
+		c.events = nil
+		m := c.read()
+		if m.Type != "event" {
+			c.t.Fatalf("unexpected %+v waiting for %s", m, kind)
+		}
+		c.events = append(c.events, m)
+	}
+}
+
+// output collects what the program printed to its standard output until
+// it exits, and its exit code.
+func (c *client) output() (string, int) {
+	c.t.Helper()
+	var out strings.Builder
+	for {
+		e := c.event("")
+		switch e.Event {
+		case "output":
+			var body struct{ Category, Output string }
+			json.Unmarshal(e.Body, &body)
+			if body.Category == "stdout" {
+				out.WriteString(body.Output)
+			}
+		case "exited":
+			var body struct{ ExitCode int }
+			json.Unmarshal(e.Body, &body)
+			return out.String(), body.ExitCode
+		}
+	}
+}
+
+func decodeBody(t *testing.T, m message, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(m.Body, v); err != nil {
+		t.Fatalf("bad body %s: %v", m.Body, err)
+	}
+}
+
+// launch starts a debug session of source with breakpoints on lines.
+func launch(t *testing.T, source string, stopOnEntry bool, lines ...int) (*client, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "prog.chore")
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	
+	c := newClient(t)
+	c.request("initialize", map[string]string{"adapterID": "chorelang"})
+	c.event("initialized")
+	var bps []map[string]int
+	for _, line := range lines {
+		bps = append(bps, map[string]int{"line": line})
+	}
+	c.request("setBreakpoints", map[string]interface{}{"source": map[string]string{"path": path}, "breakpoints": bps})
+	c.request("launch", map[string]interface{}{"program": path, "stopOnEntry": stopOnEntry})
+	c.request("configurationDone", nil)
+	return c, path
+}
+
+type stopped struct {
+	Reason   string
+	ThreadID int
+}
+
+func (c *client) stopped(reason string) stopped {
+	c.t.Helper()
+	var s stopped
+	decodeBody(c.t, c.event("stopped"), &s)
+	if s.Reason != reason {
+		c.t.Fatalf("stopped for %q, want %q", s.Reason, reason)
+	}
+	return s
+}
+
+// line returns the line a thread is stopped on.
+func (c *client) line(threadID int) int {
+	c.t.Helper()
+	var body struct {
+		StackFrames []stackFrame
+	}
+	decodeBody(c.t, c.request("stackTrace", map[string]int{"threadId": threadID}), &body)
+	if len(body.StackFrames) != 1 {
+		c.t.Fatalf("got %d frames, want 1", len(body.StackFrames))
+	}
+	return body.StackFrames[0].Line
+}
+
+// bindings returns every binding visible to a frame as "scope: name=value".
+func (c *client) bindings(frameID int) []string {
+	c.t.Helper()
+	var scopes struct{ Scopes []scope }
+	decodeBody(c.t, c.request("scopes", map[string]int{"frameId": frameID}), &scopes)
+	var list []string
+	for _, sc := range scopes.Scopes {
+		var vars struct{ Variables []variable }
+		decodeBody(c.t, c.request("variables", map[string]int{"variablesReference": sc.VariablesReference}), &vars)
+		for _, v := range vars.Variables {
+			list = append(list, sc.Name+": "+v.Name+"="+v.Value)
+		}
+	}
+	return list
+}
+
+func (c *client) disconnect() {
+	c.t.Helper()
+	c.request("disconnect", nil)
+	if err := <-c.served; err != nil {
+		c.t.Fatalf("Serve: %v", err)
+	}
+}
+
+func TestBreakpointsAndBindings(t *testing.T) {
+	source := `dance total = 0
+
+sway i from 1 to 3 {
+    total = total + i
+}
+spin print(total)
+`
+	// Line 2 has no statement, so that breakpoint moves down to line 3
+	path := filepath.Join(t.TempDir(), "prog.chore")
+	os.WriteFile(path, []byte(source), 0644)
+	c := newClient(t)
+	c.request("initialize", nil)
+	var bps struct{ Breakpoints []breakpoint }
+	decodeBody(t, c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": path},
+		"breakpoints": []map[string]int{{"line": 2}, {"line": 4}, {"line": 9}},
+	}), &bps)
+	want := []breakpoint{{Verified: true, Line: 3}, {Verified: true, Line: 4}, {Message: "no statement on or after line 9"}}
+	if len(bps.Breakpoints) != 3 || bps.Breakpoints[0] != want[0] || bps.Breakpoints[1] != want[1] || bps.Breakpoints[2] != want[2] {
+		t.Fatalf("breakpoints = %+v, want %+v", bps.Breakpoints, want)
+	}
+	c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": path},
+		"breakpoints": []map[string]int{{"line": 4}},
+	})
+	c.request("launch", map[string]interface{}{"program": path})
+	c.request("configurationDone", nil)
+	
+	for i := 1; i <= 2; i++ {
+		s := c.stopped("breakpoint")
+		if s.ThreadID != 1 || c.line(1) != 4 {
+			t.Fatalf("stopped in thread %d at line %d, want 1 at 4", s.ThreadID, c.line(1))
+		}
+		got := strings.Join(c.bindings(1), ", ")
+		want := "Locals: i=" + string(rune('0'+i)) + ", Program: total=" + []string{"", "0", "1"}[i]
+		if got != want {
+			t.Errorf("bindings = %s, want %s", got, want)
+		}
+		c.request("continue", map[string]int{"threadId": 1})
+	}
+	
+	c.stopped("breakpoint")
+	c.request("setBreakpoints", map[string]interface{}{"source": map[string]string{"path": path}, "breakpoints": []interface{}{}})
+	c.request("continue", map[string]int{"threadId": 1})
+	if out, code := c.output(); out != "6\n" || code != 0 {
+		t.Errorf("output %q, exit code %d; want \"6\\n\", 0", out, code)
+	}
+	c.event("terminated")
+	c.disconnect()
+}
+
+func TestStepping(t *testing.T) {
+	c, _ := launch(t, `dance x = 1
+if x > 0 {
+    x = 2
+    x = 3
+}
+x = 4
+spin print(x)
+`, true)
+	
+	c.stopped("entry")
+	steps := []struct {
+		request string
+		line    int
+	}{
+		{"next", 2},
+		{"next", 6}, // over the whole if
+	}
+	for _, s := range steps {
+		c.request(s.request, map[string]int{"threadId": 1})
+		c.stopped("step")
+		if got := c.line(1); got != s.line {
+			t.Fatalf("%s stopped at line %d, want %d", s.request, got, s.line)
+		}
+	}
+	c.request("continue", map[string]int{"threadId": 1})
+	c.output()
+	c.disconnect()
+	
+	c, _ = launch(t, `dance x = 1
+if x > 0 {
+    x = 2
+    x = 3
+}
+x = 4
+`, false, 2)
+	c.stopped("breakpoint")
+	for _, s := range []struct {
+		request string
+		line    int
+	}{{"stepIn", 3}, {"stepOut", 6}} {
+		c.request(s.request, map[string]int{"threadId": 1})
+		c.stopped("step")
+		if got := c.line(1); got != s.line {
+			t.Fatalf("%s stopped at line %d, want %d", s.request, got, s.line)
+		}
+	}
+	c.disconnect()
+}
+
+func TestStepIntoStart(t *testing.T) {
+	c, _ := launch(t, `flow done = flow channel<bool>
+start {
+    dance y = 5
+    send done <- true
+}
+dance ok = <-done
+`, false, 2)
+	
+	c.stopped("breakpoint")
+	c.request("stepIn", map[string]int{"threadId": 1})
+	s := c.stopped("step")
+	if s.ThreadID != 2 || c.line(2) != 3 {
+		t.Fatalf("stepped into thread %d at line %d, want 2 at 3", s.ThreadID, c.line(2))
+	}
+	c.disconnect()
+}
+
+func TestDancersAndChannels(t *testing.T) {
+	c, _ := launch(t, `flow ch = flow channel<int>
+flow never = flow channel<int>
+start send ch <- 42
+dance x = <-never
+`, false)
+	
+	// Every dancer ends up blocked, and a pause then lands there at once.
+	// A pause that comes sooner stops main at a statement, so try again.
+	var threads struct{ Threads []thread }
+	for attempt := 0; ; attempt++ {
+		c.request("pause", map[string]int{"threadId": 1})
+		c.stopped("pause")
+		decodeBody(t, c.request("threads", nil), &threads)
+		if len(threads.Threads) == 2 && strings.Contains(threads.Threads[0].Name, "[") && strings.Contains(threads.Threads[1].Name, "[") || attempt == 50 {
+			break
+		}
+		c.request("continue", map[string]int{"threadId": 1})
+		time.Sleep(10 * time.Millisecond)
+	}
+	want := []thread{
+		{1, "main [receiving from channel<int> #2 at line 4]"},
+		{2, "dancer 1 (started at line 3) [sending 42 on channel<int> #1 at line 3]"},
+	}
+	if len(threads.Threads) != 2 || threads.Threads[0] != want[0] || threads.Threads[1] != want[1] {
+		t.Fatalf("threads = %+v, want %+v", threads.Threads, want)
+	}
+	
+	var scopes struct{ Scopes []scope }
+	decodeBody(t, c.request("scopes", map[string]int{"frameId": 1}), &scopes)
+	var vars struct{ Variables []variable }
+	decodeBody(t, c.request("variables", map[string]int{"variablesReference": scopes.Scopes[0].VariablesReference}), &vars)
+	if len(vars.Variables) != 2 || vars.Variables[0].Value != "channel<int> #1 (1 waiting)" {
+		t.Fatalf("variables = %+v", vars.Variables)
+	}
+	var waiting struct{ Variables []variable }
+	decodeBody(t, c.request("variables", map[string]int{"variablesReference": vars.Variables[0].VariablesReference}), &waiting)
+	if len(waiting.Variables) != 1 || waiting.Variables[0] != (variable{Name: "dancer 1", Value: "sending 42 at line 3"}) {
+		t.Fatalf("waiting on ch = %+v", waiting.Variables)
+	}
+	
+	var result struct{ Result, Type string }
+	decodeBody(t, c.request("evaluate", map[string]interface{}{"expression": "never", "frameId": 1}), &result)
+	if result.Result != "channel<int> #2 (1 waiting)" || result.Type != "channel<int>" {
+		t.Errorf("evaluate never = %+v", result)
+	}
+	if resp := c.try("evaluate", map[string]interface{}{"expression": "nope", "frameId": 1}); resp.Success || resp.Message != "undefined: nope" {
+		t.Errorf("evaluate nope = %+v", resp)
+	}
+	
+	// Disconnecting stops the deadlocked program
+	c.disconnect()
+}
+
+func TestLaunchErrors(t *testing.T) {
+	c := newClient(t)
+	c.request("initialize", nil)
+	path := filepath.Join(t.TempDir(), "bad.chore")
+	os.WriteFile(path, []byte("missing = 1\n"), 0644)
+	resp := c.try("launch", map[string]string{"program": path})
+	if resp.Success || !strings.Contains(resp.Message, "missing") {
+		t.Errorf("launch of a broken program = %+v", resp)
+	}
+	if resp := c.try("variables", map[string]int{"variablesReference": 1}); resp.Success {
+		t.Errorf("variables without a stopped program succeeded")
+	}
+	c.disconnect()
+}
+
+func TestRuntimeErrorAndExitCode(t *testing.T) {
+	c, _ := launch(t, "spin print(1 / 0)\n", false)
+	if out, code := c.output(); out != "" || code != 1 {
+		t.Errorf("output %q, exit code %d; want \"\", 1", out, code)
+	}
+	c.disconnect()
+	
+	c, _ = launch(t, "spin print(\"bye\")\nspin exit(3)\n", false)
+	if out, code := c.output(); out != "bye\n" || code != 3 {
+		t.Errorf("output %q, exit code %d; want \"bye\\n\", 3", out, code)
+	}
+	c.disconnect()
+}
\ No newline at end of file
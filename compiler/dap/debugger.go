@@ -0,0 +1,294 @@
+package dap
+
+import (
+	"sort"
+	"sync"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/interp"
+)
+
+// What a dancer is doing, as far as the debugger knows
+const (
+	running = iota
+	held    // paused before a statement or after a channel operation
+	blocked // waiting in a channel operation
+)
+
+// Kinds of step
+const (
+	stepNone = iota
+	stepIn
+	stepOver
+	stepOut
+)
+
+// dancer is what the debugger knows of a live dancer.
+type dancer struct {
+	d     *interp.Dancer
+	state int
+	
+	// stmt is the statement the dancer is running, nil before its first,
+	// and env the bindings it runs in
+	stmt ast.Statement
+	env  *interp.Environment
+	
+	// ch is the channel a blocked dancer waits on
+	ch *interp.Channel
+}
+
+// step is a step the client asked for. Dancer is the one stepping, and
+// depth how deeply nested its bindings were when it started.
+type step struct {
+	kind   int
+	dancer int
+	depth  int
+	
+	// intoStart steps into the dancer the stepping dancer's start launches
+	intoStart bool
+}
+
+// debugger is the interp.Debugger behind a session. When one dancer
+// stops, at a breakpoint, a step or a pause, every dancer stops: each
+// holds at its next statement, or as its channel operation completes.
+// The client is told once no dancer is running any more, so it reads
+// bindings nobody is changing.
+type debugger struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	
+	dancers map[int]*dancer
+	
+	breakpoints map[int]bool // by line
+	entry       bool         // stop before main's first statement
+	pauseWanted bool
+	step        step
+	
+	paused    bool // the dancers are stopping, or stopped
+	announced bool // the client has been told about this stop
+	reason    string
+	stopper   int  // the dancer that stopped
+	halted    bool // the program is over, so nothing waits any more
+	
+	// stopped tells the client the program stopped, and thread that a
+	// dancer started or exited. They are called with mu held.
+	stopped func(reason string, dancer int)
+	thread  func(reason string, dancer int)
+}
+
+func newDebugger(stopped, thread func(string, int)) *debugger {
+	g := &debugger{
+		dancers:     make(map[int]*dancer),
+		breakpoints: make(map[int]bool),
+		stopped:     stopped,
+		thread:      thread,
+	}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+func (g *debugger) Started(d *interp.Dancer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.dancers[d.ID] = &dancer{d: d, state: running}
+	if g.step.intoStart && d.Parent == g.step.dancer {
+		g.step = step{kind: stepIn, dancer: d.ID}
+	}
+	g.thread("started", d.ID)
+}
+
+func (g *debugger) Finished(d *interp.Dancer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.dancers, d.ID)
+	if g.step.dancer == d.ID {
+		// The step ends with the dancer, and the program carries on
+		g.step = step{}
+	}
+	g.thread("exited", d.ID)
+	g.settle()
+}
+
+func (g *debugger) Statement(d *interp.Dancer, stmt ast.Statement, env *interp.Environment) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ds := g.dancers[d.ID]
+	if _, ok := stmt.(*ast.BlockStatement); ok {
+		// A block is not a place to stop, only the statements in it
+		g.hold(ds)
+		return
+	}
+	prev := ds.stmt
+	ds.stmt, ds.env = stmt, env
+	
+	if !g.paused && !g.halted {
+		if reason := g.stopReason(ds, prev); reason != "" {
+			g.pause(reason, d.ID)
+		}
+	}
+	g.hold(ds)
+}
+
+func (g *debugger) Blocking(d *interp.Dancer, ch *interp.Channel) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ds := g.dancers[d.ID]
+	ds.state, ds.ch = blocked, ch
+	g.settle()
+}
+
+func (g *debugger) Unblocked(d *interp.Dancer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ds := g.dancers[d.ID]
+	ds.ch = nil
+	g.hold(ds)
+}
+
+// stopReason says why ds should stop before the statement it has reached,
+// or "" if it should not. prev is the statement it ran before.
+func (g *debugger) stopReason(ds *dancer, prev ast.Statement) string {
+	id := ds.d.ID
+	if g.entry && id == 0 && prev == nil {
+		g.entry = false
+		return "entry"
+	}
+	if g.pauseWanted {
+		return "pause"
+	}
+	
+	if g.step.kind != stepNone && g.step.dancer == id {
+		depth := depth(ds.env)
+		switch {
+		case g.step.kind == stepIn,
+			g.step.kind == stepOver && depth <= g.step.depth,
+			g.step.kind == stepOut && depth < g.step.depth:
+			return "step"
+		}
+	}
+	
+	// A breakpoint stops a dancer once as it arrives on the line, not at
+	// every statement of the line, but again when a loop repeats it
+	line, _ := position(ds.stmt)
+	if g.breakpoints[line] {
+		if prevLine, _ := position(prev); prev == nil || prevLine != line || prev == ds.stmt {
+			return "breakpoint"
+		}
+	}
+	return ""
+}
+
+// pause stops the program because of dancer id.
+func (g *debugger) pause(reason string, id int) {
+	g.paused, g.announced = true, false
+	g.reason, g.stopper = reason, id
+	g.step = step{}
+	g.pauseWanted = false
+}
+
+// hold keeps ds where it is for as long as the program is paused.
+func (g *debugger) hold(ds *dancer) {
+	for g.paused && !g.halted {
+		ds.state = held
+		g.settle()
+		g.cond.Wait()
+	}
+	ds.state = running
+}
+
+// settle tells the client about a stop once no dancer is running. It also
+// makes a wanted pause when every dancer is blocked, since none of them
+// would reach another statement to stop at.
+func (g *debugger) settle() {
+	if g.halted || len(g.dancers) == 0 || !g.quiet() {
+		return
+	}
+	if g.pauseWanted && !g.paused {
+		g.pause("pause", g.ids()[0])
+	}
+	if g.paused && !g.announced {
+		g.announced = true
+		g.stopped(g.reason, g.stopper)
+	}
+}
+
+func (g *debugger) quiet() bool {
+	for _, ds := range g.dancers {
+		if ds.state == running {
+			return false
+		}
+	}
+	return true
+}
+
+// ids returns the numbers of the live dancers in order.
+func (g *debugger) ids() []int {
+	ids := make([]int, 0, len(g.dancers))
+	for id := range g.dancers {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// stoppedNow reports whether the program is stopped and the client knows.
+// Only then may bindings be read.
+func (g *debugger) stoppedNow() bool {
+	return g.paused && g.announced && !g.halted
+}
+
+// resume lets the dancers go on, with dancer id taking a step of the given
+// kind.
+func (g *debugger) resume(kind, id int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.paused {
+		return
+	}
+	g.step = step{}
+	if ds, ok := g.dancers[id]; ok && kind != stepNone {
+		g.step = step{kind: kind, dancer: id, depth: depth(ds.env)}
+		if _, ok := ds.stmt.(*ast.StartStatement); ok && kind == stepIn {
+			g.step = step{dancer: id, intoStart: true}
+		}
+	}
+	g.paused = false
+	g.cond.Broadcast()
+}
+
+// requestPause stops the program at the next statement any dancer reaches.
+func (g *debugger) requestPause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused || g.halted {
+		return
+	}
+	g.pauseWanted = true
+	g.settle()
+}
+
+// halt lets every held dancer go, to find the program over.
+func (g *debugger) halt() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.halted = true
+	g.cond.Broadcast()
+}
+
+func (g *debugger) setBreakpoints(lines []int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.breakpoints = make(map[int]bool)
+	for _, line := range lines {
+		g.breakpoints[line] = true
+	}
+}
+
+// depth counts the blocks around a dancer's bindings.
+func depth(env *interp.Environment) int {
+	n := 0
+	for ; env != nil; env = env.Outer() {
+		n++
+	}
+	return n
+}
\ No newline at end of file
@@ -0,0 +1,591 @@
+// Package dap is a Debug Adapter Protocol server for ChoreLang, which
+// editors run as `chorelang dap` and talk to over its standard input and
+// output.
+//
+// The program runs on the interpreter, so it is debugged in terms of its
+// .chore source rather than the Go it would compile to:
+//
+//   - breakpoints go on .chore lines, and stop every dancer that arrives
+//     on the line;
+//   - each dancer is a thread, named after its state, so a dancer blocked
+//     on a channel says so;
+//   - step over runs the statement, with any block it has, and stops at the
+//     next; step into stops at the first statement of the block, or of the
+//     dancer a start launches; step out finishes the block;
+//   - a dancer's bindings are shown as scopes, innermost block first, and a
+//     channel expands to the dancers waiting on it and the values they are
+//     sending.
+//
+// When one dancer stops, all of them do.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/internal/frame"
+	"github.com/chorlang/chorlang/compiler/interp"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/ops"
+	"github.com/chorlang/chorlang/compiler/parser"
+	"github.com/chorlang/chorlang/compiler/resolver"
+)
+
+// session is the state of one session with a client.
+type session struct {
+	in *bufio.Reader
+	
+	wmu sync.Mutex // guards out and seq
+	out io.Writer
+	seq int
+	err error // the first failure to write to the client
+	
+	dbg     *debugger
+	interp  *interp.Interpreter
+	program *ast.Program
+	path    string // the program's absolute path
+	args    []string
+	
+	launched, configured bool
+	done                 chan struct{} // closed when the program has ended
+	
+	// breakpoints holds the lines asked for in each file, by absolute path
+	breakpoints map[string][]int
+	
+	// refs are the variable references handed out since the program
+	// stopped: environments and channels, numbered from 1.
+	refs []interface{}
+}
+
+// Serve talks DAP to a client until it sends disconnect. The client's
+// messages are read from in and the adapter's written to out.
+func Serve(in io.Reader, out io.Writer) error {
+	s := &session{in: bufio.NewReader(in), out: out, breakpoints: make(map[string][]int)}
+	s.dbg = newDebugger(s.stopped, s.thread)
+	defer s.terminate()
+	
+	for {
+		body, err := frame.Read(s.in)
+		if err == io.EOF {
+			return errors.New("client closed the connection without disconnect")
+		}
+		if err != nil {
+			return err
+		}
+		
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			return fmt.Errorf("bad message: %v", err)
+		}
+		result, err := s.handle(req)
+		if rerr := s.respond(req, result, err); rerr != nil {
+			return rerr
+		}
+		switch req.Command {
+		case "initialize":
+			// The client sends breakpoints and configurationDone once told
+			s.send(&event{Type: "event", Event: "initialized"})
+		case "disconnect":
+			return nil
+		}
+	}
+}
+
+// handle runs one request, returning the body of its response.
+func (s *session) handle(req request) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		return map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		}, nil
+	case "launch":
+		var args launchArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		if err := s.launch(args); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	case "setBreakpoints":
+		var args setBreakpointsArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.setBreakpoints(args)
+	case "setExceptionBreakpoints":
+		return nil, nil
+	case "configurationDone":
+		s.configured = true
+		s.start()
+		return nil, nil
+	
+	case "threads":
+		return map[string]interface{}{"threads": s.threads()}, nil
+	case "stackTrace":
+		var args threadArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		frames, err := s.stackTrace(args.ThreadID)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+	case "scopes":
+		var args scopesArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		scopes, err := s.scopes(args.FrameID)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"scopes": scopes}, nil
+	case "variables":
+		var args variablesArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		variables, err := s.variables(args.VariablesReference)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"variables": variables}, nil
+	case "evaluate":
+		var args evaluateArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.evaluate(args)
+	
+	case "continue", "next", "stepIn", "stepOut":
+		var args threadArguments
+		if err := decode(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		kind := map[string]int{"continue": stepNone, "next": stepOver, "stepIn": stepIn, "stepOut": stepOut}[req.Command]
+		s.refs = nil
+		s.dbg.resume(kind, args.ThreadID-1)
+		if req.Command == "continue" {
+			return map[string]interface{}{"allThreadsContinued": true}, nil
+		}
+		return nil, nil
+	case "pause":
+		s.dbg.requestPause()
+		return nil, nil
+	case "terminate", "disconnect":
+		s.terminate()
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported request %q", req.Command)
+}
+
+// launch loads the program, which starts once configuration is done.
+func (s *session) launch(args launchArguments) error {
+	if s.launched {
+		return errors.New("a program is already launched")
+	}
+	if args.Program == "" {
+		return errors.New("launch needs a program")
+	}
+	path, err := filepath.Abs(args.Program)
+	if err != nil {
+		return err
+	}
+	program, err := load(path)
+	if err != nil {
+		return err
+	}
+	
+	s.program, s.path = program, path
+	s.args = append([]string{args.Program}, args.Args...)
+	s.dbg.entry = args.StopOnEntry && !args.NoDebug
+	if !args.NoDebug {
+		s.dbg.setBreakpoints(s.breakpoints[path])
+	}
+	s.launched = true
+	s.start()
+	return nil
+}
+
+// load parses and resolves the program in file.
+func load(file string) (*ast.Program, error) {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		return nil, fmt.Errorf("%s: %s", file, errs[0])
+	}
+	r := resolver.New()
+	r.Resolve(program)
+	if errs := r.Errors(); len(errs) > 0 {
+		return nil, fmt.Errorf("%s: %s", file, errs[0])
+	}
+	return program, nil
+}
+
+// start runs the program once it is launched and configured. Whatever
+// the program prints is sent to the client as output.
+func (s *session) start() {
+	if !s.launched || !s.configured || s.done != nil {
+		return
+	}
+	s.interp = interp.New(output{s})
+	s.interp.Args = s.args
+	s.interp.Debugger = s.dbg
+	s.done = make(chan struct{})
+	
+	go func() {
+		defer close(s.done)
+		err := s.interp.Run(s.program)
+		s.dbg.halt()
+		
+		code := 0
+		var exit *interp.ExitError
+		switch {
+		case errors.As(err, &exit):
+			code = exit.Code
+		case err != nil:
+			s.output("stderr", fmt.Sprintf("Runtime error: %s: %v\n", s.path, err))
+			code = 1
+		}
+		s.send(&event{Type: "event", Event: "exited", Body: map[string]int{"exitCode": code}})
+		s.send(&event{Type: "event", Event: "terminated"})
+	}()
+}
+
+// terminate stops the program, if it is running, and waits for it to end.
+func (s *session) terminate() {
+	if s.done == nil {
+		return
+	}
+	s.interp.Halt()
+	s.dbg.halt()
+	<-s.done
+}
+
+// setBreakpoints replaces the breakpoints of a file. A breakpoint on a
+// line without a statement moves down to the next line with one.
+func (s *session) setBreakpoints(args setBreakpointsArguments) (interface{}, error) {
+	path, err := filepath.Abs(args.Source.Path)
+	if err != nil {
+		return nil, err
+	}
+	program := s.program
+	if path != s.path {
+		if program, err = load(path); err != nil {
+			return nil, err
+		}
+	}
+	lines := statementLines(program)
+	
+	var set []int
+	result := make([]breakpoint, len(args.Breakpoints))
+	for i, bp := range args.Breakpoints {
+		at := sort.SearchInts(lines, bp.Line)
+		if at == len(lines) {
+			result[i] = breakpoint{Message: fmt.Sprintf("no statement on or after line %d", bp.Line)}
+			continue
+		}
+		result[i] = breakpoint{Verified: true, Line: lines[at]}
+		set = append(set, lines[at])
+	}
+	
+	s.breakpoints[path] = set
+	if path == s.path {
+		s.dbg.setBreakpoints(set)
+	}
+	return map[string]interface{}{"breakpoints": result}, nil
+}
+
+// statementLines returns the lines on which statements start, in order.
+func statementLines(program *ast.Program) []int {
+	seen := make(map[int]bool)
+	var lines []int
+	ast.Inspect(program, func(node ast.Node) bool {
+		if stmt, ok := node.(ast.Statement); ok {
+			if line, _ := position(stmt); line > 0 && !seen[line] {
+				seen[line] = true
+				lines = append(lines, line)
+			}
+		}
+		return true
+	})
+	sort.Ints(lines)
+	return lines
+}
+
+// Thread IDs are dancer numbers plus one, since clients take 0 for no
+// thread.
+
+func (s *session) threads() []thread {
+	s.dbg.mu.Lock()
+	defer s.dbg.mu.Unlock()
+	var threads []thread
+	for _, id := range s.dbg.ids() {
+		threads = append(threads, thread{ID: id + 1, Name: describe(s.dbg.dancers[id])})
+	}
+	if threads == nil {
+		threads = []thread{}
+	}
+	return threads
+}
+
+// describe names a dancer, with what it is waiting for if it is blocked.
+func describe(ds *dancer) string {
+	name := ds.d.Name()
+	if ds.d.ID > 0 {
+		name += fmt.Sprintf(" (started at line %d)", ds.d.Line)
+	}
+	if ds.state != blocked || ds.ch == nil {
+		return name
+	}
+	for _, w := range ds.ch.Waiting() {
+		if w.Dancer == ds.d {
+			if w.Send {
+				return fmt.Sprintf("%s [sending %s on %s at line %d]", name, show(w.Value), channelName(ds.ch), w.Line)
+			}
+			return fmt.Sprintf("%s [receiving from %s at line %d]", name, channelName(ds.ch), w.Line)
+		}
+	}
+	return name
+}
+
+// stackTrace returns the frame of a dancer. ChoreLang has no functions, so
+// a dancer has one frame, at the statement it is running; frames are
+// numbered as threads are.
+func (s *session) stackTrace(threadID int) ([]stackFrame, error) {
+	s.dbg.mu.Lock()
+	defer s.dbg.mu.Unlock()
+	ds, ok := s.dbg.dancers[threadID-1]
+	if !ok {
+		return nil, fmt.Errorf("no thread %d", threadID)
+	}
+	frame := stackFrame{ID: threadID, Name: ds.d.Name(), Line: ds.d.Line, Column: ds.d.Column}
+	if ds.stmt != nil {
+		frame.Line, frame.Column = position(ds.stmt)
+	}
+	frame.Source = &source{Name: filepath.Base(s.path), Path: s.path}
+	return []stackFrame{frame}, nil
+}
+
+// scopes returns the blocks around a frame's statement that bind
+// anything, innermost first. A dancer's outermost scope holds the
+// bindings it captured when it started; main's holds the program's.
+func (s *session) scopes(frameID int) ([]scope, error) {
+	s.dbg.mu.Lock()
+	defer s.dbg.mu.Unlock()
+	if !s.dbg.stoppedNow() {
+		return nil, errors.New("the program is running")
+	}
+	ds, ok := s.dbg.dancers[frameID-1]
+	if !ok {
+		return nil, fmt.Errorf("no frame %d", frameID)
+	}
+	
+	scopes := []scope{}
+	for env := ds.env; env != nil; env = env.Outer() {
+		name := "Locals"
+		switch {
+		case env.Outer() == nil && ds.d.ID == 0:
+			name = "Program"
+		case env.Outer() == nil:
+			name = "Captured at start"
+		case len(env.Names()) == 0:
+			continue
+		case len(scopes) > 0:
+			name = "Enclosing block"
+		}
+		scopes = append(scopes, scope{Name: name, VariablesReference: s.ref(env)})
+	}
+	return scopes, nil
+}
+
+// variables returns the bindings of a scope, or the dancers waiting on a
+// channel.
+func (s *session) variables(ref int) ([]variable, error) {
+	s.dbg.mu.Lock()
+	defer s.dbg.mu.Unlock()
+	if !s.dbg.stoppedNow() {
+		return nil, errors.New("the program is running")
+	}
+	if ref < 1 || ref > len(s.refs) {
+		return nil, fmt.Errorf("no variables %d", ref)
+	}
+	
+	variables := []variable{}
+	switch v := s.refs[ref-1].(type) {
+	case *interp.Environment:
+		for _, name := range v.Names() {
+			value, _ := v.Get(name)
+			variables = append(variables, s.variable(name, value))
+		}
+	case *interp.Channel:
+		for _, w := range v.Waiting() {
+			if w.Send {
+				variables = append(variables, variable{
+					Name:  w.Dancer.Name(),
+					Value: fmt.Sprintf("sending %s at line %d", show(w.Value), w.Line),
+				})
+			} else {
+				variables = append(variables, variable{
+					Name:  w.Dancer.Name(),
+					Value: fmt.Sprintf("receiving at line %d", w.Line),
+				})
+			}
+		}
+	}
+	return variables, nil
+}
+
+func (s *session) variable(name string, value interface{}) variable {
+	v := variable{Name: name, Value: show(value), Type: ops.TypeName(value)}
+	if ch, ok := value.(*interp.Channel); ok {
+		v.VariablesReference = s.ref(ch)
+	}
+	return v
+}
+
+// evaluate looks up a name in a frame's bindings, as a hover or a watch
+// does. Nothing else is evaluated, since evaluating could send or receive.
+func (s *session) evaluate(args evaluateArguments) (interface{}, error) {
+	s.dbg.mu.Lock()
+	defer s.dbg.mu.Unlock()
+	if !s.dbg.stoppedNow() {
+		return nil, errors.New("the program is running")
+	}
+	ds, ok := s.dbg.dancers[args.FrameID-1]
+	if !ok || ds.env == nil {
+		return nil, fmt.Errorf("no frame %d", args.FrameID)
+	}
+	name := strings.TrimSpace(args.Expression)
+	value, ok := ds.env.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("undefined: %s", name)
+	}
+	v := s.variable(name, value)
+	return map[string]interface{}{"result": v.Value, "type": v.Type, "variablesReference": v.VariablesReference}, nil
+}
+
+func (s *session) ref(v interface{}) int {
+	s.refs = append(s.refs, v)
+	return len(s.refs)
+}
+
+// show writes a value as ChoreLang source would, and a channel with how
+// many dancers wait on it.
+func show(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case nil:
+		return "nothing"
+	case *interp.Channel:
+		return fmt.Sprintf("%s (%d waiting)", channelName(v), len(v.Waiting()))
+	}
+	return fmt.Sprint(v)
+}
+
+func channelName(ch *interp.Channel) string {
+	return fmt.Sprintf("%s #%d", ch, ch.ID)
+}
+
+func position(stmt ast.Statement) (int, int) {
+	switch s := stmt.(type) {
+	case *ast.DanceStatement:
+		return s.Token.Line, s.Token.Column
+	case *ast.AssignStatement:
+		return s.Token.Line, s.Token.Column
+	case *ast.ExpressionStatement:
+		return s.Token.Line, s.Token.Column
+	case *ast.SwayStatement:
+		return s.Token.Line, s.Token.Column
+	case *ast.StartStatement:
+		return s.Token.Line, s.Token.Column
+	case *ast.SendStatement:
+		return s.Token.Line, s.Token.Column
+	case *ast.IfStatement:
+		return s.Token.Line, s.Token.Column
+	}
+	return 0, 0
+}
+
+// stopped tells the client the program has stopped.
+func (s *session) stopped(reason string, dancer int) {
+	s.send(&event{Type: "event", Event: "stopped", Body: map[string]interface{}{
+		"reason":            reason,
+		"threadId":          dancer + 1,
+		"allThreadsStopped": true,
+	}})
+}
+
+func (s *session) thread(reason string, dancer int) {
+	s.send(&event{Type: "event", Event: "thread", Body: map[string]interface{}{
+		"reason":   reason,
+		"threadId": dancer + 1,
+	}})
+}
+
+// output sends text the program wrote to the client.
+func (s *session) output(category, text string) {
+	s.send(&event{Type: "event", Event: "output", Body: map[string]string{"category": category, "output": text}})
+}
+
+// output is the program's standard output.
+type output struct{ s *session }
+
+func (o output) Write(p []byte) (int, error) {
+	o.s.output("stdout", string(p))
+	return len(p), nil
+}
+
+func decode(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func (s *session) respond(req request, body interface{}, err error) error {
+	resp := &response{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: err == nil, Body: body}
+	if err != nil {
+		resp.Message = err.Error()
+	}
+	s.send(resp)
+	
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	return s.err
+}
+
+// send numbers a response or event and writes it to the client.
+func (s *session) send(m interface{}) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.seq++
+	switch m := m.(type) {
+	case *response:
+		m.Seq = s.seq
+	case *event:
+		m.Seq = s.seq
+	}
+	if err := frame.Write(s.out, m); err != nil && s.err == nil {
+		s.err = err
+	}
+}
\ No newline at end of file
@@ -0,0 +1,118 @@
+// Package deadlock explains blocked dancers in the terms of the program's
+// source. Every backend reports a deadlock, and the dancers left blocked
+// when main finished, as positions of sends and receives; Sites finds the
+// channel each of them uses, and hints at why nothing completes it.
+//
+// A hint is static when the program never uses the other side of the
+// channel at all, found as chorelang chart --sequence finds it, and
+// otherwise says only that no dancer was left to complete the operation.
+package deadlock
+
+import (
+	"fmt"
+	"io"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/chart"
+	"github.com/chorlang/chorlang/compiler/interp"
+)
+
+// Site is a send or receive of a program. Channel is the channel as the
+// source writes it, and Never is set when no dancer ever does the other
+// side on it: a receive for a send, or a send for a receive.
+type Site struct {
+	Line, Column int
+	Send         bool
+	Channel      string
+	Never        bool
+}
+
+// Sites are the sends and receives of a program, by position.
+type Sites map[[2]int]Site
+
+// Find returns the sends and receives of a resolved program.
+func Find(program *ast.Program) Sites {
+	sites := make(Sites)
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.SendStatement:
+			sites[[2]int{n.Token.Line, n.Token.Column}] = Site{
+				Line: n.Token.Line, Column: n.Token.Column, Send: true, Channel: n.Channel.String(),
+			}
+		case *ast.ReceiveExpression:
+			sites[[2]int{n.Token.Line, n.Token.Column}] = Site{
+				Line: n.Token.Line, Column: n.Token.Column, Channel: n.Channel.String(),
+			}
+		}
+		return true
+	})
+	
+	// The sequence chart finds the channels only one side ever uses
+	if _, oneSided, err := chart.Sequence(program); err == nil {
+		for _, d := range oneSided {
+			if site, ok := sites[[2]int{d.Line, d.Column}]; ok {
+				site.Never = true
+				sites[[2]int{d.Line, d.Column}] = site
+			}
+		}
+	}
+	return sites
+}
+
+// Describe says what a blocked dancer waits for, as "dancer 2 (started at
+// 3:1) is blocked sending on `ch` at 3:7".
+func (s Sites) Describe(b interp.Blocked) string {
+	who := b.Name()
+	if b.Dancer != 0 {
+		who += fmt.Sprintf(" (started at %d:%d)", b.StartLine, b.StartColumn)
+	}
+	op := "receiving"
+	if b.Send {
+		op = "sending"
+	}
+	if site, ok := s[[2]int{b.Line, b.Column}]; ok {
+		if b.Send {
+			op += " on `" + site.Channel + "`"
+		} else {
+			op += " from `" + site.Channel + "`"
+		}
+	}
+	return fmt.Sprintf("%s is blocked %s at %d:%d", who, op, b.Line, b.Column)
+}
+
+// Hint suggests why nothing completes a blocked dancer's operation, or
+// returns "" when its site is unknown.
+func (s Sites) Hint(b interp.Blocked) string {
+	site, ok := s[[2]int{b.Line, b.Column}]
+	if !ok {
+		return ""
+	}
+	switch {
+	case site.Never && site.Send:
+		return "no dancer ever receives from `" + site.Channel + "`"
+	case site.Never:
+		return "no dancer ever sends on `" + site.Channel + "`"
+	case site.Send:
+		return "no dancer is left to receive from `" + site.Channel + "`"
+	default:
+		return "no dancer is left to send on `" + site.Channel + "`"
+	}
+}
+
+// Write writes a report of blocked dancers to w: a line for each, then
+// each distinct hint. Hints for leaked dancers only say what the program
+// never does, since main finishing is reason enough for the rest.
+func (s Sites) Write(w io.Writer, blocked []interp.Blocked, leaked bool) {
+	for _, b := range blocked {
+		fmt.Fprintf(w, "    %s\n", s.Describe(b))
+	}
+	seen := make(map[string]bool)
+	for _, b := range blocked {
+		hint := s.Hint(b)
+		if hint == "" || seen[hint] || leaked && !s[[2]int{b.Line, b.Column}].Never {
+			continue
+		}
+		seen[hint] = true
+		fmt.Fprintf(w, "    hint: %s\n", hint)
+	}
+}
\ No newline at end of file
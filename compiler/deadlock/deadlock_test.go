@@ -0,0 +1,82 @@
+package deadlock
+
+import (
+	"bytes"
+	"testing"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/interp"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/parser"
+)
+
+func TestWrite(t *testing.T) {
+	input := `flow results = flow channel<int>
+flow unused = flow channel<int>
+start {
+    send results <- 1
+    send unused <- 2
+}
+dance first = <-results
+dance second = <-results
+`
+	sites := Find(parse(t, input))
+	blocked := []interp.Blocked{
+		{Dancer: 0, Line: 8, Column: 16},
+		{Dancer: 1, StartLine: 3, StartColumn: 1, Send: true, Line: 5, Column: 5},
+	}
+	
+	var out bytes.Buffer
+	sites.Write(&out, blocked, false)
+	expected := "    main is blocked receiving from `results` at 8:16\n" +
+		"    dancer 1 (started at 3:1) is blocked sending on `unused` at 5:5\n" +
+		"    hint: no dancer is left to send on `results`\n" +
+		"    hint: no dancer ever receives from `unused`\n"
+	if out.String() != expected {
+		t.Errorf("report wrong.\nGot:\n%s\nExpected:\n%s", out.String(), expected)
+	}
+	
+	// A leak only hints at what the program never does
+	out.Reset()
+	sites.Write(&out, blocked, true)
+	want := "    main is blocked receiving from `results` at 8:16\n" +
+		"    dancer 1 (started at 3:1) is blocked sending on `unused` at 5:5\n" +
+		"    hint: no dancer ever receives from `unused`\n"
+	if out.String() != want {
+		t.Errorf("leak report wrong.\nGot:\n%s\nExpected:\n%s", out.String(), want)
+	}
+}
+
+func TestHint(t *testing.T) {
+	tests := []struct {
+		input    string
+		blocked  interp.Blocked
+		expected string
+	}{
+		{"flow ch = flow channel<int>\ndance v = <-ch", interp.Blocked{Line: 2, Column: 11}, "no dancer ever sends on `ch`"},
+		{"flow ch = flow channel<int>\nsend ch <- 1", interp.Blocked{Send: true, Line: 2, Column: 1}, "no dancer ever receives from `ch`"},
+		// An alias may be received from, so the send is not hopeless
+		{"flow ch = flow channel<int>\ndance alias = ch\nstart dance v = <-alias\nsend ch <- 1\nsend ch <- 2",
+			interp.Blocked{Send: true, Line: 5, Column: 1}, "no dancer is left to receive from `ch`"},
+		// Bytecode carries no source, so nothing is known of its sites
+		{"", interp.Blocked{Line: 2, Column: 11}, ""},
+	}
+	for _, tt := range tests {
+		if got := Find(parse(t, tt.input)).Hint(tt.blocked); got != tt.expected {
+			t.Errorf("input %q: expected hint %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+	
+	if got := Sites(nil).Describe(interp.Blocked{Dancer: 2, StartLine: 1, StartColumn: 1, Send: true, Line: 3, Column: 7}); got != "dancer 2 (started at 1:1) is blocked sending at 3:7" {
+		t.Errorf("description without sites wrong: %q", got)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parser errors: %v", p.Errors())
+	}
+	return program
+}
\ No newline at end of file
@@ -0,0 +1,58 @@
+package diff
+
+import "testing"
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		expected string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{"change", "a\nb\nc\n", "a\nB\nc\n", `--- old
++++ new
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+`},
+		{"missing newline", "a\nb", "a\nb\n", `--- old
++++ new
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++b
+`},
+		{"insert into empty", "", "a\n", `--- old
++++ new
+@@ -0,0 +1 @@
++a
+`},
+		{"separate hunks", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n", "x\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ny\n", `--- old
++++ new
+@@ -1,4 +1,4 @@
+-1
++x
+ 2
+ 3
+ 4
+@@ -9,4 +9,4 @@
+ 9
+ 10
+ 11
+-12
++y
+`},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Unified("old", "new", []byte(tt.old), []byte(tt.new))
+			if got != tt.expected {
+				t.Errorf("diff wrong.\nGot:\n%s\nExpected:\n%s", got, tt.expected)
+			}
+		})
+	}
+}
\ No newline at end of file
@@ -0,0 +1,388 @@
+// Package explore checks a concurrent ChoreLang program by running it under
+// many schedules. The program runs on the interpreter one dancer at a time,
+// and wherever more than one dancer could go on after a start, send or
+// receive, each of them is tried in turn, rerunning the program from the
+// beginning for every schedule. The deadlocks, failures and differing
+// outputs reached are reported, each with the smallest schedule found that
+// leads to it: the fewest preemptions, then the fewest turns.
+//
+// A preemption is a turn given to another dancer while the one running
+// could have gone on. Most concurrency bugs need only one or two, so
+// bounding them, and how many choices of a schedule are explored, keeps
+// the search small without missing much.
+package explore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/interp"
+)
+
+// Kinds of Issue
+const (
+	Deadlock = "deadlock"
+	Failure  = "failure"
+	Output   = "output"
+)
+
+// Options bound the search.
+type Options struct {
+	// Rehearsal names a rehearsal to explore instead of the program
+	Rehearsal string
+	
+	// Args are the program arguments args() reports
+	Args []string
+	
+	// Depth is how many choices of each schedule are explored. Beyond
+	// them the running dancer goes on, or the first ready one when it
+	// cannot.
+	Depth int
+	
+	// Preemptions is the most any schedule explored may have
+	Preemptions int
+	
+	// Statements cuts off a run after it has started this many
+	// statements, so a loop that never ends cannot stall the search. Zero
+	// means no limit.
+	Statements int
+	
+	// Runs stops the search after this many schedules; zero means no
+	// limit.
+	Runs int
+}
+
+// Step is one turn of a schedule: Dancer ran until Op at Line and Column,
+// where it Blocked or yielded, or until its "end".
+type Step struct {
+	Dancer       string
+	Op           string
+	Blocked      bool
+	Line, Column int
+}
+
+func (s Step) String() string {
+	if s.Op == "end" {
+		return fmt.Sprintf("%-10s end", s.Dancer)
+	}
+	text := fmt.Sprintf("%-10s %-7s at %d:%d", s.Dancer, s.Op, s.Line, s.Column)
+	if s.Blocked {
+		text += ", blocked"
+	}
+	return text
+}
+
+// Schedule is one way a run can go. Choices are the indexes chosen among
+// the ready dancers where there was a choice, which Replay follows; past
+// them the run takes the choices that preempt nobody.
+type Schedule struct {
+	Choices     []int
+	Preemptions int
+	Steps       []Step
+}
+
+// Replay writes the choices as chorelang explore -replay takes them.
+func (s Schedule) Replay() string {
+	if len(s.Choices) == 0 {
+		return "none"
+	}
+	parts := make([]string, len(s.Choices))
+	for i, c := range s.Choices {
+		parts[i] = strconv.Itoa(c)
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseChoices reads choices written by Schedule.Replay.
+func ParseChoices(s string) ([]int, error) {
+	if s == "none" {
+		return nil, nil
+	}
+	var choices []int
+	for _, part := range strings.Split(s, ",") {
+		c, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || c < 0 {
+			return nil, fmt.Errorf("bad choice %q: want indexes such as 1,0,2, or none", part)
+		}
+		choices = append(choices, c)
+	}
+	return choices, nil
+}
+
+// Issue is something a schedule leads to: a deadlock, a failure (a
+// runtime error or a failed expect), or, when runs can end differently,
+// one of the outputs. Line and Column are zero for outputs, and Message
+// gives an output's exit status, if it called exit. Blocked lists the
+// dancers of a deadlock.
+type Issue struct {
+	Kind         string
+	Line, Column int
+	Message      string
+	Output       string
+	Blocked      []interp.Blocked
+	Schedule     Schedule
+}
+
+// Report is what a search found.
+type Report struct {
+	// Runs counts the schedules run, and Cut those stopped at the
+	// statement limit, which count towards no issue
+	Runs int
+	Cut  int
+	
+	// Bounded reports that the bounds left schedules unexplored
+	Bounded bool
+	
+	Issues []Issue
+}
+
+// point is a choice a run made among N ready dancers. Yielded is true when
+// the dancer that ran last was one of them, at the back.
+type point struct {
+	n       int
+	chosen  int
+	yielded bool
+}
+
+// preempts reports whether choosing i at p takes the turn from a dancer
+// that could have gone on.
+func (p point) preempts(i int) bool {
+	return p.yielded && i != p.n-1
+}
+
+// settled is the choice at p that preempts nobody.
+func (p point) settled() int {
+	if p.yielded {
+		return p.n - 1
+	}
+	return 0
+}
+
+// run is the result of running one schedule.
+type run struct {
+	schedule Schedule
+	points   []point
+	output   string
+	err      error
+	failures []*interp.RuntimeError
+	cut      bool
+}
+
+// Explore searches the schedules of a resolved program within the bounds.
+func Explore(program *ast.Program, opts Options) *Report {
+	report := &Report{}
+	found := make(map[string]*Issue)
+	outcomes := make(map[string]*Issue)
+	
+	keep := func(key string, issues map[string]*Issue, issue Issue) {
+		if best, ok := issues[key]; ok && !shorter(issue.Schedule, best.Schedule) {
+			return
+		}
+		issues[key] = &issue
+	}
+	
+	pending := [][]int{nil}
+	for len(pending) > 0 {
+		if opts.Runs > 0 && report.Runs >= opts.Runs {
+			report.Bounded = true
+			break
+		}
+		prefix := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		
+		r := perform(program, opts, prefix, nil)
+		report.Runs++
+		
+		for _, issue := range r.issues() {
+			keep(issue.Kind+"\x00"+issue.Message+fmt.Sprintf("\x00%d:%d", issue.Line, issue.Column), found, issue)
+		}
+		if r.cut {
+			report.Cut++
+		} else if outcome, ok := r.outcome(); ok {
+			keep(outcome.Output+"\x00"+outcome.Message, outcomes, outcome)
+		}
+		
+		// Branch at every choice this run made past its prefix, the later
+		// ones first so the search goes deep before it goes wide
+		preemptions := make([]int, len(r.points)+1)
+		for j, p := range r.points {
+			preemptions[j+1] = preemptions[j]
+			if p.preempts(p.chosen) {
+				preemptions[j+1]++
+			}
+		}
+		for j := len(prefix); j < len(r.points); j++ {
+			if j >= opts.Depth {
+				report.Bounded = true
+				break
+			}
+			p := r.points[j]
+			for i := p.n - 1; i >= 0; i-- {
+				if i == p.chosen {
+					continue
+				}
+				if p.preempts(i) && preemptions[j]+1 > opts.Preemptions {
+					report.Bounded = true
+					continue
+				}
+				choices := make([]int, j+1)
+				for k := 0; k < j; k++ {
+					choices[k] = r.points[k].chosen
+				}
+				choices[j] = i
+				pending = append(pending, choices)
+			}
+		}
+	}
+	
+	for _, issue := range found {
+		report.Issues = append(report.Issues, *issue)
+	}
+	if len(outcomes) > 1 {
+		for _, issue := range outcomes {
+			report.Issues = append(report.Issues, *issue)
+		}
+	}
+	sort.Slice(report.Issues, func(i, j int) bool {
+		a, b := report.Issues[i], report.Issues[j]
+		if a.Kind != b.Kind {
+			return kindOrder(a.Kind) < kindOrder(b.Kind)
+		}
+		if a.Line != b.Line || a.Column != b.Column {
+			return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+		}
+		if a.Message != b.Message {
+			return a.Message < b.Message
+		}
+		return a.Output < b.Output
+	})
+	return report
+}
+
+// Replay runs the program once, following choices, and writes what it
+// prints to out. It returns the schedule taken and the error the program
+// stopped with, if any.
+func Replay(program *ast.Program, opts Options, choices []int, out io.Writer) (Schedule, error) {
+	r := perform(program, opts, choices, out)
+	if r.err == nil && r.cut {
+		r.err = fmt.Errorf("stopped after %d statements", opts.Statements)
+	}
+	return r.schedule, r.err
+}
+
+// errFit is a choice that does not fit the run it replays.
+var errFit = errors.New("schedule does not fit the program")
+
+// perform runs the program once, taking the given choices and then the
+// ones that preempt nobody. A copy of the output goes to echo, if set.
+func perform(program *ast.Program, opts Options, choices []int, echo io.Writer) *run {
+	r := &run{schedule: Schedule{Choices: choices}}
+	var out bytes.Buffer
+	var w io.Writer = &out
+	if echo != nil {
+		w = io.MultiWriter(&out, echo)
+	}
+	
+	in := interp.New(w)
+	in.Args = opts.Args
+	in.Rehearsal = opts.Rehearsal
+	
+	var misfit error
+	in.Pick = func(t interp.Turn) int {
+		r.schedule.Steps = append(r.schedule.Steps, Step{
+			Dancer: t.Last.Name(), Op: t.Op, Blocked: t.Blocked, Line: t.Line, Column: t.Column,
+		})
+		if len(t.Ready) <= 1 {
+			return 0
+		}
+		p := point{n: len(t.Ready), yielded: t.Ready[len(t.Ready)-1] == t.Last}
+		p.chosen = p.settled()
+		if k := len(r.points); k < len(choices) {
+			if choices[k] < p.n {
+				p.chosen = choices[k]
+			} else if misfit == nil {
+				misfit = fmt.Errorf("%w: choice %d is %d, but only %d dancers were ready", errFit, k+1, choices[k], p.n)
+			}
+		}
+		if p.preempts(p.chosen) {
+			r.schedule.Preemptions++
+		}
+		r.points = append(r.points, p)
+		return p.chosen
+	}
+	
+	// Only the dancer whose turn it is counts, so the count needs no lock
+	statements := 0
+	in.Count = func(ast.Statement) {
+		statements++
+		if opts.Statements > 0 && statements > opts.Statements && !r.cut {
+			r.cut = true
+			in.Halt()
+		}
+	}
+	
+	r.err = in.Run(program)
+	if r.err == nil {
+		r.err = misfit
+	}
+	r.failures = in.Failures()
+	r.output = out.String()
+	return r
+}
+
+// issues returns the deadlock or failures the run led to.
+func (r *run) issues() []Issue {
+	var issues []Issue
+	for _, f := range r.failures {
+		issues = append(issues, Issue{Kind: Failure, Line: f.Line, Column: f.Column, Message: f.Message, Output: r.output, Schedule: r.schedule})
+	}
+	var runtimeErr *interp.RuntimeError
+	var deadlock *interp.DeadlockError
+	switch {
+	case errors.As(r.err, &runtimeErr):
+		issues = append(issues, Issue{Kind: Failure, Line: runtimeErr.Line, Column: runtimeErr.Column,
+			Message: runtimeErr.Message, Output: r.output, Schedule: r.schedule})
+	case errors.As(r.err, &deadlock):
+		issues = append(issues, Issue{Kind: Deadlock, Line: deadlock.Line, Column: deadlock.Column,
+			Message: "all dancers are asleep - deadlock!", Output: r.output, Blocked: deadlock.Blocked, Schedule: r.schedule})
+	}
+	return issues
+}
+
+// outcome is how a run that completed ended: its output and exit status.
+func (r *run) outcome() (Issue, bool) {
+	issue := Issue{Kind: Output, Output: r.output, Schedule: r.schedule}
+	var exit *interp.ExitError
+	switch {
+	case r.err == nil:
+	case errors.As(r.err, &exit):
+		issue.Message = fmt.Sprintf("exit status %d", exit.Code)
+	default:
+		return Issue{}, false
+	}
+	return issue, true
+}
+
+// shorter reports whether a is a smaller schedule than b.
+func shorter(a, b Schedule) bool {
+	if a.Preemptions != b.Preemptions {
+		return a.Preemptions < b.Preemptions
+	}
+	return len(a.Steps) < len(b.Steps)
+}
+
+func kindOrder(kind string) int {
+	switch kind {
+	case Deadlock:
+		return 0
+	case Failure:
+		return 1
+	}
+	return 2
+}
\ No newline at end of file
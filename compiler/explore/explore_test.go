@@ -0,0 +1,186 @@
+package explore
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/parser"
+)
+
+var bounds = Options{Depth: 40, Preemptions: 2, Statements: 10000, Runs: 1000}
+
+// handshake deadlocks only when the second dancer's send arrives first.
+const handshake = `flow results = flow channel<int>
+flow ack = flow channel<int>
+start send results <- 1
+start {
+    send results <- 2
+    dance a = <-ack
+}
+dance first = <-results
+dance second = <-results
+send ack <- 0
+if first == 2 {
+    send ack <- 0
+}
+`
+
+func TestDeadlock(t *testing.T) {
+	program := parse(t, handshake)
+	complete := bounds
+	complete.Preemptions = 100
+	report := Explore(program, complete)
+	if report.Bounded || report.Runs < 2 {
+		t.Errorf("expected a complete search of several schedules, got %+v", report)
+	}
+	if len(report.Issues) != 1 {
+		t.Fatalf("expected one issue, got %+v", report.Issues)
+	}
+	issue := report.Issues[0]
+	if issue.Kind != Deadlock || issue.Line != 12 || issue.Column != 5 {
+		t.Errorf("expected a deadlock at 12:5, got %s at %d:%d: %s", issue.Kind, issue.Line, issue.Column, issue.Message)
+	}
+	// Letting dancer 2 go first needs no preemption, since main is blocked
+	if issue.Schedule.Preemptions != 0 || issue.Schedule.Replay() != "1,2,1" {
+		t.Errorf("expected dancer 2 to go first, got %+v", issue.Schedule)
+	}
+	
+	var steps []string
+	for _, s := range issue.Schedule.Steps {
+		steps = append(steps, strings.Join(strings.Fields(s.String()), " "))
+	}
+	expected := []string{
+		"main start at 3:1",
+		"main start at 4:1",
+		"main receive at 8:15, blocked",
+		"dancer 2 send at 5:5",
+		"dancer 2 receive at 6:15, blocked",
+		"dancer 1 send at 3:7, blocked",
+		"main receive at 9:16",
+		"main send at 10:1",
+		"main send at 12:5, blocked",
+		"dancer 1 end",
+		"dancer 2 end",
+	}
+	if strings.Join(steps, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("schedule wrong:\n%s", strings.Join(steps, "\n"))
+	}
+	
+	// The schedule replays to the same deadlock, and the default one does not
+	choices, err := ParseChoices(issue.Schedule.Replay())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Replay(program, bounds, choices, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "12:5: all dancers are asleep") {
+		t.Errorf("replay did not deadlock: %v", err)
+	}
+	if _, err := Replay(program, bounds, nil, &bytes.Buffer{}); err != nil {
+		t.Errorf("default schedule failed: %v", err)
+	}
+	if _, err := Replay(program, bounds, []int{5}, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "only 2 dancers were ready") {
+		t.Errorf("expected a misfit, got %v", err)
+	}
+}
+
+func TestOutputs(t *testing.T) {
+	input := `start spin print("a")
+start spin print("b")
+flow done = flow channel<int>
+start send done <- 1
+dance v = <-done
+`
+	report := Explore(parse(t, input), bounds)
+	var outputs []string
+	for _, issue := range report.Issues {
+		if issue.Kind != Output || issue.Schedule.Preemptions != 0 {
+			t.Errorf("unexpected issue %+v", issue)
+			continue
+		}
+		outputs = append(outputs, issue.Output)
+	}
+	if got := strings.Join(outputs, "|"); got != "|a\n|a\nb\n|b\n|b\na\n" {
+		t.Errorf("expected every output of the program, got %q", got)
+	}
+	
+	// A program that always prints the same has no output to report
+	report = Explore(parse(t, "flow ch = flow channel<int>\nstart send ch <- 1\nspin print(<-ch)"), bounds)
+	if len(report.Issues) != 0 {
+		t.Errorf("expected nothing, got %+v", report.Issues)
+	}
+}
+
+func TestRehearsalFailure(t *testing.T) {
+	input := `rehearse "a before b" {
+    flow order = flow channel<string>
+    start send order <- "a"
+    start send order <- "b"
+    spin expect(<-order, "a")
+    dance rest = <-order
+}
+`
+	program := parse(t, input)
+	opts := bounds
+	opts.Rehearsal = "a before b"
+	report := Explore(program, opts)
+	if len(report.Issues) != 1 || report.Issues[0].Kind != Failure || report.Issues[0].Line != 5 ||
+		report.Issues[0].Message != `got "b", want "a"` {
+		t.Fatalf("expected the expect to fail, got %+v", report.Issues)
+	}
+	
+	// Without the rehearsal the program does nothing
+	if report := Explore(program, bounds); len(report.Issues) != 0 || report.Runs != 1 {
+		t.Errorf("expected one quiet run, got %+v", report)
+	}
+}
+
+func TestBounds(t *testing.T) {
+	program := parse(t, handshake)
+	opts := bounds
+	opts.Runs = 1
+	if report := Explore(program, opts); report.Runs != 1 || !report.Bounded || len(report.Issues) != 0 {
+		t.Errorf("expected one bounded run, got %+v", report)
+	}
+	
+	opts = bounds
+	opts.Depth = 0
+	if report := Explore(program, opts); report.Runs != 1 || !report.Bounded {
+		t.Errorf("expected depth 0 to explore the default schedule only, got %+v", report)
+	}
+	
+	opts = bounds
+	opts.Statements = 100
+	report := Explore(parse(t, "sway i from 1 to 1000 {\n    dance x = i\n}"), opts)
+	if report.Runs != 1 || report.Cut != 1 || len(report.Issues) != 0 {
+		t.Errorf("expected the run to be cut off, got %+v", report)
+	}
+}
+
+func TestParseChoices(t *testing.T) {
+	for _, s := range []string{"none", "1", "1,0,2"} {
+		choices, err := ParseChoices(s)
+		if err != nil {
+			t.Errorf("ParseChoices(%q): %v", s, err)
+			continue
+		}
+		if got := (Schedule{Choices: choices}).Replay(); got != s {
+			t.Errorf("ParseChoices(%q) replays as %q", s, got)
+		}
+	}
+	for _, s := range []string{"", "a", "1,-1"} {
+		if _, err := ParseChoices(s); err == nil {
+			t.Errorf("ParseChoices(%q): expected an error", s)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parser errors: %v", p.Errors())
+	}
+	return program
+}
\ No newline at end of file
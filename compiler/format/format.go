@@ -0,0 +1,325 @@
+// Package format prints ChoreLang programs as canonical source:
+//
+//   - one statement per line, blocks and match cases indented by four
+//     spaces
+//   - single spaces around operators and after commas
+//   - parentheses only where the grouping needs them
+//   - comments where they were written, and at most one blank line between
+//     statements, none at the start or end of a block
+//
+// Formatting formatted source changes nothing.
+package format
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/parser"
+)
+
+const indent = "    "
+
+// Source parses src and returns it formatted. Formatting only moves
+// comments and spaces and adds or drops parentheses and semicolons, so
+// Source refuses, rather than lose code, if the result holds any other
+// tokens than src.
+func Source(src []byte) ([]byte, error) {
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, "\n"))
+	}
+	out := Program(program)
+	if err := Lossless(src, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Lossless reports the first token of src that out, its formatted form,
+// does not keep. Tools that print a parsed program check it before
+// writing it back.
+func Lossless(src, out []byte) error {
+	before, after := lexer.New(string(src)), lexer.New(string(out))
+	for {
+		want, got := significant(before), significant(after)
+		if want.Type != got.Type || want.Literal != got.Literal {
+			return fmt.Errorf("%d:%d: formatting would drop or change %q; the source is left as it is",
+				want.Line, want.Column, want.Literal)
+		}
+		if want.Type == lexer.EOF {
+			return nil
+		}
+	}
+}
+
+// significant returns the next token that formatting must keep.
+func significant(l *lexer.Lexer) lexer.Token {
+	for {
+		tok := l.NextToken()
+		switch tok.Type {
+		case lexer.COMMENT, lexer.SEMICOLON, lexer.LPAREN, lexer.RPAREN:
+			continue
+		}
+		return tok
+	}
+}
+
+// Program prints a parsed program. Comments and blank lines come from the
+// program's trivia, so a program built by hand prints without them.
+func Program(program *ast.Program) []byte {
+	p := &printer{program: program}
+	
+	nodes := make([]ast.Node, len(program.Statements))
+	for i, stmt := range program.Statements {
+		nodes[i] = stmt
+	}
+	p.list(nodes, program, p.statement)
+	
+	return p.out.Bytes()
+}
+
+type printer struct {
+	out     bytes.Buffer
+	program *ast.Program
+	depth   int
+}
+
+func (p *printer) write(s string) {
+	p.out.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.out.WriteString("\n")
+	p.out.WriteString(strings.Repeat(indent, p.depth))
+}
+
+// list prints the statements or cases of container, one per line, each
+// with its comments. It starts on a fresh line and ends after the last
+// one.
+func (p *printer) list(nodes []ast.Node, container ast.Node, print func(ast.Node)) {
+	lines := 0
+	line := func(blank bool) {
+		// Blank lines never open a block or a file
+		if blank && lines > 0 {
+			p.write("\n")
+		}
+		if lines > 0 || p.out.Len() > 0 {
+			p.newline()
+		} else {
+			p.write(strings.Repeat(indent, p.depth))
+		}
+		lines++
+	}
+	
+	for _, node := range nodes {
+		t := p.program.TriviaOf(node)
+		for _, c := range t.Leading {
+			line(c.BlankBefore)
+			p.write(comment(c))
+		}
+		line(t.BlankBefore)
+		print(node)
+		if t.Trailing != nil {
+			p.write(" " + comment(t.Trailing))
+		}
+	}
+	
+	for _, c := range p.program.TriviaOf(container).Dangling {
+		line(c.BlankBefore)
+		p.write(comment(c))
+	}
+	
+	if _, ok := container.(*ast.Program); ok && lines > 0 {
+		p.write("\n")
+	}
+}
+
+func comment(c *ast.Comment) string {
+	return strings.TrimRight(c.Text, " \t")
+}
+
+func (p *printer) statement(node ast.Node) {
+	switch s := node.(type) {
+	case *ast.DanceStatement:
+		// `flow channel<int> ch` declares and names in one go
+		if flow, ok := s.Value.(*ast.FlowExpression); ok && flow.Token == s.Token && flow.ElementType != nil {
+			p.write("flow ")
+			p.expression(flow.ChannelType)
+			p.write("<" + flow.ElementType.Value + "> " + s.Name.Value)
+			return
+		}
+		p.write(s.Token.Literal + " " + s.Name.Value + " = ")
+		p.expression(s.Value)
+	case *ast.AssignStatement:
+		p.write(s.Name.Value + " = ")
+		p.expression(s.Value)
+	case *ast.ExpressionStatement:
+		p.expression(s.Expression)
+	case *ast.SwayStatement:
+		p.write("sway " + s.Variable.Value + " from ")
+		p.expression(s.From)
+		p.write(" to ")
+		p.expression(s.To)
+		p.write(" ")
+		p.block(s.Body)
+	case *ast.StartStatement:
+		p.write("start ")
+		p.statement(s.Statement)
+	case *ast.SendStatement:
+		p.write("send ")
+		p.expression(s.Channel)
+		p.write(" <- ")
+		p.expression(s.Value)
+	case *ast.IfStatement:
+		p.write("if ")
+		p.expression(s.Condition)
+		p.write(" ")
+		p.block(s.Consequence)
+		if s.Alternative != nil {
+			p.write(" else ")
+			p.block(s.Alternative)
+		}
+	case *ast.RehearseStatement:
+		p.write("rehearse ")
+		p.expression(s.Name)
+		p.write(" ")
+		p.block(s.Body)
+	case *ast.EncoreStatement:
+		p.write("encore ")
+		p.expression(s.Name)
+		p.write(" ")
+		p.block(s.Body)
+	case *ast.BlockStatement:
+		p.block(s)
+	}
+}
+
+func (p *printer) block(b *ast.BlockStatement) {
+	if len(b.Statements) == 0 && len(p.program.TriviaOf(b).Dangling) == 0 {
+		p.write("{}")
+		return
+	}
+	
+	nodes := make([]ast.Node, len(b.Statements))
+	for i, stmt := range b.Statements {
+		nodes[i] = stmt
+	}
+	
+	p.write("{")
+	p.depth++
+	p.list(nodes, b, p.statement)
+	p.depth--
+	p.newline()
+	p.write("}")
+}
+
+// precedences follow the parser: comparisons of equality bind loosest,
+// then ordering, then sums, then products.
+var precedences = map[string]int{
+	"==": 1, "!=": 1, "=~": 1,
+	"<": 2, ">": 2, "<=": 2, ">=": 2,
+	"+": 3, "-": 3,
+	"*": 4, "/": 4,
+}
+
+func (p *printer) expression(exp ast.Expression) {
+	switch e := exp.(type) {
+	case *ast.Identifier:
+		p.write(e.Value)
+	case *ast.IntegerLiteral:
+		p.write(e.Token.Literal)
+	case *ast.FloatLiteral:
+		p.write(e.Token.Literal)
+	case *ast.StringLiteral:
+		p.write(`"` + e.Value + `"`)
+	case *ast.Boolean:
+		p.write(e.Token.Literal)
+	case *ast.InfixExpression:
+		// Operators group to the left, so a right operand of the same
+		// precedence needs parentheses and a left one does not
+		prec := precedences[e.Operator]
+		p.operand(e.Left, func(inner int) bool { return inner < prec })
+		p.write(" " + e.Operator + " ")
+		p.operand(e.Right, func(inner int) bool { return inner <= prec })
+	case *ast.SpinExpression:
+		p.write("spin ")
+		p.expression(e.Function)
+		p.write("(")
+		for i, arg := range e.Arguments {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(arg)
+		}
+		p.write(")")
+	case *ast.MemberCallExpression:
+		p.operand(e.Receiver, func(int) bool { return true })
+		p.write("." + e.Member.Value + "(")
+		for i, arg := range e.Arguments {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(arg)
+		}
+		p.write(")")
+	case *ast.FlowExpression:
+		p.write("flow ")
+		p.expression(e.ChannelType)
+		if e.ElementType != nil {
+			p.write("<" + e.ElementType.Value + ">")
+		}
+	case *ast.ReceiveExpression:
+		p.write("<-")
+		p.operand(e.Channel, func(int) bool { return true })
+	case *ast.MatchExpression:
+		p.match(e)
+	}
+}
+
+// operand prints an operand, in parentheses if it is a binary expression
+// whose precedence needsParens rejects.
+func (p *printer) operand(exp ast.Expression, needsParens func(int) bool) {
+	infix, ok := exp.(*ast.InfixExpression)
+	if !ok || !needsParens(precedences[infix.Operator]) {
+		p.expression(exp)
+		return
+	}
+	p.write("(")
+	p.expression(exp)
+	p.write(")")
+}
+
+func (p *printer) match(e *ast.MatchExpression) {
+	p.write("match ")
+	p.expression(e.Expression)
+	p.write(" {")
+	
+	nodes := make([]ast.Node, len(e.Cases))
+	for i, c := range e.Cases {
+		nodes[i] = c
+	}
+	
+	p.depth++
+	p.list(nodes, e, func(node ast.Node) {
+		c := node.(*ast.WhenCase)
+		p.write("when ")
+		p.expression(c.Pattern)
+		if c.Parameters != nil {
+			names := make([]string, len(c.Parameters))
+			for i, param := range c.Parameters {
+				names[i] = param.Value
+			}
+			p.write("(" + strings.Join(names, ", ") + ")")
+		}
+		p.write(": ")
+		p.expression(c.Consequence)
+	})
+	p.depth--
+	p.newline()
+	p.write("}")
+}
\ No newline at end of file
@@ -0,0 +1,98 @@
+package format
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"spacing", "dance   x=1+2*3 ;x=x*2", "dance x = 1 + 2 * 3\nx = x * 2\n"},
+		{"parentheses", "dance a = (1 + 2) * 3\ndance b = 10 - (4 - 2)\ndance c = (10 - 4) - 2\ndance d = <-(ch)",
+			"dance a = (1 + 2) * 3\ndance b = 10 - (4 - 2)\ndance c = 10 - 4 - 2\ndance d = <-ch\n"},
+		{"blocks", "if x>1{spin print( \"a\" ,x)}else{\n\n\nspin print(\"b\")\n\n}\nsway i from 1 to 3 { }",
+			"if x > 1 {\n    spin print(\"a\", x)\n} else {\n    spin print(\"b\")\n}\nsway i from 1 to 3 {}\n"},
+		{"blank lines", "\n\ndance a = 1\n\n\n\ndance b = 2\n\n", "dance a = 1\n\ndance b = 2\n"},
+		{"channels", "flow channel<int> steps\nflow jobs = flow channel<string>\nstart send steps <- 1\nstart {\nsend jobs <- \"x\"\n}",
+			"flow channel<int> steps\nflow jobs = flow channel<string>\nstart send steps <- 1\nstart {\n    send jobs <- \"x\"\n}\n"},
+		{"match", "dance r = match x {\nwhen Note(n,m): flow \"two\"\n\n\nwhen Rest(): flow 1\n}",
+			"dance r = match x {\n    when Note(n, m): flow \"two\"\n\n    when Rest(): flow 1\n}\n"},
+		{"comments", "// header   \ndance x = 1 // one\nif true { // opens\n    // inside\n}\n\n// last",
+			"// header\ndance x = 1 // one\nif true {\n    // opens\n    // inside\n}\n\n// last\n"},
+		{"comment inside an expression", "send ch <- spin f(\n  // the argument\n  1)",
+			"// the argument\nsend ch <- spin f(1)\n"},
+		{"strings are kept verbatim", `spin print("a\tb", "line
+two")`, "spin print(\"a\\tb\", \"line\ntwo\")\n"},
+		{"members", "flow files=chore . fs( )\nfiles.write( \"a\",files.read(\"b\"))",
+			"flow files = chore.fs()\nfiles.write(\"a\", files.read(\"b\"))\n"},
+		{"rehearse", "rehearse   \"adds\"{spin expect(1+2,3)}", "rehearse \"adds\" {\n    spin expect(1 + 2, 3)\n}\n"},
+		{"encore", "encore \"sums\"  {dance t=0}", "encore \"sums\" {\n    dance t = 0\n}\n"},
+		{"empty", "\n\n", ""},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Source([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("formatted wrong.\nGot:\n%q\nExpected:\n%q", got, tt.expected)
+			}
+			
+			again, err := Source(got)
+			if err != nil {
+				t.Fatalf("formatted source does not parse: %v", err)
+			}
+			if string(again) != string(got) {
+				t.Errorf("formatting is not idempotent.\nOnce:\n%s\nTwice:\n%s", got, again)
+			}
+		})
+	}
+}
+
+func TestSourceReportsParseErrors(t *testing.T) {
+	if _, err := Source([]byte("dance = 1")); err == nil {
+		t.Error("expected a parse error")
+	}
+}
+
+func TestSourceRefusesToDropCode(t *testing.T) {
+	// The parser keeps only the names of a pattern's parameters
+	_, err := Source([]byte("dance r = match x {\n    when Note(n, 5): flow 1\n}\n"))
+	expected := `2:16: formatting would drop or change ","; the source is left as it is`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+}
+
+// TestExamplesAreFormatted requires every example to be in canonical form,
+// which also shows that formatting them changes nothing.
+func TestExamplesAreFormatted(t *testing.T) {
+	files, err := filepath.Glob("../../examples/*.chore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no examples found")
+	}
+	
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Source(source)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		if string(got) != string(source) {
+			t.Errorf("%s is not formatted; run chorelang fmt -w examples", file)
+		}
+	}
+}
\ No newline at end of file
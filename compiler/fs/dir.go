@@ -0,0 +1,127 @@
+package fs
+
+import (
+	"errors"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Dir returns a sandbox of the host directory root, which must exist.
+//
+// Symbolic links inside the root are followed while they stay in it. A
+// path is checked as each operation starts, so a program that races the
+// sandbox by changing links under it could still slip out; run untrusted
+// programs in a root nothing else writes to.
+func Dir(root string) (*Sandbox, error) {
+	real, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+	real, err = filepath.Abs(real)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(real)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &os.PathError{Op: "sandbox", Path: root, Err: errNotDir}
+	}
+	return &Sandbox{b: &dir{root: real}}, nil
+}
+
+// dir is the backend of a host directory.
+type dir struct {
+	root string // absolute, with no symbolic links
+}
+
+func (d *dir) host(name string) string {
+	return filepath.Join(d.root, filepath.FromSlash(name))
+}
+
+func (d *dir) readFile(name string) ([]byte, error) {
+	data, err := os.ReadFile(d.host(name))
+	return data, bare(err)
+}
+
+func (d *dir) writeFile(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(d.host(name)), 0755); err != nil {
+		return bare(err)
+	}
+	return bare(os.WriteFile(d.host(name), data, 0644))
+}
+
+func (d *dir) readDir(name string) ([]Info, error) {
+	entries, err := os.ReadDir(d.host(name))
+	if err != nil {
+		return nil, bare(err)
+	}
+	infos := make([]Info, 0, len(entries))
+	for _, entry := range entries {
+		// Follow links, so a linked directory lists as one
+		info, err := d.stat(join(name, entry.Name()))
+		if err != nil {
+			info = Info{Name: join(name, entry.Name())}
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (d *dir) stat(name string) (Info, error) {
+	fi, err := os.Stat(d.host(name))
+	if err != nil {
+		return Info{}, bare(err)
+	}
+	return Info{Name: name, Size: fi.Size(), Dir: fi.IsDir(), ModTime: fi.ModTime()}, nil
+}
+
+func (d *dir) mkdir(name string) error {
+	return bare(os.Mkdir(d.host(name), 0755))
+}
+
+func (d *dir) removeAll(name string) error {
+	return bare(os.RemoveAll(d.host(name)))
+}
+
+// escapes resolves the deepest part of name that exists, links and all,
+// and reports whether it lies outside the root. What does not exist yet
+// cannot be a link. A link that leads nowhere escapes, since writing
+// through it would create its target wherever it points.
+func (d *dir) escapes(name string) bool {
+	host := d.host(name)
+	for {
+		if _, err := os.Lstat(host); err == nil {
+			break
+		} else if !errors.Is(err, iofs.ErrNotExist) {
+			return false
+		}
+		parent := filepath.Dir(host)
+		if parent == host || len(parent) < len(d.root) {
+			return false
+		}
+		host = parent
+	}
+	real, err := filepath.EvalSymlinks(host)
+	if err != nil {
+		return true
+	}
+	rel, err := filepath.Rel(d.root, real)
+	return err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// bare drops the host path from an error, leaving what went wrong.
+func bare(err error) error {
+	var pathErr *iofs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) {
+		return linkErr.Err
+	}
+	return err
+}
\ No newline at end of file
@@ -0,0 +1,307 @@
+// Package fs is the sandboxed file system behind chore.fs(). A Sandbox
+// reads, writes, lists, globs and watches the files under one root, and
+// nothing outside it: every path is relative to the root, whatever it
+// looks like, and a path that would leave it is denied, whether by `..`,
+// a drive letter or a symbolic link.
+//
+// Paths are slash-separated on every platform. A leading slash means the
+// root, as in a chroot, so "/poem.txt" and "poem.txt" are the same file.
+//
+// Dir jails a directory of the host, and Memory keeps the files in memory,
+// for tests. ReadOnly gives a view of either that cannot change it. Every
+// failure is an *Error naming the operation, the path as the program gave
+// it and, when the sandbox denied it, the rule that did.
+package fs
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"math/rand"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule is a sandbox rule that can deny an operation.
+type Rule string
+
+const (
+	// Jail denies a path that leaves the root by `..` or names a volume.
+	Jail Rule = "jail"
+	// Symlink denies a path through a symbolic link that leads out of the
+	// root, or nowhere.
+	Symlink Rule = "symlink"
+	// ReadOnly denies changes to a read-only sandbox.
+	ReadOnly Rule = "read-only"
+	// Root denies removing the root itself.
+	Root Rule = "root"
+)
+
+var explanations = map[Rule]string{
+	Jail:     "the path leaves the sandbox root",
+	Symlink:  "a symbolic link on the path leads out of the sandbox root, or nowhere",
+	ReadOnly: "the sandbox is read-only",
+	Root:     "the sandbox root cannot be removed",
+}
+
+// Error is a failed operation on a sandbox. Path is the path the program
+// gave. Rule is the sandbox rule that denied the operation, or empty when
+// the operation was allowed but failed, in which case Err says why.
+type Error struct {
+	Op   string
+	Path string
+	Rule Rule
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Rule != "" {
+		return fmt.Sprintf("%s %q: denied by the %s rule: %s", e.Op, e.Path, e.Rule, explanations[e.Rule])
+	}
+	return fmt.Sprintf("%s %q: %v", e.Op, e.Path, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Info describes a file or directory. Name is its path in the sandbox.
+type Info struct {
+	Name    string
+	Size    int64
+	Dir     bool
+	ModTime time.Time
+}
+
+// backend stores the files of a sandbox. The paths it is given are clean,
+// slash-separated, relative to the root ("." for the root itself), and
+// already inside the jail. Its errors never name host paths.
+type backend interface {
+	readFile(name string) ([]byte, error)
+	// writeFile creates the directories above name as needed.
+	writeFile(name string, data []byte) error
+	readDir(name string) ([]Info, error)
+	stat(name string) (Info, error)
+	// mkdir fails with fs.ErrExist if name exists.
+	mkdir(name string) error
+	removeAll(name string) error
+	// escapes reports whether a symbolic link takes name out of the root.
+	escapes(name string) bool
+}
+
+// Sandbox is a file system jailed to a root. Its methods may be called
+// from any number of dancers at once.
+type Sandbox struct {
+	b        backend
+	readOnly bool
+}
+
+// ReadOnly returns a view of the sandbox that reads what it holds but
+// denies every change.
+func (s *Sandbox) ReadOnly() *Sandbox {
+	return &Sandbox{b: s.b, readOnly: true}
+}
+
+// resolve checks name against the jail, and against the read-only rule
+// for an operation that changes the sandbox, and returns its clean path.
+func (s *Sandbox) resolve(op, name string, change bool) (string, error) {
+	p := filepath.ToSlash(name)
+	if filepath.VolumeName(name) != "" {
+		return "", &Error{Op: op, Path: name, Rule: Jail}
+	}
+	p = path.Clean("./" + strings.TrimLeft(p, "/"))
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", &Error{Op: op, Path: name, Rule: Jail}
+	}
+	if s.b.escapes(p) {
+		return "", &Error{Op: op, Path: name, Rule: Symlink}
+	}
+	if change && s.readOnly {
+		return "", &Error{Op: op, Path: name, Rule: ReadOnly}
+	}
+	return p, nil
+}
+
+// failed wraps a backend error, which already names no host path.
+func failed(op, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Op: op, Path: name, Err: err}
+}
+
+// Read returns the contents of the file name.
+func (s *Sandbox) Read(name string) ([]byte, error) {
+	p, err := s.resolve("read", name, false)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.b.readFile(p)
+	return data, failed("read", name, err)
+}
+
+// Write replaces the contents of the file name, creating it and the
+// directories above it as needed.
+func (s *Sandbox) Write(name string, data []byte) error {
+	p, err := s.resolve("write", name, true)
+	if err != nil {
+		return err
+	}
+	if p == "." {
+		return failed("write", name, errIsDir)
+	}
+	return failed("write", name, s.b.writeFile(p, data))
+}
+
+// List returns the files and directories in dir, sorted by name.
+func (s *Sandbox) List(dir string) ([]Info, error) {
+	p, err := s.resolve("list", dir, false)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := s.b.readDir(p)
+	if err != nil {
+		return nil, failed("list", dir, err)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+// Stat describes the file or directory name.
+func (s *Sandbox) Stat(name string) (Info, error) {
+	p, err := s.resolve("stat", name, false)
+	if err != nil {
+		return Info{}, err
+	}
+	info, err := s.b.stat(p)
+	return info, failed("stat", name, err)
+}
+
+// Remove removes name and, for a directory, everything in it. Removing a
+// path that does not exist is not an error.
+func (s *Sandbox) Remove(name string) error {
+	p, err := s.resolve("remove", name, true)
+	if err != nil {
+		return err
+	}
+	if p == "." {
+		return &Error{Op: "remove", Path: name, Rule: Root}
+	}
+	return failed("remove", name, s.b.removeAll(p))
+}
+
+// TempDir makes a new directory under tmp in the sandbox and returns its
+// path. As with os.MkdirTemp, a random string replaces the last "*" in
+// pattern, or is added to its end.
+func (s *Sandbox) TempDir(pattern string) (string, error) {
+	if strings.Contains(pattern, "/") {
+		return "", failed("tempdir", pattern, errors.New("pattern contains a slash"))
+	}
+	prefix, suffix := pattern, ""
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		prefix, suffix = pattern[:i], pattern[i+1:]
+	}
+	if _, err := s.resolve("tempdir", "tmp", true); err != nil {
+		return "", err
+	}
+	if err := s.b.mkdir("tmp"); err != nil && !errors.Is(err, iofs.ErrExist) {
+		return "", failed("tempdir", "tmp", err)
+	}
+	for try := 0; try < 10000; try++ {
+		name := "tmp/" + prefix + strconv.FormatUint(uint64(rand.Uint32()), 10) + suffix
+		err := s.b.mkdir(name)
+		if err == nil {
+			return name, nil
+		}
+		if !errors.Is(err, iofs.ErrExist) {
+			return "", failed("tempdir", name, err)
+		}
+	}
+	return "", failed("tempdir", pattern, errors.New("no unused name found"))
+}
+
+// Glob returns the paths that match pattern, sorted. Each element of the
+// pattern matches one element of a path as path.Match does, except "**",
+// which matches any number of directories, none included.
+func (s *Sandbox) Glob(pattern string) ([]string, error) {
+	p, err := s.resolve("glob", pattern, false)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := path.Match(p, ""); err != nil {
+		return nil, failed("glob", pattern, err)
+	}
+	var matches []string
+	if err := s.glob(".", strings.Split(p, "/"), &matches); err != nil {
+		return nil, failed("glob", pattern, err)
+	}
+	sort.Strings(matches)
+	
+	// Several "**" can reach one path more than once
+	unique := matches[:0]
+	for i, m := range matches {
+		if i == 0 || m != matches[i-1] {
+			unique = append(unique, m)
+		}
+	}
+	return unique, nil
+}
+
+// glob adds the paths under dir that match the elements of a pattern.
+func (s *Sandbox) glob(dir string, elems []string, matches *[]string) error {
+	if len(elems) == 0 {
+		*matches = append(*matches, dir)
+		return nil
+	}
+	elem, rest := elems[0], elems[1:]
+	if elem == "." {
+		return s.glob(dir, rest, matches)
+	}
+	
+	infos, err := s.b.readDir(dir)
+	if errors.Is(err, iofs.ErrNotExist) || errors.Is(err, errNotDir) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if elem == "**" {
+		// None of the directories, or one more and still **
+		if err := s.glob(dir, rest, matches); err != nil {
+			return err
+		}
+		for _, info := range infos {
+			if info.Dir && !s.b.escapes(info.Name) {
+				if err := s.glob(info.Name, elems, matches); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for _, info := range infos {
+		if ok, _ := path.Match(elem, path.Base(info.Name)); ok && !s.b.escapes(info.Name) {
+			if err := s.glob(info.Name, rest, matches); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// join is the sandbox path of name in dir.
+func join(dir, name string) string {
+	if dir == "." {
+		return name
+	}
+	return dir + "/" + name
+}
+
+var (
+	errIsDir  = errors.New("is a directory")
+	errNotDir = errors.New("not a directory")
+)
\ No newline at end of file
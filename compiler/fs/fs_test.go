@@ -0,0 +1,257 @@
+package fs
+
+import (
+	"errors"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sandboxes returns a fresh sandbox of each backend holding files.
+func sandboxes(t *testing.T, files map[string]string) map[string]*Sandbox {
+	root := t.TempDir()
+	for name, data := range files {
+		host := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(host), 0755)
+		if err := os.WriteFile(host, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir, err := Dir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory, err := Memory(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]*Sandbox{"dir": dir, "memory": memory}
+}
+
+func TestReadWriteListStat(t *testing.T) {
+	for backend, s := range sandboxes(t, map[string]string{"poem.txt": "dance", "verses/one.txt": "step"}) {
+		if data, err := s.Read("poem.txt"); err != nil || string(data) != "dance" {
+			t.Errorf("%s: read = %q, %v", backend, data, err)
+		}
+		// A leading slash is the root, and .. may move within it
+		if data, err := s.Read("/verses/../verses/one.txt"); err != nil || string(data) != "step" {
+			t.Errorf("%s: read from the root = %q, %v", backend, data, err)
+		}
+		
+		if err := s.Write("drafts/new/two.txt", []byte("turn")); err != nil {
+			t.Fatalf("%s: write: %v", backend, err)
+		}
+		info, err := s.Stat("drafts/new/two.txt")
+		if err != nil || info.Name != "drafts/new/two.txt" || info.Size != 4 || info.Dir {
+			t.Errorf("%s: stat = %+v, %v", backend, info, err)
+		}
+		
+		infos, err := s.List(".")
+		if err != nil {
+			t.Fatalf("%s: list: %v", backend, err)
+		}
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name)
+		}
+		if strings.Join(names, " ") != "drafts poem.txt verses" || !infos[0].Dir {
+			t.Errorf("%s: list = %+v", backend, infos)
+		}
+		
+		if err := s.Remove("drafts"); err != nil {
+			t.Errorf("%s: remove: %v", backend, err)
+		}
+		_, err = s.Read("drafts/new/two.txt")
+		if !errors.Is(err, iofs.ErrNotExist) || err.Error() != `read "drafts/new/two.txt": file does not exist` &&
+			!strings.HasPrefix(err.Error(), `read "drafts/new/two.txt": no such file`) {
+			t.Errorf("%s: read after remove: %v", backend, err)
+		}
+	}
+}
+
+func TestJail(t *testing.T) {
+	for backend, s := range sandboxes(t, map[string]string{"poem.txt": "dance"}) {
+		for _, name := range []string{"..", "../secret", "verses/../../secret", "/../secret"} {
+			_, err := s.Read(name)
+			var denied *Error
+			if !errors.As(err, &denied) || denied.Rule != Jail || denied.Path != name {
+				t.Errorf("%s: read %q: expected the jail rule, got %v", backend, name, err)
+			}
+		}
+		err := s.Write("../escape.txt", nil)
+		if err == nil || err.Error() != `write "../escape.txt": denied by the jail rule: the path leaves the sandbox root` {
+			t.Errorf("%s: write outside: %v", backend, err)
+		}
+		if err := s.Remove("/"); err == nil || err.(*Error).Rule != Root {
+			t.Errorf("%s: remove the root: %v", backend, err)
+		}
+	}
+}
+
+func TestSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links need privileges on Windows")
+	}
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret"), []byte("key"), 0644)
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "poem.txt"), []byte("dance"), 0644)
+	os.Mkdir(filepath.Join(root, "verses"), 0755)
+	os.Symlink(outside, filepath.Join(root, "out"))
+	os.Symlink("verses", filepath.Join(root, "in"))
+	os.Symlink(filepath.Join(outside, "missing"), filepath.Join(root, "dangling"))
+	
+	s, err := Dir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"out/secret", "out", "dangling", "out/new/file"} {
+		_, err := s.Read(name)
+		var denied *Error
+		if !errors.As(err, &denied) || denied.Rule != Symlink {
+			t.Errorf("read %q: expected the symlink rule, got %v", name, err)
+		}
+	}
+	if err := s.Write("dangling", []byte("x")); err == nil || err.(*Error).Rule != Symlink {
+		t.Errorf("write through a dangling link: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "missing")); err == nil {
+		t.Error("a write through a link escaped the sandbox")
+	}
+	
+	// A link that stays inside is followed
+	if err := s.Write("in/one.txt", []byte("step")); err != nil {
+		t.Errorf("write through a link inside: %v", err)
+	}
+	if data, err := s.Read("verses/one.txt"); err != nil || string(data) != "step" {
+		t.Errorf("read = %q, %v", data, err)
+	}
+	matches, err := s.Glob("**/*")
+	if err != nil || strings.Join(matches, " ") != "in in/one.txt poem.txt verses verses/one.txt" {
+		t.Errorf("glob skipping links out = %v, %v", matches, err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	for backend, s := range sandboxes(t, map[string]string{"poem.txt": "dance"}) {
+		view := s.ReadOnly()
+		if data, err := view.Read("poem.txt"); err != nil || string(data) != "dance" {
+			t.Errorf("%s: read = %q, %v", backend, data, err)
+		}
+		checks := map[string]error{
+			"write":   view.Write("poem.txt", []byte("x")),
+			"remove":  view.Remove("poem.txt"),
+			"tempdir": func() error { _, err := view.TempDir("x"); return err }(),
+		}
+		for op, err := range checks {
+			var denied *Error
+			if !errors.As(err, &denied) || denied.Rule != ReadOnly || denied.Op != op {
+				t.Errorf("%s: %s: expected the read-only rule, got %v", backend, op, err)
+			}
+		}
+		if data, _ := s.Read("poem.txt"); string(data) != "dance" {
+			t.Errorf("%s: read-only view changed the file: %q", backend, data)
+		}
+	}
+}
+
+func TestGlob(t *testing.T) {
+	files := map[string]string{"a.txt": "", "b.md": "", "verses/c.txt": "", "verses/deep/d.txt": ""}
+	tests := map[string]string{
+		"*.txt":        "a.txt",
+		"verses/*.txt": "verses/c.txt",
+		"**/*.txt":     "a.txt verses/c.txt verses/deep/d.txt",
+		"**/**/d.txt":  "verses/deep/d.txt",
+		"missing/*":    "",
+	}
+	for backend, s := range sandboxes(t, files) {
+		for pattern, expected := range tests {
+			matches, err := s.Glob(pattern)
+			if err != nil || strings.Join(matches, " ") != expected {
+				t.Errorf("%s: glob %q = %v, %v; want %q", backend, pattern, matches, err, expected)
+			}
+		}
+		if _, err := s.Glob("[x"); err == nil || !strings.HasPrefix(err.Error(), `glob "[x": `) {
+			t.Errorf("%s: bad pattern: %v", backend, err)
+		}
+		if _, err := s.Glob("../*"); err == nil || err.(*Error).Rule != Jail {
+			t.Errorf("%s: glob outside: %v", backend, err)
+		}
+	}
+}
+
+func TestTempDir(t *testing.T) {
+	for backend, s := range sandboxes(t, nil) {
+		first, err := s.TempDir("build-*.d")
+		if err != nil || !strings.HasPrefix(first, "tmp/build-") || !strings.HasSuffix(first, ".d") {
+			t.Fatalf("%s: tempdir = %q, %v", backend, first, err)
+		}
+		second, err := s.TempDir("build-*.d")
+		if err != nil || second == first {
+			t.Errorf("%s: second tempdir = %q, %v", backend, second, err)
+		}
+		if err := s.Write(first+"/out.txt", []byte("x")); err != nil {
+			t.Errorf("%s: write in tempdir: %v", backend, err)
+		}
+		if info, err := s.Stat(second); err != nil || !info.Dir {
+			t.Errorf("%s: stat tempdir = %+v, %v", backend, info, err)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	for backend, s := range sandboxes(t, map[string]string{"a.txt": "one", "b.txt": "two"}) {
+		w, err := s.Watch("*.txt", time.Millisecond)
+		if err != nil {
+			t.Fatalf("%s: watch: %v", backend, err)
+		}
+		s.Write("a.txt", []byte("changed"))
+		s.Remove("b.txt")
+		s.Write("c.txt", []byte("new"))
+		s.Write("c.md", []byte("unwatched"))
+		
+		want := map[Event]bool{{"a.txt", Modified}: true, {"b.txt", Removed}: true, {"c.txt", Created}: true}
+		timeout := time.After(5 * time.Second)
+		for len(want) > 0 {
+			select {
+			case e := <-w.Events:
+				// A poll between a write's truncate and its data sees an
+				// extra modification
+				if _, expected := want[e]; !expected && (e.Change != Modified || e.Path == "c.md") {
+					t.Errorf("%s: unexpected event %+v", backend, e)
+				}
+				delete(want, e)
+			case <-timeout:
+				t.Fatalf("%s: events missing: %v", backend, want)
+			}
+		}
+		w.Close()
+		if _, ok := <-w.Events; ok || w.Err != nil {
+			t.Errorf("%s: watcher still open or failed: %v", backend, w.Err)
+		}
+	}
+}
+
+func TestMemoryRejectsEscapes(t *testing.T) {
+	s, err := Memory(map[string]string{"poem.txt": "dance", "../secret": "key"})
+	var fsErr *Error
+	if s != nil || !errors.As(err, &fsErr) || fsErr.Rule != Jail || fsErr.Path != "../secret" {
+		t.Errorf("expected a jail error for ../secret, got %v, %v", s, err)
+	}
+}
+
+func TestWatchRejectsInterval(t *testing.T) {
+	for backend, s := range sandboxes(t, nil) {
+		for _, interval := range []time.Duration{0, -time.Second} {
+			w, err := s.Watch("*.txt", interval)
+			var fsErr *Error
+			if w != nil || !errors.As(err, &fsErr) || fsErr.Op != "watch" || !strings.Contains(err.Error(), "not positive") {
+				t.Errorf("%s: watch every %v = %v, %v; want an error", backend, interval, w, err)
+			}
+		}
+	}
+}
\ No newline at end of file
@@ -0,0 +1,99 @@
+package fs
+
+import "fmt"
+
+// A program opens its sandbox with chore.fs(), whose value is the file
+// system module, and calls the module's members to reach the files:
+//
+//	flow files = chore.fs()
+//	dance poem = files.read("poem.txt")
+//
+// Members describes each member as every backend offers it. Paths are
+// slash-separated and relative to the root, as for a Sandbox.
+
+// Member is a member of the file system module. Params are its arguments,
+// and Result the type of its value, or "nothing" for a member without one.
+type Member struct {
+	Name   string
+	Params []Param
+	Result string
+	Doc    string
+}
+
+// Param is an argument of a member: its name and the type it must have.
+type Param struct {
+	Name string
+	Type string
+}
+
+// Members are the members of the file system module, by name.
+var Members = map[string]*Member{
+	"read": {"read", []Param{{"path", "string"}}, "string",
+		"The contents of a file."},
+	"write": {"write", []Param{{"path", "string"}, {"text", "string"}}, "nothing",
+		"Replaces a file, making the directories above it."},
+	"remove": {"remove", []Param{{"path", "string"}}, "nothing",
+		"Removes a file, or a directory and all it holds."},
+	"exists": {"exists", []Param{{"path", "string"}}, "bool",
+		"Whether a file or directory is there."},
+	"list": {"list", []Param{{"dir", "string"}}, "string",
+		"The paths of what a directory holds, sorted, one per line; a directory's path ends in /."},
+	"stat": {"stat", []Param{{"path", "string"}}, "string",
+		"\"dir\" for a directory, or \"file\" and its size in bytes, as in \"file 12\"."},
+	"glob": {"glob", []Param{{"pattern", "string"}}, "string",
+		"The paths matching pattern, sorted, one per line; ** matches any directories."},
+	"tempdir": {"tempdir", nil, "string",
+		"Makes a new directory under tmp, and returns its path."},
+	"watch": {"watch", []Param{{"pattern", "string"}, {"ms", "int"}}, "string",
+		"Waits for the next change to the paths matching pattern, checking every ms milliseconds, " +
+			"and returns it as \"created\", \"modified\" or \"removed\" and the path. " +
+			"Changes made between watches of a pattern are kept for the next."},
+}
+
+// Signature shows how the member is called, and the type of its value.
+func (m *Member) Signature() string {
+	sig := "fs." + m.Name + "("
+	for i, p := range m.Params {
+		if i > 0 {
+			sig += ", "
+		}
+		sig += p.Name
+	}
+	sig += ")"
+	if m.Result != "nothing" {
+		sig += " " + m.Result
+	}
+	return sig
+}
+
+// CheckArity reports a call of the member with count arguments that it
+// does not take.
+func (m *Member) CheckArity(count int) error {
+	if count != len(m.Params) {
+		return fmt.Errorf("fs.%s takes %s, got %d", m.Name, arguments(len(m.Params)), count)
+	}
+	return nil
+}
+
+// CheckOpen reports a call of chore.member with count arguments that is
+// not chore.fs(), the only member of chore.
+func CheckOpen(member string, count int) error {
+	if member != "fs" {
+		return fmt.Errorf("chore has no member %s", member)
+	}
+	if count != 0 {
+		return fmt.Errorf("chore.fs takes no arguments, got %d", count)
+	}
+	return nil
+}
+
+// arguments counts arguments as the errors of the builtins count them.
+func arguments(n int) string {
+	switch n {
+	case 0:
+		return "no arguments"
+	case 1:
+		return "1 argument"
+	}
+	return fmt.Sprintf("%d arguments", n)
+}
\ No newline at end of file
@@ -0,0 +1,158 @@
+package fs
+
+import (
+	iofs "io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory returns a sandbox that keeps its files in memory, starting with
+// files, which maps paths to contents. It fails with the *Error of the
+// first path, in sorted order, that cannot be written. It has no symbolic
+// links, and nothing it holds outlives it.
+func Memory(files map[string]string) (*Sandbox, error) {
+	s := &Sandbox{b: &memory{files: map[string]*memFile{".": {dir: true, mod: time.Now()}}}}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := s.Write(name, []byte(files[name])); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// memory is the backend of a sandbox in memory. Directories are entries of
+// their own, so an empty one can be listed.
+type memory struct {
+	mu    sync.Mutex
+	files map[string]*memFile
+	last  time.Time // the last ModTime given, so each is later
+}
+
+type memFile struct {
+	data []byte
+	dir  bool
+	mod  time.Time
+}
+
+// now returns a ModTime later than any given before, so a watch sees
+// every change even on a coarse clock. The caller holds mu.
+func (m *memory) now() time.Time {
+	t := time.Now()
+	if !t.After(m.last) {
+		t = m.last.Add(time.Nanosecond)
+	}
+	m.last = t
+	return t
+}
+
+func (m *memory) readFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[name]
+	switch {
+	case !ok:
+		return nil, iofs.ErrNotExist
+	case f.dir:
+		return nil, errIsDir
+	}
+	return append([]byte(nil), f.data...), nil
+}
+
+func (m *memory) writeFile(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.mkdirAll(path.Dir(name)); err != nil {
+		return err
+	}
+	if f, ok := m.files[name]; ok && f.dir {
+		return errIsDir
+	}
+	m.files[name] = &memFile{data: append([]byte(nil), data...), mod: m.now()}
+	return nil
+}
+
+// mkdirAll makes name and the directories above it. The caller holds mu.
+func (m *memory) mkdirAll(name string) error {
+	if f, ok := m.files[name]; ok {
+		if !f.dir {
+			return errNotDir
+		}
+		return nil
+	}
+	if err := m.mkdirAll(path.Dir(name)); err != nil {
+		return err
+	}
+	m.files[name] = &memFile{dir: true, mod: m.now()}
+	return nil
+}
+
+func (m *memory) readDir(name string) ([]Info, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[name]
+	switch {
+	case !ok:
+		return nil, iofs.ErrNotExist
+	case !f.dir:
+		return nil, errNotDir
+	}
+	var infos []Info
+	for other, f := range m.files {
+		if other != "." && other != name && path.Dir(other) == name {
+			infos = append(infos, f.info(other))
+		}
+	}
+	return infos, nil
+}
+
+func (m *memory) stat(name string) (Info, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[name]
+	if !ok {
+		return Info{}, iofs.ErrNotExist
+	}
+	return f.info(name), nil
+}
+
+func (f *memFile) info(name string) Info {
+	return Info{Name: name, Size: int64(len(f.data)), Dir: f.dir, ModTime: f.mod}
+}
+
+func (m *memory) mkdir(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; ok {
+		return iofs.ErrExist
+	}
+	if parent, ok := m.files[path.Dir(name)]; !ok {
+		return iofs.ErrNotExist
+	} else if !parent.dir {
+		return errNotDir
+	}
+	m.files[name] = &memFile{dir: true, mod: m.now()}
+	return nil
+}
+
+func (m *memory) removeAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for other := range m.files {
+		if other == name || strings.HasPrefix(other, name+"/") {
+			delete(m.files, other)
+		}
+	}
+	return nil
+}
+
+func (m *memory) escapes(name string) bool {
+	return false
+}
\ No newline at end of file
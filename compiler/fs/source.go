@@ -0,0 +1,11 @@
+package fs
+
+import "embed"
+
+// Source holds the Go of the sandbox, its host backend and its watcher,
+// fs.go, dir.go and watch.go. Programs compiled to Go are built on their own, outside this
+// module, so they cannot import the package; the code generator adds these
+// declarations to them instead, and they keep the same rules.
+//
+//go:embed fs.go dir.go watch.go
+var Source embed.FS
\ No newline at end of file
@@ -0,0 +1,128 @@
+package fs
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Change is what happened to a watched file.
+type Change string
+
+const (
+	Created  Change = "created"
+	Modified Change = "modified"
+	Removed  Change = "removed"
+)
+
+// Event is a change to a file a Watcher watches.
+type Event struct {
+	Path   string
+	Change Change
+}
+
+// Watcher reports changes to the files matching a pattern. It polls, so it
+// works alike on every platform and backend, and sees a change within an
+// interval of it.
+type Watcher struct {
+	// Events delivers the changes in path order for each poll. It is
+	// closed once the Watcher is.
+	Events <-chan Event
+	
+	// Err holds the error that stopped the Watcher, if any, once Events
+	// is closed.
+	Err error
+	
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Watch reports the files matching pattern, as Glob matches them, that are
+// created, modified or removed, checking every interval, which must be
+// positive.
+func (s *Sandbox) Watch(pattern string, interval time.Duration) (*Watcher, error) {
+	if interval <= 0 {
+		return nil, failed("watch", pattern, fmt.Errorf("interval %v is not positive", interval))
+	}
+	seen, err := s.snapshot(pattern)
+	if err != nil {
+		return nil, err
+	}
+	events := make(chan Event)
+	w := &Watcher{Events: events, stop: make(chan struct{}), done: make(chan struct{})}
+	
+	go func() {
+		defer close(w.done)
+		defer close(events)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+			}
+			now, err := s.snapshot(pattern)
+			if err != nil {
+				w.Err = err
+				return
+			}
+			for _, e := range changes(seen, now) {
+				select {
+				case events <- e:
+				case <-w.stop:
+					return
+				}
+			}
+			seen = now
+		}
+	}()
+	return w, nil
+}
+
+// Close stops the Watcher and waits for Events to close.
+func (w *Watcher) Close() {
+	select {
+	case <-w.stop:
+	default:
+		close(w.stop)
+	}
+	<-w.done
+}
+
+// snapshot describes the files matching pattern, by path.
+func (s *Sandbox) snapshot(pattern string) (map[string]Info, error) {
+	names, err := s.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	infos := make(map[string]Info, len(names))
+	for _, name := range names {
+		// A file removed since the glob is simply missing
+		if info, err := s.b.stat(name); err == nil {
+			infos[name] = info
+		}
+	}
+	return infos, nil
+}
+
+// changes lists what differs between two snapshots, in path order.
+func changes(before, after map[string]Info) []Event {
+	var events []Event
+	for name, info := range after {
+		old, ok := before[name]
+		switch {
+		case !ok:
+			events = append(events, Event{name, Created})
+		case !old.ModTime.Equal(info.ModTime) || old.Size != info.Size:
+			events = append(events, Event{name, Modified})
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			events = append(events, Event{name, Removed})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+	return events
+}
\ No newline at end of file
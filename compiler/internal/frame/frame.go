@@ -0,0 +1,72 @@
+// Package frame reads and writes the messages of the language server and
+// debug adapter protocols. Both frame each message the same way: a
+// Content-Length header, any others, a blank line, then a JSON body.
+package frame
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MaxLength is the largest body Read accepts. Editors send source files
+// and small requests, so a longer Content-Length is a broken or hostile
+// client, and reading it would only allocate the memory it asks for.
+const MaxLength = 64 << 20
+
+// Read reads the body of one message. It returns io.EOF only when the
+// input ends cleanly between messages.
+func Read(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && length < 0 && line == "" {
+				return nil, io.EOF
+			}
+			return nil, io.ErrUnexpectedEOF
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("bad header %q", line)
+		}
+		if strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || length < 0 {
+				return nil, fmt.Errorf("bad Content-Length %q", value)
+			}
+			if length > MaxLength {
+				return nil, fmt.Errorf("Content-Length %d exceeds the limit of %d bytes", length, MaxLength)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("message without a Content-Length header")
+	}
+	
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return body, nil
+}
+
+// Write frames v as JSON for the other side.
+func Write(w io.Writer, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
\ No newline at end of file
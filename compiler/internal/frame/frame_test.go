@@ -0,0 +1,53 @@
+package frame
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	for _, v := range []interface{}{map[string]int{"seq": 1}, "two"} {
+		if err := Write(&buf, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !strings.HasPrefix(buf.String(), "Content-Length: 9\r\n\r\n{\"seq\":1}") {
+		t.Errorf("framed as %q", buf.String())
+	}
+	
+	r := bufio.NewReader(&buf)
+	for _, want := range []string{`{"seq":1}`, `"two"`} {
+		body, err := Read(r)
+		if err != nil || string(body) != want {
+			t.Errorf("Read = %q, %v; want %q", body, err, want)
+		}
+	}
+	if _, err := Read(r); err != io.EOF {
+		t.Errorf("Read at the end = %v, want io.EOF", err)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Content-Length: 10\r\n\r\n{}", "unexpected EOF"},
+		{"Content-Length: 2\r\n", "unexpected EOF"},
+		{"Content-Length\r\n\r\n", `bad header "Content-Length"`},
+		{"Content-Length: -1\r\n\r\n", `bad Content-Length " -1"`},
+		{"Content-Type: json\r\n\r\n{}", "message without a Content-Length header"},
+		{"Content-Length: 99999999999\r\n\r\n", "Content-Length 99999999999 exceeds the limit of 67108864 bytes"},
+	}
+	
+	for _, tt := range tests {
+		_, err := Read(bufio.NewReader(strings.NewReader(tt.input)))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("Read(%q) = %v, want %q", tt.input, err, tt.expected)
+		}
+	}
+}
\ No newline at end of file
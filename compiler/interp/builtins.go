@@ -0,0 +1,121 @@
+package interp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	
+	"github.com/chorlang/chorlang/compiler/diff"
+	"github.com/chorlang/chorlang/compiler/ops"
+)
+
+// The builtins shared by every backend:
+//
+//	print(values...), println(values...)  print the values and a newline
+//	args()                                 the number of program arguments
+//	args(i)                                argument i; args(0) is the program
+//	exit(code)                             end the program with an exit status
+//
+// and the one only rehearsals may call, which chorelang test runs on the
+// interpreter:
+//
+//	expect(got, want), expect(condition)   fail the rehearsal unless they hold
+//
+// The helpers below check the arguments once, so the interpreter and the
+// VM report the same errors.
+
+// ExitError is returned when the program calls exit. Code is the status the
+// program asked for.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// BuiltinType is the type of the value of a call to the builtin name with
+// count arguments, or "nothing" for a builtin without one.
+func BuiltinType(name string, count int) string {
+	switch {
+	case name != "args":
+		return "nothing"
+	case count == 0:
+		return "int"
+	}
+	return "string"
+}
+
+// ArgCount is the value of args(): the number of arguments after the
+// program name.
+func ArgCount(args []string) int64 {
+	if len(args) == 0 {
+		return 0
+	}
+	return int64(len(args) - 1)
+}
+
+// Arg is the value of args(i).
+func Arg(args []string, i interface{}) (string, error) {
+	n, ok := i.(int64)
+	if !ok {
+		return "", fmt.Errorf("args index must be int, got %s", ops.TypeName(i))
+	}
+	if n < 0 || n >= int64(len(args)) {
+		return "", fmt.Errorf("args index %d out of range [0:%d]", n, len(args))
+	}
+	return args[n], nil
+}
+
+// ExitCode checks the argument of exit(code).
+func ExitCode(v interface{}) (int, error) {
+	n, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("exit code must be int, got %s", ops.TypeName(v))
+	}
+	return int(n), nil
+}
+
+// Expect checks the arguments of expect. It returns "" if the expectation
+// holds, and otherwise what went wrong: got and want side by side, or a
+// diff when they are strings of several lines.
+func Expect(args []interface{}) (string, error) {
+	if len(args) == 1 {
+		ok, isBool := args[0].(bool)
+		if !isBool {
+			return "", fmt.Errorf("expect condition must be bool, got %s", ops.TypeName(args[0]))
+		}
+		if !ok {
+			return "condition is false", nil
+		}
+		return "", nil
+	}
+	if len(args) != 2 {
+		return "", fmt.Errorf("expect takes 1 or 2 arguments, got %d", len(args))
+	}
+	
+	got, want := args[0], args[1]
+	if equal, err := ops.Binary("==", got, want); err == nil && equal == true {
+		return "", nil
+	}
+	
+	if ops.TypeName(got) != ops.TypeName(want) {
+		return fmt.Sprintf("got %s %s, want %s %s", ops.TypeName(got), show(got), ops.TypeName(want), show(want)), nil
+	}
+	g, w := fmt.Sprint(got), fmt.Sprint(want)
+	if strings.Contains(g, "\n") || strings.Contains(w, "\n") {
+		return "strings differ (-want +got):\n" + diff.Unified("want", "got", []byte(w+"\n"), []byte(g+"\n")), nil
+	}
+	return fmt.Sprintf("got %s, want %s", show(got), show(want)), nil
+}
+
+// show writes a value as ChoreLang source would.
+func show(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case nil:
+		return "nothing"
+	}
+	return fmt.Sprint(v)
+}
\ No newline at end of file
@@ -0,0 +1,179 @@
+package interp
+
+import (
+	"fmt"
+	"sync/atomic"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/lexer"
+)
+
+// Dancer is one dancer of a running program. Main is dancer 0, and each
+// start numbers the dancer it launches from 1 up, in the order they start,
+// as traces do.
+type Dancer struct {
+	ID int
+	
+	// Parent is the dancer whose start launched this one, and Line and
+	// Column the position of that start. All three are zero for main.
+	Parent       int
+	Line, Column int
+	
+	// Under a schedule, wake passes the dancer its turn, waiter is the
+	// operation it is parked in and received the value a sender handed it
+	wake     chan struct{}
+	waiter   *Waiter
+	received interface{}
+}
+
+// Name is how messages refer to the dancer: "main" or "dancer 3".
+func (d *Dancer) Name() string {
+	if d.ID == 0 {
+		return "main"
+	}
+	return fmt.Sprintf("dancer %d", d.ID)
+}
+
+// Waiter is a dancer in a channel operation: a send of Value, or a
+// receive. Line and Column are the position of the operation.
+type Waiter struct {
+	Dancer       *Dancer
+	Send         bool
+	Value        interface{}
+	Line, Column int
+	
+	held int64 // the bytes of Value counted against Limits.Memory
+}
+
+// Waiting returns the dancers in an operation on the channel, in the order
+// they arrived. Channels are unbuffered, so the values of the waiting
+// senders are everything the channel holds.
+func (c *Channel) Waiting() []Waiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	waiting := make([]Waiter, len(c.waiting))
+	for i, w := range c.waiting {
+		waiting[i] = *w
+	}
+	return waiting
+}
+
+func (c *Channel) add(w *Waiter) {
+	c.mu.Lock()
+	c.waiting = append(c.waiting, w)
+	c.mu.Unlock()
+}
+
+func (c *Channel) remove(w *Waiter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, other := range c.waiting {
+		if other == w {
+			c.waiting = append(c.waiting[:i], c.waiting[i+1:]...)
+			return
+		}
+	}
+}
+
+// Debugger watches the dancers of a running program and may pause them.
+// Each method is called from the dancer it concerns, which waits until the
+// method returns.
+//
+// A dancer changes no bindings while it is inside Statement or Unblocked,
+// or between Blocking and Unblocked, so a debugger that holds every dancer
+// in one of those places may read their Environments.
+type Debugger interface {
+	// Started is called for main as the program begins, and for every
+	// other dancer by its parent, before it runs. Finished is called as a
+	// dancer ends, whether it completed, failed or was halted.
+	Started(d *Dancer)
+	Finished(d *Dancer)
+	
+	// Statement is called before d runs stmt in env.
+	Statement(d *Dancer, stmt ast.Statement, env *Environment)
+	
+	// Blocking is called as d starts an operation on ch, which waits until
+	// a partner arrives, and Unblocked as the operation completes. If the
+	// program halts first, Unblocked is not called.
+	Blocking(d *Dancer, ch *Channel)
+	Unblocked(d *Dancer)
+}
+
+// newDancer numbers a dancer launched by the start at tok, or main when
+// parent is nil.
+func (in *Interpreter) newDancer(parent *Dancer, tok lexer.Token) *Dancer {
+	d := &Dancer{ID: int(atomic.AddInt64(&in.dancers, 1) - 1)}
+	if parent != nil {
+		d.Parent = parent.ID
+		d.Line, d.Column = tok.Line, tok.Column
+	}
+	if in.sched != nil {
+		d.wake = make(chan struct{}, 1)
+	}
+	in.waitMu.Lock()
+	if max := in.Limits.Dancers; parent != nil && max > 0 && in.live >= max {
+		in.waitMu.Unlock()
+		exceeded(tok, "dancers", int64(max))
+	}
+	in.live++
+	in.waitMu.Unlock()
+	if in.Debugger != nil {
+		in.Debugger.Started(d)
+	}
+	return d
+}
+
+// send offers value on ch until a receiver takes it.
+func (in *Interpreter) send(d *Dancer, tok lexer.Token, ch *Channel, value interface{}) {
+	in.checkTime(tok)
+	w := &Waiter{Dancer: d, Send: true, Value: value, Line: tok.Line, Column: tok.Column}
+	if in.sched != nil {
+		in.scheduledSend(w, ch)
+		return
+	}
+	in.block(ch, w)
+	select {
+	case ch.ch <- w:
+		// The receiver settles w as it takes the value
+		in.unblock(d, ch)
+	case <-in.done:
+		in.settle(ch, w)
+		panic(errHalted)
+	}
+}
+
+// receive waits for a sender on ch and returns its value.
+func (in *Interpreter) receive(d *Dancer, tok lexer.Token, ch *Channel) interface{} {
+	in.checkTime(tok)
+	w := &Waiter{Dancer: d, Line: tok.Line, Column: tok.Column}
+	if in.sched != nil {
+		return in.scheduledReceive(w, ch)
+	}
+	in.block(ch, w)
+	select {
+	case v := <-ch.ch:
+		// Settling both at once, the sender is never seen waiting alone once
+		// the value has gone
+		s := v.(*Waiter)
+		in.unblock(d, ch, w, s)
+		return s.Value
+	case <-in.done:
+		in.settle(ch, w)
+		panic(errHalted)
+	}
+}
+
+func (in *Interpreter) block(ch *Channel, w *Waiter) {
+	in.wait(ch, w)
+	if in.Debugger != nil {
+		in.Debugger.Blocking(w.Dancer, ch)
+	}
+}
+
+// unblock completes d's operation on ch, settling the waiters given.
+func (in *Interpreter) unblock(d *Dancer, ch *Channel, settled ...*Waiter) {
+	in.settle(ch, settled...)
+	if in.Debugger != nil {
+		in.Debugger.Unblocked(d)
+	}
+}
\ No newline at end of file
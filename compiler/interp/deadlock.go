@@ -0,0 +1,183 @@
+package interp
+
+import (
+	"fmt"
+	"sort"
+	
+	"github.com/chorlang/chorlang/compiler/lexer"
+)
+
+// DeadlockError is returned when every dancer waits in a channel operation
+// that no other dancer can complete. Line and Column are where main waits,
+// and Blocked lists every waiting dancer, main first. The VM reports
+// deadlocks the same way.
+type DeadlockError struct {
+	Line, Column int
+	Blocked      []Blocked
+}
+
+func (e *DeadlockError) Error() string {
+	return fmt.Sprintf("%d:%d: all dancers are asleep - deadlock!", e.Line, e.Column)
+}
+
+// Blocked is a dancer waiting in a send or receive at Line and Column.
+// Dancer is its number, as Dancer.ID gives it, and StartLine and
+// StartColumn the position of the start that launched it, zero for main.
+type Blocked struct {
+	Dancer                 int
+	StartLine, StartColumn int
+	Send                   bool
+	Line, Column           int
+}
+
+// Name is how messages refer to the dancer: "main" or "dancer 3".
+func (b Blocked) Name() string {
+	return (&Dancer{ID: b.Dancer}).Name()
+}
+
+// SortBlocked orders blocked dancers by number, so main comes first.
+func SortBlocked(blocked []Blocked) {
+	sort.Slice(blocked, func(i, j int) bool { return blocked[i].Dancer < blocked[j].Dancer })
+}
+
+// Leaked returns the dancers that were still waiting in a channel
+// operation when main finished the last Run, in the order they started.
+// Ending the program stopped them; in Go they would have been leaked.
+func (in *Interpreter) Leaked() []Blocked {
+	in.waitMu.Lock()
+	defer in.waitMu.Unlock()
+	return in.leaked
+}
+
+// wait records that w's dancer waits in ch, counting a sender's value
+// against Limits.Memory unless a receiver is already there. Without a schedule, a wait
+// that leaves every dancer stuck stops the program with a *DeadlockError.
+func (in *Interpreter) wait(ch *Channel, w *Waiter) {
+	in.waitMu.Lock()
+	if w.Send && ch.partner(true) == nil {
+		// The value waits in the channel until a receiver comes
+		size := Size(w.Value)
+		if max := in.Limits.Memory; max > 0 && in.held+size > max {
+			in.waitMu.Unlock()
+			exceeded(lexer.Token{Line: w.Line, Column: w.Column}, "memory", max)
+		}
+		in.held += size
+		w.held = size
+	}
+	if in.waits == nil {
+		in.waits = make(map[*Waiter]*Channel)
+	}
+	in.waits[w] = ch
+	ch.add(w)
+	stuck := in.sched == nil && in.stuck()
+	in.waitMu.Unlock()
+	
+	if stuck {
+		in.stop(in.deadlockError())
+	}
+}
+
+// settle takes the waiters of a completed operation off their channel. A
+// receiver settles itself and its sender at once as it takes the value, so
+// neither is ever seen waiting alone after they have met.
+func (in *Interpreter) settle(ch *Channel, ws ...*Waiter) {
+	in.waitMu.Lock()
+	defer in.waitMu.Unlock()
+	for _, w := range ws {
+		delete(in.waits, w)
+		ch.remove(w)
+		in.held -= w.held
+		w.held = 0
+	}
+}
+
+// ended counts a dancer out. Without a schedule, the others may now all be
+// stuck.
+func (in *Interpreter) ended(d *Dancer) {
+	in.waitMu.Lock()
+	in.live--
+	stuck := d.ID != 0 && in.sched == nil && in.stuck()
+	in.waitMu.Unlock()
+	
+	if stuck {
+		in.stop(in.deadlockError())
+	}
+}
+
+// stuck reports whether every dancer waits and no two can meet. A
+// session's dancers wait for more input, and a debugged program is left
+// where it waits to be inspected, so neither is ever stuck. The caller
+// holds waitMu.
+func (in *Interpreter) stuck() bool {
+	if in.session || in.Debugger != nil || in.live == 0 {
+		return false
+	}
+	sides := in.sides()
+	waiting := make(map[*Dancer]bool)
+	for w, ch := range in.waits {
+		if meeting(sides[ch]) {
+			return false
+		}
+		waiting[w.Dancer] = true
+	}
+	return len(waiting) == in.live
+}
+
+// sides records, for each channel dancers wait in, whether a sender and
+// whether a receiver waits there. The caller holds waitMu.
+func (in *Interpreter) sides() map[*Channel][2]bool {
+	sides := make(map[*Channel][2]bool)
+	for w, ch := range in.waits {
+		s := sides[ch]
+		if w.Send {
+			s[0] = true
+		} else {
+			s[1] = true
+		}
+		sides[ch] = s
+	}
+	return sides
+}
+
+// meeting reports whether a channel's waiting sides will meet.
+func meeting(s [2]bool) bool {
+	return s[0] && s[1]
+}
+
+// blocked lists the waiting dancers by number, leaving out those meeting
+// a partner. The caller holds waitMu.
+func (in *Interpreter) blocked() []Blocked {
+	sides := in.sides()
+	var blocked []Blocked
+	for w, ch := range in.waits {
+		if meeting(sides[ch]) {
+			continue
+		}
+		d := w.Dancer
+		blocked = append(blocked, Blocked{
+			Dancer: d.ID, StartLine: d.Line, StartColumn: d.Column,
+			Send: w.Send, Line: w.Line, Column: w.Column,
+		})
+	}
+	SortBlocked(blocked)
+	return blocked
+}
+
+// deadlockError describes the waiting dancers, positioned where main
+// waits.
+func (in *Interpreter) deadlockError() *DeadlockError {
+	in.waitMu.Lock()
+	err := &DeadlockError{Blocked: in.blocked()}
+	in.waitMu.Unlock()
+	if len(err.Blocked) > 0 && err.Blocked[0].Dancer == 0 {
+		err.Line, err.Column = err.Blocked[0].Line, err.Blocked[0].Column
+	}
+	return err
+}
+
+// leaks records the dancers left waiting as main finishes.
+func (in *Interpreter) leaks() {
+	in.waitMu.Lock()
+	defer in.waitMu.Unlock()
+	in.leaked = in.blocked()
+}
\ No newline at end of file
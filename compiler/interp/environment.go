@@ -0,0 +1,80 @@
+package interp
+
+import "sort"
+
+// Environment holds the bindings of one block. Lookups walk outwards through
+// the enclosing blocks, mirroring the resolver's scopes.
+type Environment struct {
+	store map[string]interface{}
+	outer *Environment
+}
+
+func NewEnvironment() *Environment {
+	return &Environment{store: make(map[string]interface{})}
+}
+
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+func (e *Environment) Get(name string) (interface{}, bool) {
+	for cur := e; cur != nil; cur = cur.outer {
+		if v, ok := cur.store[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// Declare creates a binding in this block.
+func (e *Environment) Declare(name string, v interface{}) {
+	e.store[name] = v
+}
+
+// Assign updates the nearest existing binding and reports whether one was
+// found.
+func (e *Environment) Assign(name string, v interface{}) bool {
+	for cur := e; cur != nil; cur = cur.outer {
+		if _, ok := cur.store[name]; ok {
+			cur.store[name] = v
+			return true
+		}
+	}
+	return false
+}
+
+// Snapshot copies every visible binding into a fresh environment. A dancer
+// runs in a snapshot taken when it starts, so it sees the values of that
+// moment and never shares a map with the dancer that launched it.
+func (e *Environment) Snapshot() *Environment {
+	snap := NewEnvironment()
+	var chain []*Environment
+	for cur := e; cur != nil; cur = cur.outer {
+		chain = append(chain, cur)
+	}
+	// Copy outermost first so inner bindings win
+	for i := len(chain) - 1; i >= 0; i-- {
+		for name, v := range chain[i].store {
+			snap.store[name] = v
+		}
+	}
+	return snap
+}
+
+// Outer returns the environment of the enclosing block, or nil for the
+// outermost one.
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// Names returns the names bound in this block itself, sorted.
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
\ No newline at end of file
@@ -0,0 +1,259 @@
+package interp
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"strings"
+	"sync"
+	"time"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/fs"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/ops"
+)
+
+// chore.fs() opens the program's sandbox as an *FSModule, whose members
+// reach the files under its root and nothing outside it; see package fs
+// for its rules and members. The interpreter and the VM call them alike
+// through OpenFS and Member.
+
+// FSModule is the value of chore.fs(): the program's sandbox, and the
+// watchers its watches keep running between calls.
+type FSModule struct {
+	sandbox  *fs.Sandbox
+	mu       sync.Mutex
+	watchers map[string]*fs.Watcher // by interval and pattern
+}
+
+// OpenFS is the value of chore.fs(). A program given no sandbox has no
+// files to reach.
+func OpenFS(sandbox *fs.Sandbox) (*FSModule, error) {
+	if sandbox == nil {
+		return nil, errors.New("chore.fs: no file system is open to this program")
+	}
+	return &FSModule{sandbox: sandbox, watchers: make(map[string]*fs.Watcher)}, nil
+}
+
+// TypeName names the module for error messages and ops.TypeName.
+func (m *FSModule) TypeName() string {
+	return "fs"
+}
+
+func (m *FSModule) String() string {
+	return m.TypeName()
+}
+
+// Close stops the module's watchers.
+func (m *FSModule) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, w := range m.watchers {
+		w.Close()
+		delete(m.watchers, key)
+	}
+}
+
+// Watch is a call of fs.watch waiting for the next change. The caller
+// waits on Events itself, so it can stop waiting when the program does,
+// and passes what it receives to Result.
+type Watch struct {
+	Events <-chan fs.Event
+	
+	watcher *fs.Watcher
+}
+
+// Result is the value of the watch, given the event and ok as the receive
+// from Events reported them. Events closes if the watcher fails.
+func (w *Watch) Result(e fs.Event, ok bool) (interface{}, error) {
+	if !ok {
+		if w.watcher.Err != nil {
+			return nil, w.watcher.Err
+		}
+		return nil, errors.New("fs.watch: the watcher has stopped")
+	}
+	return string(e.Change) + " " + e.Path, nil
+}
+
+// Member calls member of receiver with args, as receiver.member(args)
+// does. A watch returns a *Watch to wait on rather than its value.
+func Member(receiver interface{}, member string, args []interface{}) (interface{}, error) {
+	m, ok := receiver.(*FSModule)
+	if !ok {
+		return nil, fmt.Errorf("%s has no member %s", ops.TypeName(receiver), member)
+	}
+	fn, ok := fs.Members[member]
+	if !ok {
+		return nil, fmt.Errorf("fs has no member %s", member)
+	}
+	if err := fn.CheckArity(len(args)); err != nil {
+		return nil, err
+	}
+	for i, arg := range args {
+		if want := fn.Params[i].Type; ops.TypeName(arg) != want {
+			return nil, fmt.Errorf("fs.%s %s must be %s, got %s", member, fn.Params[i].Name, want, ops.TypeName(arg))
+		}
+	}
+	return m.call(member, args)
+}
+
+// call calls a member with arguments of the types it takes.
+func (m *FSModule) call(member string, args []interface{}) (interface{}, error) {
+	var path string
+	if len(args) > 0 {
+		path = args[0].(string)
+	}
+	switch member {
+	case "read":
+		data, err := m.sandbox.Read(path)
+		return string(data), err
+	case "write":
+		return nil, m.sandbox.Write(path, []byte(args[1].(string)))
+	case "remove":
+		return nil, m.sandbox.Remove(path)
+	case "exists":
+		_, err := m.sandbox.Stat(path)
+		if errors.Is(err, iofs.ErrNotExist) {
+			return false, nil
+		}
+		return err == nil, err
+	case "list":
+		infos, err := m.sandbox.List(path)
+		names := make([]string, len(infos))
+		for i, info := range infos {
+			names[i] = info.Name
+			if info.Dir {
+				names[i] += "/"
+			}
+		}
+		return strings.Join(names, "\n"), err
+	case "stat":
+		info, err := m.sandbox.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.Dir {
+			return "dir", nil
+		}
+		return fmt.Sprintf("file %d", info.Size), nil
+	case "glob":
+		matches, err := m.sandbox.Glob(path)
+		return strings.Join(matches, "\n"), err
+	case "tempdir":
+		return m.sandbox.TempDir("")
+	default: // watch
+		w, err := m.watcher(path, args[1].(int64))
+		if err != nil {
+			return nil, err
+		}
+		return &Watch{Events: w.Events, watcher: w}, nil
+	}
+}
+
+// MemberType is the type of the value of receiver.member(...) for a
+// receiver of the type named, or "" if the type has no such member.
+func MemberType(receiver, member string) string {
+	switch receiver {
+	case "chore":
+		if member == "fs" {
+			return "fs"
+		}
+	case "fs":
+		if m, ok := fs.Members[member]; ok {
+			return m.Result
+		}
+	}
+	return ""
+}
+
+// watcher returns the watcher of pattern at an interval of ms, starting
+// it the first time the pattern is watched so.
+func (m *FSModule) watcher(pattern string, ms int64) (*fs.Watcher, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := fmt.Sprintf("%d %s", ms, pattern)
+	if w, ok := m.watchers[key]; ok {
+		return w, nil
+	}
+	w, err := m.sandbox.Watch(pattern, time.Duration(ms)*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	m.watchers[key] = w
+	return w, nil
+}
+
+// evalMember calls a member of its receiver. chore, unless the program
+// declares its own, is the library, which a program reaches only by
+// calling chore.fs().
+func (in *Interpreter) evalMember(d *Dancer, e *ast.MemberCallExpression, env *Environment) interface{} {
+	var receiver interface{}
+	library := false
+	if ident, ok := e.Receiver.(*ast.Identifier); ok && ident.Value == "chore" {
+		_, declared := env.Get(ident.Value)
+		library = !declared
+	}
+	if !library {
+		receiver = in.eval(d, e.Receiver, env)
+	}
+	
+	args := make([]interface{}, 0, len(e.Arguments))
+	for _, arg := range e.Arguments {
+		args = append(args, in.eval(d, arg, env))
+	}
+	
+	tok := e.Member.Token
+	if library {
+		if err := fs.CheckOpen(e.Member.Value, len(args)); err != nil {
+			in.fail(tok, "%s", err)
+		}
+		m, err := OpenFS(in.FS)
+		if err != nil {
+			in.fail(tok, "%s", err)
+		}
+		in.mu.Lock()
+		in.modules = append(in.modules, m)
+		in.mu.Unlock()
+		return m
+	}
+	
+	value, err := Member(receiver, e.Member.Value, args)
+	if err != nil {
+		in.fail(tok, "%s", err)
+	}
+	if w, ok := value.(*Watch); ok {
+		return in.watch(tok, w)
+	}
+	return value
+}
+
+// watch waits at tok for the change w reports, unless the program stops
+// or runs out of time first.
+func (in *Interpreter) watch(tok lexer.Token, w *Watch) interface{} {
+	in.checkTime(tok)
+	select {
+	case e, ok := <-w.Events:
+		value, err := w.Result(e, ok)
+		if err != nil {
+			in.fail(tok, "%s", err)
+		}
+		return value
+	case <-in.done:
+		panic(errHalted)
+	case <-in.timeUp:
+		exceeded(tok, "time", int64(in.Limits.Time))
+	}
+	return nil
+}
+
+// closeModules stops the watchers of the modules chore.fs() opened.
+func (in *Interpreter) closeModules() {
+	in.mu.Lock()
+	modules := in.modules
+	in.modules = nil
+	in.mu.Unlock()
+	for _, m := range modules {
+		m.Close()
+	}
+}
\ No newline at end of file
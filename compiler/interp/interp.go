@@ -0,0 +1,506 @@
+// Package interp evaluates a ChoreLang program directly from its AST, so
+// programs run without the Go toolchain. Its semantics follow the Go the
+// code generator emits:
+//
+//   - `start` runs a dancer on its own goroutine, with a snapshot of the
+//     bindings visible at launch time.
+//   - Channels are unbuffered, so `send` and `<-` block until a partner
+//     arrives.
+//   - Under a Schedule the dancers instead take turns, in an order drawn
+//     from its seed, so a run can be replayed exactly.
+//   - The program ends when the main dancer finishes; dancers still running
+//     are stopped, as Go stops goroutines when main returns, and those left
+//     waiting on a channel are reported by Leaked.
+//   - When every dancer waits on a channel no other can complete, Run
+//     returns a *DeadlockError naming them, instead of hanging. Under a
+//     Debugger they are left waiting, to be inspected.
+//   - A runtime error in any dancer stops the whole program, and so does
+//     exit(code), which Run reports as an *ExitError, and going past any of
+//     the Limits, reported as a *LimitError.
+//   - Rehearsals are skipped, except the one named by Rehearsal, which runs
+//     in place. A failed expect is recorded and the rehearsal goes on.
+//     Encores, which only run as generated Go benchmarks, are always skipped.
+package interp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/fs"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/ops"
+	"github.com/chorlang/chorlang/compiler/resolver"
+)
+
+// RuntimeError is an error raised while evaluating a program, positioned at
+// the ChoreLang token that caused it.
+type RuntimeError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// errHalted unwinds dancers once the program has stopped.
+var errHalted = errors.New("program halted")
+
+type Interpreter struct {
+	// Args are the program arguments args() reports. Args[0] names the
+	// program.
+	Args []string
+	
+	// FS is the sandbox chore.fs() opens. Without one it fails.
+	FS *fs.Sandbox
+	
+	// Rehearsal names the rehearsal Run performs; the others are skipped,
+	// and all of them are when it is empty.
+	Rehearsal string
+	
+	// Limits caps what the program may use; see Limits.
+	Limits Limits
+	
+	// Count, if set, is called as each statement starts, from the dancer
+	// running it. Coverage is measured with it.
+	Count func(ast.Statement)
+	
+	// Debugger, if set, watches every dancer and may pause it; see
+	// Debugger.
+	Debugger Debugger
+	
+	// Schedule, if set, runs the dancers one at a time in an order drawn
+	// from its seed; see Schedule.
+	Schedule *Schedule
+	
+	// Pick, if set, runs the dancers one at a time as Schedule does, but
+	// chooses each turn itself, returning an index into the Turn's Ready.
+	// It is called from the dancer whose turn has ended, and also for a
+	// turn that leaves no dancer ready, when what it returns is ignored.
+	Pick func(Turn) int
+	
+	out io.Writer
+	mu  sync.Mutex // guards out, err and failures
+	
+	err      error
+	failures []*RuntimeError
+	done     chan struct{}
+	stopOnce sync.Once
+	modules  []*FSModule // opened by chore.fs(), closed as the program ends
+	
+	dancers  int64 // dancers started so far, main included
+	channels int64 // channels made so far
+	
+	iterations int64         // sway iterations completed so far
+	expired    int32         // set once Limits.Time has run out
+	timeUp     chan struct{} // closed once Limits.Time has run out
+	printed    int64         // bytes printed so far, guarded by mu
+	
+	sched *scheduler // set while a Schedule runs
+	
+	waitMu sync.Mutex // guards live, waits, leaked and held
+	live   int        // dancers running, main included
+	waits  map[*Waiter]*Channel
+	leaked []Blocked
+	held   int64 // bytes of the values waiting senders hold
+	
+	// In a session a failing dancer stops alone instead of stopping the
+	// whole program.
+	session bool
+}
+
+func New(out io.Writer) *Interpreter {
+	return &Interpreter{out: out}
+}
+
+// Run resolves and evaluates program, returning the first runtime error.
+func (in *Interpreter) Run(program *ast.Program) error {
+	r := resolver.New()
+	r.Resolve(program)
+	if errs := r.Errors(); len(errs) > 0 {
+		return fmt.Errorf("unresolved program: %s", errs[0])
+	}
+	
+	in.done = make(chan struct{})
+	in.err = nil
+	in.failures = nil
+	in.stopOnce = sync.Once{}
+	in.dancers = 0
+	in.channels = 0
+	in.sched = nil
+	in.live = 0
+	in.waits = nil
+	in.leaked = nil
+	in.held = 0
+	in.iterations = 0
+	in.expired = 0
+	in.timeUp = make(chan struct{})
+	in.printed = 0
+	in.modules = nil
+	if in.Pick != nil {
+		in.sched = &scheduler{}
+	} else if in.Schedule != nil {
+		in.sched = &scheduler{turns: in.Schedule.Turns()}
+	}
+	
+	if in.Limits.Time > 0 {
+		timeUp := in.timeUp
+		timer := time.AfterFunc(in.Limits.Time, func() {
+			atomic.StoreInt32(&in.expired, 1)
+			close(timeUp)
+		})
+		defer timer.Stop()
+	}
+	
+	main := in.newDancer(nil, lexer.Token{})
+	if in.sched != nil {
+		in.sched.main = main
+	}
+	in.dance(main, func() {
+		env := NewEnvironment()
+		for _, stmt := range program.Statements {
+			in.execStatement(main, stmt, env)
+		}
+	})
+	
+	// Main has finished: stop every dancer still on stage, noting those
+	// left waiting
+	if !in.halted() {
+		in.leaks()
+	}
+	in.stop(nil)
+	in.closeModules()
+	
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.err
+}
+
+// Failures returns the expects that failed during the last Run, in the
+// order they failed, each positioned at its spin.
+func (in *Interpreter) Failures() []*RuntimeError {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.failures
+}
+
+// dance runs fn as dancer d, turning runtime panics into a program stop.
+func (in *Interpreter) dance(d *Dancer, fn func()) {
+	if in.Debugger != nil {
+		defer in.Debugger.Finished(d)
+	}
+	defer in.ended(d)
+	defer func() {
+		if r := recover(); r != nil {
+			if r == errHalted {
+				return
+			}
+			var err error
+			switch r := r.(type) {
+			case *RuntimeError:
+				err = r
+			case *ExitError:
+				err = r
+			case *LimitError:
+				err = r
+			default:
+				panic(r)
+			}
+			if in.session {
+				in.mu.Lock()
+				fmt.Fprintf(in.out, "dancer stopped: %v\n", err)
+				in.mu.Unlock()
+				return
+			}
+			in.stop(err)
+		}
+	}()
+	fn()
+	if in.sched != nil && d.ID != 0 {
+		in.pass(d)
+	}
+}
+
+// Halt stops a running program as though main had finished: every dancer
+// stops at its next statement or channel operation, and Run returns.
+func (in *Interpreter) Halt() {
+	in.stop(nil)
+}
+
+// stop halts the program. The first error recorded is the one Run returns.
+func (in *Interpreter) stop(err error) {
+	in.mu.Lock()
+	if in.err == nil && err != nil && !in.halted() {
+		in.err = err
+	}
+	in.mu.Unlock()
+	
+	in.stopOnce.Do(func() { close(in.done) })
+}
+
+func (in *Interpreter) halted() bool {
+	select {
+	case <-in.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (in *Interpreter) checkHalted() {
+	if in.halted() {
+		panic(errHalted)
+	}
+}
+
+func (in *Interpreter) fail(tok lexer.Token, format string, args ...interface{}) {
+	panic(&RuntimeError{Line: tok.Line, Column: tok.Column, Message: fmt.Sprintf(format, args...)})
+}
+
+func (in *Interpreter) execBlock(d *Dancer, block *ast.BlockStatement, env *Environment) {
+	inner := NewEnclosedEnvironment(env)
+	for _, stmt := range block.Statements {
+		in.execStatement(d, stmt, inner)
+	}
+}
+
+func (in *Interpreter) execStatement(d *Dancer, stmt ast.Statement, env *Environment) {
+	in.checkHalted()
+	if in.Count != nil {
+		in.Count(stmt)
+	}
+	if in.Debugger != nil {
+		in.Debugger.Statement(d, stmt, env)
+		in.checkHalted()
+	}
+	
+	switch s := stmt.(type) {
+	case *ast.DanceStatement:
+		env.Declare(s.Name.Value, in.eval(d, s.Value, env))
+	case *ast.AssignStatement:
+		value := in.eval(d, s.Value, env)
+		if !env.Assign(s.Name.Value, value) {
+			in.fail(s.Token, "undefined: %s", s.Name.Value)
+		}
+	case *ast.ExpressionStatement:
+		in.eval(d, s.Expression, env)
+	case *ast.SwayStatement:
+		in.execSway(d, s, env)
+	case *ast.StartStatement:
+		snapshot := s.Statement
+		dancerEnv := NewEnclosedEnvironment(env.Snapshot())
+		child := in.newDancer(d, s.Token)
+		go in.dance(child, func() {
+			if in.sched != nil {
+				in.await(child)
+			}
+			in.execStatement(child, snapshot, dancerEnv)
+		})
+		if in.sched != nil {
+			in.sched.ready = append(in.sched.ready, child)
+			in.yield(d, Turn{Last: d, Op: "start", Line: s.Token.Line, Column: s.Token.Column})
+		}
+	case *ast.SendStatement:
+		ch := in.channel(s.Token, in.eval(d, s.Channel, env))
+		value := in.eval(d, s.Value, env)
+		if !Accepts(ch.elem, value) {
+			in.fail(s.Token, "cannot send %s to %s", ops.TypeName(value), ch)
+		}
+		in.send(d, s.Token, ch, value)
+	case *ast.IfStatement:
+		if in.truthy(s.Token, in.eval(d, s.Condition, env)) {
+			in.execBlock(d, s.Consequence, env)
+		} else if s.Alternative != nil {
+			in.execBlock(d, s.Alternative, env)
+		}
+	case *ast.RehearseStatement:
+		if in.Rehearsal != "" && s.Name.Value == in.Rehearsal {
+			in.execBlock(d, s.Body, env)
+		}
+	case *ast.EncoreStatement:
+		// Encores only run as benchmarks, under chorelang bench
+	case *ast.BlockStatement:
+		in.execBlock(d, s, env)
+	default:
+		panic(&RuntimeError{Message: fmt.Sprintf("unknown statement type: %T", stmt)})
+	}
+}
+
+// execSway runs `for i := from; i <= to; i++`. Like the generated Go, the
+// upper bound is evaluated before every iteration.
+func (in *Interpreter) execSway(d *Dancer, s *ast.SwayStatement, env *Environment) {
+	loopEnv := NewEnclosedEnvironment(env)
+	loopEnv.Declare(s.Variable.Value, in.eval(d, s.From, env))
+	
+	for {
+		in.checkHalted()
+		
+		current, _ := loopEnv.Get(s.Variable.Value)
+		to := in.eval(d, s.To, loopEnv)
+		if !in.truthy(s.Token, in.binary(s.Token, "<=", current, to)) {
+			return
+		}
+		
+		in.execBlock(d, s.Body, loopEnv)
+		
+		current, _ = loopEnv.Get(s.Variable.Value)
+		loopEnv.Assign(s.Variable.Value, in.binary(s.Token, "+", current, int64(1)))
+		in.iterate(s.Token)
+	}
+}
+
+func (in *Interpreter) eval(d *Dancer, exp ast.Expression, env *Environment) interface{} {
+	switch e := exp.(type) {
+	case *ast.Identifier:
+		v, ok := env.Get(e.Value)
+		if !ok {
+			in.fail(e.Token, "undefined: %s", e.Value)
+		}
+		return v
+	case *ast.IntegerLiteral:
+		return e.Value
+	case *ast.FloatLiteral:
+		return e.Value
+	case *ast.StringLiteral:
+		return lexer.Unquote(e.Value)
+	case *ast.Boolean:
+		return e.Value
+	case *ast.InfixExpression:
+		left := in.eval(d, e.Left, env)
+		right := in.eval(d, e.Right, env)
+		return in.binary(e.Token, e.Operator, left, right)
+	case *ast.SpinExpression:
+		return in.evalSpin(d, e, env)
+	case *ast.MemberCallExpression:
+		return in.evalMember(d, e, env)
+	case *ast.FlowExpression:
+		if ident, ok := e.ChannelType.(*ast.Identifier); ok && ident.Value == "channel" {
+			elem := ""
+			if e.ElementType != nil {
+				elem = e.ElementType.Value
+			}
+			return in.newChannel(elem)
+		}
+		in.fail(e.Token, "flow needs a channel type such as channel<int>")
+	case *ast.ReceiveExpression:
+		ch := in.channel(e.Token, in.eval(d, e.Channel, env))
+		return in.receive(d, e.Token, ch)
+	case *ast.MatchExpression:
+		return in.evalMatch(d, e, env)
+	}
+	
+	panic(&RuntimeError{Message: fmt.Sprintf("unknown expression type: %T", exp)})
+}
+
+func (in *Interpreter) evalSpin(d *Dancer, e *ast.SpinExpression, env *Environment) interface{} {
+	args := make([]interface{}, 0, len(e.Arguments))
+	for _, arg := range e.Arguments {
+		args = append(args, in.eval(d, arg, env))
+	}
+	
+	ident, ok := e.Function.(*ast.Identifier)
+	if !ok {
+		in.fail(e.Token, "cannot call %s", e.Function.String())
+	}
+	
+	switch ident.Value {
+	case "print", "println":
+		in.mu.Lock()
+		defer in.mu.Unlock()
+		if in.halted() {
+			panic(errHalted)
+		}
+		line := fmt.Sprintln(args...)
+		if max := in.Limits.Output; max > 0 && in.printed+int64(len(line)) > max {
+			exceeded(ident.Token, "output", max)
+		}
+		in.printed += int64(len(line))
+		io.WriteString(in.out, line)
+		return nil
+	case "args":
+		switch len(args) {
+		case 0:
+			return ArgCount(in.Args)
+		case 1:
+			arg, err := Arg(in.Args, args[0])
+			if err != nil {
+				in.fail(ident.Token, "%s", err)
+			}
+			return arg
+		}
+		in.fail(ident.Token, "args takes at most 1 argument, got %d", len(args))
+	case "exit":
+		if len(args) != 1 {
+			in.fail(ident.Token, "exit takes 1 argument, got %d", len(args))
+		}
+		code, err := ExitCode(args[0])
+		if err != nil {
+			in.fail(ident.Token, "%s", err)
+		}
+		panic(&ExitError{Code: code})
+	case "expect":
+		failure, err := Expect(args)
+		if err != nil {
+			in.fail(ident.Token, "%s", err)
+		}
+		if failure != "" {
+			in.mu.Lock()
+			in.failures = append(in.failures, &RuntimeError{Line: e.Token.Line, Column: e.Token.Column, Message: failure})
+			in.mu.Unlock()
+		}
+		return nil
+	}
+	
+	in.fail(ident.Token, "undefined function: %s", ident.Value)
+	return nil
+}
+
+func (in *Interpreter) evalMatch(d *Dancer, e *ast.MatchExpression, env *Environment) interface{} {
+	subject := in.eval(d, e.Expression, env)
+	
+	for _, c := range e.Cases {
+		pattern := in.eval(d, c.Pattern, env)
+		if !in.truthy(c.Token, in.binary(c.Token, "==", subject, pattern)) {
+			continue
+		}
+		
+		// In a case, `flow value` yields the value rather than a channel
+		consequence := c.Consequence
+		if flow, ok := consequence.(*ast.FlowExpression); ok && flow.ElementType == nil {
+			consequence = flow.ChannelType
+		}
+		return in.eval(d, consequence, env)
+	}
+	
+	return nil
+}
+
+func (in *Interpreter) binary(tok lexer.Token, op string, left, right interface{}) interface{} {
+	v, err := ops.Binary(op, left, right)
+	if err != nil {
+		in.fail(tok, "%s", err)
+	}
+	return v
+}
+
+func (in *Interpreter) truthy(tok lexer.Token, v interface{}) bool {
+	b, ok := v.(bool)
+	if !ok {
+		in.fail(tok, "condition must be bool, got %s", ops.TypeName(v))
+	}
+	return b
+}
+
+func (in *Interpreter) channel(tok lexer.Token, v interface{}) *Channel {
+	ch, ok := v.(*Channel)
+	if !ok {
+		in.fail(tok, "%s is not a channel", ops.TypeName(v))
+	}
+	return ch
+}
\ No newline at end of file
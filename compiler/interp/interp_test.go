@@ -0,0 +1,621 @@
+package interp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/fs"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/parser"
+)
+
+func TestRunPrograms(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"print", `spin print("Hello", 42, 2.5, true)`, "Hello 42 2.5 true\n"},
+		{"encores are skipped", "encore \"e\" {\n    spin print(1)\n}\nspin print(2)", "2\n"},
+		{"arithmetic", `
+dance a = 7
+dance b = 2
+spin print(a + b, a - b, a * b, a / b)
+spin print(7.0 / 2, 1 + 0.5)
+spin print("ab" + "cd")
+`, "9 5 14 3\n3.5 1.5\nabcd\n"},
+		{"assignment", `
+dance total = 0
+sway i from 1 to 4 {
+    total = total + i
+}
+spin print(total)
+`, "10\n"},
+		{"shadowing", `
+dance x = 1
+if true {
+    dance x = 2
+    spin print(x)
+}
+spin print(x)
+`, "2\n1\n"},
+		{"sway bound is re-evaluated", `
+dance n = 3
+sway i from 1 to n {
+    if i == 1 {
+        n = 5
+    }
+    spin print(i)
+}
+`, "1\n2\n3\n4\n5\n"},
+		{"if else", `
+dance x = 42
+if x > 50 {
+    spin print("big")
+} else {
+    spin print("small")
+}
+`, "small\n"},
+		{"match", `
+dance item = "Rest"
+dance result = match item {
+    when "Note": flow "note"
+    when "Rest": flow "rest"
+}
+dance missing = match item {
+    when "Other": flow 1
+}
+spin print(result, missing)
+`, "rest <nil>\n"},
+		{"pattern operator", `
+dance name = "step"
+spin print(name =~ "^st.+", name =~ "^x")
+`, "true false\n"},
+		{"channels", `
+flow ch = flow channel<int>
+start sway i from 1 to 3 {
+    send ch <- i * 10
+}
+sway i from 1 to 3 {
+    dance v = <-ch
+    spin print(v)
+}
+`, "10\n20\n30\n"},
+		{"dancers snapshot loop variables", `
+flow results = flow channel<int>
+sway w from 1 to 3 {
+    start send results <- w
+}
+dance total = 0
+sway i from 1 to 3 {
+    total = total + <-results
+}
+spin print(total)
+`, "6\n"},
+		{"string escapes", `spin print("tab\there", "q\"uote")`, "tab\there q\"uote\n"},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := run(t, tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out != tt.expected {
+				t.Errorf("output wrong.\nGot:\n%q\nExpected:\n%q", out, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMainExitStopsDancers(t *testing.T) {
+	input := `
+flow never = flow channel<int>
+start {
+    dance v = <-never
+    spin print("unreachable", v)
+}
+start sway i from 1 to 1000000000 {
+    dance x = i
+}
+spin print("done")
+`
+	out, err := run(t, input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out != "done\n" {
+		t.Errorf("output wrong. got=%q", out)
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"dance x = 1 / 0", "1:13: integer divide by zero"},
+		{`dance x = 1 + "a"`, `1:13: invalid operation: int + string`},
+		{"if 1 {\n}", "1:1: condition must be bool, got int"},
+		{"spin missing(1)", "1:6: undefined function: missing"},
+		{"spin print(y)", "1:12: undefined: y"},
+		{"flow ch = flow channel<int>\nstart send ch <- \"s\"\ndance v = <-ch", `2:7: cannot send string to channel<int>`},
+		{"dance s = \"x\"\ndance b = s =~ \"(\"", "2:13: invalid pattern"},
+		{"spin print(spin args(1))", "1:17: args index 1 out of range [0:0]"},
+		{`dance a = spin args("1")`, "1:16: args index must be int, got string"},
+		{"spin exit(1.5)", "1:6: exit code must be int, got float"},
+		{"spin exit()", "1:6: exit takes 1 argument, got 0"},
+		{"flow files = chore.fs()", "1:20: chore.fs: no file system is open to this program"},
+		{"flow files = chore.files()", "1:20: chore has no member files"},
+		{"dance n = 1\nspin print(n.read(\"a\"))", "2:14: int has no member read"},
+		{"dance chore = 1\nflow files = chore.fs()", "2:20: int has no member fs"},
+	}
+	
+	for _, tt := range tests {
+		_, err := run(t, tt.input)
+		if err == nil {
+			t.Errorf("input %q: expected error %q, got none", tt.input, tt.expected)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("input %q: expected error starting with %q, got %q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestDancerErrorStopsProgram(t *testing.T) {
+	input := `
+flow ch = flow channel<int>
+start {
+    dance bad = 1 / 0
+    send ch <- bad
+}
+dance v = <-ch
+spin print("unreachable")
+`
+	out, err := run(t, input)
+	if err == nil || !strings.Contains(err.Error(), "integer divide by zero") {
+		t.Fatalf("expected divide by zero error, got %v", err)
+	}
+	if out != "" {
+		t.Errorf("main kept running after the dancer failed: %q", out)
+	}
+}
+
+func TestArgsAndExit(t *testing.T) {
+	input := `
+spin print(spin args())
+sway i from 0 to spin args() {
+    spin print(spin args(i))
+}
+start spin exit(7)
+flow never = flow channel<int>
+dance v = <-never
+spin print("unreachable")
+`
+	var out bytes.Buffer
+	in := New(&out)
+	in.Args = []string{"tool.chore", "a", "b c"}
+	err := in.Run(parse(t, input))
+	
+	var exit *ExitError
+	if !errors.As(err, &exit) || exit.Code != 7 {
+		t.Fatalf("expected exit status 7, got %v", err)
+	}
+	if out.String() != "2\ntool.chore\na\nb c\n" {
+		t.Errorf("output wrong. got=%q", out.String())
+	}
+}
+
+func TestFileSystem(t *testing.T) {
+	input := `
+flow files = chore.fs()
+files.write("drafts/poem.txt", files.read("notes.txt") + " turn")
+spin print(files.read("/drafts/poem.txt"), files.stat("drafts/poem.txt"), files.stat("drafts"))
+spin print(files.exists("drafts"), files.exists("missing.txt"))
+spin print(files.glob("**/*.txt"))
+spin print(files.list("/"))
+files.remove("drafts")
+spin print(files.glob("**/*.txt"))
+dance tmp = files.tempdir()
+spin print(files.exists(tmp), tmp =~ "^tmp/", files)
+files.read("../secret")
+`
+	sandbox, err := fs.Memory(map[string]string{"notes.txt": "step"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	in := New(&out)
+	in.FS = sandbox
+	err = in.Run(parse(t, input))
+	
+	want := `12:7: read "../secret": denied by the jail rule`
+	if err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("expected error starting with %q, got %v", want, err)
+	}
+	expected := "step turn file 9 dir\ntrue false\ndrafts/poem.txt\nnotes.txt\ndrafts/\nnotes.txt\nnotes.txt\ntrue true fs\n"
+	if out.String() != expected {
+		t.Errorf("output wrong. got=%q", out.String())
+	}
+	
+	for input, want := range map[string]string{
+		"flow files = chore.fs()\nfiles.read(1)":             "2:7: fs.read path must be string, got int",
+		"flow files = chore.fs()\nfiles.write(\"a\")":        "2:7: fs.write takes 2 arguments, got 1",
+		"flow files = chore.fs()\nfiles.watch(\"*\", \"1\")": "2:7: fs.watch ms must be int, got string",
+		"flow files = chore.fs()\nfiles.watch(\"*\", 0)":     `2:7: watch "*": interval 0s is not positive`,
+		"flow files = chore.fs()\nfiles.copy(\"a\")":         "2:7: fs has no member copy",
+	} {
+		in := New(&out)
+		in.FS = sandbox
+		if err := in.Run(parse(t, input)); err == nil || err.Error() != want {
+			t.Errorf("%q: expected error %q, got %v", input, want, err)
+		}
+	}
+}
+
+func TestFileSystemWatch(t *testing.T) {
+	input := `
+flow files = chore.fs()
+spin print(files.watch("*.txt", 5))
+spin print(files.watch("*.txt", 5))
+start spin print(files.watch("*.txt", 5))
+`
+	sandbox, err := fs.Memory(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	in := New(&out)
+	in.FS = sandbox
+	
+	// The first change may come before the watch starts, so keep changing
+	// the file until the program ends
+	done := make(chan error)
+	go func() { done <- in.Run(parse(t, input)) }()
+	for i := 1; ; i++ {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); !regexp.MustCompile(`^(created|modified) poem\.txt\nmodified poem\.txt\n$`).MatchString(got) {
+				t.Errorf("output wrong. got=%q", got)
+			}
+			return
+		case <-time.After(time.Millisecond):
+			if err := sandbox.Write("poem.txt", []byte(strings.Repeat("step", i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestFileSystemWatchTimeLimit(t *testing.T) {
+	sandbox, err := fs.Memory(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := New(&bytes.Buffer{})
+	in.FS = sandbox
+	in.Limits.Time = 20 * time.Millisecond
+	err = in.Run(parse(t, "flow files = chore.fs()\ndance change = files.watch(\"*.txt\", 5)"))
+	
+	var limit *LimitError
+	if !errors.As(err, &limit) || limit.Limit != "time" || limit.Line != 2 || limit.Column != 22 {
+		t.Errorf("expected the time limit at 2:22, got %v", err)
+	}
+}
+
+func TestRehearsals(t *testing.T) {
+	input := `
+dance base = 10
+rehearse "passes" {
+    spin print("passes ran")
+    spin expect(base + 1, 11)
+}
+rehearse "fails" {
+    spin expect(base + 1, 12)
+    spin expect(base > 100)
+    spin expect("a", 1)
+    spin expect("a\nb\n", "a\nc\n")
+    spin print("fails kept going")
+}
+spin print("setup ran")
+`
+	program := parse(t, input)
+	
+	var out bytes.Buffer
+	in := New(&out)
+	if err := in.Run(program); err != nil || out.String() != "setup ran\n" {
+		t.Fatalf("without a rehearsal selected expected only the setup to run, got %q, %v", out.String(), err)
+	}
+	
+	out.Reset()
+	in.Rehearsal = "passes"
+	if err := in.Run(program); err != nil || len(in.Failures()) != 0 {
+		t.Fatalf("passing rehearsal failed: %v, %v", err, in.Failures())
+	}
+	if out.String() != "passes ran\nsetup ran\n" {
+		t.Errorf("wrong rehearsal ran: %q", out.String())
+	}
+	
+	out.Reset()
+	in.Rehearsal = "fails"
+	if err := in.Run(program); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"8:5: got 11, want 12",
+		"9:5: condition is false",
+		"10:5: got string \"a\", want int 1",
+		"11:5: strings differ (-want +got):\n",
+	}
+	failures := in.Failures()
+	if len(failures) != len(expected) {
+		t.Fatalf("expected %d failures, got %v", len(expected), failures)
+	}
+	for i, f := range failures {
+		if !strings.HasPrefix(f.Error(), expected[i]) {
+			t.Errorf("failure %d: expected %q, got %q", i, expected[i], f.Error())
+		}
+	}
+	if !strings.Contains(out.String(), "fails kept going") {
+		t.Errorf("a failed expect stopped the rehearsal: %q", out.String())
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	input := `
+sway i from 1 to 1000000000 {
+    dance x = i
+}
+`
+	in := New(&bytes.Buffer{})
+	in.Limits.Time = 10 * time.Millisecond
+	err := in.Run(parse(t, input))
+	
+	var timeout *LimitError
+	if !errors.As(err, &timeout) || err.Error() != "2:1: time limit of 10ms exceeded" {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+}
+
+// limited are programs that go past a limit, as the interpreter and the VM
+// both report it.
+var limited = []struct {
+	input    string
+	limits   Limits
+	output   string
+	expected string
+}{
+	// A loop stops as it completes one iteration too many
+	{"sway i from 1 to 10 {\n    spin print(i)\n}", Limits{Iterations: 3},
+		"1\n2\n3\n4\n", "1:1: iterations limit of 3 exceeded"},
+	{"flow never = flow channel<int>\nsway i from 1 to 5 {\n    start dance v = <-never\n}", Limits{Dancers: 3},
+		"", "3:5: dancers limit of 3 exceeded"},
+	{"flow never = flow channel<int>\nflow ch = flow channel<string>\nsway i from 1 to 3 {\n    start send ch <- \"hello\"\n}\ndance v = <-never", Limits{Memory: 10},
+		"", "4:11: memory limit of 10 bytes exceeded"},
+	{"spin print(\"hello\")\nspin print(\"hello\")\nspin print(\"hello\")", Limits{Output: 12},
+		"hello\nhello\n", "3:6: output limit of 12 bytes exceeded"},
+	{"sway i from 1 to 1000000000 {\n}", Limits{Time: 10 * time.Millisecond},
+		"", "1:1: time limit of 10ms exceeded"},
+}
+
+func TestLimits(t *testing.T) {
+	for _, tt := range limited {
+		var out bytes.Buffer
+		in := New(&out)
+		in.Limits = tt.limits
+		err := in.Run(parse(t, tt.input))
+		
+		var limit *LimitError
+		if !errors.As(err, &limit) || err.Error() != tt.expected {
+			t.Errorf("%+v: expected %q, got %v", tt.limits, tt.expected, err)
+		}
+		if out.String() != tt.output {
+			t.Errorf("%+v: output wrong. got=%q", tt.limits, out.String())
+		}
+	}
+	
+	// Within its limits a program runs as usual
+	in := New(&bytes.Buffer{})
+	in.Limits = Limits{Time: time.Minute, Iterations: 3, Dancers: 2, Memory: 8, Output: 2}
+	if err := in.Run(parse(t, "flow ch = flow channel<int>\nstart send ch <- 1\nsway i from 1 to 3 {\n}\nspin print(<-ch)")); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestCount(t *testing.T) {
+	input := `
+sway i from 1 to 3 {
+    spin print(i)
+}
+`
+	var mu sync.Mutex
+	counts := make(map[string]int)
+	in := New(&bytes.Buffer{})
+	in.Count = func(stmt ast.Statement) {
+		mu.Lock()
+		defer mu.Unlock()
+		counts[fmt.Sprintf("%T", stmt)]++
+	}
+	if err := in.Run(parse(t, input)); err != nil {
+		t.Fatal(err)
+	}
+	
+	if counts["*ast.SwayStatement"] != 1 || counts["*ast.ExpressionStatement"] != 3 || len(counts) != 2 {
+		t.Errorf("statements counted wrong: %v", counts)
+	}
+}
+
+// racy prints in an order that depends on which dancer runs first.
+const racy = `
+flow done = flow channel<int>
+sway w from 1 to 3 {
+    start {
+        spin print("worker", w, "starts")
+        send done <- w
+    }
+}
+sway i from 1 to 3 {
+    spin print("got", <-done)
+}
+`
+
+func TestSchedule(t *testing.T) {
+	scheduled := func(seed int64, input string) (string, error) {
+		var out bytes.Buffer
+		in := New(&out)
+		in.Schedule = &Schedule{Seed: seed}
+		err := in.Run(parse(t, input))
+		return out.String(), err
+	}
+	
+	seen := make(map[string]bool)
+	for seed := int64(0); seed < 20; seed++ {
+		first, err := scheduled(seed, racy)
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		for i := 0; i < 3; i++ {
+			if again, _ := scheduled(seed, racy); again != first {
+				t.Fatalf("seed %d ran differently:\n%s\nthen:\n%s", seed, first, again)
+			}
+		}
+		seen[first] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("20 seeds gave only %d interleaving", len(seen))
+	}
+	
+	_, err := scheduled(1, "flow ch = flow channel<int>\nstart send ch <- 1\ndance a = <-ch\ndance b = <-ch")
+	if err == nil || err.Error() != "4:11: all dancers are asleep - deadlock!" {
+		t.Errorf("expected a deadlock at 4:11, got %v", err)
+	}
+	
+	// A dancer that never yields keeps the turn, and a time limit still stops it
+	in := New(&bytes.Buffer{})
+	in.Schedule = &Schedule{Seed: 1}
+	in.Limits.Time = 10 * time.Millisecond
+	err = in.Run(parse(t, "start sway i from 1 to 1000000000 { }\nflow ch = flow channel<int>\ndance v = <-ch"))
+	var timeout *LimitError
+	if !errors.As(err, &timeout) || timeout.Limit != "time" {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
+
+// cycle deadlocks every time: each dancer waits for the other to send.
+const cycle = `flow a = flow channel<int>
+flow b = flow channel<int>
+start {
+    dance x = <-a
+    send b <- x
+}
+dance y = <-b
+send a <- y
+`
+
+// leak leaves its second sender blocked, when the senders go first.
+const leak = `flow ch = flow channel<int>
+start send ch <- 1
+start send ch <- 2
+dance first = <-ch
+`
+
+func TestDeadlock(t *testing.T) {
+	expected := []Blocked{
+		{Dancer: 0, Line: 7, Column: 11},
+		{Dancer: 1, StartLine: 3, StartColumn: 1, Line: 4, Column: 15},
+	}
+	for i := 0; i < 20; i++ {
+		_, err := run(t, cycle)
+		var deadlock *DeadlockError
+		if !errors.As(err, &deadlock) || err.Error() != "7:11: all dancers are asleep - deadlock!" {
+			t.Fatalf("expected a deadlock at 7:11, got %v", err)
+		}
+		if fmt.Sprint(deadlock.Blocked) != fmt.Sprint(expected) {
+			t.Fatalf("blocked dancers wrong: %+v", deadlock.Blocked)
+		}
+	}
+	
+	// Every scheduled run ends in the same deadlock
+	in := New(&bytes.Buffer{})
+	in.Schedule = &Schedule{Seed: 1}
+	var deadlock *DeadlockError
+	if err := in.Run(parse(t, cycle)); !errors.As(err, &deadlock) || fmt.Sprint(deadlock.Blocked) != fmt.Sprint(expected) {
+		t.Errorf("expected the same deadlock under a schedule, got %v", err)
+	}
+	
+	// Letting the oldest ready dancer go first, both senders reach the channel
+	in = New(&bytes.Buffer{})
+	in.Pick = func(Turn) int { return 0 }
+	if err := in.Run(parse(t, leak)); err != nil {
+		t.Fatal(err)
+	}
+	leaked := []Blocked{{Dancer: 2, StartLine: 3, StartColumn: 1, Send: true, Line: 3, Column: 7}}
+	if fmt.Sprint(in.Leaked()) != fmt.Sprint(leaked) {
+		t.Errorf("expected dancer 2 to leak, got %+v", in.Leaked())
+	}
+	
+	// Rendezvous on one channel never look stuck, however they interleave
+	for i := 0; i < 20; i++ {
+		if _, err := run(t, "flow ch = flow channel<int>\nstart sway i from 1 to 200 {\n    send ch <- i\n}\nsway i from 1 to 200 {\n    dance v = <-ch\n}"); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"seed:42", "seed:42"},
+		{"seed:-3", "seed:-3"},
+		{"42", `schedule "42": want seed:N or random`},
+		{"seed:x", `schedule "seed:x": seed must be an integer`},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.input)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = s.String()
+		}
+		if got != tt.expected {
+			t.Errorf("ParseSchedule(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+	if s, err := ParseSchedule("random"); err != nil || !strings.HasPrefix(s.String(), "seed:") {
+		t.Errorf("ParseSchedule(random) = %v, %v", s, err)
+	}
+}
+
+func run(t *testing.T, input string) (string, error) {
+	program := parse(t, input)
+	
+	var out bytes.Buffer
+	err := New(&out).Run(program)
+	return out.String(), err
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parser errors: %v", p.Errors())
+	}
+	
+	return program
+}
\ No newline at end of file
@@ -0,0 +1,93 @@
+package interp
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+	
+	"github.com/chorlang/chorlang/compiler/lexer"
+)
+
+// Limits caps what a program may use, so that untrusted programs can be run
+// safely. A zero field means no limit. A program that goes past a limit
+// stops with a *LimitError, on the interpreter and the VM alike.
+type Limits struct {
+	// Time is how long the program may run. It is checked as loops go
+	// round and as dancers send and receive.
+	Time time.Duration
+	
+	// Iterations caps the sway iterations all dancers complete, together.
+	Iterations int64
+	
+	// Dancers caps the dancers running at once, main included.
+	Dancers int
+	
+	// Memory caps the bytes of the values senders wait to hand over, which
+	// is everything the unbuffered channels hold. Size measures them.
+	Memory int64
+	
+	// Output caps the bytes the program prints.
+	Output int64
+}
+
+// LimitError is returned when a program goes past one of its Limits. Limit
+// is "time", "iterations", "dancers", "memory" or "output", Max its value,
+// in nanoseconds for time and bytes for memory and output, and Line and
+// Column the position of the loop, start, send, receive or print that went
+// past it.
+type LimitError struct {
+	Line, Column int
+	Limit        string
+	Max          int64
+}
+
+func (e *LimitError) Error() string {
+	max := strconv.FormatInt(e.Max, 10)
+	switch e.Limit {
+	case "time":
+		max = time.Duration(e.Max).String()
+	case "memory", "output":
+		if e.Max == 1 {
+			max += " byte"
+		} else {
+			max += " bytes"
+		}
+	}
+	return fmt.Sprintf("%d:%d: %s limit of %s exceeded", e.Line, e.Column, e.Limit, max)
+}
+
+// Size is the bytes a value takes, as Limits.Memory counts them: 8 for a
+// number or a channel, 1 for a bool and the length of a string.
+func Size(v interface{}) int64 {
+	switch v := v.(type) {
+	case string:
+		return int64(len(v))
+	case bool:
+		return 1
+	case nil:
+		return 0
+	default:
+		return 8
+	}
+}
+
+// exceeded stops the dancer with a *LimitError at tok.
+func exceeded(tok lexer.Token, limit string, max int64) {
+	panic(&LimitError{Line: tok.Line, Column: tok.Column, Limit: limit, Max: max})
+}
+
+// checkTime stops the dancer at tok if the program has run out of time.
+func (in *Interpreter) checkTime(tok lexer.Token) {
+	if atomic.LoadInt32(&in.expired) != 0 {
+		exceeded(tok, "time", int64(in.Limits.Time))
+	}
+}
+
+// iterate counts a completed iteration of the sway at tok.
+func (in *Interpreter) iterate(tok lexer.Token) {
+	if max := in.Limits.Iterations; max > 0 && atomic.AddInt64(&in.iterations, 1) > max {
+		exceeded(tok, "iterations", max)
+	}
+	in.checkTime(tok)
+}
\ No newline at end of file
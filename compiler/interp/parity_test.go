@@ -0,0 +1,120 @@
+package interp_test
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/bytecode"
+	"github.com/chorlang/chorlang/compiler/codegen"
+	"github.com/chorlang/chorlang/compiler/interp"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/parser"
+	"github.com/chorlang/chorlang/compiler/vm"
+)
+
+// parityPrograms are programs where the backends once disagreed.
+var parityPrograms = map[string]string{
+	"unread binding":      "flow c = flow channel<int>\nstart send c <- 1\ndance v = <-c\nspin print(\"done\")",
+	"literal arithmetic":  "spin print(0.1 + 0.2)\nspin print(0.1 + 0.2 == 0.3)\nspin print(1 + 0.5, 7 / 2)",
+	"wrapping literal":    "spin print(9223372036854775807 + 1)",
+	"unread blank":        "dance _ = 6\nspin print(\"ok\")",
+	"exact literal stays": "spin print(1 + 2 * 3, 1.5 * 2)",
+}
+
+// TestExamplesMatchGeneratedGo runs every example, and each of
+// parityPrograms, through the interpreter, the VM and the generated Go,
+// and requires identical output. This keeps the backends' semantics in
+// step.
+func TestExamplesMatchGeneratedGo(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds Go programs")
+	}
+	
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("Go toolchain not available")
+	}
+	
+	files, err := filepath.Glob("../../examples/*.chore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no examples found")
+	}
+	
+	sources := make(map[string]string)
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources[strings.TrimSuffix(filepath.Base(file), ".chore")] = string(source)
+	}
+	for name, source := range parityPrograms {
+		sources[name] = source
+	}
+	
+	for name, source := range sources {
+		t.Run(name, func(t *testing.T) {
+			program := parse(t, source)
+			
+			var interpreted bytes.Buffer
+			if err := interp.New(&interpreted).Run(program); err != nil {
+				t.Fatalf("interpreter error: %v", err)
+			}
+			
+			goCode, err := codegen.New().Generate(program)
+			if err != nil {
+				t.Fatalf("code generation error: %v", err)
+			}
+			
+			dir := t.TempDir()
+			goFile := filepath.Join(dir, "main.go")
+			if err := os.WriteFile(goFile, []byte(goCode), 0644); err != nil {
+				t.Fatal(err)
+			}
+			
+			var stdout, stderr bytes.Buffer
+			cmd := exec.Command(goTool, "run", goFile)
+			cmd.Dir = dir
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("go run failed: %v\n%s", err, stderr.String())
+			}
+			
+			if interpreted.String() != stdout.String() {
+				t.Errorf("interpreter and generated Go disagree.\nInterpreter:\n%s\nGo:\n%s",
+					interpreted.String(), stdout.String())
+			}
+			
+			chunk, err := bytecode.Compile(program)
+			if err != nil {
+				t.Fatalf("bytecode error: %v", err)
+			}
+			var machine bytes.Buffer
+			if err := vm.New(chunk, &machine).Run(); err != nil {
+				t.Fatalf("VM error: %v", err)
+			}
+			if interpreted.String() != machine.String() {
+				t.Errorf("interpreter and VM disagree.\nInterpreter:\n%s\nVM:\n%s",
+					interpreted.String(), machine.String())
+			}
+		})
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parser errors: %v", p.Errors())
+	}
+	return program
+}
\ No newline at end of file
@@ -0,0 +1,227 @@
+package interp
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule makes a concurrent run reproducible. Dancers take turns instead
+// of running at once: the running dancer yields at every start, send and
+// receive, and the dancer that runs next is drawn from the ready ones by a
+// random source seeded with Seed. The same program, input and seed always
+// give the same interleaving, and the VM draws its turns as the
+// interpreter does, so a seed replays the same way on both.
+//
+// Between those points a dancer is never interrupted, so one that loops
+// without touching a channel keeps the others waiting until it ends.
+type Schedule struct {
+	Seed int64
+}
+
+// ParseSchedule reads a schedule as written on the command line:
+// "seed:N" for a given seed, or "random" for a seed drawn from the clock,
+// which String reports so a failing run can be replayed.
+func ParseSchedule(s string) (*Schedule, error) {
+	if s == "random" {
+		return &Schedule{Seed: time.Now().UnixNano()}, nil
+	}
+	n, ok := strings.CutPrefix(s, "seed:")
+	if !ok {
+		return nil, fmt.Errorf("schedule %q: want seed:N or random", s)
+	}
+	seed, err := strconv.ParseInt(n, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("schedule %q: seed must be an integer", s)
+	}
+	return &Schedule{Seed: seed}, nil
+}
+
+func (s *Schedule) String() string {
+	return fmt.Sprintf("seed:%d", s.Seed)
+}
+
+// Turns draws whose turn it is under a schedule. Backends that keep their
+// ready dancers alike draw alike: a dancer that yields joins the back of
+// the ready list after any dancer it made ready, and the next to run is
+// the one at index Next(len(ready)), removed from the list.
+type Turns struct {
+	rng *rand.Rand
+}
+
+// Turns starts drawing turns from the beginning of the schedule.
+func (s *Schedule) Turns() *Turns {
+	return &Turns{rng: rand.New(rand.NewSource(s.Seed))}
+}
+
+// Next picks one of n ready dancers. With only one there is no choice,
+// and nothing is drawn.
+func (t *Turns) Next(n int) int {
+	if n <= 1 {
+		return 0
+	}
+	return t.rng.Intn(n)
+}
+
+// Turn is a point at which a scheduled run chooses the dancer to run
+// next. Last is the dancer whose turn has ended, at the operation Op at
+// Line and Column: "start", "send" or "receive", or "end" when it has
+// finished. A Blocked dancer waits in its operation, so is not ready.
+//
+// Ready holds the dancers that may run, in the order a schedule draws
+// from. A Last that only yielded is among them, at the back.
+type Turn struct {
+	Last         *Dancer
+	Op           string
+	Blocked      bool
+	Line, Column int
+	Ready        []*Dancer
+}
+
+// scheduler passes the turn between the dancers of a scheduled run. Only
+// the dancer whose turn it is touches it, and handing the turn over is a
+// channel send, so it needs no lock.
+type scheduler struct {
+	turns *Turns
+	ready []*Dancer
+	main  *Dancer
+}
+
+// yield puts d at the back of the ready dancers and runs the one drawn
+// next, which may be d again.
+func (in *Interpreter) yield(d *Dancer, t Turn) {
+	in.sched.ready = append(in.sched.ready, d)
+	in.switchFrom(d, t)
+}
+
+// switchFrom hands the turn from d, which is parked or yielding, to the
+// next ready dancer, and waits for d's turn to come back.
+func (in *Interpreter) switchFrom(d *Dancer, t Turn) {
+	next := in.draw(t)
+	if next == d {
+		return
+	}
+	if next == nil {
+		in.deadlock()
+		panic(errHalted)
+	}
+	next.wake <- struct{}{}
+	in.await(d)
+}
+
+// pass hands the turn on from a dancer that has finished.
+func (in *Interpreter) pass(d *Dancer) {
+	next := in.draw(Turn{Last: d, Op: "end"})
+	if next == nil {
+		in.deadlock()
+		return
+	}
+	next.wake <- struct{}{}
+}
+
+// await waits for d's turn.
+func (in *Interpreter) await(d *Dancer) {
+	select {
+	case <-d.wake:
+	case <-in.done:
+		panic(errHalted)
+	}
+}
+
+// draw takes the next dancer to run off the ready list, or returns nil
+// when no dancer is ready. Pick chooses it if set, and the seed otherwise.
+func (in *Interpreter) draw(t Turn) *Dancer {
+	s := in.sched
+	if len(s.ready) == 0 {
+		if in.Pick != nil {
+			in.Pick(t)
+		}
+		return nil
+	}
+	var i int
+	if in.Pick != nil {
+		t.Ready = append([]*Dancer(nil), s.ready...)
+		if i = in.Pick(t); i < 0 || i >= len(s.ready) {
+			panic(fmt.Sprintf("interp: Pick chose %d of %d ready dancers", i, len(s.ready)))
+		}
+	} else {
+		i = s.turns.Next(len(s.ready))
+	}
+	d := s.ready[i]
+	s.ready = append(s.ready[:i], s.ready[i+1:]...)
+	return d
+}
+
+// deadlock stops a scheduled run in which every dancer waits on a channel.
+func (in *Interpreter) deadlock() {
+	in.stop(in.deadlockError())
+}
+
+// scheduledSend is send under a schedule. The value goes straight to a
+// waiting receiver, or d parks until one arrives and takes it.
+func (in *Interpreter) scheduledSend(w *Waiter, ch *Channel) {
+	d := w.Dancer
+	if r := ch.partner(true); r != nil {
+		in.settle(ch, r)
+		r.Dancer.received = w.Value
+		r.Dancer.waiter = nil
+		in.sched.ready = append(in.sched.ready, r.Dancer)
+		in.yield(d, w.turn())
+		return
+	}
+	in.park(ch, w)
+}
+
+// scheduledReceive is receive under a schedule.
+func (in *Interpreter) scheduledReceive(w *Waiter, ch *Channel) interface{} {
+	d := w.Dancer
+	if s := ch.partner(false); s != nil {
+		in.settle(ch, s)
+		s.Dancer.waiter = nil
+		in.sched.ready = append(in.sched.ready, s.Dancer)
+		in.yield(d, w.turn())
+		return s.Value
+	}
+	in.park(ch, w)
+	v := d.received
+	d.received = nil
+	return v
+}
+
+// park waits in ch until a partner completes w, which takes d off the
+// channel and makes it ready again.
+func (in *Interpreter) park(ch *Channel, w *Waiter) {
+	w.Dancer.waiter = w
+	in.block(ch, w)
+	t := w.turn()
+	t.Blocked = true
+	in.switchFrom(w.Dancer, t)
+	if in.Debugger != nil {
+		in.Debugger.Unblocked(w.Dancer)
+	}
+}
+
+// turn is the Turn that ends as w's dancer reaches its operation.
+func (w *Waiter) turn() Turn {
+	op := "receive"
+	if w.Send {
+		op = "send"
+	}
+	return Turn{Last: w.Dancer, Op: op, Line: w.Line, Column: w.Column}
+}
+
+// partner returns the first dancer waiting in the channel to complete an
+// operation of the other kind: a receiver for a send, a sender for a
+// receive.
+func (c *Channel) partner(send bool) *Waiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, w := range c.waiting {
+		if w.Send != send {
+			return w
+		}
+	}
+	return nil
+}
\ No newline at end of file
@@ -0,0 +1,244 @@
+package interp
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/fs"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/ops"
+	"github.com/chorlang/chorlang/compiler/resolver"
+)
+
+// Session evaluates a program one piece at a time, as the REPL does.
+// Top-level bindings persist from one piece to the next, and dancers keep
+// running in the background until the session is closed. A runtime error
+// stops only the piece, or the dancer, it happened in.
+type Session struct {
+	in       *Interpreter
+	main     *Dancer
+	env      *Environment
+	bindings map[string]sessionBinding
+}
+
+type sessionBinding struct {
+	decl *ast.Identifier
+	kind resolver.BindingKind
+}
+
+// Result is the outcome of evaluating one piece of a session.
+type Result struct {
+	// Value is the value of a trailing expression. HasValue is false when
+	// the piece ends with a statement or a builtin without a value.
+	Value    interface{}
+	HasValue bool
+	
+	Warnings []string
+}
+
+func NewSession(out io.Writer) *Session {
+	in := New(out)
+	in.done = make(chan struct{})
+	in.session = true
+	
+	return &Session{
+		in:       in,
+		main:     in.newDancer(nil, lexer.Token{}),
+		env:      NewEnvironment(),
+		bindings: make(map[string]sessionBinding),
+	}
+}
+
+// Eval resolves program against the session's bindings and runs it.
+func (s *Session) Eval(program *ast.Program) (result *Result, err error) {
+	r := resolver.New()
+	for _, b := range s.bindings {
+		r.Predeclare(b.decl, b.kind)
+	}
+	r.Resolve(program)
+	if errs := r.Errors(); len(errs) > 0 {
+		return nil, fmt.Errorf("%s", errs[0])
+	}
+	
+	result = &Result{Warnings: r.Warnings()}
+	
+	defer func() {
+		if r := recover(); r != nil {
+			switch r := r.(type) {
+			case *RuntimeError:
+				result, err = nil, r
+			case *ExitError:
+				result, err = nil, r
+			default:
+				panic(r)
+			}
+		}
+	}()
+	
+	for i, stmt := range program.Statements {
+		if exp, ok := stmt.(*ast.ExpressionStatement); ok && i == len(program.Statements)-1 {
+			result.Value = s.in.eval(s.main, exp.Expression, s.env)
+			result.HasValue = !returnsNothing(exp.Expression)
+			continue
+		}
+		
+		s.in.execStatement(s.main, stmt, s.env)
+		
+		if dance, ok := stmt.(*ast.DanceStatement); ok {
+			b := sessionBinding{decl: dance.Name, kind: resolver.Variable}
+			if dance.Token.Type == lexer.FLOW {
+				b.kind = resolver.Channel
+			}
+			s.bindings[dance.Name.Value] = b
+		}
+	}
+	
+	return result, nil
+}
+
+// Close stops every dancer still running, and the watchers of the
+// modules chore.fs() opened.
+func (s *Session) Close() {
+	s.in.stop(nil)
+	s.in.closeModules()
+}
+
+// TypeOf reports the type exp would have, without evaluating it, so asking
+// for the type of `<-ch` does not receive from ch. Identifiers have the
+// type of their current value.
+func (s *Session) TypeOf(exp ast.Expression) (string, error) {
+	switch e := exp.(type) {
+	case *ast.Identifier:
+		v, ok := s.env.Get(e.Value)
+		if !ok {
+			return "", fmt.Errorf("undefined: %s", e.Value)
+		}
+		return ops.TypeName(v), nil
+	case *ast.IntegerLiteral:
+		return "int", nil
+	case *ast.FloatLiteral:
+		return "float", nil
+	case *ast.StringLiteral:
+		return "string", nil
+	case *ast.Boolean:
+		return "bool", nil
+	case *ast.InfixExpression:
+		left, err := s.TypeOf(e.Left)
+		if err != nil {
+			return "", err
+		}
+		right, err := s.TypeOf(e.Right)
+		if err != nil {
+			return "", err
+		}
+		return infixType(e.Operator, left, right)
+	case *ast.SpinExpression:
+		if returnsNothing(e) {
+			return "nothing", nil
+		}
+		ident := e.Function.(*ast.Identifier)
+		return BuiltinType(ident.Value, len(e.Arguments)), nil
+	case *ast.MemberCallExpression:
+		receiver := "chore"
+		if ident, ok := e.Receiver.(*ast.Identifier); !ok || ident.Value != "chore" || s.declared(ident) {
+			var err error
+			if receiver, err = s.TypeOf(e.Receiver); err != nil {
+				return "", err
+			}
+		}
+		if t := MemberType(receiver, e.Member.Value); t != "" {
+			return t, nil
+		}
+		return "", fmt.Errorf("%s has no member %s", receiver, e.Member.Value)
+	case *ast.FlowExpression:
+		if e.ElementType == nil {
+			return "channel", nil
+		}
+		return "channel<" + e.ElementType.Value + ">", nil
+	case *ast.ReceiveExpression:
+		v, err := s.TypeOf(e.Channel)
+		if err != nil {
+			return "", err
+		}
+		if elem, ok := channelElem(v); ok {
+			return elem, nil
+		}
+		return "", fmt.Errorf("%s is not a channel", v)
+	case *ast.MatchExpression:
+		// A match yields nothing when no case matches, so its type is
+		// only definite when every case agrees
+		result := ""
+		for _, c := range e.Cases {
+			consequence := c.Consequence
+			if flow, ok := consequence.(*ast.FlowExpression); ok && flow.ElementType == nil {
+				consequence = flow.ChannelType
+			}
+			t, err := s.TypeOf(consequence)
+			if err != nil {
+				return "", err
+			}
+			if result != "" && t != result {
+				return "any", nil
+			}
+			result = t
+		}
+		if result == "" {
+			return "nothing", nil
+		}
+		return result, nil
+	}
+	
+	return "", fmt.Errorf("unknown expression type: %T", exp)
+}
+
+func infixType(op, left, right string) (string, error) {
+	switch op {
+	case "==", "!=", "<", ">", "<=", ">=", "=~":
+		return "bool", nil
+	}
+	
+	if left == right && (left == "int" || left == "float" || (left == "string" && op == "+")) {
+		return left, nil
+	}
+	if (left == "int" && right == "float") || (left == "float" && right == "int") {
+		return "float", nil
+	}
+	if left == "any" || right == "any" {
+		return "any", nil
+	}
+	return "", fmt.Errorf("invalid operation: %s %s %s", left, op, right)
+}
+
+// channelElem returns the element type of a channel type name.
+func channelElem(t string) (string, bool) {
+	switch {
+	case t == "channel":
+		return "any", true
+	case strings.HasPrefix(t, "channel<") && strings.HasSuffix(t, ">"):
+		return t[len("channel<") : len(t)-1], true
+	}
+	return "", false
+}
+
+// declared reports whether the session has a binding of ident's name.
+func (s *Session) declared(ident *ast.Identifier) bool {
+	_, ok := s.env.Get(ident.Value)
+	return ok
+}
+
+// returnsNothing reports whether exp is a call to a builtin, or to a member
+// of the file system module, without a value.
+func returnsNothing(exp ast.Expression) bool {
+	if member, ok := exp.(*ast.MemberCallExpression); ok {
+		m, ok := fs.Members[member.Member.Value]
+		return ok && m.Result == "nothing"
+	}
+	spin, ok := exp.(*ast.SpinExpression)
+	if !ok {
+		return false
+	}
+	ident, ok := spin.Function.(*ast.Identifier)
+	return !ok || BuiltinType(ident.Value, len(spin.Arguments)) == "nothing"
+}
\ No newline at end of file
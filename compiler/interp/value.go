@@ -0,0 +1,51 @@
+package interp
+
+import (
+	"sync"
+	"sync/atomic"
+	
+	"github.com/chorlang/chorlang/compiler/ops"
+)
+
+// Values are represented as package ops describes; channels are *Channel.
+
+// Channel is a ChoreLang flow. Channels are unbuffered, like the
+// make(chan T) the code generator emits.
+type Channel struct {
+	ch   chan interface{}
+	elem string // element type name, "" when untyped
+	
+	// ID numbers the channels of a run from 1 up, in the order they are
+	// made.
+	ID int
+	
+	mu      sync.Mutex // guards waiting
+	waiting []*Waiter
+}
+
+func (in *Interpreter) newChannel(elem string) *Channel {
+	id := atomic.AddInt64(&in.channels, 1)
+	return &Channel{ch: make(chan interface{}), elem: elem, ID: int(id)}
+}
+
+func (c *Channel) String() string {
+	if c.elem == "" {
+		return "channel"
+	}
+	return "channel<" + c.elem + ">"
+}
+
+// TypeName names the channel for error messages and ops.TypeName.
+func (c *Channel) TypeName() string {
+	return c.String()
+}
+
+// Accepts reports whether a channel of the given element type may carry v.
+func Accepts(elem string, v interface{}) bool {
+	switch elem {
+	case "int", "float", "string", "bool":
+		return ops.TypeName(v) == elem
+	default:
+		return true
+	}
+}
\ No newline at end of file
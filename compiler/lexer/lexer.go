@@ -1,6 +1,8 @@
 package lexer
 
 import (
+	"strconv"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 )
@@ -23,6 +25,7 @@ func New(input string) *Lexer {
 func (l *Lexer) readChar() {
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
+		l.position = l.readPosition
 	} else {
 		r, size := utf8.DecodeRuneInString(l.input[l.readPosition:])
 		l.ch = r
@@ -52,8 +55,9 @@ func (l *Lexer) NextToken() Token {
 	
 	l.skipWhitespace()
 	
-	tok.Line = l.line
-	tok.Column = l.column
+	line, column := l.line, l.column
+	tok.Line = line
+	tok.Column = column
 	
 	switch l.ch {
 	case '=':
@@ -88,8 +92,9 @@ func (l *Lexer) NextToken() Token {
 		}
 	case '/':
 		if l.peekChar() == '/' {
-			l.skipComment()
-			return l.NextToken()
+			tok.Type = COMMENT
+			tok.Literal = l.readComment()
+			return tok
 		} else {
 			tok = l.makeToken(SLASH, string(l.ch))
 		}
@@ -121,6 +126,8 @@ func (l *Lexer) NextToken() Token {
 		tok = l.makeToken(SEMICOLON, string(l.ch))
 	case ':':
 		tok = l.makeToken(COLON, string(l.ch))
+	case '.':
+		tok = l.makeToken(DOT, string(l.ch))
 	case '(':
 		tok = l.makeToken(LPAREN, string(l.ch))
 	case ')':
@@ -136,8 +143,6 @@ func (l *Lexer) NextToken() Token {
 	case '"':
 		tok.Type = STRING
 		tok.Literal = l.readString()
-		tok.Line = l.line
-		tok.Column = l.column
 		return tok
 	case 0:
 		tok.Literal = ""
@@ -155,6 +160,9 @@ func (l *Lexer) NextToken() Token {
 		}
 	}
 	
+	// Two-character operators are positioned at their first character
+	tok.Line, tok.Column = line, column
+	
 	l.readChar()
 	return tok
 }
@@ -169,10 +177,14 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
-func (l *Lexer) skipComment() {
+// readComment reads a // comment up to, but not including, the end of
+// the line. A trailing carriage return is not part of the comment.
+func (l *Lexer) readComment() string {
+	position := l.position
 	for l.ch != '\n' && l.ch != 0 {
 		l.readChar()
 	}
+	return strings.TrimSuffix(l.input[position:l.position], "\r")
 }
 
 func (l *Lexer) readIdentifier() string {
@@ -229,6 +241,17 @@ func (l *Lexer) readString() string {
 	return result
 }
 
+// Unquote interprets the literal of a STRING token the way the generated
+// Go does: escapes follow Go, and literal line breaks are kept. A literal
+// with a malformed escape stands for itself.
+func Unquote(raw string) string {
+	escaped := strings.NewReplacer("\n", `\n`, "\r", `\r`).Replace(raw)
+	if value, err := strconv.Unquote(`"` + escaped + `"`); err == nil {
+		return value
+	}
+	return raw
+}
+
 func isLetter(ch rune) bool {
 	return unicode.IsLetter(ch) || ch == '_'
 }
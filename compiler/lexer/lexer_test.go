@@ -22,7 +22,8 @@ if x =~ /pattern/ {
 }
 // This is a comment
 "hello world"
-== != <= >= ->`
+== != <= >= ->
+fs.read(1.5)`
 
 	tests := []struct {
 		expectedType    TokenType
@@ -103,12 +104,19 @@ if x =~ /pattern/ {
 		{RPAREN, ")"},
 		{RBRACE, "}"},
 		{RBRACE, "}"},
+		{COMMENT, "// This is a comment"},
 		{STRING, "hello world"},
 		{EQ, "=="},
 		{NOT_EQ, "!="},
 		{LTE, "<="},
 		{GTE, ">="},
 		{ARROW, "->"},
+		{IDENT, "fs"},
+		{DOT, "."},
+		{IDENT, "read"},
+		{LPAREN, "("},
+		{FLOAT, "1.5"},
+		{RPAREN, ")"},
 		{EOF, ""},
 	}
 
@@ -127,4 +135,90 @@ if x =~ /pattern/ {
 				i, tt.expectedLiteral, tok.Literal)
 		}
 	}
+}
+
+func TestTokenAtEndOfInput(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    TokenType
+		expectedLiteral string
+	}{
+		{"count = 1", INT, "1"},
+		{"count = total", IDENT, "total"},
+		{"dance f = 2.5", FLOAT, "2.5"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+
+		var last Token
+		for tok := l.NextToken(); tok.Type != EOF; tok = l.NextToken() {
+			last = tok
+		}
+
+		if last.Type != tt.expectedType || last.Literal != tt.expectedLiteral {
+			t.Errorf("input %q: last token wrong. expected=%s %q, got=%s %q",
+				tt.input, tt.expectedType, tt.expectedLiteral, last.Type, last.Literal)
+		}
+	}
+}
+
+func TestTokenColumns(t *testing.T) {
+	input := `a =~ b == c <- d + "s"`
+
+	expected := []struct {
+		literal string
+		column  int
+	}{
+		{"a", 1}, {"=~", 3}, {"b", 6}, {"==", 8}, {"c", 11}, {"<-", 13}, {"d", 16}, {"+", 18}, {"s", 20},
+	}
+
+	l := New(input)
+	for i, want := range expected {
+		tok := l.NextToken()
+		if tok.Literal != want.literal || tok.Column != want.column {
+			t.Fatalf("tests[%d] - expected %q at column %d, got %q at column %d",
+				i, want.literal, want.column, tok.Literal, tok.Column)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "x = 1 // note\r\n  // own line\ny"
+
+	expected := []Token{
+		{Type: IDENT, Literal: "x", Line: 1, Column: 1},
+		{Type: ASSIGN, Literal: "=", Line: 1, Column: 3},
+		{Type: INT, Literal: "1", Line: 1, Column: 5},
+		{Type: COMMENT, Literal: "// note", Line: 1, Column: 7},
+		{Type: COMMENT, Literal: "// own line", Line: 2, Column: 3},
+		{Type: IDENT, Literal: "y", Line: 3, Column: 1},
+	}
+
+	l := New(input)
+	for i, want := range expected {
+		if tok := l.NextToken(); tok != want {
+			t.Fatalf("tests[%d] - expected %+v, got %+v", i, want, tok)
+		}
+	}
+}
+func TestUnquote(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected string
+	}{
+		{`plain`, "plain"},
+		{`tab\there`, "tab\there"},
+		{`quote \" and \\`, `quote " and \`},
+		{"two\nlines", "two\nlines"},
+		{"crlf\r\n", "crlf\r\n"},
+		{`é`, "é"},
+		{`bad \q escape`, `bad \q escape`},
+	}
+
+	for _, tt := range tests {
+		if got := Unquote(tt.raw); got != tt.expected {
+			t.Errorf("Unquote(%q) = %q, want %q", tt.raw, got, tt.expected)
+		}
+	}
 }
\ No newline at end of file
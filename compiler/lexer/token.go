@@ -6,6 +6,8 @@ const (
 	ILLEGAL TokenType = iota
 	EOF
 	
+	COMMENT // a // comment, up to the end of the line
+	
 	// Literals
 	IDENT
 	INT
@@ -33,6 +35,7 @@ const (
 	COMMA
 	SEMICOLON
 	COLON
+	DOT
 	LPAREN
 	RPAREN
 	LBRACE
@@ -57,6 +60,8 @@ const (
 	FUNCTION   // function
 	TRUE       // true
 	FALSE      // false
+	REHEARSE   // rehearse (test declaration)
+	ENCORE     // encore (benchmark declaration)
 )
 
 var keywords = map[string]TokenType{
@@ -76,6 +81,8 @@ var keywords = map[string]TokenType{
 	"function": FUNCTION,
 	"true":     TRUE,
 	"false":    FALSE,
+	"rehearse": REHEARSE,
+	"encore":   ENCORE,
 }
 
 type Token struct {
@@ -98,6 +105,8 @@ func (t TokenType) String() string {
 		return "ILLEGAL"
 	case EOF:
 		return "EOF"
+	case COMMENT:
+		return "COMMENT"
 	case IDENT:
 		return "IDENT"
 	case INT:
@@ -142,6 +151,8 @@ func (t TokenType) String() string {
 		return ";"
 	case COLON:
 		return ":"
+	case DOT:
+		return "."
 	case LPAREN:
 		return "("
 	case RPAREN:
@@ -186,6 +197,10 @@ func (t TokenType) String() string {
 		return "true"
 	case FALSE:
 		return "false"
+	case REHEARSE:
+		return "rehearse"
+	case ENCORE:
+		return "encore"
 	default:
 		return "UNKNOWN"
 	}
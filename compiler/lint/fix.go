@@ -0,0 +1,70 @@
+package lint
+
+import (
+	"sort"
+	"strings"
+)
+
+// ApplyFixes applies the fixes of diagnostics to source. A fix whose edits
+// overlap one applied before it is skipped whole, so the result never mixes
+// half of two changes. It returns the new source and the diagnostics that
+// remain: those without a fix or whose fix was skipped.
+func ApplyFixes(source []byte, diagnostics []Diagnostic) ([]byte, []Diagnostic) {
+	lines := strings.SplitAfter(string(source), "\n")
+	offset := func(line, column int) int {
+		if line > len(lines) {
+			return len(source)
+		}
+		start := 0
+		for _, l := range lines[:line-1] {
+			start += len(l)
+		}
+		return start + runeOffset([]byte(strings.TrimRight(lines[line-1], "\n")), column)
+	}
+	
+	type span struct {
+		start, end int
+		text       string
+	}
+	var spans []span
+	overlaps := func(s span) bool {
+		for _, t := range spans {
+			if s.start < t.end && t.start < s.end || s.start == t.start {
+				return true
+			}
+		}
+		return false
+	}
+	
+	remaining := []Diagnostic{}
+	for _, d := range diagnostics {
+		if d.Fix == nil {
+			remaining = append(remaining, d)
+			continue
+		}
+		
+		var fix []span
+		ok := true
+		for _, e := range d.Fix.Edits {
+			s := span{offset(e.Line, e.Column), offset(e.EndLine, e.EndColumn), e.NewText}
+			if overlaps(s) {
+				ok = false
+				break
+			}
+			fix = append(fix, s)
+		}
+		if !ok {
+			remaining = append(remaining, d)
+			continue
+		}
+		spans = append(spans, fix...)
+	}
+	
+	// Apply from the end, so earlier offsets stay valid
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start > spans[j].start })
+	out := string(source)
+	for _, s := range spans {
+		out = out[:s.start] + s.text + out[s.end:]
+	}
+	return []byte(out), remaining
+}
\ No newline at end of file
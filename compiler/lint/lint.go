@@ -0,0 +1,295 @@
+// Package lint checks ChoreLang programs for style problems and likely
+// mistakes. Each check is a Rule; a Linter runs a set of them over a
+// resolved program and collects their diagnostics:
+//
+//	3:7: variable "total" is declared but never used (unused)
+//
+// Rules may attach a Fix, a set of source edits that resolves the
+// diagnostic, which `chorelang lint -fix` applies.
+//
+// A comment of the form
+//
+//	// lint:ignore rule[,rule...] reason
+//
+// silences the named rules for the statement it precedes, or for its own
+// line when it ends a statement.
+package lint
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/resolver"
+)
+
+// Diagnostic is one problem found by a rule. Line and Column locate it as
+// lexer tokens do, counting from 1.
+type Diagnostic struct {
+	Line, Column int
+	Rule         string
+	Message      string
+	Fix          *Fix // nil when the rule has no suggestion
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s (%s)", d.Line, d.Column, d.Message, d.Rule)
+}
+
+// Fix is a suggested change that resolves a diagnostic.
+type Fix struct {
+	Message string // what the fix does, e.g. `rename to "count2"`
+	Edits   []Edit
+}
+
+// Edit replaces the source from Line:Column up to, but not including,
+// EndLine:EndColumn with NewText.
+type Edit struct {
+	Line, Column       int
+	EndLine, EndColumn int
+	NewText            string
+}
+
+// Rule is one check. Name identifies it in chore.json and in lint:ignore
+// comments.
+type Rule interface {
+	Name() string
+	Doc() string // one line describing what the rule reports
+	Check(pass *Pass)
+}
+
+// Config is the "lint" section of chore.json:
+//
+//	"lint": {"disable": ["camel-case"]}
+type Config struct {
+	// Disable lists rules that are not run
+	Disable []string `json:"disable"`
+}
+
+// Linter runs a set of rules.
+type Linter struct {
+	rules []Rule
+}
+
+// New returns a linter running rules, less those cfg disables. Disabling a
+// rule that does not exist is an error, which catches typos.
+func New(cfg Config, rules []Rule) (*Linter, error) {
+	disabled := make(map[string]bool)
+	for _, name := range cfg.Disable {
+		disabled[name] = true
+	}
+	
+	l := &Linter{}
+	for _, rule := range rules {
+		if disabled[rule.Name()] {
+			delete(disabled, rule.Name())
+			continue
+		}
+		l.rules = append(l.rules, rule)
+	}
+	
+	for _, name := range cfg.Disable {
+		if disabled[name] {
+			return nil, fmt.Errorf("unknown lint rule %q", name)
+		}
+	}
+	return l, nil
+}
+
+// Rules returns the rules the linter runs.
+func (l *Linter) Rules() []Rule {
+	return l.rules
+}
+
+// Check resolves program and runs the rules over it, returning their
+// diagnostics in source order. Source is the text program was parsed from;
+// rules read it to build fixes. Check fails if the program does not
+// resolve, since the rules rely on its bindings.
+func (l *Linter) Check(program *ast.Program, source []byte) ([]Diagnostic, error) {
+	r := resolver.New()
+	r.Resolve(program)
+	if errs := r.Errors(); len(errs) > 0 {
+		return nil, errors.New(strings.Join(errs, "\n"))
+	}
+	
+	pass := newPass(program, source, r)
+	for _, rule := range l.rules {
+		pass.rule = rule.Name()
+		rule.Check(pass)
+	}
+	
+	ignored := ignores(program)
+	diagnostics := []Diagnostic{}
+	for _, d := range pass.diagnostics {
+		if !ignored[d.Line][d.Rule] {
+			diagnostics = append(diagnostics, *d)
+		}
+	}
+	
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return diagnostics, nil
+}
+
+// Pass is what a rule sees of the program being checked.
+type Pass struct {
+	Program  *ast.Program
+	Source   []byte
+	Resolver *resolver.Resolver
+	
+	rule        string
+	reads       map[*resolver.Binding][]*ast.Identifier
+	writes      map[*resolver.Binding][]*ast.Identifier
+	names       map[string]bool
+	diagnostics []*Diagnostic
+}
+
+func newPass(program *ast.Program, source []byte, r *resolver.Resolver) *Pass {
+	pass := &Pass{
+		Program:  program,
+		Source:   source,
+		Resolver: r,
+		reads:    make(map[*resolver.Binding][]*ast.Identifier),
+		writes:   make(map[*resolver.Binding][]*ast.Identifier),
+		names:    make(map[string]bool),
+	}
+	
+	targets := make(map[*ast.Identifier]bool)
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.AssignStatement:
+			targets[n.Name] = true
+		case *ast.Identifier:
+			pass.names[n.Value] = true
+			b := r.BindingOf(n)
+			switch {
+			case b == nil || b.Decl == n:
+			case targets[n]:
+				pass.writes[b] = append(pass.writes[b], n)
+			default:
+				pass.reads[b] = append(pass.reads[b], n)
+			}
+		}
+		return true
+	})
+	return pass
+}
+
+// Reads returns the identifiers that read b's value, in source order.
+func (p *Pass) Reads(b *resolver.Binding) []*ast.Identifier {
+	return p.reads[b]
+}
+
+// Writes returns the identifiers that assign to b with `b = ...`.
+func (p *Pass) Writes(b *resolver.Binding) []*ast.Identifier {
+	return p.writes[b]
+}
+
+// Report records a diagnostic for the current rule at tok. The returned
+// diagnostic may be given a Fix.
+func (p *Pass) Report(tok lexer.Token, format string, args ...interface{}) *Diagnostic {
+	d := &Diagnostic{
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Rule:    p.rule,
+		Message: fmt.Sprintf(format, args...),
+	}
+	p.diagnostics = append(p.diagnostics, d)
+	return d
+}
+
+// FreshName returns a name based on base that no identifier in the program
+// uses: base2, base3 and so on.
+func (p *Pass) FreshName(base string) string {
+	for i := 2; ; i++ {
+		name := fmt.Sprintf("%s%d", base, i)
+		if !p.names[name] {
+			return name
+		}
+	}
+}
+
+// Rename returns a fix that renames b, at its declaration and at every use,
+// to name.
+func (p *Pass) Rename(b *resolver.Binding, name string) *Fix {
+	fix := &Fix{Message: fmt.Sprintf("rename to %q", name)}
+	idents := append([]*ast.Identifier{b.Decl}, p.reads[b]...)
+	idents = append(idents, p.writes[b]...)
+	for _, ident := range idents {
+		fix.Edits = append(fix.Edits, replaceToken(ident.Token, name))
+	}
+	return fix
+}
+
+// replaceToken is an edit replacing a one-line token whose literal is its
+// source text, as for names and numbers.
+func replaceToken(tok lexer.Token, text string) Edit {
+	end := tok.Column + len([]rune(tok.Literal))
+	return Edit{Line: tok.Line, Column: tok.Column, EndLine: tok.Line, EndColumn: end, NewText: text}
+}
+
+// ignores collects the lint:ignore comments of a program, by line and rule.
+func ignores(program *ast.Program) map[int]map[string]bool {
+	ignored := make(map[int]map[string]bool)
+	add := func(line int, c *ast.Comment) {
+		fields := strings.Fields(strings.TrimPrefix(c.Text, "//"))
+		if len(fields) < 2 || fields[0] != "lint:ignore" {
+			return
+		}
+		if ignored[line] == nil {
+			ignored[line] = make(map[string]bool)
+		}
+		for _, rule := range strings.Split(fields[1], ",") {
+			ignored[line][rule] = true
+		}
+	}
+	
+	for node, trivia := range program.Trivia {
+		for _, c := range trivia.Leading {
+			if tok, ok := tokenOf(node); ok {
+				add(tok.Line, c)
+			}
+		}
+		if c := trivia.Trailing; c != nil {
+			add(c.Token.Line, c)
+		}
+	}
+	return ignored
+}
+
+// tokenOf returns the first token of a statement or case.
+func tokenOf(node ast.Node) (lexer.Token, bool) {
+	switch n := node.(type) {
+	case *ast.DanceStatement:
+		return n.Token, true
+	case *ast.AssignStatement:
+		return n.Token, true
+	case *ast.ExpressionStatement:
+		return n.Token, true
+	case *ast.SwayStatement:
+		return n.Token, true
+	case *ast.StartStatement:
+		return n.Token, true
+	case *ast.SendStatement:
+		return n.Token, true
+	case *ast.IfStatement:
+		return n.Token, true
+	case *ast.RehearseStatement:
+		return n.Token, true
+	case *ast.EncoreStatement:
+		return n.Token, true
+	case *ast.BlockStatement:
+		return n.Token, true
+	case *ast.WhenCase:
+		return n.Token, true
+	}
+	return lexer.Token{}, false
+}
\ No newline at end of file
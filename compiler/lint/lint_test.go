@@ -0,0 +1,237 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	return program
+}
+
+func check(t *testing.T, cfg Config, input string) []Diagnostic {
+	t.Helper()
+	l, err := New(cfg, Default())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	diagnostics, err := l.Check(parse(t, input), []byte(input))
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	return diagnostics
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			"unused",
+			"dance x = 1\ndance y = 2\nspin print(y)\n",
+			[]string{`1:7: variable "x" is declared but never used (unused)`},
+		},
+		{
+			"assigned but never read",
+			"dance x = 1\nx = 2\n",
+			[]string{`1:7: variable "x" is assigned but never read (unused)`},
+		},
+		{
+			"underscore is meant to be unused",
+			"dance _ignored = spin args()\n",
+			nil,
+		},
+		{
+			"shadow",
+			"dance a = 1\nif true {\n    dance a = 2\n    spin print(a)\n}\nspin print(a)\n",
+			[]string{`3:11: dance "a" shadows variable declared at 1:7 (shadow)`},
+		},
+		{
+			"sway range",
+			"sway i from 10 to 1 {\n    spin print(i)\n}\nsway j from 1 to 1 {\n    spin print(j)\n}\n",
+			[]string{`1:1: sway from 10 to 1 never runs; sway counts up (sway-range)`},
+		},
+		{
+			"unreceived send",
+			"flow channel<int> ch\nstart send ch <- 1\n",
+			[]string{`2:7: send on "ch", but nothing ever receives from it; the send blocks forever (unreceived-send)`},
+		},
+		{
+			"received send",
+			"flow channel<int> ch\nstart send ch <- 1\nspin print(<-ch)\n",
+			nil,
+		},
+		{
+			"escaping channel is not judged",
+			"flow channel<int> ch\ndance alias = ch\nstart send ch <- 1\nspin print(<-alias)\n",
+			nil,
+		},
+		{
+			"match without fallback",
+			"dance x = 1\ndance y = match x {\n    when 1: flow \"one\"\n}\nspin print(y)\n",
+			[]string{"2:11: match on \"x\" has no fallback case; end with `when x: ...` to handle other values (match-fallback)"},
+		},
+		{
+			"match with fallback",
+			"dance x = 1\ndance y = match x {\n    when 1: flow \"one\"\n    when x: flow \"other\"\n}\nspin print(y)\n",
+			nil,
+		},
+		{
+			"camel case",
+			"dance max_size = 1\nsway Index from 0 to max_size {\n    spin print(Index)\n}\n",
+			[]string{
+				`1:7: variable "max_size" should be camelCase: "maxSize" (camel-case)`,
+				`2:6: loop variable "Index" should be camelCase: "index" (camel-case)`,
+			},
+		},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, d := range check(t, Config{}, tt.input) {
+				got = append(got, d.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("diagnostics wrong.\nwant:\n%s\ngot:\n%s",
+					strings.Join(tt.expected, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestFixes(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"unused pure value is deleted",
+			"dance x = 1 // not needed\nspin print(\"hi\")\n",
+			"spin print(\"hi\")\n",
+		},
+		{
+			"unused call keeps its effect",
+			"dance n = spin args()\n",
+			"spin args()\n",
+		},
+		{
+			"shadow is renamed",
+			"dance a = 1\nif true {\n    dance a = 2\n    a = a + 1\n    spin print(a)\n}\nspin print(a)\n",
+			"dance a = 1\nif true {\n    dance a2 = 2\n    a2 = a2 + 1\n    spin print(a2)\n}\nspin print(a)\n",
+		},
+		{
+			"names become camel case",
+			"dance total_count = 1\nspin print(total_count)\n",
+			"dance totalCount = 1\nspin print(totalCount)\n",
+		},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixed, remaining := ApplyFixes([]byte(tt.input), check(t, Config{}, tt.input))
+			if string(fixed) != tt.expected {
+				t.Errorf("fixed source wrong.\nwant:\n%s\ngot:\n%s", tt.expected, fixed)
+			}
+			if len(remaining) != 0 {
+				t.Errorf("expected every diagnostic fixed, left %v", remaining)
+			}
+			if again := check(t, Config{}, string(fixed)); len(again) != 0 {
+				t.Errorf("fixed source still has diagnostics: %v", again)
+			}
+		})
+	}
+}
+
+func TestSwayRangeHasNoFix(t *testing.T) {
+	// Swapping the bounds would run a loop that never ran
+	input := "sway i from 10 to 1 {\n    spin print(i)\n}\n"
+	diagnostics := check(t, Config{}, input)
+	if len(diagnostics) != 1 || diagnostics[0].Fix != nil {
+		t.Fatalf("expected one sway-range diagnostic without a fix, got %v", diagnostics)
+	}
+	if fixed, _ := ApplyFixes([]byte(input), diagnostics); string(fixed) != input {
+		t.Errorf("-fix changed the loop:\n%s", fixed)
+	}
+}
+
+func TestOverlappingFixesApplyOnce(t *testing.T) {
+	// camel-case and shadow both rename the inner my_x
+	input := "dance my_x = 1\nif true {\n    dance my_x = 2\n    spin print(my_x)\n}\nspin print(my_x)\n"
+	diagnostics := check(t, Config{}, input)
+	
+	fixed, remaining := ApplyFixes([]byte(input), diagnostics)
+	if len(remaining) == 0 {
+		t.Fatalf("expected a fix to be skipped")
+	}
+	if strings.Count(string(fixed), "myX") != 2 {
+		t.Errorf("expected the outer binding renamed once, got:\n%s", fixed)
+	}
+}
+
+func TestIgnoreComments(t *testing.T) {
+	input := `// lint:ignore unused kept for the next release
+dance spare = 1
+dance other = 2 // lint:ignore unused,camel-case
+dance snake_name = 3 // lint:ignore unused
+`
+	var got []string
+	for _, d := range check(t, Config{}, input) {
+		got = append(got, d.String())
+	}
+	expected := `4:7: variable "snake_name" should be camelCase: "snakeName" (camel-case)`
+	if strings.Join(got, "\n") != expected {
+		t.Errorf("diagnostics wrong.\nwant:\n%s\ngot:\n%s", expected, strings.Join(got, "\n"))
+	}
+}
+
+func TestConfigDisablesRules(t *testing.T) {
+	if got := check(t, Config{Disable: []string{"unused", "camel-case"}}, "dance snake_name = 1\n"); len(got) != 0 {
+		t.Errorf("expected no diagnostics with the rules disabled, got %v", got)
+	}
+	
+	if _, err := New(Config{Disable: []string{"unsued"}}, Default()); err == nil ||
+		err.Error() != `unknown lint rule "unsued"` {
+		t.Errorf("expected an unknown rule error, got %v", err)
+	}
+}
+
+func TestCheckNeedsAResolvedProgram(t *testing.T) {
+	l, _ := New(Config{}, Default())
+	input := "x = 1\n"
+	if _, err := l.Check(parse(t, input), []byte(input)); err == nil ||
+		!strings.Contains(err.Error(), `cannot assign to undeclared "x"`) {
+		t.Errorf("expected the resolver error, got %v", err)
+	}
+}
+
+func TestCamelCase(t *testing.T) {
+	tests := map[string]string{
+		"count":      "count",
+		"max_size":   "maxSize",
+		"MAX_SIZE":   "maxSize",
+		"MaxSize":    "maxSize",
+		"HTTPServer": "httpServer",
+		"_tmp_value": "_tmpValue",
+		"_":          "_",
+		"X":          "x",
+	}
+	for input, expected := range tests {
+		if got := camelCase(input); got != expected {
+			t.Errorf("camelCase(%q) = %q, want %q", input, got, expected)
+		}
+	}
+}
\ No newline at end of file
@@ -0,0 +1,342 @@
+package lint
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/format"
+	"github.com/chorlang/chorlang/compiler/resolver"
+)
+
+// rule is a Rule made of a name, a doc line and a check function.
+type rule struct {
+	name  string
+	doc   string
+	check func(*Pass)
+}
+
+func (r *rule) Name() string     { return r.name }
+func (r *rule) Doc() string      { return r.doc }
+func (r *rule) Check(pass *Pass) { r.check(pass) }
+
+// Default returns the built-in rules.
+func Default() []Rule {
+	return []Rule{
+		&rule{"unused", "a dance or flow whose value is never read", checkUnused},
+		&rule{"shadow", "a declaration that hides a binding from an enclosing block", checkShadow},
+		&rule{"sway-range", "a sway whose from is greater than its to, so it never runs", checkSwayRange},
+		&rule{"unreceived-send", "a send on a channel nothing ever receives from", checkUnreceivedSend},
+		&rule{"match-fallback", "a match without a last case that catches every value", checkMatchFallback},
+		&rule{"camel-case", "a name that is not camelCase", checkCamelCase},
+	}
+}
+
+// checkUnused reports bindings that are never read. Names starting with an
+// underscore are meant to be unused.
+func checkUnused(pass *Pass) {
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		s, ok := node.(*ast.DanceStatement)
+		if !ok {
+			return true
+		}
+		b := pass.Resolver.BindingOf(s.Name)
+		if b == nil || strings.HasPrefix(b.Name, "_") || len(pass.Reads(b)) > 0 {
+			return true
+		}
+		
+		if len(pass.Writes(b)) > 0 {
+			pass.Report(s.Name.Token, "%s %q is assigned but never read", b.Kind, b.Name)
+			return true
+		}
+		d := pass.Report(s.Name.Token, "%s %q is declared but never used", b.Kind, b.Name)
+		if hasEffects(s.Value) {
+			d.Fix = unbindFix(pass, s)
+		} else {
+			d.Fix = deleteLineFix(pass, s)
+		}
+		return true
+	})
+}
+
+// hasEffects reports whether evaluating exp can do more than produce a
+// value: call a function or a member, or receive.
+func hasEffects(exp ast.Expression) bool {
+	effects := false
+	ast.Inspect(exp, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.SpinExpression, *ast.MemberCallExpression, *ast.ReceiveExpression:
+			effects = true
+		}
+		return !effects
+	})
+	return effects
+}
+
+// unbindFix turns `dance x = value` into the expression statement `value`,
+// if the source spells the declaration out as expected.
+func unbindFix(pass *Pass, s *ast.DanceStatement) *Fix {
+	line, ok := sourceLine(pass.Source, s.Token.Line)
+	if !ok {
+		return nil
+	}
+	rest := string(line[runeOffset(line, s.Token.Column):])
+	
+	prefix := regexp.MustCompile(`^` + s.Token.Literal + `[ \t]+` + regexp.QuoteMeta(s.Name.Value) + `[ \t]*=[ \t]*`)
+	m := prefix.FindString(rest)
+	if m == "" {
+		return nil
+	}
+	return &Fix{
+		Message: "remove the binding and keep the value",
+		Edits: []Edit{{
+			Line: s.Token.Line, Column: s.Token.Column,
+			EndLine: s.Token.Line, EndColumn: s.Token.Column + len([]rune(m)),
+		}},
+	}
+}
+
+// deleteLineFix removes the line holding s, if s is alone on it apart from
+// a trailing comment.
+func deleteLineFix(pass *Pass, s ast.Statement) *Fix {
+	tok, _ := tokenOf(s)
+	line, ok := sourceLine(pass.Source, tok.Line)
+	if !ok {
+		return nil
+	}
+	if c := pass.Program.TriviaOf(s).Trailing; c != nil {
+		line = line[:runeOffset(line, c.Token.Column)]
+	}
+	
+	printed := format.Program(&ast.Program{Statements: []ast.Statement{s}})
+	if strings.TrimSpace(string(line)) != strings.TrimSpace(string(printed)) {
+		return nil
+	}
+	return &Fix{
+		Message: "remove the declaration",
+		Edits:   []Edit{{Line: tok.Line, Column: 1, EndLine: tok.Line + 1, EndColumn: 1}},
+	}
+}
+
+// checkShadow reports declarations that hide an outer binding, as the
+// resolver warns, and suggests a fresh name.
+func checkShadow(pass *Pass) {
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		var decl *ast.Identifier
+		keyword := "dance"
+		switch s := node.(type) {
+		case *ast.DanceStatement:
+			decl, keyword = s.Name, s.Token.Literal
+		case *ast.SwayStatement:
+			decl, keyword = s.Variable, "sway"
+		default:
+			return true
+		}
+		
+		b := pass.Resolver.BindingOf(decl)
+		if b == nil {
+			return true
+		}
+		outer := pass.Resolver.Shadowed(b)
+		if outer == nil {
+			return true
+		}
+		d := pass.Report(decl.Token, "%s %q shadows %s declared at %d:%d",
+			keyword, b.Name, outer.Kind, outer.Decl.Token.Line, outer.Decl.Token.Column)
+		d.Fix = pass.Rename(b, pass.FreshName(b.Name))
+		return true
+	})
+}
+
+// checkSwayRange reports loops over literal bounds that count down. Sway
+// only counts up, so they never run. There is no fix: swapping the bounds
+// would make a loop that never ran run, which only the author can decide.
+func checkSwayRange(pass *Pass) {
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		s, ok := node.(*ast.SwayStatement)
+		if !ok {
+			return true
+		}
+		from, ok1 := s.From.(*ast.IntegerLiteral)
+		to, ok2 := s.To.(*ast.IntegerLiteral)
+		if !ok1 || !ok2 || from.Value <= to.Value {
+			return true
+		}
+		
+		pass.Report(s.Token, "sway from %d to %d never runs; sway counts up", from.Value, to.Value)
+		return true
+	})
+}
+
+// checkUnreceivedSend reports sends on a channel that is never received
+// from. Channels are unbuffered, so such a send blocks its dancer forever.
+// A channel used in any other way may be received from elsewhere, and is
+// left alone.
+func checkUnreceivedSend(pass *Pass) {
+	sends := make(map[*resolver.Binding][]*ast.SendStatement)
+	var order []*resolver.Binding
+	used := make(map[*ast.Identifier]bool)
+	received := make(map[*resolver.Binding]bool)
+	
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.SendStatement:
+			if ident, ok := n.Channel.(*ast.Identifier); ok {
+				if b := pass.Resolver.BindingOf(ident); b != nil && b.Kind == resolver.Channel {
+					if sends[b] == nil {
+						order = append(order, b)
+					}
+					sends[b] = append(sends[b], n)
+					used[ident] = true
+				}
+			}
+		case *ast.ReceiveExpression:
+			if ident, ok := n.Channel.(*ast.Identifier); ok {
+				if b := pass.Resolver.BindingOf(ident); b != nil {
+					received[b] = true
+				}
+			}
+		}
+		return true
+	})
+	
+	for _, b := range order {
+		if received[b] || escapes(pass, b, used) {
+			continue
+		}
+		for _, s := range sends[b] {
+			pass.Report(s.Token, "send on %q, but nothing ever receives from it; the send blocks forever", b.Name)
+		}
+	}
+}
+
+// escapes reports whether b is read other than by the uses given.
+func escapes(pass *Pass, b *resolver.Binding, used map[*ast.Identifier]bool) bool {
+	for _, ident := range pass.Reads(b) {
+		if !used[ident] {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMatchFallback reports matches that can end without a case matching,
+// which gives no value. A case whose pattern is the subject itself, as in
+// `when x:` for `match x`, matches every value.
+func checkMatchFallback(pass *Pass) {
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		m, ok := node.(*ast.MatchExpression)
+		if !ok {
+			return true
+		}
+		subject, ok := m.Expression.(*ast.Identifier)
+		if !ok {
+			pass.Report(m.Token, "match has no fallback case; bind the subject with dance and end with `when name: ...`")
+			return true
+		}
+		
+		for _, c := range m.Cases {
+			if pattern, ok := c.Pattern.(*ast.Identifier); ok && c.Parameters == nil && pattern.Value == subject.Value {
+				return true
+			}
+		}
+		pass.Report(m.Token, "match on %q has no fallback case; end with `when %s: ...` to handle other values",
+			subject.Value, subject.Value)
+		return true
+	})
+}
+
+// checkCamelCase reports declared names that are not camelCase, such as
+// snake_case or capitalized names. Leading underscores are kept.
+func checkCamelCase(pass *Pass) {
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		var decl *ast.Identifier
+		switch s := node.(type) {
+		case *ast.DanceStatement:
+			decl = s.Name
+		case *ast.SwayStatement:
+			decl = s.Variable
+		default:
+			return true
+		}
+		
+		b := pass.Resolver.BindingOf(decl)
+		if b == nil || b.Decl != decl {
+			return true
+		}
+		want := camelCase(b.Name)
+		if want == b.Name {
+			return true
+		}
+		d := pass.Report(decl.Token, "%s %q should be camelCase: %q", b.Kind, b.Name, want)
+		if !pass.names[want] {
+			d.Fix = pass.Rename(b, want)
+		}
+		return true
+	})
+}
+
+// camelCase converts a name to camelCase: max_size, MAX_SIZE and MaxSize
+// all become maxSize, and HTTPServer becomes httpServer.
+func camelCase(name string) string {
+	trimmed := strings.TrimLeft(name, "_")
+	lead := name[:len(name)-len(trimmed)]
+	if trimmed == "" {
+		return name
+	}
+	shouting := strings.ToUpper(trimmed) == trimmed
+	
+	var out strings.Builder
+	out.WriteString(lead)
+	for i, part := range strings.FieldsFunc(trimmed, func(r rune) bool { return r == '_' }) {
+		if shouting {
+			part = strings.ToLower(part)
+		}
+		runes := []rune(part)
+		if i == 0 {
+			lowerInitials(runes)
+		} else {
+			runes[0] = unicode.ToUpper(runes[0])
+		}
+		out.WriteString(string(runes))
+	}
+	return out.String()
+}
+
+// lowerInitials lowers the leading capitals of a word, leaving the last one
+// if it starts the next word, as the S in HTTPServer does.
+func lowerInitials(runes []rune) {
+	n := 0
+	for n < len(runes) && unicode.IsUpper(runes[n]) {
+		n++
+	}
+	if n > 1 && n < len(runes) {
+		n--
+	}
+	for i := 0; i < n; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+}
+
+// sourceLine returns the text of a line, without its newline.
+func sourceLine(source []byte, line int) ([]byte, bool) {
+	lines := strings.SplitAfter(string(source), "\n")
+	if line < 1 || line > len(lines) {
+		return nil, false
+	}
+	return []byte(strings.TrimRight(lines[line-1], "\r\n")), true
+}
+
+// runeOffset returns the byte offset of a 1-based column in line, or the
+// end of the line if it is shorter.
+func runeOffset(line []byte, column int) int {
+	col := 1
+	for i := range string(line) {
+		if col == column {
+			return i
+		}
+		col++
+	}
+	return len(line)
+}
\ No newline at end of file
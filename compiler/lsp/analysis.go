@@ -0,0 +1,212 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/lint"
+	"github.com/chorlang/chorlang/compiler/parser"
+	"github.com/chorlang/chorlang/compiler/resolver"
+)
+
+// analysis is what the server knows of one version of a document. A text
+// that does not parse has only its tokens and syntax errors; the rest needs
+// a whole tree.
+type analysis struct {
+	doc         *document
+	tokens      []lexer.Token // every token, comments included, up to EOF
+	diagnostics []diagnostic
+	
+	program  *ast.Program
+	resolver *resolver.Resolver
+	idents   []*ast.Identifier                             // every identifier, in source order
+	types    map[*ast.Identifier]bool                      // those naming types, as in channel<int>
+	members  map[*ast.Identifier]*ast.MemberCallExpression // those naming members, by their calls
+	values   map[*resolver.Binding]ast.Expression          // what each dance and flow was declared with
+	closing  map[lexer.Token]lexer.Token                   // the } of each {
+	
+	bindingTypes map[*resolver.Binding]string
+}
+
+// analyze lexes, parses, resolves and checks the document's text. The
+// linter's findings are reported as warnings; it may be nil.
+func analyze(doc *document, linter *lint.Linter) *analysis {
+	a := &analysis{
+		doc:          doc,
+		types:        make(map[*ast.Identifier]bool),
+		members:      make(map[*ast.Identifier]*ast.MemberCallExpression),
+		values:       make(map[*resolver.Binding]ast.Expression),
+		closing:      make(map[lexer.Token]lexer.Token),
+		bindingTypes: make(map[*resolver.Binding]string),
+	}
+	
+	l := lexer.New(doc.text)
+	var open []lexer.Token
+	for {
+		tok := l.NextToken()
+		a.tokens = append(a.tokens, tok)
+		switch tok.Type {
+		case lexer.LBRACE:
+			open = append(open, tok)
+		case lexer.RBRACE:
+			if len(open) > 0 {
+				a.closing[open[len(open)-1]] = tok
+				open = open[:len(open)-1]
+			}
+		}
+		if tok.Type == lexer.EOF {
+			break
+		}
+	}
+	
+	p := parser.New(lexer.New(doc.text))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		for _, err := range errs {
+			a.reportMessage(severityError, err)
+		}
+		a.sort()
+		return a
+	}
+	
+	a.program = program
+	a.resolver = resolver.New()
+	a.resolver.Resolve(program)
+	for _, err := range a.resolver.Errors() {
+		a.reportMessage(severityError, err)
+	}
+	
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.Identifier:
+			a.idents = append(a.idents, n)
+		case *ast.DanceStatement:
+			if b := a.resolver.BindingOf(n.Name); b != nil && b.Decl == n.Name {
+				a.values[b] = n.Value
+			}
+		case *ast.MemberCallExpression:
+			a.members[n.Member] = n
+		case *ast.FlowExpression:
+			if ident, ok := n.ChannelType.(*ast.Identifier); ok && ident.Value == "channel" && a.resolver.BindingOf(ident) == nil {
+				a.types[ident] = true
+			}
+			if n.ElementType != nil {
+				a.types[n.ElementType] = true
+			}
+		}
+		return true
+	})
+	sort.SliceStable(a.idents, func(i, j int) bool {
+		return before(a.idents[i].Token, a.idents[j].Token)
+	})
+	
+	a.check()
+	if linter != nil && len(a.resolver.Errors()) == 0 {
+		found, err := linter.Check(program, []byte(doc.text))
+		if err == nil {
+			for _, d := range found {
+				a.report(severityWarning, d.Rule, d.Line, d.Column, "%s", d.Message)
+			}
+		}
+	}
+	a.sort()
+	return a
+}
+
+// positioned matches the errors of the parser and resolver, which start
+// with the line and column they are at.
+var positioned = regexp.MustCompile(`(?s)^(\d+):(\d+): (.*)$`)
+
+func (a *analysis) reportMessage(severity int, message string) {
+	m := positioned.FindStringSubmatch(message)
+	if m == nil {
+		a.report(severity, "", 1, 1, "%s", message)
+		return
+	}
+	line, _ := strconv.Atoi(m[1])
+	column, _ := strconv.Atoi(m[2])
+	a.report(severity, "", line, column, "%s", m[3])
+}
+
+// report records a diagnostic covering the token at line and column.
+func (a *analysis) report(severity int, code string, line, column int, format string, args ...interface{}) {
+	length := 0
+	if tok, ok := a.tokenAt(line, column); ok && tok.Line == line && tok.Column == column {
+		length = tokenLength(tok)
+	}
+	a.diagnostics = append(a.diagnostics, diagnostic{
+		Range:    a.doc.span(line, column, length),
+		Severity: severity,
+		Code:     code,
+		Source:   "chorelang",
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (a *analysis) sort() {
+	sort.SliceStable(a.diagnostics, func(i, j int) bool {
+		p, q := a.diagnostics[i].Range.Start, a.diagnostics[j].Range.Start
+		return p.Line < q.Line || p.Line == q.Line && p.Character < q.Character
+	})
+}
+
+// tokenAt returns the token covering line and column, or that ends just
+// before it, so that a cursor at the end of a name finds the name.
+func (a *analysis) tokenAt(line, column int) (lexer.Token, bool) {
+	var ending lexer.Token
+	found := false
+	for _, tok := range a.tokens {
+		if tok.Type == lexer.EOF || tok.Line > line || tok.Line == line && tok.Column > column {
+			break
+		}
+		if tok.Line != line {
+			continue
+		}
+		switch end := tok.Column + tokenLength(tok); {
+		case column < end:
+			return tok, true
+		case column == end:
+			ending, found = tok, true
+		}
+	}
+	return ending, found
+}
+
+// identAt returns the identifier at a protocol position, or nil.
+func (a *analysis) identAt(p position) *ast.Identifier {
+	line, column := a.doc.column(p)
+	for _, ident := range a.idents {
+		tok := ident.Token
+		if tok.Line == line && tok.Column <= column && column <= tok.Column+utf8.RuneCountInString(ident.Value) {
+			return ident
+		}
+	}
+	return nil
+}
+
+// identSpan is the range an identifier covers.
+func (a *analysis) identSpan(ident *ast.Identifier) span {
+	return a.doc.span(ident.Token.Line, ident.Token.Column, utf8.RuneCountInString(ident.Value))
+}
+
+// tokenLength is how many runes of source a token covers. A string spans
+// its quotes; one running over several lines is counted to the end of its
+// first.
+func tokenLength(tok lexer.Token) int {
+	switch tok.Type {
+	case lexer.EOF:
+		return 0
+	case lexer.STRING:
+		return utf8.RuneCountInString(tok.Literal) + 2
+	}
+	return utf8.RuneCountInString(tok.Literal)
+}
+
+func before(a, b lexer.Token) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
\ No newline at end of file
@@ -0,0 +1,133 @@
+package lsp
+
+import (
+	"fmt"
+	"unicode/utf8"
+	
+	"github.com/chorlang/chorlang/compiler/lint"
+)
+
+// document is an open file as the client last described it, with the
+// analysis of its current text. Only the document an edit touches is
+// analysed again.
+type document struct {
+	uri      string
+	version  int
+	text     string
+	lines    []int // byte offset of the start of each line
+	analysis *analysis
+	
+	linter  *lint.Linter // as chore.json configures it for the file
+	problem string       // what was wrong with chore.json, if anything
+}
+
+func newDocument(uri string, version int, text string) *document {
+	d := &document{uri: uri, version: version}
+	d.setText(text)
+	return d
+}
+
+func (d *document) setText(text string) {
+	d.text = text
+	d.lines = []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			d.lines = append(d.lines, i+1)
+		}
+	}
+}
+
+// apply makes the client's edits, in order. Each one is either a range of
+// the text as the edits before it left it, or the whole new text.
+func (d *document) apply(changes []contentChange) error {
+	for _, c := range changes {
+		if c.Range == nil {
+			d.setText(c.Text)
+			continue
+		}
+		start, end := d.offset(c.Range.Start), d.offset(c.Range.End)
+		if start > end {
+			return fmt.Errorf("edit range ends before it starts: %+v", *c.Range)
+		}
+		d.setText(d.text[:start] + c.Text + d.text[end:])
+	}
+	return nil
+}
+
+// line returns the text of a line counted from zero, without its line
+// break.
+func (d *document) line(n int) string {
+	if n < 0 || n >= len(d.lines) {
+		return ""
+	}
+	end := len(d.text)
+	if n+1 < len(d.lines) {
+		end = d.lines[n+1] - 1
+	}
+	if end > d.lines[n] && d.text[end-1] == '\r' {
+		end--
+	}
+	return d.text[d.lines[n]:end]
+}
+
+// offset converts a protocol position to a byte offset in the text.
+// Positions past the end of a line or of the text are clamped to it.
+func (d *document) offset(p position) int {
+	if p.Line < 0 {
+		return 0
+	}
+	if p.Line >= len(d.lines) {
+		return len(d.text)
+	}
+	start := d.lines[p.Line]
+	line := d.line(p.Line)
+	units := 0
+	for i, r := range line {
+		if units >= p.Character {
+			return start + i
+		}
+		units += utf16Len(r)
+	}
+	return start + len(line)
+}
+
+// position converts a lexer position, a line and a rune column counted from
+// one, to a protocol position.
+func (d *document) position(line, column int) position {
+	text := d.line(line - 1)
+	units := 0
+	for i := 1; i < column && text != ""; i++ {
+		r, size := utf8.DecodeRuneInString(text)
+		units += utf16Len(r)
+		text = text[size:]
+	}
+	return position{Line: line - 1, Character: units}
+}
+
+// column converts a protocol position to the lexer's line and rune column.
+func (d *document) column(p position) (line, column int) {
+	text := d.line(p.Line)
+	units := 0
+	column = 1
+	for _, r := range text {
+		if units >= p.Character {
+			break
+		}
+		units += utf16Len(r)
+		column++
+	}
+	return p.Line + 1, column
+}
+
+// span returns the range of runes runes starting at a lexer position.
+func (d *document) span(line, column, runes int) span {
+	return span{Start: d.position(line, column), End: d.position(line, column+runes)}
+}
+
+// utf16Len is how many UTF-16 code units encode r.
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
\ No newline at end of file
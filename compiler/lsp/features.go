@@ -0,0 +1,345 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/fs"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/resolver"
+)
+
+// builtin describes a function every program may call.
+type builtin struct {
+	signature string
+	doc       string
+}
+
+var builtins = map[string]*builtin{
+	"print":   {"print(values...)", "Prints the values, separated by spaces, and a newline."},
+	"println": {"println(values...)", "Prints the values, separated by spaces, and a newline."},
+	"args":    {"args() int\nargs(i) string", "The number of program arguments, or argument i; args(0) is the program."},
+	"exit":    {"exit(code)", "Ends the program with an exit status."},
+	"expect":  {"expect(got, want)\nexpect(condition)", "Fails the rehearsal unless got equals want, or the condition holds. Only rehearsals may call it."},
+}
+
+// openFS describes chore.fs(), the library's only member; package fs
+// describes the members of its value.
+var openFS = &builtin{"chore.fs() fs", "The file system module, whose members reach the files of the program's sandbox and nothing outside it."}
+
+// keyword describes a keyword for hovers and completion.
+type keyword struct {
+	usage string
+	doc   string
+}
+
+// keywords are the keywords a program may use. The lexer also reserves
+// return and function, which nothing parses yet.
+var keywords = map[lexer.TokenType]*keyword{
+	lexer.DANCE:    {"dance name = value", "Declares a binding in the current block. Assign to an existing one with `name = value`."},
+	lexer.SWAY:     {"sway i from a to b { ... }", "Loops with i counting up from a to b, both included."},
+	lexer.FROM:     {"sway i from a to b { ... }", "Loops with i counting up from a to b, both included."},
+	lexer.TO:       {"sway i from a to b { ... }", "Loops with i counting up from a to b, both included."},
+	lexer.SPIN:     {"spin function(arguments)", "Calls a function."},
+	lexer.FLOW:     {"flow name = flow channel<T>", "Declares a channel that dancers pass values of type T over. Channels are unbuffered."},
+	lexer.START:    {"start statement", "Starts a dancer running the statement alongside the rest of the program. The dancer works on a copy of the bindings it uses."},
+	lexer.SEND_KW:  {"send channel <- value", "Sends a value over a channel, waiting until a dancer receives it."},
+	lexer.MATCH:    {"match value { when pattern: flow result ... }", "The result of the first case whose pattern matches the value."},
+	lexer.WHEN:     {"when pattern: flow result", "A case of a match."},
+	lexer.IF:       {"if condition { ... } else { ... }", "Runs the first block if the condition holds, and otherwise the else block."},
+	lexer.ELSE:     {"if condition { ... } else { ... }", "Runs the first block if the condition holds, and otherwise the else block."},
+	lexer.TRUE:     {"true", "A bool value."},
+	lexer.FALSE:    {"false", "A bool value."},
+	lexer.REHEARSE: {"rehearse \"name\" { ... }", "A test of the file, run by chorelang test. Only rehearsals may call expect."},
+	lexer.ENCORE:   {"encore \"name\" { ... }", "A benchmark of the file, run by chorelang bench."},
+}
+
+// hover describes the binding, builtin, member or keyword at p.
+func (a *analysis) hover(p position) *hover {
+	if a.program != nil {
+		if ident := a.identAt(p); ident != nil {
+			if fn := a.member(ident); fn != nil {
+				return &hover{Contents: markdown(code(fn.signature) + fn.doc), Range: a.identSpan(ident)}
+			}
+			if b := a.resolver.BindingOf(ident); b != nil {
+				return &hover{Contents: markdown(a.describe(b)), Range: a.identSpan(ident)}
+			}
+			if fn := builtins[ident.Value]; fn != nil && !a.types[ident] {
+				return &hover{Contents: markdown(code(fn.signature) + fn.doc), Range: a.identSpan(ident)}
+			}
+			return nil
+		}
+	}
+	
+	line, column := a.doc.column(p)
+	tok, ok := a.tokenAt(line, column)
+	if !ok {
+		return nil
+	}
+	kw := keywords[tok.Type]
+	if kw == nil {
+		return nil
+	}
+	return &hover{Contents: markdown(code(kw.usage) + kw.doc), Range: a.doc.span(tok.Line, tok.Column, tokenLength(tok))}
+}
+
+// describe shows a binding as its declaration would read, with its type.
+func (a *analysis) describe(b *resolver.Binding) string {
+	keyword := "dance"
+	switch b.Kind {
+	case resolver.LoopVariable:
+		keyword = "sway"
+	case resolver.Channel:
+		keyword = "flow"
+	}
+	decl := keyword + " " + b.Name
+	if t := a.bindingType(b); t != "" {
+		decl += " " + t
+	}
+	
+	text := code(decl) + fmt.Sprintf("%s declared at %d:%d.", capitalize(b.Kind.String()), b.Decl.Token.Line, b.Decl.Token.Column)
+	if outer := a.resolver.Shadowed(b); outer != nil {
+		text += fmt.Sprintf(" Shadows the %s declared at %d:%d.", outer.Kind, outer.Decl.Token.Line, outer.Decl.Token.Column)
+	}
+	return text
+}
+
+// definition is where the binding at p is declared.
+func (a *analysis) definition(p position) *location {
+	b := a.bindingAt(p)
+	if b == nil {
+		return nil
+	}
+	return &location{URI: a.doc.uri, Range: a.identSpan(b.Decl)}
+}
+
+// references are the uses of the binding at p, in source order, with its
+// declaration if asked for.
+func (a *analysis) references(p position, declaration bool) []location {
+	b := a.bindingAt(p)
+	if b == nil {
+		return nil
+	}
+	locations := []location{}
+	for _, ident := range a.idents {
+		if a.resolver.BindingOf(ident) == b && (declaration || ident != b.Decl) {
+			locations = append(locations, location{URI: a.doc.uri, Range: a.identSpan(ident)})
+		}
+	}
+	return locations
+}
+
+func (a *analysis) bindingAt(p position) *resolver.Binding {
+	if a.program == nil {
+		return nil
+	}
+	ident := a.identAt(p)
+	if ident == nil {
+		return nil
+	}
+	return a.resolver.BindingOf(ident)
+}
+
+// symbols outlines the document: its top-level dance and flow
+// declarations, and its rehearsals and encores with the declarations of
+// their bodies.
+func (a *analysis) symbols() []documentSymbol {
+	if a.program == nil {
+		return []documentSymbol{}
+	}
+	return a.symbolsOf(a.program.Statements)
+}
+
+func (a *analysis) symbolsOf(statements []ast.Statement) []documentSymbol {
+	symbols := []documentSymbol{}
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *ast.DanceStatement:
+			symbol := documentSymbol{Name: s.Name.Value, Kind: symbolVariable, SelectionRange: a.identSpan(s.Name)}
+			if b := a.resolver.BindingOf(s.Name); b != nil {
+				symbol.Detail = a.bindingType(b)
+			}
+			symbol.Range = span{Start: a.doc.position(s.Token.Line, s.Token.Column), End: a.lineEnd(s.Token.Line)}
+			symbols = append(symbols, symbol)
+		case *ast.RehearseStatement:
+			symbols = append(symbols, a.blockSymbol(s.Token, s.Name, "rehearsal", s.Body))
+		case *ast.EncoreStatement:
+			symbols = append(symbols, a.blockSymbol(s.Token, s.Name, "encore", s.Body))
+		}
+	}
+	return symbols
+}
+
+func (a *analysis) blockSymbol(tok lexer.Token, name *ast.StringLiteral, detail string, body *ast.BlockStatement) documentSymbol {
+	end := a.lineEnd(tok.Line)
+	if closing, ok := a.closing[body.Token]; ok {
+		end = a.doc.position(closing.Line, closing.Column+1)
+	}
+	return documentSymbol{
+		Name:           tok.Literal + " " + name.String(),
+		Detail:         detail,
+		Kind:           symbolFunction,
+		Range:          span{Start: a.doc.position(tok.Line, tok.Column), End: end},
+		SelectionRange: a.doc.span(name.Token.Line, name.Token.Column, tokenLength(name.Token)),
+		Children:       a.symbolsOf(body.Statements),
+	}
+}
+
+func (a *analysis) lineEnd(line int) position {
+	return a.doc.position(line, utf8.RuneCountInString(a.doc.line(line-1))+1)
+}
+
+// completion offers the keywords and builtins. Names are filtered by the
+// client as the user types.
+func completion() []completionItem {
+	var items []completionItem
+	for t, kw := range keywords {
+		if t == lexer.FROM || t == lexer.TO || t == lexer.ELSE {
+			// Only ever typed after the keyword that starts the statement
+			continue
+		}
+		items = append(items, completionItem{Label: t.String(), Kind: completionKeyword, Detail: kw.usage, Documentation: &markupContent{Kind: "markdown", Value: kw.doc}})
+	}
+	for name, fn := range builtins {
+		items = append(items, completionItem{Label: name, Kind: completionFunction, Detail: fn.signature, Documentation: &markupContent{Kind: "markdown", Value: fn.doc}})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items
+}
+
+// The semantic token types and modifiers the server reports, as indexes
+// into these lists.
+var (
+	tokenTypes     = []string{"keyword", "variable", "function", "type", "string", "number", "comment"}
+	tokenModifiers = []string{"declaration", "readonly"}
+)
+
+const (
+	tokenKeyword = iota
+	tokenVariable
+	tokenFunction
+	tokenType
+	tokenString
+	tokenNumber
+	tokenComment
+)
+
+const (
+	modifierDeclaration = 1 << iota
+	modifierReadonly
+)
+
+// semanticTokens classifies the document's tokens for highlighting:
+// keywords, comments and literals from the lexer, and names by what the
+// resolver bound them to. Loop variables are read-only.
+func (a *analysis) semanticTokens() semanticTokens {
+	idents := make(map[lexer.Token]*ast.Identifier)
+	for _, ident := range a.idents {
+		idents[ident.Token] = ident
+	}
+	
+	data := []int{}
+	last := position{}
+	for _, tok := range a.tokens {
+		kind, modifiers := -1, 0
+		switch tok.Type {
+		case lexer.COMMENT:
+			kind = tokenComment
+		case lexer.STRING:
+			kind = tokenString
+		case lexer.INT, lexer.FLOAT:
+			kind = tokenNumber
+		case lexer.IDENT:
+			kind, modifiers = a.classify(idents[tok])
+		default:
+			if keywords[tok.Type] != nil {
+				kind = tokenKeyword
+			}
+		}
+		if kind < 0 {
+			continue
+		}
+		
+		s := a.doc.span(tok.Line, tok.Column, tokenLength(tok))
+		if s.End.Line != s.Start.Line || s.End.Character == s.Start.Character {
+			continue
+		}
+		delta := s.Start.Character
+		if s.Start.Line == last.Line {
+			delta -= last.Character
+		}
+		data = append(data, s.Start.Line-last.Line, delta, s.End.Character-s.Start.Character, kind, modifiers)
+		last = s.Start
+	}
+	return semanticTokens{Data: data}
+}
+
+func (a *analysis) classify(ident *ast.Identifier) (int, int) {
+	if ident == nil {
+		// Without a tree every name is taken for a variable
+		if a.program == nil {
+			return tokenVariable, 0
+		}
+		return -1, 0
+	}
+	if a.types[ident] {
+		return tokenType, 0
+	}
+	if a.members[ident] != nil {
+		return tokenFunction, 0
+	}
+	b := a.resolver.BindingOf(ident)
+	if b == nil {
+		if builtins[ident.Value] != nil {
+			return tokenFunction, 0
+		}
+		return -1, 0
+	}
+	modifiers := 0
+	if b.Decl == ident {
+		modifiers |= modifierDeclaration
+	}
+	if b.Kind == resolver.LoopVariable {
+		modifiers |= modifierReadonly
+	}
+	return tokenVariable, modifiers
+}
+
+// member describes the member an identifier names, if its receiver's type
+// is known to have it.
+func (a *analysis) member(ident *ast.Identifier) *builtin {
+	call := a.members[ident]
+	if call == nil {
+		return nil
+	}
+	switch a.receiverType(call) {
+	case "chore":
+		if ident.Value == "fs" {
+			return openFS
+		}
+	case "fs":
+		if m := fs.Members[ident.Value]; m != nil {
+			return &builtin{m.Signature(), m.Doc}
+		}
+	}
+	return nil
+}
+
+func markdown(text string) markupContent {
+	return markupContent{Kind: "markdown", Value: text}
+}
+
+// code shows text as a ChoreLang code block, followed by a paragraph break.
+func code(text string) string {
+	return "```chorelang\n" + text + "\n```\n\n"
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
\ No newline at end of file
@@ -0,0 +1,428 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	
+	"github.com/chorlang/chorlang/compiler/internal/frame"
+)
+
+const uri = "untitled:test.chore"
+
+// message is a message of a test session in either direction.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int            `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+func call(id int, method string, params interface{}) message {
+	return message{JSONRPC: "2.0", ID: &id, Method: method, Params: marshal(params)}
+}
+
+func notice(method string, params interface{}) message {
+	return message{JSONRPC: "2.0", Method: method, Params: marshal(params)}
+}
+
+func marshal(v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// session runs the messages between an initialize and a shutdown and exit,
+// and returns what the server sent in reply to them.
+func session(t *testing.T, messages ...message) []message {
+	t.Helper()
+	
+	all := append([]message{call(0, "initialize", map[string]interface{}{})}, messages...)
+	all = append(all, call(1000, "shutdown", nil), notice("exit", nil))
+	replies, err := serve(all)
+	if err != nil {
+		t.Fatalf("session failed: %v", err)
+	}
+	if len(replies) < 2 || replies[0].Error != nil || replies[len(replies)-1].Error != nil {
+		t.Fatalf("initialize or shutdown failed: %+v", replies)
+	}
+	return replies[1 : len(replies)-1]
+}
+
+func serve(messages []message) ([]message, error) {
+	var in, out bytes.Buffer
+	for _, m := range messages {
+		if err := frame.Write(&in, m); err != nil {
+			return nil, err
+		}
+	}
+	err := Serve(&in, &out)
+	
+	var replies []message
+	r := bufio.NewReader(&out)
+	for {
+		body, rerr := frame.Read(r)
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return nil, rerr
+		}
+		var m message
+		if rerr := json.Unmarshal(body, &m); rerr != nil {
+			return nil, rerr
+		}
+		replies = append(replies, m)
+	}
+	return replies, err
+}
+
+func open(text string) message {
+	return notice("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": "chorelang", "version": 1, "text": text},
+	})
+}
+
+func at(id int, method string, line, character int) message {
+	return call(id, method, map[string]interface{}{
+		"textDocument": map[string]string{"uri": uri},
+		"position":     position{line, character},
+		"context":      map[string]bool{"includeDeclaration": true},
+	})
+}
+
+// result decodes the result of the reply with the given ID.
+func result(t *testing.T, replies []message, id int, v interface{}) {
+	t.Helper()
+	
+	for _, m := range replies {
+		if m.ID != nil && *m.ID == id {
+			if m.Error != nil {
+				t.Fatalf("request %d failed: %v", id, m.Error)
+			}
+			if err := json.Unmarshal(m.Result, v); err != nil {
+				t.Fatalf("request %d: %v", id, err)
+			}
+			return
+		}
+	}
+	t.Fatalf("no reply to request %d in %+v", id, replies)
+}
+
+// published returns the diagnostics of each publishDiagnostics
+// notification, as "line:character: message" strings.
+func published(t *testing.T, replies []message) [][]string {
+	t.Helper()
+	
+	var all [][]string
+	for _, m := range replies {
+		if m.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		var params publishDiagnosticsParams
+		if err := json.Unmarshal(m.Params, &params); err != nil {
+			t.Fatal(err)
+		}
+		list := []string{}
+		for _, d := range params.Diagnostics {
+			list = append(list, fmt.Sprintf("%d:%d-%d: %s", d.Range.Start.Line, d.Range.Start.Character, d.Range.End.Character, d.Message))
+		}
+		all = append(all, list)
+	}
+	return all
+}
+
+func TestLifecycle(t *testing.T) {
+	replies, err := serve([]message{
+		call(1, "textDocument/hover", nil),
+		call(2, "initialize", nil),
+		call(3, "workspace/symbol", nil),
+		call(4, "textDocument/hover", at(0, "", 0, 0).Params),
+		call(5, "shutdown", nil),
+		call(6, "textDocument/completion", nil),
+		notice("exit", nil),
+	})
+	if err != nil {
+		t.Fatalf("orderly session failed: %v", err)
+	}
+	codes := []int{codeServerNotInitialized, 0, codeMethodNotFound, codeInvalidParams, 0, codeInvalidRequest}
+	if len(replies) != len(codes) {
+		t.Fatalf("expected %d replies, got %+v", len(codes), replies)
+	}
+	for i, code := range codes {
+		got := 0
+		if replies[i].Error != nil {
+			got = replies[i].Error.Code
+		}
+		if got != code {
+			t.Errorf("reply %d: expected error code %d, got %+v", i+1, code, replies[i])
+		}
+	}
+	
+	if _, err := serve([]message{call(1, "initialize", nil), notice("exit", nil)}); err == nil {
+		t.Error("expected exit without shutdown to fail")
+	}
+	if _, err := serve([]message{call(1, "initialize", nil)}); err == nil {
+		t.Error("expected a closed connection to fail")
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	replies := session(t,
+		open("dance total = )\nspin print(total)\n"),
+		notice("textDocument/didChange", map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+			"contentChanges": []contentChange{{Range: &span{position{0, 14}, position{0, 15}}, Text: "1 + \"a\""}},
+		}),
+		notice("textDocument/didChange", map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri, "version": 3},
+			"contentChanges": []contentChange{{Text: `flow jobs = flow channel<int>
+send jobs <- "x"
+dance n = <-jobs
+if n { spin shout(n) }
+dance unused = 1
+`}},
+		}),
+		notice("textDocument/didClose", map[string]interface{}{"textDocument": map[string]string{"uri": uri}}),
+	)
+	
+	expected := [][]string{
+		{"0:14-15: no prefix parse function for ) found"},
+		{"0:16-17: invalid operation: int + string"},
+		{
+			"1:0-4: cannot send string to channel<int>",
+			"3:0-2: condition must be bool, got int",
+			"3:12-17: undefined function: shout",
+			"4:6-12: variable \"unused\" is declared but never used",
+		},
+		{},
+	}
+	if got := published(t, replies); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected diagnostics\n%q\ngot\n%q", expected, got)
+	}
+}
+
+func TestMembers(t *testing.T) {
+	replies := session(t,
+		open(`flow files = chore.fs()
+dance text = files.read(1)
+files.copy("a")
+dance n = 1
+spin print(text, n.read("a"), chore.files(), files.write("a"))
+`),
+		at(1, "textDocument/hover", 1, 20),
+		at(2, "textDocument/hover", 0, 20),
+	)
+	
+	expected := [][]string{{
+		"1:19-23: fs.read path must be string, got int",
+		"2:6-10: fs has no member copy",
+		"4:19-23: int has no member read",
+		"4:36-41: chore has no member files",
+		"4:51-56: fs.write takes 2 arguments, got 1",
+	}}
+	if got := published(t, replies); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected diagnostics\n%q\ngot\n%q", expected, got)
+	}
+	
+	hovers := []string{
+		"```chorelang\nfs.read(path) string\n```\n\nThe contents of a file.",
+		"```chorelang\nchore.fs() fs\n```\n\nThe file system module, whose members reach the files of the program's sandbox and nothing outside it.",
+	}
+	for i, want := range hovers {
+		var h hover
+		result(t, replies, i+1, &h)
+		if h.Contents.Value != want {
+			t.Errorf("hover %d: expected %q, got %q", i+1, want, h.Contents.Value)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	d := newDocument(uri, 1, "spin print(\"𝄞 a\")\r\nline two\n")
+	err := d.apply([]contentChange{
+		// The clef is two UTF-16 code units
+		{Range: &span{position{0, 15}, position{0, 16}}, Text: "b"},
+		{Range: &span{position{1, 5}, position{1, 99}}, Text: "2"},
+		{Range: &span{position{2, 0}, position{2, 0}}, Text: "end"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.text != "spin print(\"𝄞 b\")\r\nline 2\nend" {
+		t.Errorf("edits applied wrong: %q", d.text)
+	}
+	if p := d.position(1, 14); p != (position{0, 14}) {
+		t.Errorf("expected the rune after the clef at character 14, got %+v", p)
+	}
+	if line, column := d.column(position{0, 14}); line != 1 || column != 14 {
+		t.Errorf("expected 1:14, got %d:%d", line, column)
+	}
+	if err := d.apply([]contentChange{{Range: &span{position{1, 2}, position{0, 0}}}}); err == nil {
+		t.Error("expected an error for a backwards range")
+	}
+}
+
+const program = `dance count = 0
+sway i from 1 to 3 {
+    count = count + i
+}
+flow done = flow channel<bool>
+spin print(count)
+
+rehearse "counts" {
+    dance want = 6
+    spin expect(count, want)
+}
+`
+
+func TestNavigation(t *testing.T) {
+	replies := session(t,
+		open(program),
+		at(1, "textDocument/hover", 2, 14),
+		at(2, "textDocument/hover", 2, 21),
+		at(3, "textDocument/hover", 5, 6),
+		at(4, "textDocument/hover", 1, 1),
+		at(5, "textDocument/hover", 4, 6),
+		at(6, "textDocument/hover", 3, 0),
+		at(7, "textDocument/definition", 5, 12),
+		at(8, "textDocument/references", 0, 8),
+		at(9, "textDocument/definition", 5, 2),
+	)
+	
+	hovers := []string{
+		"```chorelang\ndance count int\n```\n\nVariable declared at 1:7.",
+		"```chorelang\nsway i int\n```\n\nLoop variable declared at 2:6.",
+		"```chorelang\nprint(values...)\n```\n\nPrints the values, separated by spaces, and a newline.",
+		"```chorelang\nsway i from a to b { ... }\n```\n\nLoops with i counting up from a to b, both included.",
+		"```chorelang\nflow done channel<bool>\n```\n\nChannel declared at 5:6.",
+	}
+	for i, want := range hovers {
+		var h hover
+		result(t, replies, i+1, &h)
+		if h.Contents.Value != want {
+			t.Errorf("hover %d: expected %q, got %q", i+1, want, h.Contents.Value)
+		}
+	}
+	var nothing *hover
+	if result(t, replies, 6, &nothing); nothing != nil {
+		t.Errorf("expected no hover over a brace, got %+v", nothing)
+	}
+	
+	var def location
+	result(t, replies, 7, &def)
+	if def != (location{uri, span{position{0, 6}, position{0, 11}}}) {
+		t.Errorf("definition: got %+v", def)
+	}
+	var refs []location
+	result(t, replies, 8, &refs)
+	var lines []int
+	for _, r := range refs {
+		lines = append(lines, r.Range.Start.Line)
+	}
+	if !reflect.DeepEqual(lines, []int{0, 2, 2, 5, 9}) {
+		t.Errorf("references on lines %v", lines)
+	}
+	var none *location
+	if result(t, replies, 9, &none); none != nil {
+		t.Errorf("expected no definition for a keyword, got %+v", none)
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	replies := session(t, open(program), call(1, "textDocument/documentSymbol", documentParams{textDocumentIdentifier{uri}}))
+	
+	var symbols []documentSymbol
+	result(t, replies, 1, &symbols)
+	var got []string
+	var walk func([]documentSymbol, string)
+	walk = func(list []documentSymbol, indent string) {
+		for _, s := range list {
+			got = append(got, fmt.Sprintf("%s%s %s %d:%d-%d:%d", indent, s.Name, s.Detail,
+				s.Range.Start.Line, s.Range.Start.Character, s.Range.End.Line, s.Range.End.Character))
+			walk(s.Children, indent+"  ")
+		}
+	}
+	walk(symbols, "")
+	
+	expected := []string{
+		"count int 0:0-0:15",
+		"done channel<bool> 4:0-4:30",
+		`rehearse "counts" rehearsal 7:0-10:1`,
+		"  want int 8:4-8:18",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected symbols\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	replies := session(t, call(1, "textDocument/completion", at(0, "", 0, 0).Params))
+	
+	var items []completionItem
+	result(t, replies, 1, &items)
+	labels := make(map[string]int)
+	for _, item := range items {
+		labels[item.Label] = item.Kind
+	}
+	if labels["dance"] != completionKeyword || labels["rehearse"] != completionKeyword || labels["print"] != completionFunction {
+		t.Errorf("keywords or builtins missing: %v", labels)
+	}
+	if _, ok := labels["return"]; ok {
+		t.Error("offered a keyword nothing parses")
+	}
+}
+
+func TestSemanticTokens(t *testing.T) {
+	source := "dance x = 1 // one\nsway i from x to 2 {\n    spin print(\"é\", i)\n}\n"
+	replies := session(t, open(source), call(1, "textDocument/semanticTokens/full", documentParams{textDocumentIdentifier{uri}}))
+	
+	var tokens semanticTokens
+	result(t, replies, 1, &tokens)
+	expected := []int{
+		0, 0, 5, tokenKeyword, 0,
+		0, 6, 1, tokenVariable, modifierDeclaration,
+		0, 4, 1, tokenNumber, 0,
+		0, 2, 6, tokenComment, 0,
+		1, 0, 4, tokenKeyword, 0,
+		0, 5, 1, tokenVariable, modifierDeclaration | modifierReadonly,
+		0, 2, 4, tokenKeyword, 0,
+		0, 5, 1, tokenVariable, 0,
+		0, 2, 2, tokenKeyword, 0,
+		0, 3, 1, tokenNumber, 0,
+		1, 4, 4, tokenKeyword, 0,
+		0, 5, 5, tokenFunction, 0,
+		0, 6, 3, tokenString, 0,
+		0, 5, 1, tokenVariable, modifierReadonly,
+	}
+	if !reflect.DeepEqual(tokens.Data, expected) {
+		t.Errorf("expected tokens\n%v\ngot\n%v", expected, tokens.Data)
+	}
+}
+func TestExamplesHaveNoErrors(t *testing.T) {
+	files, err := filepath.Glob("../../examples/*.chore")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no examples found: %v", err)
+	}
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a := analyze(newDocument("file:///"+file, 1, string(source)), nil)
+		for _, d := range a.diagnostics {
+			t.Errorf("%s:%d:%d: %s", file, d.Range.Start.Line+1, d.Range.Start.Character+1, d.Message)
+		}
+	}
+}
\ No newline at end of file
@@ -0,0 +1,300 @@
+// Package lsp is a Language Server Protocol server for ChoreLang, which
+// editors run as `chorelang lsp` and talk to over its standard input and
+// output.
+//
+// Each open document is analysed with the lexer, parser and resolver as it
+// changes, and only that document: the client sends edits, the server
+// applies them to its copy of the text and analyses the result. On top of
+// that analysis the server offers
+//
+//   - diagnostics: syntax and resolver errors, type errors the program
+//     would fail with at run time, and the linter's findings as warnings;
+//   - hover, showing a binding's declaration and inferred type, or what a
+//     builtin or keyword does;
+//   - go to definition and find references for dance, flow and sway
+//     bindings;
+//   - an outline of a document's declarations, rehearsals and encores;
+//   - completion of keywords and builtins;
+//   - semantic tokens for keywords, names, literals and comments.
+//
+// Requests are handled one at a time, in the order they arrive.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+	
+	"github.com/chorlang/chorlang/compiler/config"
+	"github.com/chorlang/chorlang/compiler/internal/frame"
+	"github.com/chorlang/chorlang/compiler/lint"
+)
+
+// server is the state of one session with a client.
+type server struct {
+	in  *bufio.Reader
+	out io.Writer
+	
+	docs        map[string]*document
+	initialized bool
+	shutdown    bool
+	err         error // the first failure to write to the client
+}
+
+// Serve talks LSP to a client until it sends exit, which ends a session
+// normally if shutdown came first. The client's messages are read from in
+// and the server's written to out.
+func Serve(in io.Reader, out io.Writer) error {
+	s := &server{in: bufio.NewReader(in), out: out, docs: make(map[string]*document)}
+	for {
+		body, err := frame.Read(s.in)
+		if err == io.EOF {
+			return errors.New("client closed the connection without exit")
+		}
+		if err != nil {
+			return err
+		}
+		
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			if err := s.respond(json.RawMessage("null"), nil, &rpcError{codeParseError, err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("client sent exit without shutdown")
+			}
+			return nil
+		}
+		
+		result, rerr := s.handle(req)
+		if s.err != nil {
+			return s.err
+		}
+		if req.ID == nil {
+			// Notifications are not answered, even when they fail
+			continue
+		}
+		if err := s.respond(req.ID, result, rerr); err != nil {
+			return err
+		}
+	}
+}
+
+// handle runs one request or notification.
+func (s *server) handle(req request) (interface{}, *rpcError) {
+	switch {
+	case req.Method == "initialize":
+		s.initialized = true
+		return s.initialize(), nil
+	case !s.initialized:
+		return nil, &rpcError{codeServerNotInitialized, "initialize has not been called"}
+	case s.shutdown:
+		return nil, &rpcError{codeInvalidRequest, "the server is shutting down"}
+	}
+	
+	switch req.Method {
+	case "initialized", "$/cancelRequest", "$/setTrace", "workspace/didChangeConfiguration":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		item := params.TextDocument
+		doc := newDocument(item.URI, item.Version, item.Text)
+		doc.linter, doc.problem = linterFor(item.URI)
+		s.docs[item.URI] = doc
+		s.analyze(doc)
+		return nil, nil
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		doc, rerr := s.document(params.TextDocument.URI)
+		if rerr != nil {
+			return nil, rerr
+		}
+		if err := doc.apply(params.ContentChanges); err != nil {
+			return nil, &rpcError{codeInvalidParams, err.Error()}
+		}
+		doc.version = params.TextDocument.Version
+		s.analyze(doc)
+		return nil, nil
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		delete(s.docs, params.TextDocument.URI)
+		// Clear the closed document's diagnostics
+		s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []diagnostic{}})
+		return nil, nil
+	
+	case "textDocument/hover":
+		return s.atPosition(req.Params, func(a *analysis, p position) interface{} {
+			if h := a.hover(p); h != nil {
+				return h
+			}
+			return nil
+		})
+	case "textDocument/definition":
+		return s.atPosition(req.Params, func(a *analysis, p position) interface{} {
+			if l := a.definition(p); l != nil {
+				return l
+			}
+			return nil
+		})
+	case "textDocument/references":
+		var params referenceParams
+		if err := decode(req.Params, &params); err != nil {
+			return nil, err
+		}
+		doc, rerr := s.document(params.TextDocument.URI)
+		if rerr != nil {
+			return nil, rerr
+		}
+		return doc.analysis.references(params.Position, params.Context.IncludeDeclaration), nil
+	case "textDocument/documentSymbol":
+		doc, rerr := s.documentOf(req.Params)
+		if rerr != nil {
+			return nil, rerr
+		}
+		return doc.analysis.symbols(), nil
+	case "textDocument/completion":
+		return completion(), nil
+	case "textDocument/semanticTokens/full":
+		doc, rerr := s.documentOf(req.Params)
+		if rerr != nil {
+			return nil, rerr
+		}
+		return doc.analysis.semanticTokens(), nil
+	}
+	return nil, &rpcError{codeMethodNotFound, "method not supported: " + req.Method}
+}
+
+func (s *server) initialize() interface{} {
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync": map[string]interface{}{
+				"openClose": true,
+				"change":    2, // incremental
+			},
+			"hoverProvider":          true,
+			"definitionProvider":     true,
+			"referencesProvider":     true,
+			"documentSymbolProvider": true,
+			"completionProvider":     map[string]interface{}{},
+			"semanticTokensProvider": map[string]interface{}{
+				"legend": map[string]interface{}{
+					"tokenTypes":     tokenTypes,
+					"tokenModifiers": tokenModifiers,
+				},
+				"full": true,
+			},
+		},
+		"serverInfo": map[string]string{"name": "chorelang"},
+	}
+}
+
+// analyze analyses a document as it now reads and publishes its
+// diagnostics.
+func (s *server) analyze(doc *document) {
+	doc.analysis = analyze(doc, doc.linter)
+	diagnostics := doc.analysis.diagnostics
+	if doc.problem != "" {
+		diagnostics = append([]diagnostic{{Severity: severityWarning, Source: "chorelang", Message: doc.problem}}, diagnostics...)
+	}
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         doc.uri,
+		Version:     doc.version,
+		Diagnostics: diagnostics,
+	})
+}
+
+// linterFor returns the linter the chore.json governing a file configures,
+// as chorelang lint would run it. It is read when the document is opened.
+// A broken configuration falls back to every rule, with the problem to
+// report.
+func linterFor(uri string) (*lint.Linter, string) {
+	settings := lint.Config{}
+	problem := ""
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		cfg, err := config.Load(u.Path)
+		if err == nil {
+			err = cfg.Section("lint", &settings)
+		}
+		if err != nil {
+			settings, problem = lint.Config{}, "config error: "+err.Error()
+		}
+	}
+	linter, err := lint.New(settings, lint.Default())
+	if err != nil {
+		problem = "config error: " + err.Error()
+		linter, _ = lint.New(lint.Config{}, lint.Default())
+	}
+	return linter, problem
+}
+
+// atPosition answers a request about a position in a document.
+func (s *server) atPosition(raw json.RawMessage, answer func(*analysis, position) interface{}) (interface{}, *rpcError) {
+	var params positionParams
+	if err := decode(raw, &params); err != nil {
+		return nil, err
+	}
+	doc, rerr := s.document(params.TextDocument.URI)
+	if rerr != nil {
+		return nil, rerr
+	}
+	return answer(doc.analysis, params.Position), nil
+}
+
+func (s *server) documentOf(raw json.RawMessage) (*document, *rpcError) {
+	var params documentParams
+	if err := decode(raw, &params); err != nil {
+		return nil, err
+	}
+	return s.document(params.TextDocument.URI)
+}
+
+func (s *server) document(uri string) (*document, *rpcError) {
+	doc, ok := s.docs[uri]
+	if !ok {
+		return nil, &rpcError{codeInvalidParams, "document is not open: " + uri}
+	}
+	return doc, nil
+}
+
+func decode(raw json.RawMessage, v interface{}) *rpcError {
+	if err := json.Unmarshal(raw, v); err != nil {
+		return &rpcError{codeInvalidParams, err.Error()}
+	}
+	return nil
+}
+
+func (s *server) respond(id json.RawMessage, result interface{}, rerr *rpcError) error {
+	resp := response{JSONRPC: "2.0", ID: id, Error: rerr}
+	if rerr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		resp.Result = data
+	}
+	return frame.Write(s.out, resp)
+}
+
+func (s *server) notify(method string, params interface{}) {
+	if err := frame.Write(s.out, notification{JSONRPC: "2.0", Method: method, Params: params}); err != nil && s.err == nil {
+		s.err = err
+	}
+}
\ No newline at end of file
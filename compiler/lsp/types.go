@@ -0,0 +1,236 @@
+package lsp
+
+import (
+	"strings"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/fs"
+	"github.com/chorlang/chorlang/compiler/interp"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/ops"
+	"github.com/chorlang/chorlang/compiler/resolver"
+)
+
+// Types are inferred from the source alone, following the declarations of
+// the bindings an expression reads, and named as ops.TypeName names
+// them. An empty name means the type cannot be known without running the
+// program.
+
+// typeOf infers the type of exp.
+func (a *analysis) typeOf(exp ast.Expression) string {
+	switch e := exp.(type) {
+	case *ast.Identifier:
+		if b := a.resolver.BindingOf(e); b != nil {
+			return a.bindingType(b)
+		}
+	case *ast.IntegerLiteral:
+		return "int"
+	case *ast.FloatLiteral:
+		return "float"
+	case *ast.StringLiteral:
+		return "string"
+	case *ast.Boolean:
+		return "bool"
+	case *ast.InfixExpression:
+		t, _ := infixType(e.Operator, a.typeOf(e.Left), a.typeOf(e.Right))
+		return t
+	case *ast.SpinExpression:
+		if ident, ok := e.Function.(*ast.Identifier); ok && builtins[ident.Value] != nil {
+			return interp.BuiltinType(ident.Value, len(e.Arguments))
+		}
+	case *ast.MemberCallExpression:
+		return interp.MemberType(a.receiverType(e), e.Member.Value)
+	case *ast.FlowExpression:
+		if e.ElementType == nil {
+			return "channel"
+		}
+		return "channel<" + e.ElementType.Value + ">"
+	case *ast.ReceiveExpression:
+		elem, _ := channelElem(a.typeOf(e.Channel))
+		return elem
+	case *ast.MatchExpression:
+		// A match yields nothing when no case matches, so its type is
+		// only definite when every case agrees
+		result := ""
+		for _, c := range e.Cases {
+			consequence := c.Consequence
+			if flow, ok := consequence.(*ast.FlowExpression); ok && flow.ElementType == nil {
+				consequence = flow.ChannelType
+			}
+			t := a.typeOf(consequence)
+			if t == "" {
+				return ""
+			}
+			if result != "" && t != result {
+				return "any"
+			}
+			result = t
+		}
+		return result
+	}
+	return ""
+}
+
+// bindingType is the type of a binding's declared value. Bindings are
+// declared before they are used, so the lookup cannot loop, but a binding is
+// marked while its type is worked out in case a broken tree would.
+func (a *analysis) bindingType(b *resolver.Binding) string {
+	if t, ok := a.bindingTypes[b]; ok {
+		return t
+	}
+	a.bindingTypes[b] = ""
+	t := ""
+	switch b.Kind {
+	case resolver.LoopVariable:
+		t = "int"
+	default:
+		if value, ok := a.values[b]; ok {
+			t = a.typeOf(value)
+		}
+		// A flow declared from a match or a call is still a channel, but
+		// one declared from a member has the member's type
+		_, member := a.values[b].(*ast.MemberCallExpression)
+		if b.Kind == resolver.Channel && !member && !strings.HasPrefix(t, "channel") {
+			t = "channel"
+		}
+	}
+	a.bindingTypes[b] = t
+	return t
+}
+
+// receiverType is the type of the receiver of a member call. chore,
+// unless the program declares its own, is the library, of type "chore".
+func (a *analysis) receiverType(e *ast.MemberCallExpression) string {
+	if a.library(e) {
+		return "chore"
+	}
+	return a.typeOf(e.Receiver)
+}
+
+// library reports whether the receiver of a member call is the library.
+func (a *analysis) library(e *ast.MemberCallExpression) bool {
+	ident, ok := e.Receiver.(*ast.Identifier)
+	return ok && ident.Value == "chore" && a.resolver.BindingOf(ident) == nil
+}
+
+// samples are values of the types an operator's operands may have. The
+// interpreter's own Binary is applied to them, so the server agrees with
+// every backend on what each operator accepts.
+var samples = map[string]interface{}{
+	"int":    int64(1),
+	"float":  1.5,
+	"string": "a",
+	"bool":   true,
+}
+
+// infixType is the type of an operator applied to operands of the given
+// types, or the error every backend reports for them.
+func infixType(op, left, right string) (string, error) {
+	l, ok := samples[left]
+	r, ok2 := samples[right]
+	if !ok || !ok2 {
+		switch op {
+		case "==", "!=", "<", ">", "<=", ">=", "=~":
+			return "bool", nil
+		}
+		return "", nil
+	}
+	v, err := ops.Binary(op, l, r)
+	if err != nil {
+		return "", err
+	}
+	return ops.TypeName(v), nil
+}
+
+// channelElem returns the type of the values of a channel type, and
+// whether t is known to be a channel at all.
+func channelElem(t string) (string, bool) {
+	switch {
+	case t == "channel":
+		return "any", true
+	case strings.HasPrefix(t, "channel<") && strings.HasSuffix(t, ">"):
+		return t[len("channel<") : len(t)-1], true
+	}
+	return "", false
+}
+
+// check reports the type errors the program would fail with at run time,
+// where the types involved are known, in the words the interpreter uses.
+func (a *analysis) check() {
+	ast.Inspect(a.program, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.InfixExpression:
+			if _, err := infixType(n.Operator, a.typeOf(n.Left), a.typeOf(n.Right)); err != nil {
+				a.errorAt(n.Token, "%s", err)
+			}
+		case *ast.IfStatement:
+			if t := a.typeOf(n.Condition); t != "" && t != "bool" && t != "any" {
+				a.errorAt(n.Token, "condition must be bool, got %s", t)
+			}
+		case *ast.SendStatement:
+			ct := a.typeOf(n.Channel)
+			elem, ok := channelElem(ct)
+			switch {
+			case ct == "" || ct == "any":
+			case !ok:
+				a.errorAt(n.Token, "%s is not a channel", ct)
+			case samples[elem] != nil:
+				if t := a.typeOf(n.Value); samples[t] != nil && t != elem {
+					a.errorAt(n.Token, "cannot send %s to %s", t, ct)
+				}
+			}
+		case *ast.ReceiveExpression:
+			if t := a.typeOf(n.Channel); t != "" && t != "any" {
+				if _, ok := channelElem(t); !ok {
+					a.errorAt(n.Token, "%s is not a channel", t)
+				}
+			}
+		case *ast.SpinExpression:
+			ident, ok := n.Function.(*ast.Identifier)
+			switch {
+			case !ok:
+				a.errorAt(n.Token, "cannot call %s", n.Function.String())
+			case builtins[ident.Value] == nil:
+				a.errorAt(ident.Token, "undefined function: %s", ident.Value)
+			}
+		case *ast.MemberCallExpression:
+			a.checkMember(n)
+		}
+		return true
+	})
+}
+
+// checkMember reports a member call the receiver's type has no member for,
+// or whose arguments the member does not take, where the types are known.
+func (a *analysis) checkMember(e *ast.MemberCallExpression) {
+	tok := e.Member.Token
+	rt := a.receiverType(e)
+	switch {
+	case rt == "chore":
+		if err := fs.CheckOpen(e.Member.Value, len(e.Arguments)); err != nil {
+			a.errorAt(tok, "%s", err)
+		}
+		return
+	case rt == "" || rt == "any":
+		return
+	case interp.MemberType(rt, e.Member.Value) == "":
+		a.errorAt(tok, "%s has no member %s", rt, e.Member.Value)
+		return
+	}
+	
+	m := fs.Members[e.Member.Value]
+	if err := m.CheckArity(len(e.Arguments)); err != nil {
+		a.errorAt(tok, "%s", err)
+		return
+	}
+	for i, arg := range e.Arguments {
+		if t, want := a.typeOf(arg), m.Params[i].Type; samples[t] != nil && t != want {
+			a.errorAt(tok, "fs.%s %s must be %s, got %s", m.Name, m.Params[i].Name, want, t)
+		}
+	}
+}
+
+// errorAt reports an error at tok in the form the parser and resolver use.
+func (a *analysis) errorAt(tok lexer.Token, format string, args ...interface{}) {
+	a.report(severityError, "", tok.Line, tok.Column, format, args...)
+}
\ No newline at end of file
@@ -0,0 +1,193 @@
+// Package ops holds the semantics of ChoreLang values that every backend
+// shares: their type names, and the binary operators on them. The
+// interpreter and the VM apply them as they run, and the code generator
+// as it folds arithmetic on literals, so all three agree.
+//
+// Values are represented by plain Go values so they print exactly as the
+// generated Go prints them:
+//
+//	int     int64
+//	float   float64
+//	string  string
+//	bool    bool
+//	channel a backend's own type, with a TypeName method
+//	nothing nil (a match without a matching case)
+package ops
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+)
+
+// TypeName returns the ChoreLang name of a value's type. Channels name
+// themselves with a TypeName method, since each backend has its own.
+func TypeName(v interface{}) string {
+	switch v := v.(type) {
+	case int64:
+		return "int"
+	case float64:
+		return "float"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case nil:
+		return "nothing"
+	case interface{ TypeName() string }:
+		return v.TypeName()
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// isChannel reports whether v is a channel of any backend.
+func isChannel(v interface{}) bool {
+	_, ok := v.(interface{ TypeName() string })
+	return ok
+}
+
+// Binary applies a ChoreLang binary operator to two values: arithmetic,
+// comparison and pattern matching. Channels are compared by identity.
+func Binary(op string, left, right interface{}) (interface{}, error) {
+	if op == "=~" {
+		text, ok1 := left.(string)
+		pattern, ok2 := right.(string)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("=~ needs a string and a pattern string, got %s and %s",
+				TypeName(left), TypeName(right))
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		return re.MatchString(text), nil
+	}
+	
+	// Mixed int and float arithmetic only type-checks in Go when the int is
+	// a constant, which converts to float; do the same here.
+	if l, ok := left.(int64); ok {
+		if _, ok := right.(float64); ok {
+			left = float64(l)
+		}
+	}
+	if r, ok := right.(int64); ok {
+		if _, ok := left.(float64); ok {
+			right = float64(r)
+		}
+	}
+	
+	switch l := left.(type) {
+	case int64:
+		if r, ok := right.(int64); ok {
+			return intOp(op, l, r)
+		}
+	case float64:
+		if r, ok := right.(float64); ok {
+			return floatOp(op, l, r)
+		}
+	case string:
+		if r, ok := right.(string); ok {
+			return stringOp(op, l, r)
+		}
+	case bool:
+		if r, ok := right.(bool); ok {
+			switch op {
+			case "==":
+				return l == r, nil
+			case "!=":
+				return l != r, nil
+			}
+		}
+	default:
+		if TypeName(left) == TypeName(right) && isChannel(left) {
+			switch op {
+			case "==":
+				return left == right, nil
+			case "!=":
+				return left != right, nil
+			}
+		}
+	}
+	
+	return nil, fmt.Errorf("invalid operation: %s %s %s", TypeName(left), op, TypeName(right))
+}
+
+func intOp(op string, l, r int64) (interface{}, error) {
+	switch op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, errors.New("integer divide by zero")
+		}
+		if l == math.MinInt64 && r == -1 {
+			return l, nil
+		}
+		return l / r, nil
+	case "==":
+		return l == r, nil
+	case "!=":
+		return l != r, nil
+	case "<":
+		return l < r, nil
+	case ">":
+		return l > r, nil
+	case "<=":
+		return l <= r, nil
+	case ">=":
+		return l >= r, nil
+	}
+	return nil, fmt.Errorf("invalid operation: int %s int", op)
+}
+
+func floatOp(op string, l, r float64) (interface{}, error) {
+	switch op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		return l / r, nil
+	case "==":
+		return l == r, nil
+	case "!=":
+		return l != r, nil
+	case "<":
+		return l < r, nil
+	case ">":
+		return l > r, nil
+	case "<=":
+		return l <= r, nil
+	case ">=":
+		return l >= r, nil
+	}
+	return nil, fmt.Errorf("invalid operation: float %s float", op)
+}
+
+func stringOp(op string, l, r string) (interface{}, error) {
+	switch op {
+	case "+":
+		return l + r, nil
+	case "==":
+		return l == r, nil
+	case "!=":
+		return l != r, nil
+	case "<":
+		return l < r, nil
+	case ">":
+		return l > r, nil
+	case "<=":
+		return l <= r, nil
+	case ">=":
+		return l >= r, nil
+	}
+	return nil, fmt.Errorf("invalid operation: string %s string", op)
+}
\ No newline at end of file
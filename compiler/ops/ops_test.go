@@ -0,0 +1,73 @@
+package ops
+
+import (
+	"math"
+	"testing"
+)
+
+// channel stands in for a backend's channel.
+type channel struct{ elem string }
+
+func (c *channel) TypeName() string { return "channel<" + c.elem + ">" }
+
+func TestBinary(t *testing.T) {
+	ch := &channel{"int"}
+	tests := []struct {
+		op          string
+		left, right interface{}
+		expected    interface{}
+		err         string
+	}{
+		{"+", int64(2), int64(3), int64(5), ""},
+		{"/", int64(7), int64(2), int64(3), ""},
+		{"/", int64(math.MinInt64), int64(-1), int64(math.MinInt64), ""},
+		{"/", int64(1), int64(0), nil, "integer divide by zero"},
+		{"+", int64(1), 0.5, 1.5, ""},
+		{"<", 0.5, int64(1), true, ""},
+		{"+", "chore", "lang", "chorelang", ""},
+		{"-", "a", "b", nil, "invalid operation: string - string"},
+		{"==", true, true, true, ""},
+		{"<", true, false, nil, "invalid operation: bool < bool"},
+		{"==", ch, ch, true, ""},
+		{"!=", ch, &channel{"int"}, true, ""},
+		{"==", ch, &channel{"string"}, nil, "invalid operation: channel<int> == channel<string>"},
+		{"=~", "hello", "^h", true, ""},
+		{"=~", "hello", "(", nil, "invalid pattern \"(\": error parsing regexp: missing closing ): `(`"},
+		{"=~", int64(1), "1", nil, "=~ needs a string and a pattern string, got int and string"},
+		{"+", "1", int64(1), nil, "invalid operation: string + int"},
+	}
+	
+	for _, tt := range tests {
+		got, err := Binary(tt.op, tt.left, tt.right)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%v %s %v: got error %v, want %q", tt.left, tt.op, tt.right, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.expected {
+			t.Errorf("%v %s %v = %v, %v; want %v", tt.left, tt.op, tt.right, got, err, tt.expected)
+		}
+	}
+}
+
+func TestTypeName(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{int64(1), "int"},
+		{1.5, "float"},
+		{"s", "string"},
+		{false, "bool"},
+		{nil, "nothing"},
+		{&channel{"bool"}, "channel<bool>"},
+		{int32(1), "int32"},
+	}
+	
+	for _, tt := range tests {
+		if got := TypeName(tt.value); got != tt.expected {
+			t.Errorf("TypeName(%#v) = %q, want %q", tt.value, got, tt.expected)
+		}
+	}
+}
\ No newline at end of file
@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	
 	"github.com/chorlang/chorlang/compiler/ast"
 	"github.com/chorlang/chorlang/compiler/lexer"
@@ -31,6 +32,18 @@ type Parser struct {
 	curToken  lexer.Token
 	peekToken lexer.Token
 	
+	// Comments are not tokens the grammar sees. They wait in pending until
+	// the statement, case or block they belong to takes them.
+	pending []*ast.Comment
+	trivia  map[ast.Node]*ast.Trivia
+	
+	// lastLine is the line the last token or comment read ended on, and
+	// curBlank and peekBlank report whether a blank line came before
+	// curToken and peekToken
+	lastLine  int
+	curBlank  bool
+	peekBlank bool
+	
 	prefixParseFns map[lexer.TokenType]prefixParseFn
 	infixParseFns  map[lexer.TokenType]infixParseFn
 }
@@ -39,6 +52,7 @@ func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
 		errors: []string{},
+		trivia: make(map[ast.Node]*ast.Trivia),
 	}
 	
 	p.prefixParseFns = make(map[lexer.TokenType]prefixParseFn)
@@ -52,6 +66,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(lexer.SPIN, p.parseSpinExpression)
 	p.registerPrefix(lexer.FLOW, p.parseFlowExpression)
 	p.registerPrefix(lexer.MATCH, p.parseMatchExpression)
+	p.registerPrefix(lexer.SEND, p.parseReceiveExpression)
 	
 	p.infixParseFns = make(map[lexer.TokenType]infixParseFn)
 	p.registerInfix(lexer.PLUS, p.parseInfixExpression)
@@ -65,6 +80,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(lexer.LTE, p.parseInfixExpression)
 	p.registerInfix(lexer.GTE, p.parseInfixExpression)
 	p.registerInfix(lexer.MATCH_OP, p.parseInfixExpression)
+	p.registerInfix(lexer.DOT, p.parseMemberCallExpression)
 	
 	// Read two tokens, so curToken and peekToken are both set
 	p.nextToken()
@@ -74,8 +90,78 @@ func New(l *lexer.Lexer) *Parser {
 }
 
 func (p *Parser) nextToken() {
-	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+	p.curToken, p.curBlank = p.peekToken, p.peekBlank
+	
+	for {
+		tok := p.l.NextToken()
+		blank := tok.Line > p.lastLine+1
+		p.lastLine = tok.Line + strings.Count(tok.Literal, "\n")
+		
+		if tok.Type != lexer.COMMENT {
+			p.peekToken, p.peekBlank = tok, blank
+			return
+		}
+		p.pending = append(p.pending, &ast.Comment{Token: tok, Text: tok.Literal, BlankBefore: blank})
+	}
+}
+
+// takeComments removes and returns the pending comments that come before
+// tok.
+func (p *Parser) takeComments(tok lexer.Token) []*ast.Comment {
+	n := 0
+	for n < len(p.pending) && before(p.pending[n].Token, tok) {
+		n++
+	}
+	taken := p.pending[:n:n]
+	p.pending = p.pending[n:]
+	return taken
+}
+
+// takeTrailing removes and returns the comment that follows last on the
+// line last ends on, if there is one.
+func (p *Parser) takeTrailing(last lexer.Token) *ast.Comment {
+	end := last.Line + strings.Count(last.Literal, "\n")
+	if len(p.pending) == 0 || p.pending[0].Token.Line != end {
+		return nil
+	}
+	c := p.pending[0]
+	p.pending = p.pending[1:]
+	return c
+}
+
+// attach records the trivia of a node that ends at curToken, given the
+// comments that came before it. Comments from inside the node join the
+// leading ones, so no comment is lost.
+func (p *Parser) attach(node ast.Node, blank bool, leading []*ast.Comment) {
+	t := &ast.Trivia{Leading: leading, BlankBefore: blank}
+	t.Leading = append(t.Leading, p.takeComments(p.curToken)...)
+	t.Trailing = p.takeTrailing(p.curToken)
+	
+	if len(t.Leading) > 0 || t.Trailing != nil || t.BlankBefore {
+		p.trivia[node] = t
+	}
+}
+
+// dangle records the comments before the closing token of node.
+func (p *Parser) dangle(node ast.Node, closing lexer.Token) {
+	comments := p.takeComments(closing)
+	if closing.Type == lexer.EOF {
+		comments = append(comments, p.pending...)
+		p.pending = nil
+	}
+	if len(comments) == 0 {
+		return
+	}
+	t, ok := p.trivia[node]
+	if !ok {
+		t = &ast.Trivia{}
+		p.trivia[node] = t
+	}
+	t.Dangling = comments
+}
+
+func before(a, b lexer.Token) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
 }
 
 func (p *Parser) curTokenIs(t lexer.TokenType) bool {
@@ -101,9 +187,14 @@ func (p *Parser) Errors() []string {
 }
 
 func (p *Parser) peekError(t lexer.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
+	p.errorAt(p.peekToken, "expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+}
+
+// errorAt records an error at tok, prefixed with its position as the
+// resolver's errors are.
+func (p *Parser) errorAt(tok lexer.Token, format string, args ...interface{}) {
+	p.errors = append(p.errors, fmt.Sprintf("%d:%d: ", tok.Line, tok.Column)+fmt.Sprintf(format, args...))
 }
 
 func (p *Parser) registerPrefix(tokenType lexer.TokenType, fn prefixParseFn) {
@@ -119,20 +210,44 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 	
 	for !p.curTokenIs(lexer.EOF) {
-		stmt := p.parseStatement()
+		stmt := p.parseListedStatement()
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
 		p.nextToken()
 	}
 	
+	p.dangle(program, p.curToken)
+	program.Trivia = p.trivia
+	
 	return program
 }
 
+// parseListedStatement parses a statement of a program or block together
+// with its comments.
+func (p *Parser) parseListedStatement() ast.Statement {
+	blank := p.curBlank
+	leading := p.takeComments(p.curToken)
+	
+	stmt := p.parseStatement()
+	if stmt == nil {
+		p.pending = append(leading, p.pending...)
+		return nil
+	}
+	
+	p.attach(stmt, blank, leading)
+	return stmt
+}
+
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case lexer.DANCE:
 		return p.parseDanceStatement()
+	case lexer.FLOW:
+		if p.peekTokenIs(lexer.IDENT) {
+			return p.parseFlowStatement()
+		}
+		return p.parseExpressionStatement()
 	case lexer.SWAY:
 		return p.parseSwayStatement()
 	case lexer.START:
@@ -141,6 +256,15 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseSendStatement()
 	case lexer.IF:
 		return p.parseIfStatement()
+	case lexer.REHEARSE:
+		return p.parseRehearseStatement()
+	case lexer.ENCORE:
+		return p.parseEncoreStatement()
+	case lexer.IDENT:
+		if p.peekTokenIs(lexer.ASSIGN) {
+			return p.parseAssignStatement()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -170,6 +294,60 @@ func (p *Parser) parseDanceStatement() *ast.DanceStatement {
 	return stmt
 }
 
+// parseFlowStatement parses the two channel declaration forms,
+// `flow ch = <expr>` and `flow channel<int> ch`, into a DanceStatement.
+func (p *Parser) parseFlowStatement() *ast.DanceStatement {
+	stmt := &ast.DanceStatement{Token: p.curToken}
+	
+	p.nextToken()
+	
+	if p.curToken.Literal == "channel" && p.peekTokenIs(lexer.LT) {
+		value := &ast.FlowExpression{Token: stmt.Token}
+		if !p.parseChannelType(value) {
+			return nil
+		}
+		
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		
+		stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		stmt.Value = value
+	} else {
+		stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		
+		if !p.expectPeek(lexer.ASSIGN) {
+			return nil
+		}
+		
+		p.nextToken()
+		stmt.Value = p.parseExpression(LOWEST)
+	}
+	
+	if p.peekTokenIs(lexer.SEMICOLON) {
+		p.nextToken()
+	}
+	
+	return stmt
+}
+
+func (p *Parser) parseAssignStatement() *ast.AssignStatement {
+	stmt := &ast.AssignStatement{Token: p.curToken}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	
+	// Skip the = token
+	p.nextToken()
+	p.nextToken()
+	
+	stmt.Value = p.parseExpression(LOWEST)
+	
+	if p.peekTokenIs(lexer.SEMICOLON) {
+		p.nextToken()
+	}
+	
+	return stmt
+}
+
 func (p *Parser) parseSwayStatement() *ast.SwayStatement {
 	stmt := &ast.SwayStatement{Token: p.curToken}
 	
@@ -207,7 +385,11 @@ func (p *Parser) parseStartStatement() *ast.StartStatement {
 	
 	p.nextToken()
 	
-	stmt.Statement = p.parseStatement()
+	if p.curTokenIs(lexer.LBRACE) {
+		stmt.Statement = p.parseBlockStatement()
+	} else {
+		stmt.Statement = p.parseStatement()
+	}
 	
 	return stmt
 }
@@ -257,6 +439,42 @@ func (p *Parser) parseIfStatement() *ast.IfStatement {
 	return stmt
 }
 
+func (p *Parser) parseRehearseStatement() *ast.RehearseStatement {
+	stmt := &ast.RehearseStatement{Token: p.curToken}
+	
+	if !p.expectPeek(lexer.STRING) {
+		return nil
+	}
+	
+	stmt.Name = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	
+	if !p.expectPeek(lexer.LBRACE) {
+		return nil
+	}
+	
+	stmt.Body = p.parseBlockStatement()
+	
+	return stmt
+}
+
+func (p *Parser) parseEncoreStatement() *ast.EncoreStatement {
+	stmt := &ast.EncoreStatement{Token: p.curToken}
+	
+	if !p.expectPeek(lexer.STRING) {
+		return nil
+	}
+	
+	stmt.Name = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	
+	if !p.expectPeek(lexer.LBRACE) {
+		return nil
+	}
+	
+	stmt.Body = p.parseBlockStatement()
+	
+	return stmt
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 	
@@ -300,8 +518,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorAt(p.curToken, "could not parse %q as integer", p.curToken.Literal)
 		return nil
 	}
 	
@@ -315,8 +532,7 @@ func (p *Parser) parseFloatLiteral() ast.Expression {
 	
 	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as float", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorAt(p.curToken, "could not parse %q as float", p.curToken.Literal)
 		return nil
 	}
 	
@@ -351,6 +567,12 @@ func (p *Parser) parseSpinExpression() ast.Expression {
 	p.nextToken()
 	exp.Function = p.parseExpression(LOWEST)
 	
+	// A member call is a call already
+	if member, ok := exp.Function.(*ast.MemberCallExpression); ok {
+		p.errorAt(exp.Token, "%s is called without spin", member.String())
+		return nil
+	}
+	
 	if !p.expectPeek(lexer.LPAREN) {
 		return nil
 	}
@@ -364,11 +586,43 @@ func (p *Parser) parseFlowExpression() ast.Expression {
 	exp := &ast.FlowExpression{Token: p.curToken}
 	
 	p.nextToken()
+	
+	if p.curToken.Literal == "channel" && p.peekTokenIs(lexer.LT) {
+		if !p.parseChannelType(exp) {
+			return nil
+		}
+		return exp
+	}
+	
 	exp.ChannelType = p.parseExpression(LOWEST)
 	
 	return exp
 }
 
+// parseChannelType parses `channel<T>` with curToken on `channel`.
+func (p *Parser) parseChannelType(exp *ast.FlowExpression) bool {
+	exp.ChannelType = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	
+	p.nextToken()
+	
+	if !p.expectPeek(lexer.IDENT) {
+		return false
+	}
+	
+	exp.ElementType = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	
+	return p.expectPeek(lexer.GT)
+}
+
+func (p *Parser) parseReceiveExpression() ast.Expression {
+	exp := &ast.ReceiveExpression{Token: p.curToken}
+	
+	p.nextToken()
+	exp.Channel = p.parseExpression(PREFIX)
+	
+	return exp
+}
+
 func (p *Parser) parseMatchExpression() ast.Expression {
 	exp := &ast.MatchExpression{Token: p.curToken}
 	
@@ -383,16 +637,30 @@ func (p *Parser) parseMatchExpression() ast.Expression {
 	
 	p.nextToken()
 	
+	errors := len(p.errors)
 	for !p.curTokenIs(lexer.RBRACE) && !p.curTokenIs(lexer.EOF) {
-		if p.curTokenIs(lexer.WHEN) {
+		switch {
+		case p.curTokenIs(lexer.WHEN):
+			blank := p.curBlank
+			leading := p.takeComments(p.curToken)
 			whenCase := p.parseWhenCase()
 			if whenCase != nil {
 				exp.Cases = append(exp.Cases, whenCase)
+				p.attach(whenCase, blank, leading)
+			} else {
+				p.pending = append(leading, p.pending...)
 			}
+		case p.curTokenIs(lexer.SEMICOLON):
+		case len(p.errors) == errors:
+			// Skipping it unreported would drop it from the program, and
+			// from what fmt writes back; one error per match is enough
+			p.errorAt(p.curToken, "expected when or } in match, got %q", p.curToken.Literal)
 		}
 		p.nextToken()
 	}
 	
+	p.dangle(exp, p.curToken)
+	
 	return exp
 }
 
@@ -400,7 +668,7 @@ func (p *Parser) parseWhenCase() *ast.WhenCase {
 	whenCase := &ast.WhenCase{Token: p.curToken}
 	
 	p.nextToken()
-	whenCase.Pattern = p.parsePattern()
+	p.parsePattern(whenCase)
 	
 	if !p.expectPeek(lexer.COLON) {
 		return nil
@@ -412,21 +680,25 @@ func (p *Parser) parseWhenCase() *ast.WhenCase {
 	return whenCase
 }
 
-func (p *Parser) parsePattern() ast.Expression {
-	// For now, we'll parse patterns as expressions
-	// This handles simple patterns like Note(n), Rest(), etc.
-	pattern := p.parseExpression(CALL)
+// parsePattern parses a case pattern. Patterns are expressions, which may
+// be followed by parameter names as in Note(n) and Rest().
+func (p *Parser) parsePattern(whenCase *ast.WhenCase) {
+	whenCase.Pattern = p.parseExpression(CALL)
 	
-	// Skip optional parentheses for pattern parameters
-	if p.peekTokenIs(lexer.LPAREN) {
-		p.nextToken()
-		// Parse pattern parameters if any
-		for !p.curTokenIs(lexer.RPAREN) && !p.curTokenIs(lexer.EOF) {
-			p.nextToken()
-		}
+	if !p.peekTokenIs(lexer.LPAREN) {
+		return
 	}
+	p.nextToken()
 	
-	return pattern
+	// Only names are kept; anything else between the parentheses is
+	// skipped
+	whenCase.Parameters = []*ast.Identifier{}
+	for !p.curTokenIs(lexer.RPAREN) && !p.curTokenIs(lexer.EOF) {
+		if p.curTokenIs(lexer.IDENT) {
+			whenCase.Parameters = append(whenCase.Parameters, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+		}
+		p.nextToken()
+	}
 }
 
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
@@ -450,16 +722,38 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	p.nextToken()
 	
 	for !p.curTokenIs(lexer.RBRACE) && !p.curTokenIs(lexer.EOF) {
-		stmt := p.parseStatement()
+		stmt := p.parseListedStatement()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
 		p.nextToken()
 	}
 	
+	p.dangle(block, p.curToken)
+	
 	return block
 }
 
+// parseMemberCallExpression parses `.member(arguments)` after receiver,
+// with curToken on the dot.
+func (p *Parser) parseMemberCallExpression(receiver ast.Expression) ast.Expression {
+	exp := &ast.MemberCallExpression{Token: p.curToken, Receiver: receiver}
+	
+	if !p.expectPeek(lexer.IDENT) {
+		return nil
+	}
+	
+	exp.Member = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	
+	if !p.expectPeek(lexer.LPAREN) {
+		return nil
+	}
+	
+	exp.Arguments = p.parseExpressionList(lexer.RPAREN)
+	
+	return exp
+}
+
 func (p *Parser) parseExpressionList(end lexer.TokenType) []ast.Expression {
 	list := []ast.Expression{}
 	
@@ -496,6 +790,7 @@ var precedences = map[lexer.TokenType]int{
 	lexer.MINUS:    SUM,
 	lexer.SLASH:    PRODUCT,
 	lexer.ASTERISK: PRODUCT,
+	lexer.DOT:      CALL,
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -515,6 +810,5 @@ func (p *Parser) curPrecedence() int {
 }
 
 func (p *Parser) noPrefixParseFnError(t lexer.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.curToken, "no prefix parse function for %s found", t)
 }
\ No newline at end of file
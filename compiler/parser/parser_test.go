@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"strings"
 	"testing"
 	
 	"github.com/chorlang/chorlang/compiler/ast"
@@ -43,6 +44,35 @@ func TestDanceStatements(t *testing.T) {
 	}
 }
 
+func TestAssignStatement(t *testing.T) {
+	input := `
+dance count = 0
+count = count + 1
+`
+	
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+	
+	stmt, ok := program.Statements[1].(*ast.AssignStatement)
+	if !ok {
+		t.Fatalf("program.Statements[1] is not ast.AssignStatement. got=%T",
+			program.Statements[1])
+	}
+	
+	if !testIdentifier(t, stmt.Name, "count") {
+		return
+	}
+	
+	testInfixExpression(t, stmt.Value, "count", "+", 1)
+}
+
 func TestSwayStatement(t *testing.T) {
 	input := `
 sway i from 0 to 10 {
@@ -121,6 +151,56 @@ func TestSpinExpression(t *testing.T) {
 	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
 }
 
+func TestMemberCallExpression(t *testing.T) {
+	input := "flow fs = chore.fs()\nfs.write(\"a.txt\", fs.read(\"b.txt\") + \"!\")"
+	
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+	
+	open, ok := program.Statements[0].(*ast.DanceStatement).Value.(*ast.MemberCallExpression)
+	if !ok {
+		t.Fatalf("flow value is not ast.MemberCallExpression. got=%T",
+			program.Statements[0].(*ast.DanceStatement).Value)
+	}
+	if !testIdentifier(t, open.Receiver, "chore") || !testIdentifier(t, open.Member, "fs") {
+		return
+	}
+	if len(open.Arguments) != 0 || open.Token.Line != 1 || open.Token.Column != 16 {
+		t.Errorf("chore.fs() parsed as %q at %d:%d", open.String(), open.Token.Line, open.Token.Column)
+	}
+	
+	stmt, ok := program.Statements[1].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T",
+			program.Statements[1])
+	}
+	if got := stmt.Expression.String(); got != `fs.write("a.txt", (fs.read("b.txt") + "!"))` {
+		t.Errorf("member calls parsed as %s", got)
+	}
+}
+
+func TestMemberCallErrors(t *testing.T) {
+	tests := map[string]string{
+		`spin fs.read("a")`: `1:1: fs.read("a") is called without spin`,
+		"dance n = fs.size": "1:17: expected next token to be (, got EOF instead",
+		"dance n = fs.(1)":  "1:14: expected next token to be IDENT, got ( instead",
+	}
+	
+	for input, expected := range tests {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != expected {
+			t.Errorf("%q: errors %q, expected %q first", input, p.Errors(), expected)
+		}
+	}
+}
+
 func TestStartStatement(t *testing.T) {
 	input := `start sway i from 0 to 3 {
     send steps <- i
@@ -153,6 +233,94 @@ func TestStartStatement(t *testing.T) {
 	}
 }
 
+func TestStartBlockWithReceive(t *testing.T) {
+	input := `start {
+    dance job = <-jobs
+    send results <- job * 2
+}`
+	
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+	
+	stmt, ok := program.Statements[0].(*ast.StartStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.StartStatement. got=%T",
+			program.Statements[0])
+	}
+	
+	block, ok := stmt.Statement.(*ast.BlockStatement)
+	if !ok {
+		t.Fatalf("stmt.Statement is not ast.BlockStatement. got=%T", stmt.Statement)
+	}
+	
+	if len(block.Statements) != 2 {
+		t.Fatalf("block does not contain 2 statements. got=%d", len(block.Statements))
+	}
+	
+	dance := block.Statements[0].(*ast.DanceStatement)
+	recv, ok := dance.Value.(*ast.ReceiveExpression)
+	if !ok {
+		t.Fatalf("dance.Value is not ast.ReceiveExpression. got=%T", dance.Value)
+	}
+	testIdentifier(t, recv.Channel, "jobs")
+	
+	send := block.Statements[1].(*ast.SendStatement)
+	testInfixExpression(t, send.Value, "job", "*", 2)
+}
+
+func TestFlowDeclarations(t *testing.T) {
+	tests := []struct {
+		input       string
+		name        string
+		elementType string
+	}{
+		{"flow jobs = flow channel<int>", "jobs", "int"},
+		{"flow channel<string> names", "names", "string"},
+	}
+	
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+		
+		stmt, ok := program.Statements[0].(*ast.DanceStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.DanceStatement. got=%T",
+				program.Statements[0])
+		}
+		
+		if stmt.Token.Type != lexer.FLOW {
+			t.Errorf("stmt.Token is not FLOW. got=%s", stmt.Token.Type)
+		}
+		
+		if !testIdentifier(t, stmt.Name, tt.name) {
+			continue
+		}
+		
+		flow, ok := stmt.Value.(*ast.FlowExpression)
+		if !ok {
+			t.Fatalf("stmt.Value is not ast.FlowExpression. got=%T", stmt.Value)
+		}
+		
+		if flow.ElementType == nil || flow.ElementType.Value != tt.elementType {
+			t.Errorf("flow.ElementType wrong. expected=%s, got=%v", tt.elementType, flow.ElementType)
+		}
+	}
+}
+
 func TestIfStatement(t *testing.T) {
 	input := `if x < y {
     dance z = x
@@ -197,8 +365,8 @@ func TestIfStatement(t *testing.T) {
 
 func TestMatchExpression(t *testing.T) {
 	input := `dance result = match item {
-    when Note(n): flow process_note(n)
-    when Rest(): flow handle_rest()
+    when Note(n): flow spin process_note(n)
+    when Rest(): flow spin handle_rest()
 }`
 	
 	l := lexer.New(input)
@@ -229,6 +397,121 @@ func TestMatchExpression(t *testing.T) {
 	if len(match.Cases) != 2 {
 		t.Fatalf("match.Cases does not contain 2 cases. got=%d", len(match.Cases))
 	}
+	
+	if params := match.Cases[0].Parameters; len(params) != 1 || params[0].Value != "n" {
+		t.Errorf("Note(n) parameters wrong. got=%v", params)
+	}
+	if params := match.Cases[1].Parameters; params == nil || len(params) != 0 {
+		t.Errorf("Rest() should have an empty parameter list. got=%v", params)
+	}
+}
+
+func TestMatchRejectsStrayTokens(t *testing.T) {
+	tests := map[string]string{
+		"match x {\n 7 -> \"seven\"\n _ -> \"other\"\n}":        `2:2: expected when or } in match, got "7"`,
+		"match x {\n when 1: flow f(1)\n}":                      `2:16: expected when or } in match, got "("`,
+		"match x {\n when 1: flow \"a\"; when 2: flow \"b\"\n}": "",
+	}
+	
+	for input, expected := range tests {
+		p := New(lexer.New("dance r = " + input))
+		p.ParseProgram()
+		if got := strings.Join(p.Errors(), "\n"); got != expected {
+			t.Errorf("%q: errors %q, expected %q", input, got, expected)
+		}
+	}
+}
+
+func TestCommentsAttachToStatements(t *testing.T) {
+	input := `// leading
+dance x = 1 // trailing
+
+// after a blank line
+if x > 0 {
+    spin print(x)
+    // dangling
+}
+// at the end`
+	
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	
+	dance := program.TriviaOf(program.Statements[0])
+	if len(dance.Leading) != 1 || dance.Leading[0].Text != "// leading" {
+		t.Errorf("leading comment wrong. got=%+v", dance.Leading)
+	}
+	if dance.Trailing == nil || dance.Trailing.Text != "// trailing" {
+		t.Errorf("trailing comment wrong. got=%+v", dance.Trailing)
+	}
+	
+	ifTrivia := program.TriviaOf(program.Statements[1])
+	if len(ifTrivia.Leading) != 1 || !ifTrivia.Leading[0].BlankBefore || ifTrivia.BlankBefore {
+		t.Errorf("blank line before the comment not recorded. got=%+v", ifTrivia)
+	}
+	
+	block := program.Statements[1].(*ast.IfStatement).Consequence
+	if dangling := program.TriviaOf(block).Dangling; len(dangling) != 1 || dangling[0].Text != "// dangling" {
+		t.Errorf("dangling block comment wrong. got=%+v", dangling)
+	}
+	if dangling := program.TriviaOf(program).Dangling; len(dangling) != 1 || dangling[0].Text != "// at the end" {
+		t.Errorf("dangling program comment wrong. got=%+v", dangling)
+	}
+}
+
+func TestRehearseStatement(t *testing.T) {
+	input := `rehearse "adds numbers" {
+    spin expect(1 + 2, 3)
+}`
+	
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+	
+	stmt, ok := program.Statements[0].(*ast.RehearseStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.RehearseStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Name.Value != "adds numbers" {
+		t.Errorf("stmt.Name.Value not 'adds numbers'. got=%q", stmt.Name.Value)
+	}
+	if len(stmt.Body.Statements) != 1 {
+		t.Fatalf("stmt.Body does not contain 1 statement. got=%d", len(stmt.Body.Statements))
+	}
+	
+	for _, bad := range []string{"rehearse {\n}", "rehearse \"x\" spin print(1)"} {
+		p := New(lexer.New(bad))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("input %q: expected a parse error", bad)
+		}
+	}
+}
+
+func TestEncoreStatement(t *testing.T) {
+	input := `encore "sums" {
+    dance total = 0
+}`
+	
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	
+	stmt, ok := program.Statements[0].(*ast.EncoreStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.EncoreStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Name.Value != "sums" || len(stmt.Body.Statements) != 1 {
+		t.Errorf("encore parsed wrong. got=%s", stmt.String())
+	}
 }
 
 func testDanceStatement(t *testing.T, s ast.Statement, name string) bool {
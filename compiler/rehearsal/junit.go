@@ -0,0 +1,126 @@
+package rehearsal
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Suite is the results of one test file. Err is set instead when the file
+// could not be loaded, and so nothing ran.
+type Suite struct {
+	File    string
+	Results []Result
+	Err     string
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// JUnit writes suites as JUnit XML, the report format CI systems read. A
+// file that could not be loaded is reported as one errored test case.
+func JUnit(w io.Writer, suites []Suite) error {
+	report := junitSuites{}
+	var total time.Duration
+	for _, s := range suites {
+		suite := junitSuite{Name: s.File}
+		var elapsed time.Duration
+		if s.Err != "" {
+			suite.Errors = 1
+			suite.Cases = append(suite.Cases, junitCase{
+				Name: "load", Classname: s.File, Time: seconds(0),
+				Error: &junitMessage{Message: firstLine(s.Err), Text: s.Err},
+			})
+		}
+		for _, r := range s.Results {
+			c := junitCase{Name: r.Name, Classname: s.File, Time: seconds(r.Elapsed), SystemOut: r.Output}
+			if !r.Passed() {
+				suite.Failures++
+				var text strings.Builder
+				for _, f := range r.Failures {
+					text.WriteString(FormatFailure(s.File, f))
+				}
+				c.Failure = &junitMessage{Message: firstLine(r.Failures[0].Message), Text: text.String()}
+			}
+			suite.Cases = append(suite.Cases, c)
+			elapsed += r.Elapsed
+		}
+		suite.Tests = len(suite.Cases)
+		suite.Time = seconds(elapsed)
+		
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Errors += suite.Errors
+		report.Suites = append(report.Suites, suite)
+		total += elapsed
+	}
+	report.Time = seconds(total)
+	
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// FormatFailure describes a failure as file:line:column, the source line
+// it happened on and the message, indented below it:
+//
+//	math_test.chore:4:5: spin expect(add(1, 2), 4)
+//	    got 3, want 4
+func FormatFailure(file string, f Failure) string {
+	var out strings.Builder
+	if f.Line > 0 {
+		fmt.Fprintf(&out, "%s:%d:%d: %s\n", file, f.Line, f.Column, f.Source)
+	} else {
+		fmt.Fprintf(&out, "%s:\n", file)
+	}
+	for _, line := range strings.Split(strings.TrimRight(f.Message, "\n"), "\n") {
+		fmt.Fprintf(&out, "    %s\n", line)
+	}
+	return out.String()
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func firstLine(s string) string {
+	return strings.SplitN(s, "\n", 2)[0]
+}
\ No newline at end of file
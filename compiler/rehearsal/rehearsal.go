@@ -0,0 +1,170 @@
+// Package rehearsal runs the rehearse blocks of ChoreLang test files:
+//
+//	rehearse "adds numbers" {
+//	    spin expect(1 + 2, 3)
+//	}
+//
+// Each rehearsal runs the whole file afresh on the interpreter, with that
+// rehearsal's body in place and the others skipped, so the statements
+// around the rehearsals set up every one of them alike and no rehearsal
+// sees another's changes. That also lets rehearsals run in parallel.
+package rehearsal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/deadlock"
+	"github.com/chorlang/chorlang/compiler/interp"
+)
+
+// Rehearsal is a rehearse block, named as the source writes it.
+type Rehearsal struct {
+	Name         string
+	Line, Column int
+}
+
+// List returns the rehearsals of a program in source order.
+func List(program *ast.Program) []Rehearsal {
+	var list []Rehearsal
+	for _, stmt := range program.Statements {
+		if r, ok := stmt.(*ast.RehearseStatement); ok {
+			list = append(list, Rehearsal{Name: r.Name.Value, Line: r.Token.Line, Column: r.Token.Column})
+		}
+	}
+	return list
+}
+
+// Options control which rehearsals run and how.
+type Options struct {
+	// Run selects the rehearsals whose names it matches; nil runs all.
+	Run *regexp.Regexp
+	
+	// Timeout fails a rehearsal that runs longer; zero means no limit.
+	Timeout time.Duration
+	
+	// Parallel is how many rehearsals run at once, at least one.
+	Parallel int
+	
+	// Count, if set, is called as each statement starts, as the
+	// interpreter's hook of the same name. Rehearsals running at once call
+	// it concurrently.
+	Count func(ast.Statement)
+	
+	// Schedule, if set, runs every rehearsal under it, so its dancers take
+	// turns in the order the seed draws.
+	Schedule *interp.Schedule
+}
+
+// Failure is why a rehearsal failed: a failed expect, a runtime error, a
+// call to exit or a timeout. Source is the line of source it happened on,
+// trimmed, or "" when it has no position.
+type Failure struct {
+	Line, Column int
+	Source       string
+	Message      string
+}
+
+// Result is the outcome of one rehearsal.
+type Result struct {
+	Rehearsal
+	Failures []Failure
+	Output   string // what the rehearsal printed
+	Elapsed  time.Duration
+	
+	// Schedule is the schedule the rehearsal ran under, nil if none
+	Schedule *interp.Schedule
+}
+
+// Passed reports whether the rehearsal had no failures.
+func (r Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// Run runs the selected rehearsals of a resolved program, whose source is
+// used to show where failures happened. Results come in source order.
+func Run(program *ast.Program, source []byte, opts Options) []Result {
+	var selected []Rehearsal
+	for _, r := range List(program) {
+		if opts.Run == nil || opts.Run.MatchString(r.Name) {
+			selected = append(selected, r)
+		}
+	}
+	
+	parallel := opts.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+	lines := strings.Split(string(source), "\n")
+	results := make([]Result, len(selected))
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, r := range selected {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, r Rehearsal) {
+			defer wg.Done()
+			results[i] = perform(program, lines, r, opts)
+			<-slots
+		}(i, r)
+	}
+	wg.Wait()
+	return results
+}
+
+// perform runs one rehearsal on a fresh interpreter.
+func perform(program *ast.Program, lines []string, r Rehearsal, opts Options) Result {
+	var out bytes.Buffer
+	in := interp.New(&out)
+	in.Rehearsal = r.Name
+	in.Limits.Time = opts.Timeout
+	in.Count = opts.Count
+	in.Schedule = opts.Schedule
+	
+	start := time.Now()
+	err := in.Run(program)
+	result := Result{Rehearsal: r, Elapsed: time.Since(start), Schedule: opts.Schedule}
+	
+	failure := func(line, column int, message string) {
+		f := Failure{Line: line, Column: column, Message: message}
+		if line > 0 && line <= len(lines) {
+			f.Source = strings.TrimSpace(lines[line-1])
+		}
+		result.Failures = append(result.Failures, f)
+	}
+	for _, f := range in.Failures() {
+		failure(f.Line, f.Column, f.Message)
+	}
+	
+	var runtimeErr *interp.RuntimeError
+	var deadlockErr *interp.DeadlockError
+	var exitErr *interp.ExitError
+	var limitErr *interp.LimitError
+	switch {
+	case err == nil:
+	case errors.As(err, &runtimeErr):
+		failure(runtimeErr.Line, runtimeErr.Column, "runtime error: "+runtimeErr.Message)
+	case errors.As(err, &deadlockErr):
+		// The message goes on to say which dancers are blocked where
+		var message strings.Builder
+		message.WriteString("runtime error: all dancers are asleep - deadlock!\n")
+		deadlock.Find(program).Write(&message, deadlockErr.Blocked, false)
+		failure(deadlockErr.Line, deadlockErr.Column, message.String())
+	case errors.As(err, &exitErr):
+		failure(r.Line, r.Column, fmt.Sprintf("rehearsal called exit(%d)", exitErr.Code))
+	case errors.As(err, &limitErr):
+		// The time limit is the only one rehearsals run with
+		failure(r.Line, r.Column, fmt.Sprintf("rehearsal timed out after %v", opts.Timeout))
+	default:
+		failure(0, 0, err.Error())
+	}
+	
+	result.Output = out.String()
+	return result
+}
\ No newline at end of file
@@ -0,0 +1,188 @@
+package rehearsal
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/interp"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/parser"
+)
+
+const sample = `dance base = 10
+
+rehearse "adds" {
+    spin expect(base + 1, 11)
+}
+
+rehearse "fails" {
+    spin print("working")
+    spin expect(base + 2, 13)
+}
+
+rehearse "divides" {
+    dance zero = 0
+    spin print(base / zero)
+}
+
+rehearse "exits" {
+    spin exit(3)
+}
+
+rehearse "hangs" {
+    sway i from 1 to 1000000000 {
+    }
+}
+`
+
+func TestList(t *testing.T) {
+	list := List(parse(t, sample))
+	if len(list) != 5 {
+		t.Fatalf("expected 5 rehearsals, got %v", list)
+	}
+	if list[1] != (Rehearsal{Name: "fails", Line: 7, Column: 1}) {
+		t.Errorf("second rehearsal wrong: %+v", list[1])
+	}
+}
+
+func TestRun(t *testing.T) {
+	results := Run(parse(t, sample), []byte(sample), Options{Timeout: 50 * time.Millisecond, Parallel: 2})
+	expected := []struct {
+		name    string
+		failure string
+	}{
+		{"adds", ""},
+		{"fails", "9:5: spin expect(base + 2, 13): got 12, want 13"},
+		{"divides", "14:21: spin print(base / zero): runtime error: integer divide by zero"},
+		{"exits", "17:1: rehearse \"exits\" {: rehearsal called exit(3)"},
+		{"hangs", "21:1: rehearse \"hangs\" {: rehearsal timed out after 50ms"},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results, got %d", len(expected), len(results))
+	}
+	for i, tt := range expected {
+		r := results[i]
+		if r.Name != tt.name {
+			t.Errorf("result %d: expected %s, got %s", i, tt.name, r.Name)
+			continue
+		}
+		if tt.failure == "" {
+			if !r.Passed() {
+				t.Errorf("%s: expected to pass, got %+v", r.Name, r.Failures)
+			}
+			continue
+		}
+		if len(r.Failures) != 1 {
+			t.Errorf("%s: expected 1 failure, got %+v", r.Name, r.Failures)
+			continue
+		}
+		f := r.Failures[0]
+		if got := describe(f); got != tt.failure {
+			t.Errorf("%s: expected failure %q, got %q", r.Name, tt.failure, got)
+		}
+	}
+	if results[1].Output != "working\n" {
+		t.Errorf("output not captured: %q", results[1].Output)
+	}
+	
+	selected := Run(parse(t, sample), []byte(sample), Options{Run: regexp.MustCompile("^(adds|fails)$")})
+	if len(selected) != 2 || selected[0].Name != "adds" || selected[1].Name != "fails" {
+		t.Errorf("-run selected wrong rehearsals: %+v", selected)
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	input := `
+rehearse "first sender wins" {
+    flow done = flow channel<int>
+    start send done <- 1
+    start send done <- 2
+    spin expect(<-done, 1)
+    dance rest = <-done
+}
+`
+	program := parse(t, input)
+	outcomes := make(map[bool]bool)
+	for seed := int64(0); seed < 20; seed++ {
+		opts := Options{Schedule: &interp.Schedule{Seed: seed}}
+		first := Run(program, []byte(input), opts)[0]
+		if first.Schedule != opts.Schedule {
+			t.Fatalf("seed %d: result does not record its schedule", seed)
+		}
+		for i := 0; i < 3; i++ {
+			if again := Run(program, []byte(input), opts)[0]; again.Passed() != first.Passed() {
+				t.Fatalf("seed %d: rehearsal passed, then failed", seed)
+			}
+		}
+		outcomes[first.Passed()] = true
+	}
+	if !outcomes[true] || !outcomes[false] {
+		t.Errorf("20 seeds did not both pass and fail the racy rehearsal: %v", outcomes)
+	}
+}
+
+func TestDeadlock(t *testing.T) {
+	input := `
+rehearse "stuck" {
+    flow never = flow channel<int>
+    dance v = <-never
+}
+`
+	results := Run(parse(t, input), []byte(input), Options{})
+	if len(results) != 1 || len(results[0].Failures) != 1 {
+		t.Fatalf("expected 1 failure, got %+v", results)
+	}
+	expected := "4:15: dance v = <-never: runtime error: all dancers are asleep - deadlock!\n" +
+		"    main is blocked receiving from `never` at 4:15\n" +
+		"    hint: no dancer ever sends on `never`\n"
+	if got := describe(results[0].Failures[0]); got != expected {
+		t.Errorf("expected failure %q, got %q", expected, got)
+	}
+}
+
+func TestJUnit(t *testing.T) {
+	suites := []Suite{
+		{File: "math_test.chore", Results: []Result{
+			{Rehearsal: Rehearsal{Name: "adds"}, Elapsed: 1500 * time.Microsecond},
+			{Rehearsal: Rehearsal{Name: "fails"}, Output: "working\n", Failures: []Failure{
+				{Line: 9, Column: 5, Source: "spin expect(base + 2, 13)", Message: "got 12, want 13"},
+			}},
+		}},
+		{File: "broken_test.chore", Err: "Parser errors:\n  broken_test.chore: 1:1: no prefix parse function"},
+	}
+	var out bytes.Buffer
+	if err := JUnit(&out, suites); err != nil {
+		t.Fatal(err)
+	}
+	
+	for _, want := range []string{
+		`<testsuites tests="3" failures="1" errors="1" time="0.002">`,
+		`<testsuite name="math_test.chore" tests="2" failures="1" errors="0" time="0.002">`,
+		`<testcase name="adds" classname="math_test.chore" time="0.002"></testcase>`,
+		`<failure message="got 12, want 13">math_test.chore:9:5: spin expect(base + 2, 13)&#xA;    got 12, want 13&#xA;</failure>`,
+		`<system-out>working&#xA;</system-out>`,
+		`<error message="Parser errors:">`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report lacks %s:\n%s", want, out.String())
+		}
+	}
+}
+
+func describe(f Failure) string {
+	return fmt.Sprintf("%d:%d: %s: %s", f.Line, f.Column, f.Source, f.Message)
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parser errors: %v", p.Errors())
+	}
+	return program
+}
\ No newline at end of file
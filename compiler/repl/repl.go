@@ -0,0 +1,306 @@
+// Package repl implements ChoreLang's interactive read-eval-print loop.
+// Each input runs in one interpreter session, so bindings and running
+// dancers persist from one input to the next.
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/codegen"
+	"github.com/chorlang/chorlang/compiler/interp"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/ops"
+	"github.com/chorlang/chorlang/compiler/parser"
+)
+
+const (
+	Prompt         = "chore> "
+	ContinuePrompt = "...    "
+)
+
+const help = `Enter ChoreLang statements or expressions. An input with an open { continues
+on the next line.
+
+  :type <expr>       show the type of an expression without evaluating it
+  :ast <code>        show the syntax tree of some code
+  :go [code]         show the Go generated for the session, plus code if given
+  :load <file>       run a .chore file in the session
+  :help              show this help
+  :quit              leave (so does end of input, or calling exit)
+`
+
+// REPL is one interactive session.
+type REPL struct {
+	out     io.Writer
+	session *interp.Session
+	
+	// history holds every input that ran successfully, for :go
+	history []string
+}
+
+func New(out io.Writer) *REPL {
+	return &REPL{out: out, session: interp.NewSession(out)}
+}
+
+// Start reads inputs from in until it ends or the user quits.
+func Start(in io.Reader, out io.Writer) {
+	r := New(out)
+	defer r.Close()
+	
+	scanner := bufio.NewScanner(in)
+	var pending strings.Builder
+	
+	for {
+		if pending.Len() == 0 {
+			fmt.Fprint(out, Prompt)
+		} else {
+			fmt.Fprint(out, ContinuePrompt)
+		}
+		
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return
+		}
+		
+		pending.WriteString(scanner.Text())
+		pending.WriteString("\n")
+		
+		input := pending.String()
+		if Incomplete(input) {
+			continue
+		}
+		pending.Reset()
+		
+		if !r.Handle(input) {
+			return
+		}
+	}
+}
+
+// Close stops the session's dancers.
+func (r *REPL) Close() {
+	r.session.Close()
+}
+
+// Handle runs one complete input and reports whether to keep going.
+func (r *REPL) Handle(input string) bool {
+	trimmed := strings.TrimSpace(input)
+	if trimmed == "" {
+		return true
+	}
+	
+	if !strings.HasPrefix(trimmed, ":") {
+		return r.eval(input)
+	}
+	
+	command, arg := trimmed, ""
+	if i := strings.IndexAny(trimmed, " \t\n"); i >= 0 {
+		command, arg = trimmed[:i], strings.TrimSpace(trimmed[i:])
+	}
+	
+	switch command {
+	case ":type":
+		r.showType(arg)
+	case ":ast":
+		if program, ok := r.parse(arg); ok {
+			fmt.Fprint(r.out, ast.Dump(program))
+		}
+	case ":go":
+		r.showGo(arg)
+	case ":load":
+		return r.load(arg)
+	case ":help":
+		fmt.Fprint(r.out, help)
+	case ":quit", ":q":
+		return false
+	default:
+		fmt.Fprintf(r.out, "unknown command %s (try :help)\n", command)
+	}
+	return true
+}
+
+// eval runs input in the session and reports whether to keep going: a
+// program that calls exit ends the session.
+func (r *REPL) eval(input string) bool {
+	program, ok := r.parse(input)
+	if !ok {
+		return true
+	}
+	
+	result, err := r.session.Eval(program)
+	var exit *interp.ExitError
+	if errors.As(err, &exit) {
+		return false
+	}
+	if err != nil {
+		fmt.Fprintf(r.out, "error: %v\n", err)
+		return true
+	}
+	r.history = append(r.history, input)
+	
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(r.out, "warning: %s\n", warning)
+	}
+	if result.HasValue {
+		fmt.Fprintf(r.out, "%s (%s)\n", formatValue(result.Value), ops.TypeName(result.Value))
+	}
+	return true
+}
+
+func (r *REPL) showType(input string) {
+	program, ok := r.parse(input)
+	if !ok {
+		return
+	}
+	
+	if len(program.Statements) != 1 {
+		fmt.Fprintln(r.out, "error: :type takes a single expression")
+		return
+	}
+	exp, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		fmt.Fprintln(r.out, "error: :type takes an expression, not a statement")
+		return
+	}
+	
+	t, err := r.session.TypeOf(exp.Expression)
+	if err != nil {
+		fmt.Fprintf(r.out, "error: %v\n", err)
+		return
+	}
+	fmt.Fprintln(r.out, t)
+}
+
+func (r *REPL) showGo(input string) {
+	sources := r.history
+	if strings.TrimSpace(input) != "" {
+		sources = append(sources[:len(sources):len(sources)], input)
+	}
+	
+	program, ok := r.sessionProgram(sources)
+	if !ok {
+		return
+	}
+	
+	code, err := codegen.New().Generate(program)
+	if err != nil {
+		fmt.Fprintf(r.out, "error: %v\n", err)
+		return
+	}
+	fmt.Fprintln(r.out, code)
+}
+
+func (r *REPL) load(file string) bool {
+	if file == "" {
+		fmt.Fprintln(r.out, "error: :load needs a file name")
+		return true
+	}
+	
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(r.out, "error: %v\n", err)
+		return true
+	}
+	return r.eval(string(source))
+}
+
+// sessionProgram joins inputs into one program. A later input may
+// redeclare a top-level name, which a program may not, so a redeclaration
+// opens a nested block that shadows the earlier binding. Bare values the
+// REPL only echoed are left out.
+func (r *REPL) sessionProgram(sources []string) (*ast.Program, bool) {
+	program := &ast.Program{}
+	target := &program.Statements
+	declared := make(map[string]bool)
+	
+	for _, source := range sources {
+		parsed, ok := r.parse(source)
+		if !ok {
+			return nil, false
+		}
+		
+		for _, stmt := range parsed.Statements {
+			if exp, ok := stmt.(*ast.ExpressionStatement); ok {
+				switch exp.Expression.(type) {
+				case *ast.SpinExpression, *ast.MemberCallExpression, *ast.ReceiveExpression:
+				default:
+					continue
+				}
+			}
+			
+			if dance, ok := stmt.(*ast.DanceStatement); ok {
+				if declared[dance.Name.Value] {
+					block := &ast.BlockStatement{Token: lexer.Token{Type: lexer.LBRACE, Literal: "{"}}
+					*target = append(*target, block)
+					target = &block.Statements
+					declared = make(map[string]bool)
+				}
+				declared[dance.Name.Value] = true
+			}
+			
+			*target = append(*target, stmt)
+		}
+	}
+	
+	return program, true
+}
+
+func (r *REPL) parse(input string) (*ast.Program, bool) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	
+	if len(p.Errors()) > 0 {
+		for _, err := range p.Errors() {
+			fmt.Fprintf(r.out, "parse error: %s\n", err)
+		}
+		return nil, false
+	}
+	return program, true
+}
+
+// Incomplete reports whether input has a { that is not yet closed, so the
+// REPL should read another line before running it. Braces inside strings
+// and comments do not count.
+func Incomplete(input string) bool {
+	depth := 0
+	inString, inComment := false, false
+	
+	for i := 0; i < len(input); i++ {
+		ch := input[i]
+		switch {
+		case inComment:
+			if ch == '\n' {
+				inComment = false
+			}
+		case inString:
+			if ch == '\\' {
+				i++
+			} else if ch == '"' {
+				inString = false
+			}
+		case ch == '"':
+			inString = true
+		case ch == '/' && i+1 < len(input) && input[i+1] == '/':
+			inComment = true
+		case ch == '{':
+			depth++
+		case ch == '}':
+			depth--
+		}
+	}
+	
+	return depth > 0
+}
+
+func formatValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprint(v)
+}
\ No newline at end of file
@@ -0,0 +1,194 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBindingsPersistAcrossInputs(t *testing.T) {
+	out := session(t, `
+dance x = 40
+x = x + 2
+x
+dance x = "redefined"
+x
+spin print(x, 1.5)
+`)
+	
+	expected := []string{`42 (int)`, `"redefined" (string)`, `redefined 1.5`}
+	checkLines(t, out, expected)
+}
+
+func TestMultiLineInput(t *testing.T) {
+	out := session(t, `
+dance total = 0
+sway i from 1 to 4 {
+    if i > 2 {
+        total = total + i
+    }
+}
+total
+`)
+	
+	checkLines(t, out, []string{"7 (int)"})
+	if !strings.Contains(out, ContinuePrompt) {
+		t.Errorf("expected a continuation prompt in:\n%s", out)
+	}
+}
+
+func TestDancersKeepRunning(t *testing.T) {
+	out := session(t, `
+flow ch = flow channel<int>
+start sway i from 1 to 3 {
+    send ch <- i * 10
+}
+<-ch
+<-ch
+<-ch
+`)
+	
+	checkLines(t, out, []string{"10 (int)", "20 (int)", "30 (int)"})
+}
+
+func TestErrorsDoNotEndTheSession(t *testing.T) {
+	out := session(t, `
+dance x = 1 / 0
+y = 2
+dance x = 3
+x
+`)
+	
+	checkLines(t, out, []string{
+		"error: 1:13: integer divide by zero",
+		"error: 1:1: cannot assign to undeclared \"y\"; declare it with `dance y = ...`",
+		"3 (int)",
+	})
+}
+
+func TestExitEndsTheSession(t *testing.T) {
+	out := session(t, `
+dance x = 1
+spin exit(0)
+x
+`)
+	
+	if strings.Contains(out, "1 (int)") {
+		t.Errorf("the session went on after exit:\n%s", out)
+	}
+}
+
+func TestTypeCommand(t *testing.T) {
+	out := session(t, `
+flow ch = flow channel<string>
+dance n = 2
+:type n * 1.5
+:type <-ch
+:type match n {
+    when 1: flow "one"
+    when 2: flow "two"
+}
+:type n + "s"
+`)
+	
+	checkLines(t, out, []string{"float", "string", "string", "error: invalid operation: int + string"})
+}
+
+func TestASTCommand(t *testing.T) {
+	out := session(t, ":ast dance x = 1\n")
+	
+	expected := "DanceStatement 1:1\n    Name: Identifier 1:7 Value=\"x\"\n    Value: IntegerLiteral 1:11 Value=1"
+	if !strings.Contains(out, expected) {
+		t.Errorf("expected syntax tree in output:\n%s", out)
+	}
+}
+
+func TestGoCommand(t *testing.T) {
+	out := session(t, `
+dance x = 1
+x
+dance x = 2
+:go spin print(x)
+`)
+	
+	expected := `func main() {
+	x := 1
+	_ = x
+	{
+		x := 2
+		fmt.Println(x)
+	}
+}`
+	if !strings.Contains(out, expected) {
+		t.Errorf("expected generated Go in output:\n%s", out)
+	}
+}
+
+func TestLoadCommand(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "lib.chore")
+	if err := os.WriteFile(file, []byte("dance greeting = \"hi\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	
+	out := session(t, ":load "+file+"\ngreeting + \"!\"\n")
+	checkLines(t, out, []string{`"hi!" (string)`})
+}
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"sway i from 1 to 3 {\n", true},
+		{"sway i from 1 to 3 {\n}\n", false},
+		{`dance s = "{"` + "\n", false},
+		{"if x { // }\n", true},
+		{`dance s = "\"{"` + "\n", false},
+	}
+	
+	for _, tt := range tests {
+		if got := Incomplete(tt.input); got != tt.expected {
+			t.Errorf("Incomplete(%q) = %v, want %v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+// session runs input through a REPL and returns its output without the
+// prompts.
+func session(t *testing.T, input string) string {
+	var out bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		Start(strings.NewReader(strings.TrimPrefix(input, "\n")), &out)
+		close(done)
+	}()
+	
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("REPL did not finish")
+	}
+	
+	return out.String()
+}
+
+func checkLines(t *testing.T, out string, expected []string) {
+	t.Helper()
+	
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		for strings.HasPrefix(line, Prompt) || strings.HasPrefix(line, ContinuePrompt) {
+			line = strings.TrimPrefix(strings.TrimPrefix(line, Prompt), ContinuePrompt)
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("output wrong.\nGot:\n%s\nExpected:\n%s", strings.Join(lines, "\n"), strings.Join(expected, "\n"))
+	}
+}
\ No newline at end of file
@@ -0,0 +1,380 @@
+// Package resolver binds every identifier in a ChoreLang program to the
+// declaration it refers to and enforces the language's scoping rules:
+//
+//   - `dance x = ...` always declares a new binding in the current block.
+//     Declaring the same name twice in one block is an error.
+//   - `x = ...` always mutates an existing binding, found by walking
+//     outwards through the enclosing blocks. Assigning to a name that was
+//     never declared is an error.
+//   - A `dance` that reuses a name from an enclosing block shadows it for
+//     the rest of the inner block and produces a warning.
+//
+// Blocks are the program itself, each `sway` (which holds the loop
+// variable) and its body, each branch of an `if`, and each `start`.
+//
+// A `start` launches a dancer that sees a snapshot of every outer binding
+// it uses, taken at the moment it starts. The resolver records these
+// captures for code generation and rejects assignments to captured
+// bindings, which would otherwise race with the launching dancer.
+//
+// A `rehearse` block is a test. Rehearsals sit at the top level of a file
+// and have names unique within it, and only code inside one, including the
+// dancers it starts, may call expect. An `encore` block is a benchmark, and
+// sits at the top level under a unique name in the same way.
+package resolver
+
+import (
+	"fmt"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/lexer"
+)
+
+type BindingKind int
+
+const (
+	Variable     BindingKind = iota // declared with dance
+	LoopVariable                    // declared by sway
+	Channel                         // declared with flow
+)
+
+func (k BindingKind) String() string {
+	switch k {
+	case Variable:
+		return "variable"
+	case LoopVariable:
+		return "loop variable"
+	case Channel:
+		return "channel"
+	default:
+		return "binding"
+	}
+}
+
+// Binding is a single declared name.
+type Binding struct {
+	Name  string
+	Kind  BindingKind
+	Decl  *ast.Identifier
+	Depth int // block nesting depth, 0 for the program scope
+}
+
+type scope struct {
+	parent   *scope
+	depth    int
+	bindings map[string]*Binding
+}
+
+func (s *scope) lookup(name string) *Binding {
+	for cur := s; cur != nil; cur = cur.parent {
+		if b, ok := cur.bindings[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// dancer tracks a `start` being resolved. Bindings declared below depth
+// belong to an enclosing dancer and are captured.
+type dancer struct {
+	depth    int
+	captures []*Binding
+	seen     map[*Binding]bool
+}
+
+type Resolver struct {
+	scope    *scope
+	errors   []string
+	warnings []string
+	bindings map[*ast.Identifier]*Binding
+	dancers  []*dancer
+	captures map[*ast.StartStatement][]*Binding
+	shadows  map[*Binding]*Binding
+	
+	rehearsals map[string]*ast.RehearseStatement
+	rehearsing bool
+	encores    map[string]*ast.EncoreStatement
+}
+
+func New() *Resolver {
+	return &Resolver{
+		scope:    &scope{bindings: make(map[string]*Binding)},
+		errors:   []string{},
+		warnings: []string{},
+		bindings: make(map[*ast.Identifier]*Binding),
+		captures: make(map[*ast.StartStatement][]*Binding),
+		shadows:  make(map[*Binding]*Binding),
+		
+		rehearsals: make(map[string]*ast.RehearseStatement),
+		encores:    make(map[string]*ast.EncoreStatement),
+	}
+}
+
+// Resolve walks the program, recording bindings and reporting errors and
+// warnings.
+func (r *Resolver) Resolve(program *ast.Program) {
+	for _, stmt := range program.Statements {
+		r.resolveStatement(stmt)
+	}
+}
+
+func (r *Resolver) Errors() []string {
+	return r.errors
+}
+
+func (r *Resolver) Warnings() []string {
+	return r.warnings
+}
+
+// Predeclare makes decl visible to the program as if it had been declared
+// just before it, as the REPL does for bindings from earlier inputs. The
+// program may redeclare the name without a shadowing warning.
+func (r *Resolver) Predeclare(decl *ast.Identifier, kind BindingKind) {
+	prelude := r.scope.parent
+	if prelude == nil {
+		prelude = &scope{depth: -1, bindings: make(map[string]*Binding)}
+		r.scope.parent = prelude
+	}
+	prelude.bindings[decl.Value] = &Binding{Name: decl.Value, Kind: kind, Decl: decl, Depth: prelude.depth}
+}
+
+// BindingOf returns the binding an identifier declares or refers to, or nil
+// if it does not name a declared binding (builtins, types, patterns).
+func (r *Resolver) BindingOf(ident *ast.Identifier) *Binding {
+	return r.bindings[ident]
+}
+
+// Shadowed returns the binding from an enclosing block that b hides, or nil
+// if b shadows nothing.
+func (r *Resolver) Shadowed(b *Binding) *Binding {
+	return r.shadows[b]
+}
+
+// Captures returns the outer bindings a `start` uses, in order of first use.
+// Each one is copied when the dancer starts.
+func (r *Resolver) Captures(stmt *ast.StartStatement) []*Binding {
+	return r.captures[stmt]
+}
+
+func (r *Resolver) resolveStatement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.DanceStatement:
+		// The value is resolved first so `dance x = x + 1` in an inner
+		// block reads the outer x.
+		r.resolveExpression(s.Value)
+		if s.Token.Type == lexer.FLOW {
+			r.declare(s.Name, Channel)
+		} else {
+			r.declare(s.Name, Variable)
+		}
+	case *ast.AssignStatement:
+		r.resolveExpression(s.Value)
+		r.assign(s.Name)
+	case *ast.ExpressionStatement:
+		r.resolveExpression(s.Expression)
+	case *ast.SwayStatement:
+		r.resolveExpression(s.From)
+		r.resolveExpression(s.To)
+		r.pushScope()
+		r.declare(s.Variable, LoopVariable)
+		r.resolveBlock(s.Body)
+		r.popScope()
+	case *ast.StartStatement:
+		r.pushScope()
+		d := &dancer{depth: r.scope.depth, captures: []*Binding{}, seen: make(map[*Binding]bool)}
+		r.dancers = append(r.dancers, d)
+		r.resolveStatement(s.Statement)
+		r.dancers = r.dancers[:len(r.dancers)-1]
+		r.captures[s] = d.captures
+		r.popScope()
+	case *ast.SendStatement:
+		r.resolveExpression(s.Channel)
+		r.resolveExpression(s.Value)
+	case *ast.IfStatement:
+		r.resolveExpression(s.Condition)
+		r.resolveBlock(s.Consequence)
+		if s.Alternative != nil {
+			r.resolveBlock(s.Alternative)
+		}
+	case *ast.RehearseStatement:
+		r.resolveRehearsal(s)
+	case *ast.EncoreStatement:
+		r.resolveEncore(s)
+	case *ast.BlockStatement:
+		r.resolveBlock(s)
+	}
+}
+
+func (r *Resolver) resolveRehearsal(s *ast.RehearseStatement) {
+	if r.scope.depth > 0 || len(r.dancers) > 0 {
+		r.errorAt(s.Token, "rehearse must be at the top level of a file")
+	} else if prev, ok := r.rehearsals[s.Name.Value]; ok {
+		r.errorAt(s.Token, "rehearsal %q already declared at %d:%d",
+			s.Name.Value, prev.Token.Line, prev.Token.Column)
+	} else {
+		r.rehearsals[s.Name.Value] = s
+	}
+	
+	rehearsing := r.rehearsing
+	r.rehearsing = true
+	r.resolveBlock(s.Body)
+	r.rehearsing = rehearsing
+}
+
+func (r *Resolver) resolveEncore(s *ast.EncoreStatement) {
+	if r.scope.depth > 0 || len(r.dancers) > 0 {
+		r.errorAt(s.Token, "encore must be at the top level of a file")
+	} else if prev, ok := r.encores[s.Name.Value]; ok {
+		r.errorAt(s.Token, "encore %q already declared at %d:%d",
+			s.Name.Value, prev.Token.Line, prev.Token.Column)
+	} else {
+		r.encores[s.Name.Value] = s
+	}
+	r.resolveBlock(s.Body)
+}
+
+func (r *Resolver) resolveBlock(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	
+	r.pushScope()
+	for _, stmt := range block.Statements {
+		r.resolveStatement(stmt)
+	}
+	r.popScope()
+}
+
+func (r *Resolver) resolveExpression(exp ast.Expression) {
+	switch e := exp.(type) {
+	case *ast.Identifier:
+		if b := r.scope.lookup(e.Value); b != nil {
+			r.bindings[e] = b
+			r.capture(b)
+		}
+	case *ast.InfixExpression:
+		r.resolveExpression(e.Left)
+		r.resolveExpression(e.Right)
+	case *ast.SpinExpression:
+		r.resolveExpression(e.Function)
+		if ident, ok := e.Function.(*ast.Identifier); ok && ident.Value == "expect" && !r.rehearsing {
+			r.errorf(ident, "expect can only be called in a rehearse block")
+		}
+		for _, arg := range e.Arguments {
+			r.resolveExpression(arg)
+		}
+	case *ast.MemberCallExpression:
+		// The member is named by the receiver, not bound
+		r.resolveExpression(e.Receiver)
+		for _, arg := range e.Arguments {
+			r.resolveExpression(arg)
+		}
+	case *ast.FlowExpression:
+		// channel<T> names a type, not a binding
+		if e.ElementType == nil {
+			r.resolveExpression(e.ChannelType)
+		}
+	case *ast.ReceiveExpression:
+		r.resolveExpression(e.Channel)
+	case *ast.MatchExpression:
+		r.resolveExpression(e.Expression)
+		// Patterns name constructors or literals, not bindings
+		for _, c := range e.Cases {
+			r.resolveExpression(c.Consequence)
+		}
+	}
+}
+
+func (r *Resolver) declare(ident *ast.Identifier, kind BindingKind) {
+	if ident == nil {
+		return
+	}
+	
+	if prev, ok := r.scope.bindings[ident.Value]; ok {
+		r.errorf(ident, "%q already declared in this block at %s; use `%s = ...` to reassign",
+			ident.Value, position(prev.Decl), ident.Value)
+		r.bindings[ident] = prev
+		return
+	}
+	
+	b := &Binding{Name: ident.Value, Kind: kind, Decl: ident, Depth: r.scope.depth}
+	
+	if outer := r.scope.lookup(ident.Value); outer != nil && outer.Depth >= 0 {
+		r.shadows[b] = outer
+		keyword := "dance"
+		if kind == Channel {
+			keyword = "flow"
+		}
+		r.warnf(ident, "%s %q shadows %s declared at %s",
+			keyword, ident.Value, outer.Kind, position(outer.Decl))
+	}
+	
+	r.scope.bindings[ident.Value] = b
+	r.bindings[ident] = b
+}
+
+func (r *Resolver) assign(ident *ast.Identifier) {
+	b := r.scope.lookup(ident.Value)
+	if b == nil {
+		r.errorf(ident, "cannot assign to undeclared %q; declare it with `dance %s = ...`",
+			ident.Value, ident.Value)
+		return
+	}
+	r.bindings[ident] = b
+	
+	if r.isCaptured(b) {
+		r.errorf(ident, "dancer cannot assign to %q declared at %s outside its start; "+
+			"dancers work on a copy, so send the value over a flow instead",
+			ident.Value, position(b.Decl))
+		return
+	}
+	r.capture(b)
+}
+
+// capture records b on every enclosing dancer it was declared outside of.
+func (r *Resolver) capture(b *Binding) {
+	for _, d := range r.dancers {
+		if b.Depth < d.depth && !d.seen[b] {
+			d.seen[b] = true
+			d.captures = append(d.captures, b)
+		}
+	}
+}
+
+// isCaptured reports whether b was declared outside the innermost dancer.
+func (r *Resolver) isCaptured(b *Binding) bool {
+	if len(r.dancers) == 0 {
+		return false
+	}
+	return b.Depth < r.dancers[len(r.dancers)-1].depth
+}
+
+func (r *Resolver) pushScope() {
+	r.scope = &scope{
+		parent:   r.scope,
+		depth:    r.scope.depth + 1,
+		bindings: make(map[string]*Binding),
+	}
+}
+
+func (r *Resolver) popScope() {
+	if r.scope.parent != nil {
+		r.scope = r.scope.parent
+	}
+}
+
+func (r *Resolver) errorf(ident *ast.Identifier, format string, args ...interface{}) {
+	r.errors = append(r.errors, position(ident)+": "+fmt.Sprintf(format, args...))
+}
+
+func (r *Resolver) errorAt(tok lexer.Token, format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf("%d:%d: ", tok.Line, tok.Column)+fmt.Sprintf(format, args...))
+}
+
+func (r *Resolver) warnf(ident *ast.Identifier, format string, args ...interface{}) {
+	r.warnings = append(r.warnings, position(ident)+": "+fmt.Sprintf(format, args...))
+}
+
+func position(ident *ast.Identifier) string {
+	return fmt.Sprintf("%d:%d", ident.Token.Line, ident.Token.Column)
+}
\ No newline at end of file
@@ -0,0 +1,272 @@
+package resolver
+
+import (
+	"strings"
+	"testing"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/parser"
+)
+
+func TestAssignmentMutatesOuterBinding(t *testing.T) {
+	input := `
+dance total = 0
+sway i from 1 to 3 {
+    total = total + i
+}
+`
+	program, r := resolve(t, input)
+	checkNoErrors(t, r)
+	
+	if len(r.Warnings()) != 0 {
+		t.Fatalf("expected no warnings, got %v", r.Warnings())
+	}
+	
+	decl := program.Statements[0].(*ast.DanceStatement)
+	sway := program.Statements[1].(*ast.SwayStatement)
+	assign, ok := sway.Body.Statements[0].(*ast.AssignStatement)
+	if !ok {
+		t.Fatalf("sway body is not ast.AssignStatement. got=%T", sway.Body.Statements[0])
+	}
+	
+	if r.BindingOf(assign.Name) != r.BindingOf(decl.Name) {
+		t.Errorf("assignment does not resolve to the outer declaration")
+	}
+}
+
+func TestMemberCallResolvesReceiver(t *testing.T) {
+	input := `
+flow fs = chore.fs()
+dance read = "a.txt"
+start spin print(fs.read(read))
+`
+	program, r := resolve(t, input)
+	checkNoErrors(t, r)
+	
+	open := program.Statements[0].(*ast.DanceStatement).Value.(*ast.MemberCallExpression)
+	if b := r.BindingOf(open.Receiver.(*ast.Identifier)); b != nil {
+		t.Errorf("chore resolved to %s %q", b.Kind, b.Name)
+	}
+	
+	start := program.Statements[2].(*ast.StartStatement)
+	call := start.Statement.(*ast.ExpressionStatement).Expression.(*ast.SpinExpression).Arguments[0].(*ast.MemberCallExpression)
+	if b := r.BindingOf(call.Member); b != nil {
+		t.Errorf("member read resolved to %s declared at %s", b.Kind, position(b.Decl))
+	}
+	
+	var names []string
+	for _, b := range r.Captures(start) {
+		names = append(names, b.Name)
+	}
+	if strings.Join(names, " ") != "fs read" {
+		t.Errorf("start captures %v, expected [fs read]", names)
+	}
+}
+
+func TestDanceShadowsWithWarning(t *testing.T) {
+	input := `
+dance a = 1
+if true {
+    dance a = 2
+    spin print(a)
+}
+spin print(a)
+`
+	program, r := resolve(t, input)
+	checkNoErrors(t, r)
+	
+	warnings := r.Warnings()
+	if len(warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %d: %v", len(warnings), warnings)
+	}
+	if !strings.Contains(warnings[0], `dance "a" shadows variable declared at 2:7`) {
+		t.Errorf("unexpected warning: %q", warnings[0])
+	}
+	
+	outer := program.Statements[0].(*ast.DanceStatement)
+	ifStmt := program.Statements[1].(*ast.IfStatement)
+	inner := ifStmt.Consequence.Statements[0].(*ast.DanceStatement)
+	innerUse := ifStmt.Consequence.Statements[1].(*ast.ExpressionStatement).
+		Expression.(*ast.SpinExpression).Arguments[0].(*ast.Identifier)
+	outerUse := program.Statements[2].(*ast.ExpressionStatement).
+		Expression.(*ast.SpinExpression).Arguments[0].(*ast.Identifier)
+	
+	if r.BindingOf(innerUse) != r.BindingOf(inner.Name) {
+		t.Errorf("inner use does not resolve to the shadowing declaration")
+	}
+	if r.BindingOf(outerUse) != r.BindingOf(outer.Name) {
+		t.Errorf("outer use does not resolve to the outer declaration")
+	}
+	if r.Shadowed(r.BindingOf(inner.Name)) != r.BindingOf(outer.Name) {
+		t.Errorf("inner declaration does not record the binding it shadows")
+	}
+	if r.Shadowed(r.BindingOf(outer.Name)) != nil {
+		t.Errorf("outer declaration shadows nothing")
+	}
+}
+
+func TestShadowingLoopVariable(t *testing.T) {
+	input := `
+sway i from 0 to 3 {
+    dance i = 10
+}
+`
+	_, r := resolve(t, input)
+	checkNoErrors(t, r)
+	
+	if len(r.Warnings()) != 1 || !strings.Contains(r.Warnings()[0], "shadows loop variable") {
+		t.Errorf("expected loop variable shadowing warning, got %v", r.Warnings())
+	}
+}
+
+func TestDanceValueReadsOuterBinding(t *testing.T) {
+	input := `
+dance x = 1
+start dance x = x + 1
+`
+	program, r := resolve(t, input)
+	checkNoErrors(t, r)
+	
+	outer := program.Statements[0].(*ast.DanceStatement)
+	inner := program.Statements[1].(*ast.StartStatement).Statement.(*ast.DanceStatement)
+	use := inner.Value.(*ast.InfixExpression).Left.(*ast.Identifier)
+	
+	if r.BindingOf(use) != r.BindingOf(outer.Name) {
+		t.Errorf("value of inner dance should read the outer x")
+	}
+}
+
+func TestStartCapturesOuterBindings(t *testing.T) {
+	input := `
+flow jobs = flow channel<int>
+sway w from 1 to 3 {
+    start {
+        dance job = <-jobs
+        spin print(w, job)
+    }
+}
+`
+	program, r := resolve(t, input)
+	checkNoErrors(t, r)
+	
+	sway := program.Statements[1].(*ast.SwayStatement)
+	start := sway.Body.Statements[0].(*ast.StartStatement)
+	
+	var names []string
+	for _, b := range r.Captures(start) {
+		names = append(names, b.Name)
+	}
+	
+	// job is declared inside the dancer and must not be captured
+	if strings.Join(names, ",") != "jobs,w" {
+		t.Errorf("expected captures jobs,w in order of use, got %v", names)
+	}
+}
+
+func TestNestedStartCapturesThroughOuterDancer(t *testing.T) {
+	input := `
+dance x = 1
+start {
+    dance y = 2
+    start spin print(x, y)
+}
+`
+	program, r := resolve(t, input)
+	checkNoErrors(t, r)
+	
+	outer := program.Statements[1].(*ast.StartStatement)
+	inner := outer.Statement.(*ast.BlockStatement).Statements[1].(*ast.StartStatement)
+	
+	if got := r.Captures(outer); len(got) != 1 || got[0].Name != "x" {
+		t.Errorf("outer dancer should capture only x, got %v", got)
+	}
+	if got := r.Captures(inner); len(got) != 2 || got[0].Name != "x" || got[1].Name != "y" {
+		t.Errorf("inner dancer should capture x and y, got %v", got)
+	}
+}
+
+func TestPredeclaredBindings(t *testing.T) {
+	input := `
+total = total + 1
+dance count = 2
+start spin print(total)
+`
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	
+	total := &ast.Identifier{Value: "total"}
+	r := New()
+	r.Predeclare(total, Variable)
+	r.Predeclare(&ast.Identifier{Value: "count"}, Variable)
+	r.Resolve(program)
+	checkNoErrors(t, r)
+	
+	// Redeclaring a predeclared name replaces it quietly
+	if len(r.Warnings()) != 0 {
+		t.Errorf("unexpected warnings: %v", r.Warnings())
+	}
+	
+	assign := program.Statements[0].(*ast.AssignStatement)
+	if b := r.BindingOf(assign.Name); b == nil || b.Decl != total {
+		t.Errorf("assignment should mutate the predeclared total, got %v", b)
+	}
+	
+	start := program.Statements[2].(*ast.StartStatement)
+	if got := r.Captures(start); len(got) != 1 || got[0].Decl != total {
+		t.Errorf("dancer should capture the predeclared total, got %v", got)
+	}
+}
+
+func TestResolverErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"count = 1", `1:1: cannot assign to undeclared "count"`},
+		{"dance x = 1\ndance x = 2", `2:7: "x" already declared in this block at 1:7`},
+		{"if true {\n    dance y = 1\n}\ny = 2", `4:1: cannot assign to undeclared "y"`},
+		{"sway i from 0 to 1 {\n}\ni = 3", `3:1: cannot assign to undeclared "i"`},
+		{"dance total = 0\nstart total = total + 1", `2:7: dancer cannot assign to "total" declared at 1:7`},
+		{"if true {\n    rehearse \"a\" {\n    }\n}", `2:5: rehearse must be at the top level of a file`},
+		{"rehearse \"a\" {\n}\nrehearse \"a\" {\n}", `3:1: rehearsal "a" already declared at 1:1`},
+		{"spin expect(true)", `1:6: expect can only be called in a rehearse block`},
+		{"sway i from 0 to 1 {\n    encore \"a\" {\n    }\n}", `2:5: encore must be at the top level of a file`},
+		{"encore \"a\" {\n}\nencore \"a\" {\n}", `3:1: encore "a" already declared at 1:1`},
+		{"encore \"a\" {\n    spin expect(true)\n}", `2:10: expect can only be called in a rehearse block`},
+	}
+	
+	for _, tt := range tests {
+		_, r := resolve(t, tt.input)
+		
+		if len(r.Errors()) != 1 {
+			t.Errorf("input %q: expected 1 error, got %v", tt.input, r.Errors())
+			continue
+		}
+		if !strings.HasPrefix(r.Errors()[0], tt.expected) {
+			t.Errorf("input %q: expected error starting with %q, got %q",
+				tt.input, tt.expected, r.Errors()[0])
+		}
+	}
+}
+
+func resolve(t *testing.T, input string) (*ast.Program, *Resolver) {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parser errors: %v", p.Errors())
+	}
+	
+	r := New()
+	r.Resolve(program)
+	return program, r
+}
+
+func checkNoErrors(t *testing.T, r *Resolver) {
+	if len(r.Errors()) != 0 {
+		t.Fatalf("unexpected resolver errors: %v", r.Errors())
+	}
+}
\ No newline at end of file
@@ -0,0 +1,120 @@
+package trace
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	
+	"github.com/chorlang/chorlang/compiler/chart"
+)
+
+// Sequence returns a Mermaid sequence diagram of a traced run: a lifeline
+// for main and for each dancer, an arrow for each start, and an arrow from
+// sender to receiver for each message, drawn when the message was taken.
+//
+// Dancers record an operation only after it completes, so the two sides of
+// one message may be recorded in either order, and other operations may come
+// between them. A send is paired with the first unpaired receive on the same
+// channel that got the same value. An operation whose partner the trace
+// never recorded, because main returned first, is left out.
+func Sequence(events []Event) string {
+	var sb strings.Builder
+	sb.WriteString("sequenceDiagram\n")
+	sb.WriteString("    participant main\n")
+	for _, e := range events {
+		if e.Kind == Spawn {
+			fmt.Fprintf(&sb, "    participant %s as dancer %d at line %d\n", dancerID(e.Child), e.Child, e.Line)
+		}
+	}
+	
+	// Operations waiting for their partner, by channel
+	sends := make(map[int][]Event)
+	receives := make(map[int][]Event)
+	for _, e := range events {
+		switch e.Kind {
+		case Spawn:
+			fmt.Fprintf(&sb, "    %s-)%s: start\n", dancerID(e.Dancer), dancerID(e.Child))
+		case Send:
+			if receive, ok := take(receives, e); ok {
+				message(&sb, e, receive)
+			} else {
+				sends[e.Channel] = append(sends[e.Channel], e)
+			}
+		case Receive:
+			if send, ok := take(sends, e); ok {
+				message(&sb, send, e)
+			} else {
+				receives[e.Channel] = append(receives[e.Channel], e)
+			}
+		case Exit:
+			fmt.Fprintf(&sb, "    Note over %s: exit %d\n", dancerID(e.Dancer), e.Code)
+		}
+	}
+	return sb.String()
+}
+
+// take removes and returns the first waiting operation that could be the
+// other side of e.
+func take(waiting map[int][]Event, e Event) (Event, bool) {
+	for i, w := range waiting[e.Channel] {
+		if w.Value == e.Value {
+			waiting[e.Channel] = append(waiting[e.Channel][:i:i], waiting[e.Channel][i+1:]...)
+			return w, true
+		}
+	}
+	return Event{}, false
+}
+
+func message(sb *strings.Builder, send, receive Event) {
+	fmt.Fprintf(sb, "    %s->>%s: %s\n", dancerID(send.Dancer), dancerID(receive.Dancer),
+		chart.Escape(send.Name+" <- "+send.Value))
+}
+
+// Timeline returns a trace as text, one event per line: when it happened,
+// in which dancer, at which position, and how long a channel operation was
+// blocked.
+func Timeline(events []Event) string {
+	var sb strings.Builder
+	for _, e := range events {
+		var what string
+		switch e.Kind {
+		case Begin:
+			what = "begin " + e.File
+		case Spawn:
+			what = "start " + dancerID(e.Child)
+		case Send:
+			what = fmt.Sprintf("send %s on %s", e.Value, e.Name)
+		case Receive:
+			what = fmt.Sprintf("receive %s from %s", e.Value, e.Name)
+		case End:
+			what = "end"
+		case Exit:
+			what = fmt.Sprintf("exit %d", e.Code)
+		default:
+			what = e.Kind
+		}
+		if wait := round(e.Wait); wait > 0 {
+			what += fmt.Sprintf(" (blocked %v)", wait)
+		}
+		
+		position := ""
+		if e.Line > 0 {
+			position = fmt.Sprintf("%d:%d", e.Line, e.Column)
+		}
+		fmt.Fprintf(&sb, "%10v  %-8s  %-7s  %s\n", round(e.Time), dancerID(e.Dancer), position, what)
+	}
+	return sb.String()
+}
+
+// round keeps durations to the microsecond; finer times are noise from the
+// tracing itself.
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
+
+func dancerID(dancer int) string {
+	if dancer == 0 {
+		return "main"
+	}
+	return fmt.Sprintf("dancer%d", dancer)
+}
\ No newline at end of file
@@ -0,0 +1,75 @@
+// Package trace reads the choreography traces that programs built with
+// tracing record, and replays them as Mermaid sequence diagrams or as
+// timelines.
+//
+// A trace file holds one JSON object per line, one per event, in the order
+// the events happened. Every event names the dancer it happened in: dancer 0
+// is main, and each start numbers the dancer it launches from 1 up. Channel
+// operations are recorded once they complete, with how long the dancer was
+// blocked waiting for the other side.
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Event kinds
+const (
+	Begin   = "begin"   // the program started; File names its source
+	Spawn   = "spawn"   // a start launched dancer Child
+	Send    = "send"    // a send on a channel completed
+	Receive = "receive" // a receive from a channel completed
+	End     = "end"     // the dancer finished
+	Exit    = "exit"    // the program called exit with Code
+)
+
+// Event is one step of a traced run. Line and Column are the position of
+// the statement or expression in the .chore source; begin, end and exit
+// events have none.
+type Event struct {
+	Time   time.Duration `json:"t"`
+	Dancer int           `json:"dancer"`
+	Kind   string        `json:"kind"`
+	Line   int           `json:"line,omitempty"`
+	Column int           `json:"column,omitempty"`
+	
+	File  string `json:"file,omitempty"`
+	Child int    `json:"child,omitempty"`
+	Code  int    `json:"code,omitempty"`
+	
+	// Channel tells channels apart: each gets a number, from 1 up, the
+	// first time it is used. Name is the channel as the source wrote it,
+	// so one channel may appear under several names.
+	Channel int           `json:"channel,omitempty"`
+	Name    string        `json:"name,omitempty"`
+	Value   string        `json:"value,omitempty"`
+	Wait    time.Duration `json:"wait,omitempty"`
+}
+
+// Read returns the events of a trace file.
+func Read(r io.Reader) ([]Event, error) {
+	var events []Event
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if e.Kind == "" {
+			return nil, fmt.Errorf("line %d: event has no kind", line)
+		}
+		events = append(events, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
\ No newline at end of file
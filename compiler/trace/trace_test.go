@@ -0,0 +1,102 @@
+package trace
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// sample is a worker receiving two jobs from main and answering on a
+// second channel. The worker records taking job 2 after main records
+// handing over the answer to job 1, as a racing trace may.
+const sample = `{"t":1000,"dancer":0,"kind":"begin","file":"work.chore"}
+{"t":2000,"dancer":0,"kind":"spawn","line":3,"column":1,"child":1}
+{"t":5000,"dancer":0,"kind":"send","line":7,"column":5,"channel":1,"name":"jobs","value":"1","wait":3000}
+{"t":6000,"dancer":1,"kind":"receive","line":4,"column":15,"channel":1,"name":"jobs","value":"1","wait":4000}
+
+{"t":8000,"dancer":0,"kind":"send","line":7,"column":5,"channel":1,"name":"jobs","value":"2"}
+{"t":9000,"dancer":1,"kind":"send","line":5,"column":5,"channel":2,"name":"out","value":"\"one\""}
+{"t":10000,"dancer":0,"kind":"receive","line":8,"column":11,"channel":2,"name":"answers","value":"\"one\"","wait":1500000}
+{"t":11000,"dancer":1,"kind":"receive","line":4,"column":15,"channel":1,"name":"jobs","value":"2"}
+{"t":12000,"dancer":1,"kind":"end"}
+{"t":15000,"dancer":0,"kind":"exit","code":3}
+`
+
+func read(t *testing.T, input string) []Event {
+	t.Helper()
+	events, err := Read(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestRead(t *testing.T) {
+	events := read(t, sample)
+	if len(events) != 10 {
+		t.Fatalf("expected 10 events, got %d", len(events))
+	}
+	
+	e := events[7]
+	if e.Kind != Receive || e.Dancer != 1 || e.Line != 4 || e.Column != 15 || e.Channel != 1 || e.Value != "2" {
+		t.Errorf("receive read wrong: %+v", e)
+	}
+	if events[6].Wait != 1500*time.Microsecond {
+		t.Errorf("wait read wrong: %v", events[6].Wait)
+	}
+	
+	for _, input := range []string{"not json\n", "{}\n"} {
+		if _, err := Read(strings.NewReader(input)); err == nil || !strings.HasPrefix(err.Error(), "line 1: ") {
+			t.Errorf("%q: expected an error naming line 1, got %v", input, err)
+		}
+	}
+}
+
+func TestSequence(t *testing.T) {
+	expected := `sequenceDiagram
+    participant main
+    participant dancer1 as dancer 1 at line 3
+    main-)dancer1: start
+    main->>dancer1: jobs #lt;- 1
+    dancer1->>main: out #lt;- #quot;one#quot;
+    main->>dancer1: jobs #lt;- 2
+    Note over main: exit 3
+`
+	if got := Sequence(read(t, sample)); got != expected {
+		t.Errorf("sequence wrong.\nwant:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestSequencePairsByValue(t *testing.T) {
+	// Two receivers record out of order: the value tells who got what
+	events := read(t, `{"dancer":0,"kind":"send","channel":1,"name":"ch","value":"1"}
+{"dancer":0,"kind":"send","channel":1,"name":"ch","value":"2"}
+{"dancer":2,"kind":"receive","channel":1,"name":"ch","value":"2"}
+{"dancer":1,"kind":"receive","channel":1,"name":"ch","value":"1"}
+{"dancer":1,"kind":"receive","channel":1,"name":"ch","value":"3"}
+`)
+	got := Sequence(events)
+	if !strings.Contains(got, "main->>dancer2: ch #lt;- 2\n    main->>dancer1: ch #lt;- 1\n") {
+		t.Errorf("messages paired wrong:\n%s", got)
+	}
+	if strings.Contains(got, "3") {
+		t.Errorf("a receive without a recorded send was drawn:\n%s", got)
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	expected := `       1µs  main               begin work.chore
+       2µs  main      3:1      start dancer1
+       5µs  main      7:5      send 1 on jobs (blocked 3µs)
+       6µs  dancer1   4:15     receive 1 from jobs (blocked 4µs)
+       8µs  main      7:5      send 2 on jobs
+       9µs  dancer1   5:5      send "one" on out
+      10µs  main      8:11     receive "one" from answers (blocked 1.5ms)
+      11µs  dancer1   4:15     receive 2 from jobs
+      12µs  dancer1            end
+      15µs  main               exit 3
+`
+	if got := Timeline(read(t, sample)); got != expected {
+		t.Errorf("timeline wrong.\nwant:\n%s\ngot:\n%s", expected, got)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,612 @@
+// Package vm runs compiled ChoreLang bytecode. Dancers are lightweight:
+// each is an instruction pointer, a value stack and a copy of the variable
+// slots, and all of them share one goroutine. The scheduler runs the ready
+// dancers round-robin, switching after a fixed number of instructions or
+// when a dancer blocks on a channel or waits in fs.watch.
+//
+// The semantics are those of the interpreter and the generated Go:
+// channels are unbuffered, a dancer starts with a snapshot of the bindings,
+// the program ends when the main dancer does, and a runtime error in any
+// dancer stops the program, as does exit(code). When every dancer is
+// blocked, the VM reports a deadlock instead of hanging, as an
+// *interp.DeadlockError, and Leaked reports the dancers left blocked when
+// main finished. A program that goes past its Limits stops with an
+// *interp.LimitError.
+//
+// Under an interp.Schedule the scheduler instead draws the next dancer at
+// every start, send and receive, never after a quantum, and draws it as the
+// interpreter does, so a seed gives the same interleaving on both.
+package vm
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sync/atomic"
+	"time"
+	
+	"github.com/chorlang/chorlang/compiler/bytecode"
+	"github.com/chorlang/chorlang/compiler/fs"
+	"github.com/chorlang/chorlang/compiler/interp"
+	"github.com/chorlang/chorlang/compiler/ops"
+)
+
+// Quantum is the number of instructions a dancer runs before the scheduler
+// moves on to the next ready dancer.
+const Quantum = 1000
+
+// RuntimeError is an error raised while running a program, positioned at
+// the ChoreLang token the failing instruction was compiled from.
+type RuntimeError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// Channel is a flow between dancers. Sends and receives rendezvous: a
+// dancer that arrives first waits in the channel until a partner comes.
+type Channel struct {
+	elem      string
+	senders   []*dancer
+	receivers []*dancer
+}
+
+func (c *Channel) String() string {
+	return c.TypeName()
+}
+
+// TypeName names the channel for error messages and ops.TypeName.
+func (c *Channel) TypeName() string {
+	if c.elem == "" {
+		return "channel"
+	}
+	return "channel<" + c.elem + ">"
+}
+
+type dancer struct {
+	ip    int
+	stack []interface{}
+	slots []interface{}
+	
+	// id numbers the dancer as the interpreter does, and startedAt is the
+	// offset of the start that launched it
+	id        int
+	startedAt int
+	
+	// sending is the value a blocked sender is offering, and sends is set
+	// while it waits
+	sending interface{}
+	sends   bool
+	// watch is the fs.watch the dancer waits in
+	watch *interp.Watch
+	// blockedAt is the offset of the instruction the dancer waits in
+	blockedAt int
+}
+
+type VM struct {
+	// Args are the program arguments args() reports. Args[0] names the
+	// program.
+	Args []string
+	
+	// FS is the sandbox chore.fs() opens. Without one it fails.
+	FS *fs.Sandbox
+	
+	// Schedule, if set, draws the order the dancers run in from its seed.
+	Schedule *interp.Schedule
+	
+	// Limits caps what the program may use, counted as the interpreter
+	// counts it.
+	Limits interp.Limits
+	
+	chunk *bytecode.Chunk
+	out   io.Writer
+	
+	main    *dancer
+	ready   []*dancer
+	turns   *interp.Turns // set while a Schedule runs
+	dancers int           // dancers started so far, main included
+	waiting map[*dancer]bool
+	leaked  []interp.Blocked
+	
+	modules  []*interp.FSModule // opened by chore.fs(), closed as Run returns
+	watching []*dancer          // the dancers waiting in fs.watch
+	
+	live       int           // dancers running, main included
+	iterations int64         // sway iterations completed so far
+	held       int64         // bytes of the values waiting senders hold
+	printed    int64         // bytes printed so far
+	expired    int32         // set once Limits.Time has run out
+	timeUp     chan struct{} // closed once Limits.Time has run out
+}
+
+func New(chunk *bytecode.Chunk, out io.Writer) *VM {
+	return &VM{chunk: chunk, out: out}
+}
+
+// Run executes the program until the main dancer finishes, returning the
+// first runtime error, or an *interp.ExitError if the program called exit.
+func (vm *VM) Run() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch r := r.(type) {
+			case *RuntimeError:
+				err = r
+			case *interp.ExitError:
+				err = r
+			case *interp.DeadlockError:
+				err = r
+			case *interp.LimitError:
+				err = r
+			default:
+				panic(r)
+			}
+		}
+	}()
+	
+	vm.main = &dancer{slots: make([]interface{}, len(vm.chunk.Slots))}
+	vm.ready = []*dancer{vm.main}
+	vm.dancers = 1
+	vm.waiting = make(map[*dancer]bool)
+	vm.leaked = nil
+	vm.live = 1
+	vm.iterations = 0
+	vm.held = 0
+	vm.printed = 0
+	vm.expired = 0
+	vm.timeUp = make(chan struct{})
+	vm.turns = nil
+	vm.modules = nil
+	vm.watching = nil
+	defer vm.closeModules()
+	if vm.Limits.Time > 0 {
+		timeUp := vm.timeUp
+		timer := time.AfterFunc(vm.Limits.Time, func() {
+			atomic.StoreInt32(&vm.expired, 1)
+			close(timeUp)
+		})
+		defer timer.Stop()
+	}
+	if vm.Schedule != nil {
+		vm.turns = vm.Schedule.Turns()
+	}
+	
+	for len(vm.ready) > 0 || len(vm.watching) > 0 {
+		vm.wake(len(vm.ready) == 0)
+		i := 0
+		if vm.turns != nil {
+			i = vm.turns.Next(len(vm.ready))
+		}
+		d := vm.ready[i]
+		vm.ready = append(vm.ready[:i], vm.ready[i+1:]...)
+		
+		if vm.step(d) && d == vm.main {
+			// Main has finished: dancers still on stage are dropped
+			vm.leaked = vm.blocked()
+			return nil
+		}
+	}
+	
+	deadlock := &interp.DeadlockError{Blocked: vm.blocked()}
+	deadlock.Line, deadlock.Column = vm.chunk.PositionOf(vm.main.blockedAt)
+	return deadlock
+}
+
+// Leaked returns the dancers that were still blocked on a channel when
+// main finished the last Run, in the order they started.
+func (vm *VM) Leaked() []interp.Blocked {
+	return vm.leaked
+}
+
+// wake readies the watching dancers whose change has come, and when wait
+// is set and none has, waits for one.
+func (vm *VM) wake(wait bool) {
+	for i := 0; i < len(vm.watching); {
+		d := vm.watching[i]
+		select {
+		case e, ok := <-d.watch.Events:
+			vm.watching = append(vm.watching[:i], vm.watching[i+1:]...)
+			vm.watched(d, e, ok)
+		default:
+			i++
+		}
+	}
+	if !wait || len(vm.ready) > 0 {
+		return
+	}
+	
+	cases := make([]reflect.SelectCase, 0, len(vm.watching)+1)
+	for _, d := range vm.watching {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(d.watch.Events)})
+	}
+	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(vm.timeUp)})
+	i, v, ok := reflect.Select(cases)
+	if i == len(vm.watching) {
+		vm.exceeded(vm.watching[0].blockedAt, "time", int64(vm.Limits.Time))
+	}
+	d := vm.watching[i]
+	vm.watching = append(vm.watching[:i], vm.watching[i+1:]...)
+	vm.watched(d, v.Interface().(fs.Event), ok)
+}
+
+// watched readies d with the value of its watch, given what the receive
+// from the watch's Events reported.
+func (vm *VM) watched(d *dancer, e fs.Event, ok bool) {
+	value, err := d.watch.Result(e, ok)
+	if err != nil {
+		vm.fail(d.blockedAt, "%s", err)
+	}
+	d.watch = nil
+	d.push(value)
+	vm.ready = append(vm.ready, d)
+}
+
+// closeModules stops the watchers of the modules chore.fs() opened.
+func (vm *VM) closeModules() {
+	for _, m := range vm.modules {
+		m.Close()
+	}
+	vm.modules = nil
+}
+
+// blocked lists the dancers waiting on a channel, by number.
+func (vm *VM) blocked() []interp.Blocked {
+	var blocked []interp.Blocked
+	for d := range vm.waiting {
+		b := interp.Blocked{Dancer: d.id, Send: d.sends}
+		b.Line, b.Column = vm.chunk.PositionOf(d.blockedAt)
+		if d != vm.main {
+			b.StartLine, b.StartColumn = vm.chunk.PositionOf(d.startedAt)
+		}
+		blocked = append(blocked, b)
+	}
+	interp.SortBlocked(blocked)
+	return blocked
+}
+
+// step runs d for up to Quantum instructions, or to its next start, send
+// or receive under a schedule, and reports whether it finished. A dancer
+// that is neither finished nor blocked goes back on the ready queue.
+func (vm *VM) step(d *dancer) bool {
+	code := vm.chunk.Code
+	
+	for n := 0; n < Quantum || vm.turns != nil; n++ {
+		offset := d.ip
+		op := bytecode.Opcode(code[offset])
+		d.ip++
+		
+		switch op {
+		case bytecode.OpConstant:
+			d.push(vm.chunk.Constants[vm.operand16(d)])
+		case bytecode.OpTrue:
+			d.push(true)
+		case bytecode.OpFalse:
+			d.push(false)
+		case bytecode.OpNil:
+			d.push(nil)
+		case bytecode.OpPop:
+			vm.pop(d, offset)
+		case bytecode.OpDup:
+			v := vm.pop(d, offset)
+			d.push(v)
+			d.push(v)
+		case bytecode.OpGet:
+			d.push(d.slots[vm.operand16(d)])
+		case bytecode.OpSet:
+			d.slots[vm.operand16(d)] = vm.pop(d, offset)
+		
+		case bytecode.OpAdd, bytecode.OpSub, bytecode.OpMul, bytecode.OpDiv,
+			bytecode.OpEqual, bytecode.OpNotEqual, bytecode.OpLess, bytecode.OpGreater,
+			bytecode.OpLessEqual, bytecode.OpGreaterEqual, bytecode.OpMatch:
+			right := vm.pop(d, offset)
+			left := vm.pop(d, offset)
+			d.push(vm.binary(op, left, right, offset))
+		
+		case bytecode.OpJump:
+			d.ip = vm.operand32(d)
+			if d.ip < offset {
+				// Only a sway jumps back, as it completes an iteration
+				vm.iterate(offset)
+			}
+		case bytecode.OpJumpIfFalse:
+			target := vm.operand32(d)
+			v := vm.pop(d, offset)
+			cond, ok := v.(bool)
+			if !ok {
+				vm.fail(offset, "condition must be bool, got %s", ops.TypeName(v))
+			}
+			if !cond {
+				d.ip = target
+			}
+		
+		case bytecode.OpPrint:
+			count := vm.operand16(d)
+			if count > len(d.stack) {
+				vm.fail(offset, "stack underflow")
+			}
+			line := fmt.Sprintln(d.stack[len(d.stack)-count:]...)
+			if max := vm.Limits.Output; max > 0 && vm.printed+int64(len(line)) > max {
+				vm.exceeded(offset, "output", max)
+			}
+			vm.printed += int64(len(line))
+			io.WriteString(vm.out, line)
+			d.stack = d.stack[:len(d.stack)-count]
+			d.push(nil)
+		case bytecode.OpChannel:
+			elem := vm.chunk.Constants[vm.operand16(d)].(string)
+			d.push(&Channel{elem: elem})
+		case bytecode.OpSend:
+			vm.checkTime(offset)
+			value := vm.pop(d, offset)
+			ch := vm.channel(vm.pop(d, offset), offset)
+			if !interp.Accepts(ch.elem, value) {
+				vm.fail(offset, "cannot send %s to %s", ops.TypeName(value), ch)
+			}
+			if !vm.send(d, ch, value, offset) {
+				return false
+			}
+			if vm.turns != nil {
+				return vm.yield(d)
+			}
+		case bytecode.OpReceive:
+			vm.checkTime(offset)
+			ch := vm.channel(vm.pop(d, offset), offset)
+			if !vm.receive(d, ch, offset) {
+				return false
+			}
+			if vm.turns != nil {
+				return vm.yield(d)
+			}
+		case bytecode.OpStart:
+			end := vm.operand32(d)
+			if max := vm.Limits.Dancers; max > 0 && vm.live >= max {
+				vm.exceeded(offset, "dancers", int64(max))
+			}
+			vm.live++
+			child := &dancer{ip: d.ip, slots: make([]interface{}, len(d.slots)), id: vm.dancers, startedAt: offset}
+			vm.dancers++
+			copy(child.slots, d.slots)
+			vm.ready = append(vm.ready, child)
+			d.ip = end
+			if vm.turns != nil {
+				return vm.yield(d)
+			}
+		case bytecode.OpEnd:
+			vm.live--
+			return true
+		case bytecode.OpArgs:
+			if vm.operand16(d) == 0 {
+				d.push(interp.ArgCount(vm.Args))
+				break
+			}
+			arg, err := interp.Arg(vm.Args, vm.pop(d, offset))
+			if err != nil {
+				vm.fail(offset, "%s", err)
+			}
+			d.push(arg)
+		case bytecode.OpExit:
+			code, err := interp.ExitCode(vm.pop(d, offset))
+			if err != nil {
+				vm.fail(offset, "%s", err)
+			}
+			panic(&interp.ExitError{Code: code})
+		case bytecode.OpFS:
+			m, err := interp.OpenFS(vm.FS)
+			if err != nil {
+				vm.fail(offset, "%s", err)
+			}
+			vm.modules = append(vm.modules, m)
+			d.push(m)
+		case bytecode.OpMember:
+			name := vm.chunk.Constants[vm.operand16(d)].(string)
+			count := vm.operand16(d)
+			if count >= len(d.stack) {
+				vm.fail(offset, "stack underflow")
+			}
+			args := append([]interface{}(nil), d.stack[len(d.stack)-count:]...)
+			receiver := d.stack[len(d.stack)-count-1]
+			d.stack = d.stack[:len(d.stack)-count-1]
+			value, err := interp.Member(receiver, name, args)
+			if err != nil {
+				vm.fail(offset, "%s", err)
+			}
+			if w, ok := value.(*interp.Watch); ok {
+				// The dancer waits for the change aside, as the others run
+				vm.checkTime(offset)
+				d.watch, d.blockedAt = w, offset
+				vm.watching = append(vm.watching, d)
+				return false
+			}
+			d.push(value)
+		default:
+			vm.fail(offset, "unknown opcode %d", op)
+		}
+	}
+	
+	vm.ready = append(vm.ready, d)
+	return false
+}
+
+// yield puts d back on the ready queue for the scheduler to draw again.
+func (vm *VM) yield(d *dancer) bool {
+	vm.ready = append(vm.ready, d)
+	return false
+}
+
+// send offers value on ch. It hands the value straight to a waiting
+// receiver, or parks d until one arrives, and reports whether d may go on.
+func (vm *VM) send(d *dancer, ch *Channel, value interface{}, offset int) bool {
+	if len(ch.receivers) > 0 {
+		r := ch.receivers[0]
+		ch.receivers = ch.receivers[1:]
+		delete(vm.waiting, r)
+		r.push(value)
+		vm.ready = append(vm.ready, r)
+		return true
+	}
+	
+	size := interp.Size(value)
+	if max := vm.Limits.Memory; max > 0 && vm.held+size > max {
+		vm.exceeded(offset, "memory", max)
+	}
+	vm.held += size
+	d.sending = value
+	d.sends = true
+	d.blockedAt = offset
+	ch.senders = append(ch.senders, d)
+	vm.waiting[d] = true
+	return false
+}
+
+// receive takes a value from a waiting sender, or parks d until one
+// arrives, and reports whether d may go on.
+func (vm *VM) receive(d *dancer, ch *Channel, offset int) bool {
+	if len(ch.senders) > 0 {
+		s := ch.senders[0]
+		ch.senders = ch.senders[1:]
+		delete(vm.waiting, s)
+		d.push(s.sending)
+		vm.held -= interp.Size(s.sending)
+		s.sending = nil
+		s.sends = false
+		vm.ready = append(vm.ready, s)
+		return true
+	}
+	
+	d.blockedAt = offset
+	ch.receivers = append(ch.receivers, d)
+	vm.waiting[d] = true
+	return false
+}
+
+func (vm *VM) channel(v interface{}, offset int) *Channel {
+	ch, ok := v.(*Channel)
+	if !ok {
+		vm.fail(offset, "%s is not a channel", ops.TypeName(v))
+	}
+	return ch
+}
+
+func (vm *VM) operand16(d *dancer) int {
+	v := int(bytecode.ReadUint16(vm.chunk.Code[d.ip:]))
+	d.ip += 2
+	return v
+}
+
+func (vm *VM) operand32(d *dancer) int {
+	v := int(bytecode.ReadUint32(vm.chunk.Code[d.ip:]))
+	d.ip += 4
+	return v
+}
+
+func (vm *VM) pop(d *dancer, offset int) interface{} {
+	if len(d.stack) == 0 {
+		vm.fail(offset, "stack underflow")
+	}
+	v := d.stack[len(d.stack)-1]
+	d.stack = d.stack[:len(d.stack)-1]
+	return v
+}
+
+func (d *dancer) push(v interface{}) {
+	d.stack = append(d.stack, v)
+}
+
+// binary applies an arithmetic or comparison opcode. Two ints or two
+// floats are worked out here, as the loops that make up most of a
+// program's time need; anything else, and any error, goes through
+// ops.Binary, so every backend agrees on the result and its message.
+func (vm *VM) binary(op bytecode.Opcode, left, right interface{}, offset int) interface{} {
+	switch l := left.(type) {
+	case int64:
+		if r, ok := right.(int64); ok {
+			switch op {
+			case bytecode.OpAdd:
+				return l + r
+			case bytecode.OpSub:
+				return l - r
+			case bytecode.OpMul:
+				return l * r
+			case bytecode.OpDiv:
+				if r > 0 {
+					return l / r
+				}
+			case bytecode.OpEqual:
+				return l == r
+			case bytecode.OpNotEqual:
+				return l != r
+			case bytecode.OpLess:
+				return l < r
+			case bytecode.OpGreater:
+				return l > r
+			case bytecode.OpLessEqual:
+				return l <= r
+			case bytecode.OpGreaterEqual:
+				return l >= r
+			}
+		}
+	case float64:
+		if r, ok := right.(float64); ok {
+			switch op {
+			case bytecode.OpAdd:
+				return l + r
+			case bytecode.OpSub:
+				return l - r
+			case bytecode.OpMul:
+				return l * r
+			case bytecode.OpDiv:
+				return l / r
+			case bytecode.OpEqual:
+				return l == r
+			case bytecode.OpNotEqual:
+				return l != r
+			case bytecode.OpLess:
+				return l < r
+			case bytecode.OpGreater:
+				return l > r
+			case bytecode.OpLessEqual:
+				return l <= r
+			case bytecode.OpGreaterEqual:
+				return l >= r
+			}
+		}
+	}
+	
+	operator, _ := bytecode.Operator(op)
+	result, err := ops.Binary(operator, left, right)
+	if err != nil {
+		vm.fail(offset, "%s", err)
+	}
+	return result
+}
+
+// iterate counts a completed iteration of the sway compiled at offset.
+func (vm *VM) iterate(offset int) {
+	if max := vm.Limits.Iterations; max > 0 {
+		if vm.iterations++; vm.iterations > max {
+			vm.exceeded(offset, "iterations", max)
+		}
+	}
+	vm.checkTime(offset)
+}
+
+// checkTime stops the program at offset if it has run out of time.
+func (vm *VM) checkTime(offset int) {
+	if atomic.LoadInt32(&vm.expired) != 0 {
+		vm.exceeded(offset, "time", int64(vm.Limits.Time))
+	}
+}
+
+// exceeded stops the program with an *interp.LimitError at offset.
+func (vm *VM) exceeded(offset int, limit string, max int64) {
+	line, column := vm.chunk.PositionOf(offset)
+	panic(&interp.LimitError{Line: line, Column: column, Limit: limit, Max: max})
+}
+
+func (vm *VM) fail(offset int, format string, args ...interface{}) {
+	line, column := vm.chunk.PositionOf(offset)
+	panic(&RuntimeError{Line: line, Column: column, Message: fmt.Sprintf(format, args...)})
+}
\ No newline at end of file
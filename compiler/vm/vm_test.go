@@ -0,0 +1,509 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	
+	"github.com/chorlang/chorlang/compiler/ast"
+	"github.com/chorlang/chorlang/compiler/bytecode"
+	"github.com/chorlang/chorlang/compiler/fs"
+	"github.com/chorlang/chorlang/compiler/interp"
+	"github.com/chorlang/chorlang/compiler/lexer"
+	"github.com/chorlang/chorlang/compiler/parser"
+)
+
+func TestRunPrograms(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"print", `spin print("Hello", 42, 2.5, true)`, "Hello 42 2.5 true\n"},
+		{"arithmetic", `
+dance a = 7
+dance b = 2
+spin print(a + b, a - b, a * b, a / b)
+spin print(7.0 / 2, 1 + 0.5)
+`, "9 5 14 3\n3.5 1.5\n"},
+		{"division edges", `
+dance min = 0 - 9223372036854775807 - 1
+dance d = 0 - 1
+spin print(7 / d, min / d, (0 - 7) / 2)
+spin print(1.0 / 0.0 > 1.0, 2 < 2.5, "a" < "b")
+`, "-7 -9223372036854775808 -3\ntrue true true\n"},
+		{"shadowing", `
+dance x = 1
+if true {
+    dance x = 2
+    spin print(x)
+}
+spin print(x)
+`, "2\n1\n"},
+		{"sway bound is re-evaluated", `
+dance n = 3
+sway i from 1 to n {
+    if i == 1 {
+        n = 5
+    }
+    spin print(i)
+}
+`, "1\n2\n3\n4\n5\n"},
+		{"match", `
+dance item = "Rest"
+dance result = match item {
+    when "Note": flow "note"
+    when "Rest": flow "rest"
+}
+dance missing = match item {
+    when "Other": flow 1
+}
+spin print(result, missing)
+`, "rest <nil>\n"},
+		{"channels", `
+flow ch = flow channel<int>
+start sway i from 1 to 3 {
+    send ch <- i * 10
+}
+sway i from 1 to 3 {
+    spin print(<-ch)
+}
+`, "10\n20\n30\n"},
+		{"dancers snapshot bindings", `
+flow results = flow channel<int>
+dance base = 100
+sway w from 1 to 3 {
+    start send results <- base + w
+}
+base = 0
+dance total = 0
+sway i from 1 to 3 {
+    total = total + <-results
+}
+spin print(total)
+`, "306\n"},
+		{"dancers are preempted", `
+flow ch = flow channel<int>
+start {
+    dance spins = 0
+    sway i from 1 to 100000 {
+        spins = spins + 1
+    }
+    send ch <- spins
+}
+start sway i from 1 to 100000000 {
+    dance busy = i
+}
+spin print(<-ch)
+`, "100000\n"},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := run(t, tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out != tt.expected {
+				t.Errorf("output wrong.\nGot:\n%q\nExpected:\n%q", out, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMainExitStopsDancers(t *testing.T) {
+	input := `
+flow never = flow channel<int>
+start spin print("blocked", <-never)
+start sway i from 1 to 1000000000 {
+    dance x = i
+}
+spin print("done")
+`
+	out, err := run(t, input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out != "done\n" {
+		t.Errorf("output wrong. got=%q", out)
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"dance x = 1 / 0", "1:13: integer divide by zero"},
+		{"dance z = 0\ndance x = 1 / z", "2:13: integer divide by zero"},
+		{"dance x = true < false", "1:16: invalid operation: bool < bool"},
+		{`dance x = 1 + "a"`, `1:13: invalid operation: int + string`},
+		{"if 1 {\n}", "1:1: condition must be bool, got int"},
+		{"flow ch = flow channel<int>\nstart send ch <- \"s\"\ndance v = <-ch", `2:7: cannot send string to channel<int>`},
+		{"dance s = \"x\"\ndance b = s =~ \"(\"", "2:13: invalid pattern"},
+		{"spin print(spin args(1))", "1:17: args index 1 out of range [0:0]"},
+		{"spin exit(1.5)", "1:6: exit code must be int, got float"},
+		{"flow files = chore.fs()", "1:20: chore.fs: no file system is open to this program"},
+		{"dance n = 1\nspin print(n.read(\"a\"))", "2:14: int has no member read"},
+		{"flow ch = flow channel<int>\ndance v = <-ch", "2:11: all dancers are asleep - deadlock!"},
+		{"dance n = 1\nstart dance m = n / 0\nsway i from 1 to 3 { }\nflow ch = flow channel<int>\ndance v = <-ch",
+			"2:19: integer divide by zero"},
+	}
+	
+	for _, tt := range tests {
+		_, err := run(t, tt.input)
+		if err == nil {
+			t.Errorf("input %q: expected error %q, got none", tt.input, tt.expected)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("input %q: expected error starting with %q, got %q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+// TestExamplesMatchInterpreter runs every example on the VM and on the
+// tree-walking interpreter and requires identical output.
+func TestExamplesMatchInterpreter(t *testing.T) {
+	files, err := filepath.Glob("../../examples/*.chore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no examples found")
+	}
+	
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".chore")
+		
+		t.Run(name, func(t *testing.T) {
+			source, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			
+			var interpreted bytes.Buffer
+			if err := interp.New(&interpreted).Run(parse(t, string(source))); err != nil {
+				t.Fatalf("interpreter error: %v", err)
+			}
+			
+			out, err := run(t, string(source))
+			if err != nil {
+				t.Fatalf("VM error: %v", err)
+			}
+			
+			if out != interpreted.String() {
+				t.Errorf("VM and interpreter disagree.\nVM:\n%s\nInterpreter:\n%s", out, interpreted.String())
+			}
+		})
+	}
+}
+
+// TestScheduleMatchesInterpreter requires the VM to draw the same turns
+// as the interpreter for every seed, so a seed replays on either backend.
+func TestScheduleMatchesInterpreter(t *testing.T) {
+	inputs := []string{`
+flow done = flow channel<int>
+sway w from 1 to 3 {
+    start {
+        spin print("worker", w, "starts")
+        send done <- w
+    }
+}
+sway i from 1 to 3 {
+    spin print("got", <-done)
+}
+`, `
+flow ping = flow channel<string>
+flow pong = flow channel<string>
+start sway i from 1 to 3 {
+    spin print("ping", i)
+    send ping <- "ping"
+    dance reply = <-pong
+}
+start sway i from 1 to 3 {
+    dance msg = <-ping
+    spin print("pong", i)
+    send pong <- "pong"
+}
+start spin print("bystander")
+flow never = flow channel<int>
+dance v = <-never
+`, `
+flow ch = flow channel<int>
+start send ch <- 1
+start send ch <- 2
+dance first = <-ch
+`}
+	
+	for i, input := range inputs {
+		program := parse(t, input)
+		chunk, err := bytecode.Compile(program)
+		if err != nil {
+			t.Fatalf("compile error: %v", err)
+		}
+		for seed := int64(0); seed < 20; seed++ {
+			var interpreted bytes.Buffer
+			in := interp.New(&interpreted)
+			in.Schedule = &interp.Schedule{Seed: seed}
+			interpErr := in.Run(program)
+			
+			var out bytes.Buffer
+			machine := New(chunk, &out)
+			machine.Schedule = &interp.Schedule{Seed: seed}
+			vmErr := machine.Run()
+			
+			if out.String() != interpreted.String() || fmt.Sprint(vmErr) != fmt.Sprint(interpErr) {
+				t.Errorf("input %d, seed %d: VM and interpreter disagree.\nVM (%v):\n%s\nInterpreter (%v):\n%s",
+					i, seed, vmErr, out.String(), interpErr, interpreted.String())
+			}
+			vmBlocked := fmt.Sprint(blocked(vmErr), machine.Leaked())
+			if interpBlocked := fmt.Sprint(blocked(interpErr), in.Leaked()); vmBlocked != interpBlocked {
+				t.Errorf("input %d, seed %d: VM and interpreter block differently.\nVM: %s\nInterpreter: %s",
+					i, seed, vmBlocked, interpBlocked)
+			}
+		}
+	}
+}
+
+// blocked returns the dancers of a deadlock.
+func blocked(err error) []interp.Blocked {
+	var deadlock *interp.DeadlockError
+	if errors.As(err, &deadlock) {
+		return deadlock.Blocked
+	}
+	return nil
+}
+
+func TestDeadlock(t *testing.T) {
+	input := `flow a = flow channel<int>
+flow b = flow channel<int>
+start {
+    dance x = <-a
+    send b <- x
+}
+dance y = <-b
+send a <- y
+`
+	_, err := run(t, input)
+	expected := []interp.Blocked{
+		{Dancer: 0, Line: 7, Column: 11},
+		{Dancer: 1, StartLine: 3, StartColumn: 1, Line: 4, Column: 15},
+	}
+	if fmt.Sprint(blocked(err)) != fmt.Sprint(expected) {
+		t.Errorf("expected both dancers blocked, got %v: %+v", err, blocked(err))
+	}
+	
+	// Main finishes with the second sender still waiting
+	chunk, err := bytecode.Compile(parse(t, "flow ch = flow channel<int>\nstart send ch <- 1\nstart send ch <- 2\ndance first = <-ch"))
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	machine := New(chunk, &bytes.Buffer{})
+	if err := machine.Run(); err != nil {
+		t.Fatal(err)
+	}
+	leaked := []interp.Blocked{{Dancer: 2, StartLine: 3, StartColumn: 1, Send: true, Line: 3, Column: 7}}
+	if fmt.Sprint(machine.Leaked()) != fmt.Sprint(leaked) {
+		t.Errorf("expected dancer 2 to leak, got %+v", machine.Leaked())
+	}
+}
+
+func TestLimitsMatchInterpreter(t *testing.T) {
+	tests := []struct {
+		input  string
+		limits interp.Limits
+	}{
+		{"sway i from 1 to 10 {\n    spin print(i)\n}", interp.Limits{Iterations: 3}},
+		{"flow never = flow channel<int>\nsway i from 1 to 5 {\n    start dance v = <-never\n}", interp.Limits{Dancers: 3}},
+		{"flow never = flow channel<int>\nflow ch = flow channel<string>\nsway i from 1 to 3 {\n    start send ch <- \"hello\"\n}\ndance v = <-never", interp.Limits{Memory: 10}},
+		{"spin print(\"hello\")\nspin print(\"hello\")\nspin print(\"hello\")", interp.Limits{Output: 12}},
+		{"sway i from 1 to 1000000000 {\n}", interp.Limits{Time: 10 * time.Millisecond}},
+		// Within its limits
+		{"flow ch = flow channel<int>\nstart send ch <- 1\nsway i from 1 to 3 {\n}\nspin print(<-ch)", interp.Limits{Iterations: 3, Dancers: 2, Memory: 8, Output: 2}},
+	}
+	for i, tt := range tests {
+		program := parse(t, tt.input)
+		chunk, err := bytecode.Compile(program)
+		if err != nil {
+			t.Fatalf("compile error: %v", err)
+		}
+		var vmOut, interpOut bytes.Buffer
+		machine := New(chunk, &vmOut)
+		machine.Limits = tt.limits
+		vmErr := machine.Run()
+		in := interp.New(&interpOut)
+		in.Limits = tt.limits
+		interpErr := in.Run(program)
+		
+		if fmt.Sprint(vmErr) != fmt.Sprint(interpErr) || vmOut.String() != interpOut.String() {
+			t.Errorf("%+v: vm gave %q, %v; interpreter gave %q, %v",
+				tt.limits, vmOut.String(), vmErr, interpOut.String(), interpErr)
+		}
+		var limit *interp.LimitError
+		if i < len(tests)-1 && !errors.As(vmErr, &limit) {
+			t.Errorf("%+v: expected a *interp.LimitError, got %v", tt.limits, vmErr)
+		}
+	}
+}
+
+func TestArgsAndExit(t *testing.T) {
+	input := `
+spin print(spin args())
+sway i from 0 to spin args() {
+    spin print(spin args(i))
+}
+start spin exit(7)
+flow never = flow channel<int>
+dance v = <-never
+spin print("unreachable")
+`
+	var out bytes.Buffer
+	chunk, err := bytecode.Compile(parse(t, input))
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	machine := New(chunk, &out)
+	machine.Args = []string{"tool.chore", "a", "b c"}
+	err = machine.Run()
+	
+	var exit *interp.ExitError
+	if !errors.As(err, &exit) || exit.Code != 7 {
+		t.Fatalf("expected exit status 7, got %v", err)
+	}
+	if out.String() != "2\ntool.chore\na\nb c\n" {
+		t.Errorf("output wrong. got=%q", out.String())
+	}
+}
+
+func TestFileSystem(t *testing.T) {
+	input := `
+flow files = chore.fs()
+files.write("drafts/poem.txt", files.read("notes.txt") + " turn")
+spin print(files.read("/drafts/poem.txt"), files.stat("drafts/poem.txt"), files.stat("drafts"))
+spin print(files.exists("drafts"), files.exists("missing.txt"))
+spin print(files.glob("**/*.txt"))
+spin print(files.list("/"))
+files.remove("drafts")
+spin print(files.glob("**/*.txt"))
+dance tmp = files.tempdir()
+spin print(files.exists(tmp), tmp =~ "^tmp/", files)
+files.read("../secret")
+`
+	sandbox, err := fs.Memory(map[string]string{"notes.txt": "step"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	machine := New(compile(t, input), &out)
+	machine.FS = sandbox
+	err = machine.Run()
+	
+	want := `12:7: read "../secret": denied by the jail rule`
+	if err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("expected error starting with %q, got %v", want, err)
+	}
+	expected := "step turn file 9 dir\ntrue false\ndrafts/poem.txt\nnotes.txt\ndrafts/\nnotes.txt\nnotes.txt\ntrue true fs\n"
+	if out.String() != expected {
+		t.Errorf("output wrong. got=%q", out.String())
+	}
+	
+	for input, want := range map[string]string{
+		"flow files = chore.fs()\nfiles.read(1)":         "2:7: fs.read path must be string, got int",
+		"flow files = chore.fs()\nfiles.write(\"a\")":    "2:7: fs.write takes 2 arguments, got 1",
+		"flow files = chore.fs()\nfiles.watch(\"*\", 0)": `2:7: watch "*": interval 0s is not positive`,
+		"flow files = chore.fs()\nfiles.copy(\"a\")":     "2:7: fs has no member copy",
+	} {
+		machine := New(compile(t, input), &out)
+		machine.FS = sandbox
+		if err := machine.Run(); err == nil || err.Error() != want {
+			t.Errorf("%q: expected error %q, got %v", input, want, err)
+		}
+	}
+}
+
+func TestFileSystemWatch(t *testing.T) {
+	input := `
+flow files = chore.fs()
+flow changes = flow channel<string>
+start send changes <- files.watch("*.txt", 5)
+start spin print("danced on")
+spin print(<-changes)
+`
+	sandbox, err := fs.Memory(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	machine := New(compile(t, input), &out)
+	machine.FS = sandbox
+	
+	// The first change may come before the watch starts, so keep changing
+	// the file until the program ends. The other dancers run meanwhile.
+	done := make(chan error)
+	go func() { done <- machine.Run() }()
+	for i := 1; ; i++ {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); !regexp.MustCompile(`^danced on\n(created|modified) poem\.txt\n$`).MatchString(got) {
+				t.Errorf("output wrong. got=%q", got)
+			}
+			return
+		case <-time.After(time.Millisecond):
+			if err := sandbox.Write("poem.txt", []byte(strings.Repeat("step", i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestFileSystemWatchTimeLimit(t *testing.T) {
+	sandbox, err := fs.Memory(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine := New(compile(t, "flow files = chore.fs()\ndance change = files.watch(\"*.txt\", 5)"), &bytes.Buffer{})
+	machine.FS = sandbox
+	machine.Limits.Time = 20 * time.Millisecond
+	err = machine.Run()
+	
+	var limit *interp.LimitError
+	if !errors.As(err, &limit) || limit.Limit != "time" || limit.Line != 2 || limit.Column != 22 {
+		t.Errorf("expected the time limit at 2:22, got %v", err)
+	}
+}
+
+func run(t *testing.T, input string) (string, error) {
+	var out bytes.Buffer
+	err := New(compile(t, input), &out).Run()
+	return out.String(), err
+}
+
+func compile(t *testing.T, input string) *bytecode.Chunk {
+	chunk, err := bytecode.Compile(parse(t, input))
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	return chunk
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parser errors: %v", p.Errors())
+	}
+	
+	return program
+}
\ No newline at end of file